@@ -0,0 +1,350 @@
+package syncstation
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+func computersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "computers",
+		Short: "Manage the computers sharing this cloud directory",
+		Long: `Show and manage the computers sharing this cloud directory. Each computer records
+its OS, architecture and last sync time, and can carry tags and variables that
+are available to every template. Computers can subscribe to item tags to sync
+only the relevant items.`,
+	}
+
+	cmd.AddCommand(computersListCmd())
+	cmd.AddCommand(computersShowCmd())
+	cmd.AddCommand(computersSetCmd())
+	cmd.AddCommand(computersRenameCmd())
+	cmd.AddCommand(computersForgetCmd())
+	return cmd
+}
+
+func computersListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List known computers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, syncItems, err := loadComputers()
+			if err != nil {
+				return err
+			}
+
+			computerIDs := syncItems.ComputerIDs()
+			if len(computerIDs) == 0 {
+				fmt.Println("📭 No computers recorded")
+				return nil
+			}
+
+			fmt.Printf("💻 Computers (%d total)\n\n", len(computerIDs))
+			for _, computerID := range computerIDs {
+				marker := "  "
+				if computerID == localConfig.CurrentComputer {
+					marker = "▶ "
+				}
+
+				details := []string{fmt.Sprintf("%d items", syncItems.CountComputerItems(computerID))}
+				if info := syncItems.GetComputer(computerID); info != nil {
+					if info.OS != "" {
+						details = append(details, info.OS+"/"+info.Arch)
+					}
+					if len(info.Tags) > 0 {
+						details = append(details, "tags: "+strings.Join(info.Tags, ", "))
+					}
+					if len(info.Subscriptions) > 0 {
+						details = append(details, "subscribes to: "+strings.Join(info.Subscriptions, ", "))
+					}
+					details = append(details, "last seen "+formatLastSeen(info.LastSeen))
+				} else {
+					details = append(details, "never seen")
+				}
+
+				fmt.Printf("%s%s (%s)\n", marker, computerID, strings.Join(details, ", "))
+			}
+
+			return nil
+		},
+	}
+}
+
+func computersShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [computer-id]",
+		Short: "Show the details of a computer",
+		Long:  `Show the metadata, variables and item paths of a computer (this computer by default).`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, syncItems, err := loadComputers()
+			if err != nil {
+				return err
+			}
+
+			computerID := localConfig.CurrentComputer
+			if len(args) > 0 {
+				computerID = args[0]
+			}
+			if !syncItems.HasComputer(computerID) {
+				return fmt.Errorf("computer not found: %s", computerID)
+			}
+
+			fmt.Printf("💻 %s", computerID)
+			if computerID == localConfig.CurrentComputer {
+				fmt.Printf(" (this computer)")
+			}
+			fmt.Println()
+
+			if info := syncItems.GetComputer(computerID); info != nil {
+				if info.Hostname != "" {
+					fmt.Printf("   Hostname:  %s\n", info.Hostname)
+				}
+				if info.OS != "" {
+					fmt.Printf("   Platform:  %s/%s\n", info.OS, info.Arch)
+				}
+				fmt.Printf("   Last seen: %s\n", formatLastSeen(info.LastSeen))
+				if len(info.Tags) > 0 {
+					fmt.Printf("   Tags:      %s\n", strings.Join(info.Tags, ", "))
+				}
+				if len(info.Subscriptions) > 0 {
+					fmt.Printf("   Syncs:     untagged items and items tagged %s\n", strings.Join(info.Subscriptions, ", "))
+				}
+				if len(info.Vars) > 0 {
+					fmt.Printf("\n🧩 Variables\n")
+					for _, name := range sortedKeys(info.Vars) {
+						fmt.Printf("   %s = %s\n", name, info.Vars[name])
+					}
+				}
+			}
+
+			fmt.Printf("\n📦 Items\n")
+			found := false
+			for _, item := range syncItems.SyncItems {
+				if path, exists := item.Paths[computerID]; exists {
+					fmt.Printf("   %s: %s\n", item.Name, path)
+					found = true
+				}
+			}
+			if !found {
+				fmt.Printf("   (none)\n")
+			}
+
+			return nil
+		},
+	}
+}
+
+func computersSetCmd() *cobra.Command {
+	var tags []string
+	var untags []string
+	var vars []string
+	var unset []string
+	var subscribe []string
+	var unsubscribe []string
+
+	cmd := &cobra.Command{
+		Use:   "set [computer-id]",
+		Short: "Set the tags, subscriptions and variables of a computer",
+		Long: `Set the tags, subscriptions and variables of a computer (this computer by default).
+Variables are available to every template as {{ .Vars.<name> }}.
+A computer subscribed to item tags only syncs untagged items and items with one
+of those tags, unless other items are selected by name, glob or --tag.
+
+Example:
+  syncstation computers set --tag work --var email=me@work.com
+  syncstation computers set --subscribe shell,editor`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			assignments, err := parseTemplateVars(vars)
+			if err != nil {
+				return err
+			}
+
+			computerID := localConfig.CurrentComputer
+			if len(args) > 0 {
+				computerID = args[0]
+			}
+
+			err = config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+				if computerID != localConfig.CurrentComputer && !syncItems.HasComputer(computerID) {
+					return fmt.Errorf("computer not found: %s", computerID)
+				}
+
+				info := syncItems.EnsureComputer(computerID)
+				for _, tag := range tags {
+					if !info.HasTag(tag) {
+						info.Tags = append(info.Tags, tag)
+					}
+				}
+				for _, tag := range untags {
+					info.Tags = removeString(info.Tags, tag)
+				}
+				for name, value := range assignments {
+					info.Vars[name] = value
+				}
+				for _, name := range unset {
+					delete(info.Vars, name)
+				}
+				info.Subscriptions = addTags(info.Subscriptions, subscribe)
+				for _, tag := range unsubscribe {
+					info.Subscriptions = removeString(info.Subscriptions, tag)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ Updated computer %s\n", computerID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&tags, "tag", []string{}, "Add tags")
+	cmd.Flags().StringSliceVar(&untags, "untag", []string{}, "Remove tags")
+	cmd.Flags().StringSliceVar(&vars, "var", []string{}, "Set variables (name=value)")
+	cmd.Flags().StringSliceVar(&unset, "unset", []string{}, "Remove variables")
+	cmd.Flags().StringSliceVar(&subscribe, "subscribe", []string{}, "Sync only items with these tags (and untagged items)")
+	cmd.Flags().StringSliceVar(&unsubscribe, "unsubscribe", []string{}, "Remove tag subscriptions")
+	return cmd
+}
+
+func computersRenameCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rename <old-id> <new-id>",
+		Short: "Rename a computer",
+		Long: `Rename a computer in every item path, template variable and file metadata entry.
+Renaming this computer also updates the local configuration.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldID, newID := args[0], strings.TrimSpace(args[1])
+			if newID == "" {
+				return fmt.Errorf("computer ID cannot be empty")
+			}
+
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := config.RenameCloudComputer(localConfig, oldID, newID); err != nil {
+				return err
+			}
+
+			// Keep this computer pointing at its new ID
+			configPath := filepath.Join(getConfigDir(), "config.json")
+			storedConfig, err := config.LoadLocalConfig(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			if storedConfig.CurrentComputer == oldID {
+				storedConfig.CurrentComputer = newID
+				if err := storedConfig.SaveLocalConfig(configPath); err != nil {
+					return fmt.Errorf("failed to save local config: %w", err)
+				}
+				fmt.Printf("📁 This computer is now %s\n", newID)
+			}
+
+			fmt.Printf("✅ Renamed computer %s to %s\n", oldID, newID)
+			if oldID != localConfig.CurrentComputer {
+				fmt.Printf("💡 Set \"currentComputer\": \"%s\" in the config.json of that computer\n", newID)
+			}
+			return nil
+		},
+	}
+}
+
+func computersForgetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "forget <computer-id>",
+		Short: "Remove a computer that no longer syncs",
+		Long: `Remove a departed computer from every item path, template variable and file
+metadata entry. Cloud copies and other computers are not affected.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			computerID := args[0]
+
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			itemCount, err := config.ForgetCloudComputer(localConfig, computerID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ Forgot computer %s (removed from %d items)\n", computerID, itemCount)
+			return nil
+		},
+	}
+}
+
+// loadComputers loads the config and the sync items holding the computer metadata
+func loadComputers() (*config.LocalConfig, *config.SyncItemsData, error) {
+	localConfig, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	syncItems, err := config.LoadSyncItemsData(localConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sync items: %w", err)
+	}
+
+	return localConfig, syncItems, nil
+}
+
+// formatLastSeen formats an RFC3339 timestamp relative to now
+func formatLastSeen(lastSeen string) string {
+	seen, err := time.Parse(time.RFC3339, lastSeen)
+	if err != nil {
+		return "never"
+	}
+
+	elapsed := time.Since(seen)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%d minutes ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%d hours ago", int(elapsed.Hours()))
+	default:
+		return fmt.Sprintf("%d days ago", int(elapsed.Hours()/24))
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// removeString returns values without value
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, existing := range values {
+		if existing != value {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
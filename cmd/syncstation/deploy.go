@@ -0,0 +1,98 @@
+package syncstation
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/encryption"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+func deployCmd() *cobra.Command {
+	var mode string
+
+	cmd := &cobra.Command{
+		Use:   "deploy <item-name...>",
+		Short: "Show or change how items are deployed",
+		Long: `Show or change how items are deployed on each computer.
+
+In copy mode (the default) the local path holds a copy of the cloud files.
+In link mode the local path is replaced by a symlink to the cloud copy, GNU stow
+style, so edits land in the cloud directory directly. Existing local files are
+moved aside to <path>.syncstation-backup-<time> when the link is created.
+Changes apply on each computer at its next sync.
+
+Example:
+  syncstation deploy "Neovim Config" --mode link
+  syncstation sync "Neovim Config"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			var items []*config.SyncItem
+			if mode != "" {
+				if mode != config.DeployCopy && mode != config.DeployLink {
+					return fmt.Errorf("invalid deploy mode %q: use copy or link", mode)
+				}
+
+				codec := encryption.NewCodec(localConfig)
+				err = config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+					var err error
+					if items, err = syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer); err != nil {
+						return err
+					}
+					if mode == config.DeployLink {
+						for _, item := range items {
+							if item.Template || codec.ShouldEncrypt(item) {
+								return fmt.Errorf("%s can't be deployed as a symlink: templates and encrypted items need a copy", item.Name)
+							}
+						}
+					}
+
+					for _, item := range items {
+						item.Deploy = mode
+						if mode == config.DeployCopy {
+							item.Deploy = "" // copy is the default
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("✅ Updated deploy mode of %d items\n", len(items))
+				fmt.Printf("💡 Run 'syncstation sync' on each computer to apply it\n\n")
+			} else {
+				syncItems, err := config.LoadSyncItemsData(localConfig)
+				if err != nil {
+					return fmt.Errorf("failed to load sync items: %w", err)
+				}
+				if items, err = syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer); err != nil {
+					return err
+				}
+			}
+
+			for _, item := range items {
+				switch {
+				case sync.IsLinked(localConfig, item) && item.Deploy == config.DeployLink:
+					fmt.Printf("🔗 %s: link (linked on this computer)\n", item.Name)
+				case sync.IsLinked(localConfig, item):
+					fmt.Printf("📄 %s: copy (still linked on this computer until the next sync)\n", item.Name)
+				case item.Deploy == config.DeployLink:
+					fmt.Printf("🔗 %s: link (not linked on this computer yet)\n", item.Name)
+				default:
+					fmt.Printf("📄 %s: copy\n", item.Name)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&mode, "mode", "", "Deploy mode: copy or link")
+	return cmd
+}
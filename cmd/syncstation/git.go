@@ -0,0 +1,104 @@
+package syncstation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/gitrepo"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+// loadConfigForSync loads the configuration, waits for the cloud drive client to settle and,
+// in git mode, fetches the git remote and rebases onto it, so that the sync sees what other
+// computers pushed. The repository is nil outside git mode and in dry runs.
+func loadConfigForSync() (*config.LocalConfig, *gitrepo.Repo, error) {
+	localConfig, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := waitForCloudSettle(localConfig); err != nil {
+		return nil, nil, err
+	}
+	if !localConfig.GitMode || dryRun {
+		return localConfig, nil, nil
+	}
+
+	repo, err := gitrepo.Open(localConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch err := repo.Pull(); {
+	case errors.Is(err, gitrepo.ErrUnreachable):
+		fmt.Printf("⚠️  %v\n   Syncing with the local repository, changes will be pushed by a later sync\n\n", err)
+	case errors.Is(err, gitrepo.ErrDetachedHead):
+		fmt.Printf("⚠️  %v\n   Files are synced, but not committed\n\n", err)
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to update git repository: %w", err)
+	}
+	return localConfig, repo, nil
+}
+
+// pullGitRepoForInit fetches and rebases the git repository of a new computer, so that
+// init preserves the sync items other computers pushed
+func pullGitRepoForInit(localConfig *config.LocalConfig) error {
+	repo, err := gitrepo.Open(localConfig)
+	if err != nil {
+		return err
+	}
+	err = repo.Pull()
+	if errors.Is(err, gitrepo.ErrUnreachable) || errors.Is(err, gitrepo.ErrDetachedHead) {
+		fmt.Printf("⚠️  %v\n", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update git repository: %w", err)
+	}
+	return nil
+}
+
+// finishGitSync commits the changes of a sync and pushes them. Failures are added to the
+// result as warnings, since the files themselves are synced. It returns lines describing
+// what was done.
+func finishGitSync(repo *gitrepo.Repo, result *sync.SyncResult) []string {
+	if repo == nil {
+		return nil
+	}
+
+	var lines []string
+	// The file metadata is still pushed on detached HEAD, it doesn't depend on branches
+	commit, err := repo.Commit(changedItems(result.Files))
+	if errors.Is(err, gitrepo.ErrDetachedHead) {
+		result.Errors = append(result.Errors, fmt.Sprintf("git warning: %v", err))
+	} else if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("git warning: failed to commit: %v", err))
+		return nil
+	}
+	if commit != "" {
+		lines = append(lines, fmt.Sprintf("📝 Committed %s", commit))
+	}
+
+	pushed, err := repo.Push()
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("git warning: %v", err))
+		return lines
+	}
+	if pushed != "" {
+		lines = append(lines, fmt.Sprintf("☁️  Pushed to %s", pushed))
+	}
+	return lines
+}
+
+// changedItems returns the names of the items whose cloud copy changed, in sync order
+func changedItems(outcomes []sync.FileOutcome) []string {
+	var items []string
+	seen := make(map[string]bool)
+	for _, outcome := range outcomes {
+		if outcome.Action != "pushed" || seen[outcome.ItemName] {
+			continue
+		}
+		seen[outcome.ItemName] = true
+		items = append(items, outcome.ItemName)
+	}
+	return items
+}
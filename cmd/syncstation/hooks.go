@@ -0,0 +1,232 @@
+package syncstation
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+// hookFlags maps the hook flags to the hook names they set
+var hookFlags = []struct {
+	flag string
+	hook string
+}{
+	{"pre-push", sync.HookPrePush},
+	{"post-push", sync.HookPostPush},
+	{"pre-pull", sync.HookPrePull},
+	{"post-pull", sync.HookPostPull},
+}
+
+func hooksCmd() *cobra.Command {
+	var global bool
+	var timeout int
+
+	cmd := &cobra.Command{
+		Use:   "hooks [item-name...]",
+		Short: "Show or set commands run before and after syncs",
+		Long: `Show or set the hooks of items selected by name or glob, or with --global the hooks
+run for every item on this computer.
+
+Hooks are shell commands run before and after an item is pushed or pulled. Post-hooks
+only run when files changed. They get SYNCSTATION_ITEM, SYNCSTATION_HOOK,
+SYNCSTATION_COMPUTER, SYNCSTATION_LOCAL_PATH, SYNCSTATION_CLOUD_PATH and
+SYNCSTATION_CHANGED_FILES (one path per line) in their environment. A failing
+pre-hook skips the item. Pass an empty command to remove a hook.
+
+Item hooks are shared with every computer, but each computer only runs them
+once approved with 'syncstation trust'. Hooks set here are approved on this
+computer.
+
+Example:
+  syncstation hooks "Tmux Config" --post-pull "tmux source-file ~/.tmux.conf"
+  syncstation hooks --global --pre-push "pass git pull" --timeout 60`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			changed := cmd.Flags().Changed("timeout")
+			for _, hookFlag := range hookFlags {
+				changed = changed || cmd.Flags().Changed(hookFlag.flag)
+			}
+
+			if global || (len(args) == 0 && !changed) {
+				if len(args) > 0 {
+					return fmt.Errorf("--global can't be combined with item names")
+				}
+				if changed {
+					if err := updateGlobalHooks(cmd, timeout); err != nil {
+						return err
+					}
+					if localConfig, err = loadConfig(); err != nil {
+						return err
+					}
+				}
+				return printAllHooks(localConfig)
+			}
+
+			if len(args) == 0 {
+				return fmt.Errorf("specify the items by name or glob, or use --global")
+			}
+			if cmd.Flags().Changed("timeout") {
+				return fmt.Errorf("the hook timeout is set with --global")
+			}
+
+			var items []*config.SyncItem
+			if changed {
+				var commands []string
+				err = config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+					var err error
+					if items, err = syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer); err != nil {
+						return err
+					}
+					commands = nil
+					for _, item := range items {
+						setHooks(cmd, &item.Hooks)
+						commands = append(commands, sync.ItemCommands(item)...)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				// Hooks set here are approved on this computer, other computers approve them with trust
+				if _, err := updateTrustedCommands(commands, true); err != nil {
+					return err
+				}
+				fmt.Printf("✅ Updated hooks of %d items\n", len(items))
+				fmt.Printf("💡 Other computers run them once approved with 'syncstation trust'\n\n")
+			} else {
+				syncItems, err := config.LoadSyncItemsData(localConfig)
+				if err != nil {
+					return fmt.Errorf("failed to load sync items: %w", err)
+				}
+				if items, err = syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer); err != nil {
+					return err
+				}
+			}
+
+			for _, item := range items {
+				printHooks(item.Name, item.Hooks)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&global, "global", false, "Show or set the hooks run for every item on this computer")
+	cmd.Flags().IntVar(&timeout, "timeout", 0, "Seconds before a hook is killed, with --global (0 for the default)")
+	for _, hookFlag := range hookFlags {
+		cmd.Flags().String(hookFlag.flag, "", fmt.Sprintf("Command run as the %s hook", hookFlag.hook))
+	}
+	return cmd
+}
+
+// setHooks applies the hook flags given on the command line to hooks
+func setHooks(cmd *cobra.Command, hooks *config.Hooks) {
+	for _, hookFlag := range hookFlags {
+		if !cmd.Flags().Changed(hookFlag.flag) {
+			continue
+		}
+		command, _ := cmd.Flags().GetString(hookFlag.flag)
+		command = strings.TrimSpace(command)
+
+		switch hookFlag.hook {
+		case sync.HookPrePush:
+			hooks.PrePush = command
+		case sync.HookPostPush:
+			hooks.PostPush = command
+		case sync.HookPrePull:
+			hooks.PrePull = command
+		case sync.HookPostPull:
+			hooks.PostPull = command
+		}
+	}
+}
+
+// updateGlobalHooks saves the hook flags and timeout as the hooks of this computer
+func updateGlobalHooks(cmd *cobra.Command, timeout int) error {
+	if timeout < 0 {
+		return fmt.Errorf("invalid timeout %d: use a number of seconds", timeout)
+	}
+
+	// Reload from disk so flag overrides such as --computer are not persisted
+	configPath := filepath.Join(getConfigDir(), "config.json")
+	storedConfig, err := config.LoadLocalConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	setHooks(cmd, &storedConfig.Hooks)
+	if cmd.Flags().Changed("timeout") {
+		storedConfig.HookTimeout = timeout
+	}
+	if err := storedConfig.SaveLocalConfig(configPath); err != nil {
+		return fmt.Errorf("failed to save local config: %w", err)
+	}
+
+	fmt.Printf("✅ Updated global hooks\n\n")
+	return nil
+}
+
+// printAllHooks prints the global hooks and the hooks of every item that has any
+func printAllHooks(localConfig *config.LocalConfig) error {
+	syncItems, err := config.LoadSyncItemsData(localConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load sync items: %w", err)
+	}
+
+	timeout := sync.DefaultHookTimeout.String()
+	if localConfig.HookTimeout > 0 {
+		timeout = fmt.Sprintf("%ds", localConfig.HookTimeout)
+	}
+	fmt.Printf("⏱️  Timeout: %s\n\n", timeout)
+
+	printHooks("Global (every item on this computer)", localConfig.Hooks)
+	for _, item := range syncItems.SyncItems {
+		if !item.Hooks.IsEmpty() {
+			printHooks(item.Name, item.Hooks)
+		}
+	}
+	return nil
+}
+
+// printHooks prints the commands of a set of hooks
+func printHooks(title string, hooks config.Hooks) {
+	fmt.Printf("🪝 %s\n", title)
+	if hooks.IsEmpty() {
+		fmt.Printf("   (none)\n")
+	}
+	for _, hookFlag := range hookFlags {
+		if command := hooks.Command(hookFlag.hook); command != "" {
+			fmt.Printf("   %s: %s\n", hookFlag.hook, command)
+		}
+	}
+}
+
+// printHookRuns prints the hooks run during a sync with their output
+func printHookRuns(runs []sync.HookRun) {
+	fmt.Println("\n🪝 Hooks:")
+	for _, run := range runs {
+		status := "✅"
+		if run.Err != nil {
+			status = "❌"
+		}
+		fmt.Printf("   %s %s %s: %s (%s)\n", status, run.ItemName, run.Hook, run.Command, run.Duration.Round(time.Millisecond))
+		if run.Err != nil {
+			fmt.Printf("      %v\n", run.Err)
+		}
+		for _, line := range strings.Split(run.Output, "\n") {
+			if line != "" {
+				fmt.Printf("      │ %s\n", line)
+			}
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package syncstation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/encryption"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+func keysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage encryption of cloud copies",
+		Long: `Manage the key used to encrypt cloud copies of sync items.
+Encrypted items are stored with XChaCha20-Poly1305 in the cloud folder and
+decrypted when pulled. The key is either a random key file that you copy to
+each computer, or derived from a passphrase.`,
+	}
+
+	cmd.AddCommand(keysInitCmd())
+	cmd.AddCommand(keysRotateCmd())
+	cmd.AddCommand(keysEncryptCmd(true))
+	cmd.AddCommand(keysEncryptCmd(false))
+
+	return cmd
+}
+
+func keysInitCmd() *cobra.Command {
+	var usePassphrase bool
+	var importKeyFile string
+	var encryptAll bool
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Set up encryption or add this computer to it",
+		Long: `Set up encryption for the cloud folder. The first computer creates the key;
+other computers run the same command to install it: pass --key-file with a copy
+of the key file, or enter the passphrase when prompted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			settings, err := config.LoadEncryptionData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load encryption settings: %w", err)
+			}
+
+			keyFile := getKeyFilePath()
+
+			// Encryption already set up by another computer: install its key here
+			if settings.Enabled() {
+				key, err := obtainExistingKey(settings, importKeyFile)
+				if err != nil {
+					return err
+				}
+				if encryption.KeyID(key) != settings.KeyID {
+					return fmt.Errorf("%w: wrong passphrase or key file (cloud key %s)", encryption.ErrWrongKey, settings.KeyID)
+				}
+
+				if err := installKey(localConfig, keyFile, key); err != nil {
+					return err
+				}
+
+				fmt.Printf("✅ Encryption key installed on %s\n", localConfig.CurrentComputer)
+				fmt.Printf("🔑 Key file: %s\n", keyFile)
+				return nil
+			}
+
+			// First computer: create the key
+			var key []byte
+			newSettings := &config.EncryptionData{}
+			if usePassphrase {
+				newSettings, err = encryption.NewPassphraseSettings()
+				if err != nil {
+					return err
+				}
+
+				passphrase, err := readPassphrase("🔑 New passphrase: ", true)
+				if err != nil {
+					return err
+				}
+
+				key, err = encryption.DeriveKey(passphrase, newSettings)
+				if err != nil {
+					return err
+				}
+			} else {
+				key, err = encryption.GenerateKey()
+				if err != nil {
+					return err
+				}
+			}
+
+			newSettings.KeyID = encryption.KeyID(key)
+			newSettings.EncryptAll = encryptAll
+
+			if err := installKey(localConfig, keyFile, key); err != nil {
+				return err
+			}
+
+			if err := newSettings.SaveEncryptionData(localConfig); err != nil {
+				return fmt.Errorf("failed to save encryption settings: %w", err)
+			}
+
+			// Encrypt existing cloud copies of encrypted items
+			if encryptAll {
+				if err := rewriteCloudCopies(localConfig, nil, true); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("✅ Encryption set up (key %s)\n", newSettings.KeyID)
+			fmt.Printf("🔑 Key file: %s\n", keyFile)
+			if usePassphrase {
+				fmt.Printf("\n💡 On other computers run 'syncstation keys init' and enter the same passphrase,\n")
+				fmt.Printf("   or set %s\n", encryption.PassphraseEnv)
+			} else {
+				fmt.Printf("\n⚠️  Keep a backup of the key file: encrypted files can't be recovered without it.\n")
+				fmt.Printf("💡 Copy it to your other computers and run 'syncstation keys init --key-file <path>'\n")
+			}
+			if !encryptAll {
+				fmt.Printf("💡 Encrypt items with 'syncstation keys encrypt <item>' or 'syncstation add --encrypt'\n")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&usePassphrase, "passphrase", false, "Derive the key from a passphrase instead of generating a key file")
+	cmd.Flags().StringVar(&importKeyFile, "key-file", "", "Key file copied from another computer")
+	cmd.Flags().BoolVar(&encryptAll, "all", false, "Encrypt every sync item")
+	return cmd
+}
+
+func keysRotateCmd() *cobra.Command {
+	var usePassphrase bool
+
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Replace the encryption key and re-encrypt cloud copies",
+		Long: `Generate a new key (or derive one from a new passphrase) and re-encrypt every
+encrypted file in the cloud folder. Other computers must run 'syncstation keys init'
+again afterwards.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			settings, err := config.LoadEncryptionData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load encryption settings: %w", err)
+			}
+			if !settings.Enabled() {
+				return fmt.Errorf("encryption is not set up. Run 'syncstation keys init' first")
+			}
+
+			oldCipher, err := encryption.LoadCipher(localConfig, settings)
+			if err != nil {
+				return err
+			}
+
+			// Create the new key
+			var key []byte
+			newSettings := &config.EncryptionData{}
+			if usePassphrase {
+				newSettings, err = encryption.NewPassphraseSettings()
+				if err != nil {
+					return err
+				}
+
+				passphrase, err := readPassphrase("🔑 New passphrase: ", true)
+				if err != nil {
+					return err
+				}
+
+				key, err = encryption.DeriveKey(passphrase, newSettings)
+				if err != nil {
+					return err
+				}
+			} else {
+				key, err = encryption.GenerateKey()
+				if err != nil {
+					return err
+				}
+			}
+			newSettings.KeyID = encryption.KeyID(key)
+			newSettings.EncryptAll = settings.EncryptAll
+
+			newCipher, err := encryption.NewCipher(key)
+			if err != nil {
+				return err
+			}
+
+			// Keep the new key next to the old one until every file is re-encrypted
+			keyFile := getKeyFilePath()
+			pendingKeyFile := keyFile + ".new"
+			if err := encryption.SaveKeyFile(pendingKeyFile, key); err != nil {
+				return fmt.Errorf("failed to save new key: %w", err)
+			}
+
+			count, err := encryption.RewriteFiles(localConfig.CloudStorage(), config.CloudConfigsKey, func(data []byte) ([]byte, error) {
+				if !encryption.IsEncrypted(data) {
+					return data, nil
+				}
+				plaintext, err := oldCipher.Decrypt(data)
+				if err != nil {
+					return nil, err
+				}
+				return newCipher.Encrypt(plaintext)
+			})
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to re-encrypt cloud copies (new key kept in %s): %w", pendingKeyFile, err)
+			}
+
+			if err := os.Rename(pendingKeyFile, keyFile); err != nil {
+				return fmt.Errorf("failed to install new key (kept in %s): %w", pendingKeyFile, err)
+			}
+			if err := recordKeyFile(localConfig, keyFile); err != nil {
+				return err
+			}
+
+			if err := newSettings.SaveEncryptionData(localConfig); err != nil {
+				return fmt.Errorf("failed to save encryption settings: %w", err)
+			}
+
+			fmt.Printf("✅ Rotated key %s -> %s\n", settings.KeyID, newSettings.KeyID)
+			fmt.Printf("🔒 Re-encrypted %d files\n", count)
+			fmt.Printf("💡 Run 'syncstation keys init' on your other computers to install the new key\n")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&usePassphrase, "passphrase", false, "Derive the new key from a passphrase")
+	return cmd
+}
+
+func keysEncryptCmd(encrypt bool) *cobra.Command {
+	var all bool
+
+	use, short := "encrypt [item-name...]", "Encrypt the cloud copies of items"
+	if !encrypt {
+		use, short = "decrypt [item-name...]", "Store the cloud copies of items unencrypted"
+	}
+
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long: short + `.
+Existing cloud copies are rewritten immediately. Use --all to change the
+setting for every item.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && !all {
+				return fmt.Errorf("specify item names or --all")
+			}
+
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			settings, err := config.LoadEncryptionData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load encryption settings: %w", err)
+			}
+			if !settings.Enabled() {
+				return fmt.Errorf("encryption is not set up. Run 'syncstation keys init' first")
+			}
+
+			syncItems, err := config.LoadSyncItemsData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load sync items: %w", err)
+			}
+
+			items := syncItems.SyncItems
+			if !all {
+				if !encrypt && settings.EncryptAll {
+					return fmt.Errorf("all items are encrypted. Use 'syncstation keys decrypt --all' to turn that off")
+				}
+
+				items = nil
+				for _, name := range args {
+					item := syncItems.FindSyncItem(name)
+					if item == nil {
+						return fmt.Errorf("sync item not found: %s", name)
+					}
+					items = append(items, item)
+				}
+			}
+
+			// Local paths linked to the cloud copy would see the ciphertext, and encrypted
+			// copies differ on every push so the object store couldn't deduplicate them
+			if encrypt {
+				for _, item := range items {
+					if item.Deploy == config.DeployLink {
+						return fmt.Errorf("%s is deployed as a symlink. Switch it to copies with 'syncstation deploy \"%s\" --mode copy' first", item.Name, item.Name)
+					}
+					if item.UsesObjectStore() {
+						return fmt.Errorf("%s is kept in the object store, which can't hold encrypted files. Move it out with 'syncstation store \"%s\" --mode files' first", item.Name, item.Name)
+					}
+				}
+			}
+
+			// Rewrite the cloud copies before saving the setting so a missing key changes nothing
+			if err := rewriteCloudCopies(localConfig, items, encrypt); err != nil {
+				return err
+			}
+
+			if all {
+				// --all also applies to items added later
+				settings.EncryptAll = encrypt
+				if err := settings.SaveEncryptionData(localConfig); err != nil {
+					return fmt.Errorf("failed to save encryption settings: %w", err)
+				}
+			}
+			if !all || !encrypt {
+				err := config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+					for _, item := range items {
+						if saved := syncItems.FindSyncItem(item.Name); saved != nil {
+							saved.Encrypt = encrypt
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, item := range items {
+				if encrypt {
+					fmt.Printf("🔒 %s: cloud copy encrypted\n", item.Name)
+				} else {
+					fmt.Printf("🔓 %s: cloud copy decrypted\n", item.Name)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Apply to every sync item")
+	return cmd
+}
+
+// rewriteCloudCopies encrypts or decrypts the existing cloud copies of items (all items when nil)
+func rewriteCloudCopies(localConfig *config.LocalConfig, items []*config.SyncItem, encrypt bool) error {
+	settings, err := config.LoadEncryptionData(localConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption settings: %w", err)
+	}
+
+	cipher, err := encryption.LoadCipher(localConfig, settings)
+	if err != nil {
+		return err
+	}
+
+	if items == nil {
+		syncItems, err := config.LoadSyncItemsData(localConfig)
+		if err != nil {
+			return fmt.Errorf("failed to load sync items: %w", err)
+		}
+		items = syncItems.SyncItems
+	}
+
+	for _, item := range items {
+		cloudStorage := localConfig.CloudStorage()
+		if !storage.Exists(cloudStorage, item.CloudKey()) {
+			continue
+		}
+
+		_, err := encryption.RewriteFiles(cloudStorage, item.CloudKey(), func(data []byte) ([]byte, error) {
+			if encryption.IsEncrypted(data) == encrypt {
+				return data, nil
+			}
+			if encrypt {
+				return cipher.Encrypt(data)
+			}
+			return cipher.Decrypt(data)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to rewrite cloud copy of %s: %w", item.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// obtainExistingKey returns the key of an existing setup from a key file or passphrase
+func obtainExistingKey(settings *config.EncryptionData, importKeyFile string) ([]byte, error) {
+	if importKeyFile != "" {
+		return encryption.LoadKeyFile(importKeyFile)
+	}
+
+	if settings.KDF == "" {
+		return nil, fmt.Errorf("encryption uses a key file. Copy it from another computer and pass --key-file")
+	}
+
+	passphrase, err := readPassphrase("🔑 Passphrase: ", false)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.DeriveKey(passphrase, settings)
+}
+
+// installKey saves the key file of this computer and records it in the local config
+func installKey(localConfig *config.LocalConfig, keyFile string, key []byte) error {
+	if err := encryption.SaveKeyFile(keyFile, key); err != nil {
+		return fmt.Errorf("failed to save key file: %w", err)
+	}
+
+	return recordKeyFile(localConfig, keyFile)
+}
+
+// recordKeyFile stores the key file path in the local config on disk
+func recordKeyFile(localConfig *config.LocalConfig, keyFile string) error {
+	// Reload from disk so flag overrides such as --computer are not persisted
+	configPath := filepath.Join(getConfigDir(), "config.json")
+	storedConfig, err := config.LoadLocalConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	storedConfig.KeyFile = keyFile
+	if err := storedConfig.SaveLocalConfig(configPath); err != nil {
+		return fmt.Errorf("failed to save local config: %w", err)
+	}
+
+	localConfig.KeyFile = keyFile
+	return nil
+}
+
+// readPassphrase reads a passphrase from the environment or the terminal without echoing it
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	if passphrase := os.Getenv(encryption.PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	read := func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			input, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			return string(input), err
+		}
+
+		input, err := reader.ReadString('\n')
+		return strings.TrimRight(input, "\r\n"), err
+	}
+
+	passphrase, err := read(prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase cannot be empty")
+	}
+
+	if confirm {
+		again, err := read("🔑 Confirm passphrase: ")
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+func getKeyFilePath() string {
+	return filepath.Join(getConfigDir(), "encryption.key")
+}
@@ -2,16 +2,22 @@ package syncstation
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/AntoineArt/syncstation/internal/config"
 	"github.com/AntoineArt/syncstation/internal/diff"
+	"github.com/AntoineArt/syncstation/internal/encryption"
+	"github.com/AntoineArt/syncstation/internal/gitrepo"
+	"github.com/AntoineArt/syncstation/internal/secrets"
+	"github.com/AntoineArt/syncstation/internal/storage"
 	"github.com/AntoineArt/syncstation/internal/sync"
 	"github.com/AntoineArt/syncstation/internal/tui"
 )
@@ -74,6 +80,18 @@ Features:
 	rootCmd.AddCommand(tuiCmd())
 	rootCmd.AddCommand(removeCmd())
 	rootCmd.AddCommand(configCmd())
+	rootCmd.AddCommand(keysCmd())
+	rootCmd.AddCommand(scanCmd())
+	rootCmd.AddCommand(templateCmd())
+	rootCmd.AddCommand(computersCmd())
+	rootCmd.AddCommand(pathsCmd())
+	rootCmd.AddCommand(tagsCmd())
+	rootCmd.AddCommand(deployCmd())
+	rootCmd.AddCommand(storeCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(hooksCmd())
+	rootCmd.AddCommand(trustCmd())
+	rootCmd.AddCommand(validateCmd())
 
 	return rootCmd
 }
@@ -141,12 +159,12 @@ If no directory is provided, the current directory will be used.`,
 				}
 			}
 
-			// Detect if cloud directory is a git repository
-			isGitRepo := isGitRepository(absCloudDir)
-			gitRepoRoot := ""
-			if isGitRepo {
-				gitRepoRoot = findGitRoot(absCloudDir)
+			// Detect if cloud directory is in a git repository
+			gitRepoRoot, err := config.FindGitRoot(absCloudDir)
+			if err != nil && !errors.Is(err, config.ErrNotGitRepository) {
+				return fmt.Errorf("failed to detect git repository: %w", err)
 			}
+			isGitRepo := err == nil
 
 			// Create local config
 			localConfig := config.NewLocalConfig()
@@ -160,22 +178,29 @@ If no directory is provided, the current directory will be used.`,
 				return fmt.Errorf("failed to save local config: %w", err)
 			}
 
+			// Start from what other computers already pushed
+			if localConfig.GitMode && isGitRepo {
+				if err := pullGitRepoForInit(localConfig); err != nil {
+					return err
+				}
+			}
+
 			// Initialize cloud storage files (preserve existing data)
-			syncItemsPath := localConfig.GetSyncItemsPath()
-			syncItemsData, err := config.LoadSyncItemsData(syncItemsPath)
+			syncItemsData, err := config.LoadSyncItemsData(localConfig)
 			if err != nil {
 				return fmt.Errorf("failed to load or initialize sync items file: %w", err)
 			}
-			if err := syncItemsData.SaveSyncItemsData(syncItemsPath); err != nil {
+			syncItemsData.TouchComputer(computerID)
+			if err := syncItemsData.SaveSyncItemsData(localConfig); err != nil {
 				return fmt.Errorf("failed to save sync items file: %w", err)
 			}
 
 			// Initialize metadata (git-aware, preserve existing data)
-			metadataData, err := config.LoadFileMetadataDataGitAware(localConfig, localConfig.GetFileMetadataPath())
+			metadataData, err := config.LoadCloudFileMetadata(localConfig)
 			if err != nil {
 				return fmt.Errorf("failed to load or initialize metadata file: %w", err)
 			}
-			if err := metadataData.SaveFileMetadataDataGitAware(localConfig, localConfig.GetFileMetadataPath()); err != nil {
+			if err := metadataData.SaveCloudFileMetadata(localConfig); err != nil {
 				return fmt.Errorf("failed to save metadata file: %w", err)
 			}
 
@@ -185,9 +210,18 @@ If no directory is provided, the current directory will be used.`,
 				fmt.Printf("🔄 Git mode enabled (detected git repository)\n")
 			}
 
-			// Check if there are existing sync items and offer to configure local paths
-			if len(syncItemsData.SyncItems) > 0 {
-				fmt.Printf("\n🔧 Found %d existing sync items. Would you like to set up local file paths for this computer? (y/N): ", len(syncItemsData.SyncItems))
+			// Check if there are existing sync items without a path and offer to configure local paths
+			unconfigured := 0
+			for _, item := range syncItemsData.SyncItems {
+				if item.GetCurrentComputerPath(computerID) == "" {
+					unconfigured++
+				}
+			}
+			if resolved := len(syncItemsData.SyncItems) - unconfigured; resolved > 0 {
+				fmt.Printf("📂 %d existing sync items already have a path on this computer\n", resolved)
+			}
+			if unconfigured > 0 {
+				fmt.Printf("\n🔧 Found %d existing sync items without a path. Would you like to set up local file paths for this computer? (y/N): ", unconfigured)
 				reader := bufio.NewReader(os.Stdin)
 				response, err := reader.ReadString('\n')
 				if err != nil {
@@ -234,7 +268,7 @@ Use --all to show all items, or --reconfigure to allow changing existing paths.`
 			}
 
 			// Load sync items
-			syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+			syncItems, err := config.LoadSyncItemsData(localConfig)
 			if err != nil {
 				return fmt.Errorf("failed to load sync items: %w", err)
 			}
@@ -288,6 +322,14 @@ Use --all to show all items, or --reconfigure to allow changing existing paths.`
 
 func addCmd() *cobra.Command {
 	var excludePatterns []string
+	var encrypt bool
+	var secretPolicy string
+	var template bool
+	var vars []string
+	var defaultPaths []string
+	var tags []string
+	var link bool
+	var objectStore bool
 
 	cmd := &cobra.Command{
 		Use:   "add <name> <path>",
@@ -318,17 +360,13 @@ The path should be the location on this computer.`,
 			}
 
 			// Auto-detect type
-			info, err := os.Stat(absolutePath)
+			itemType, err := config.DetectItemType(absolutePath)
 			if err != nil {
 				return fmt.Errorf("failed to stat path: %w", err)
 			}
-			itemType := "file"
-			if info.IsDir() {
-				itemType = "folder"
-			}
 
 			// Load sync items
-			syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+			syncItems, err := config.LoadSyncItemsData(localConfig)
 			if err != nil {
 				return fmt.Errorf("failed to load sync items: %w", err)
 			}
@@ -338,13 +376,68 @@ The path should be the location on this computer.`,
 				localConfig.CurrentComputer: absolutePath,
 			}
 
+			// Encrypted items need a key on this computer
+			if encrypt {
+				settings, err := config.LoadEncryptionData(localConfig)
+				if err != nil {
+					return fmt.Errorf("failed to load encryption settings: %w", err)
+				}
+				if !settings.Enabled() {
+					return fmt.Errorf("encryption is not set up. Run 'syncstation keys init' first")
+				}
+				if _, err := encryption.LoadCipher(localConfig, settings); err != nil {
+					return err
+				}
+			}
+
+			if template && itemType != "file" {
+				return fmt.Errorf("templates are only supported for file items")
+			}
+			assignments, err := parseTemplateVars(vars)
+			if err != nil {
+				return err
+			}
+			var pathRules []config.PathRule
+			for _, defaultPath := range defaultPaths {
+				rule, err := config.ParsePathRule(defaultPath)
+				if err != nil {
+					return err
+				}
+				pathRules = append(pathRules, rule)
+			}
+
+			if link && (encrypt || template) {
+				return fmt.Errorf("--link can't be combined with --encrypt or --template")
+			}
+
+			if secretPolicy != "" && !secrets.ValidPolicy(secretPolicy) {
+				return fmt.Errorf("invalid secret policy %q: use off, warn, block or encrypt", secretPolicy)
+			}
+
 			// Add sync item
 			if err := syncItems.AddSyncItem(name, itemType, paths, excludePatterns); err != nil {
 				return fmt.Errorf("failed to add sync item: %w", err)
 			}
+			syncItems.FindSyncItem(name).Encrypt = encrypt
+			syncItems.FindSyncItem(name).SecretPolicy = secretPolicy
+			syncItems.FindSyncItem(name).Template = template
+			setTemplateVars(syncItems.FindSyncItem(name), localConfig.CurrentComputer, assignments)
+			for _, rule := range pathRules {
+				syncItems.FindSyncItem(name).SetPathRule(rule)
+			}
+			syncItems.FindSyncItem(name).Tags = addTags(nil, tags)
+			if link {
+				syncItems.FindSyncItem(name).Deploy = config.DeployLink
+			}
+			if objectStore {
+				syncItems.FindSyncItem(name).Store = config.StoreObjects
+				if err := sync.CheckObjectStore(localConfig, syncItems.FindSyncItem(name)); err != nil {
+					return err
+				}
+			}
 
 			// Save sync items
-			if err := syncItems.SaveSyncItemsData(localConfig.GetSyncItemsPath()); err != nil {
+			if err := syncItems.SaveSyncItemsData(localConfig); err != nil {
 				return fmt.Errorf("failed to save sync items: %w", err)
 			}
 
@@ -354,76 +447,135 @@ The path should be the location on this computer.`,
 			if len(excludePatterns) > 0 {
 				fmt.Printf("🚫 Exclude patterns: %s\n", strings.Join(excludePatterns, ", "))
 			}
+			if encrypt {
+				fmt.Printf("🔒 Cloud copy will be encrypted\n")
+			}
+			if secretPolicy != "" {
+				fmt.Printf("🔑 Secret policy: %s\n", secretPolicy)
+			}
+			if template {
+				fmt.Printf("🧩 Stored as a template for per-computer rendering\n")
+			}
+			for _, rule := range pathRules {
+				fmt.Printf("🧭 Default path for %s: %s\n", rule, rule.Path)
+			}
+			if len(tags) > 0 {
+				fmt.Printf("🏷️  Tags: %s\n", strings.Join(syncItems.FindSyncItem(name).Tags, ", "))
+			}
+			if link {
+				fmt.Printf("🔗 Deployed as a symlink to the cloud copy on the next sync\n")
+			}
+			if objectStore {
+				fmt.Printf("🧱 Cloud copy kept in the object store\n")
+			}
 
 			return nil
 		},
 	}
 
 	cmd.Flags().StringSliceVar(&excludePatterns, "exclude", []string{}, "Patterns to exclude from sync")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the cloud copy (requires 'syncstation keys init')")
+	cmd.Flags().StringVar(&secretPolicy, "secret-policy", "", "Secret policy before push: off, warn, block or encrypt")
+	cmd.Flags().BoolVar(&template, "template", false, "Store the file as a template rendered for each computer")
+	cmd.Flags().StringSliceVar(&vars, "var", []string{}, "Template variable of this computer (name=value)")
+	cmd.Flags().StringSliceVar(&tags, "tag", []string{}, "Tags used to select the item (e.g. shell, work)")
+	cmd.Flags().BoolVar(&link, "link", false, "Replace the local path with a symlink to the cloud copy")
+	cmd.Flags().BoolVar(&objectStore, "objects", false, "Keep the cloud copy of a folder in the deduplicating object store")
+	cmd.Flags().StringArrayVar(&defaultPaths, "default-path", []string{}, "Default path for other computers: <os>=<path>, tag:<tag>=<path> or *=<path>")
 
 	return cmd
 }
 
 func syncCmd() *cobra.Command {
+	var selector itemSelector
+	var watch bool
+	var interval time.Duration
+
 	cmd := &cobra.Command{
-		Use:   "sync [item-name]",
+		Use:   "sync [item-name...]",
 		Short: "Smart sync items",
 		Long: `Perform intelligent bidirectional sync using hash comparison and timestamps.
-If no item name is provided, all items will be synced.`,
-		Args: cobra.MaximumNArgs(1),
+Items can be selected by name, glob ("nvim*") or --tag.
+If no item is selected, all items this computer subscribes to will be synced.
+With --watch, syncs again whenever the cloud copy or the local files change.`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return performSync(sync.SyncSmart, args)
+			if watch {
+				return watchSync(args, &selector, interval)
+			}
+			return performSync(sync.SyncSmart, args, &selector)
 		},
 	}
 
+	addSelectorFlags(cmd, &selector)
+	addSettleFlag(cmd)
+	cmd.Flags().BoolVar(&watch, "watch", false, "Keep running and sync whenever the cloud copy settles after a change, or local files change")
+	cmd.Flags().DurationVar(&interval, "interval", defaultWatchInterval, "How often --watch checks for changes")
 	return cmd
 }
 
 func pushCmd() *cobra.Command {
-	var force bool
+	var force, resolveCopies bool
+	var selector itemSelector
 
 	cmd := &cobra.Command{
-		Use:   "push [item-name]",
+		Use:   "push [item-name...]",
 		Short: "Push items from local to cloud",
 		Long: `Push configuration files from local to cloud storage.
-If no item name is provided, all items will be pushed.
-Use --force to override conflict warnings.`,
-		Args: cobra.MaximumNArgs(1),
+Items can be selected by name, glob ("nvim*") or --tag.
+If no item is selected, all items this computer subscribes to will be pushed.
+Use --force to override conflict warnings, and --resolve-copies to delete the provider
+conflict copies of the pushed items once their changes are merged.`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return performSyncWithConflictCheck(sync.SyncPush, args, force)
+			return performSyncWithConflictCheck(sync.SyncPush, args, &selector, force, resolveCopies)
 		},
 	}
 
+	addSelectorFlags(cmd, &selector)
+
+	addSettleFlag(cmd)
 	cmd.Flags().BoolVar(&force, "force", false, "Force push even when conflicts are detected")
+	cmd.Flags().BoolVar(&resolveCopies, "resolve-copies", false, "Delete the provider conflict copies of the pushed items, keeping the pushed version")
 	return cmd
 }
 
 func pullCmd() *cobra.Command {
-	var force bool
+	var force, resolveCopies bool
+	var selector itemSelector
 
 	cmd := &cobra.Command{
-		Use:   "pull [item-name]",
+		Use:   "pull [item-name...]",
 		Short: "Pull items from cloud to local",
 		Long: `Pull configuration files from cloud storage to local.
-If no item name is provided, all items will be pulled.
-Use --force to override conflict warnings.`,
-		Args: cobra.MaximumNArgs(1),
+Items can be selected by name, glob ("nvim*") or --tag.
+If no item is selected, all items this computer subscribes to will be pulled.
+Use --force to override conflict warnings, and --resolve-copies to delete the provider
+conflict copies of the pulled items once their changes are merged.`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return performSyncWithConflictCheck(sync.SyncPull, args, force)
+			return performSyncWithConflictCheck(sync.SyncPull, args, &selector, force, resolveCopies)
 		},
 	}
 
+	addSelectorFlags(cmd, &selector)
+
+	addSettleFlag(cmd)
 	cmd.Flags().BoolVar(&force, "force", false, "Force pull even when conflicts are detected")
+	cmd.Flags().BoolVar(&resolveCopies, "resolve-copies", false, "Delete the provider conflict copies of the pulled items, keeping the pulled version")
 	return cmd
 }
 
 func statusCmd() *cobra.Command {
+	var selector itemSelector
+
 	cmd := &cobra.Command{
-		Use:   "status [item-name]",
+		Use:   "status [item-name...]",
 		Short: "Show sync status",
 		Long: `Display the synchronization status of items.
-Shows whether files are in sync, have conflicts, or need updates.`,
-		Args: cobra.MaximumNArgs(1),
+Shows whether files are in sync, have conflicts, or need updates.
+Items can be selected by name, glob ("nvim*") or --tag.`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Load configuration
 			localConfig, err := loadConfig()
@@ -432,7 +584,7 @@ Shows whether files are in sync, have conflicts, or need updates.`,
 			}
 
 			// Load sync items
-			syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+			syncItems, err := config.LoadSyncItemsData(localConfig)
 			if err != nil {
 				return fmt.Errorf("failed to load sync items: %w", err)
 			}
@@ -442,37 +594,48 @@ Shows whether files are in sync, have conflicts, or need updates.`,
 				return nil
 			}
 
-			// Filter items if specific item requested
-			itemsToCheck := syncItems.SyncItems
-			if len(args) > 0 {
-				itemName := args[0]
-				item := syncItems.FindSyncItem(itemName)
-				if item == nil {
-					return fmt.Errorf("sync item not found: %s", itemName)
-				}
-				itemsToCheck = []*config.SyncItem{item}
+			// Filter items by the selection
+			itemsToCheck, err := selector.selectItems(localConfig, syncItems, args)
+			if err != nil {
+				return err
+			}
+			if len(itemsToCheck) == 0 {
+				fmt.Println("📭 No sync items selected")
+				return nil
 			}
 
 			// Display status header
 			fmt.Printf("🔄 Sync Status - Computer: %s\n", localConfig.CurrentComputer)
 			fmt.Printf("☁️  Cloud Directory: %s\n\n", localConfig.CloudSyncDir)
 
-			// Create diff engine for status checking
-			diffEngine := diff.NewDiffEngine()
-
 			// Check each item
+			conflictCopies := syncItems.NewConflictCopyFinder()
 			for _, item := range itemsToCheck {
 				localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
-				cloudPath := item.GetCloudPath(localConfig.GetCloudConfigsPath())
+				cloudKey := item.CloudKey()
+				cloudExists := storage.Exists(sync.ItemStorage(localConfig, item), cloudKey)
 
 				fmt.Printf("📦 %s (%s)\n", item.Name, item.Type)
 				fmt.Printf("   Local:  %s\n", getPathStatus(localPath))
-				fmt.Printf("   Cloud:  %s\n", getPathStatus(cloudPath))
+				fmt.Printf("   Cloud:  %s\n", getCloudStatus(localConfig, item))
+				if copies, err := conflictCopies.Find(sync.ItemStorage(localConfig, item), item); err == nil {
+					for _, conflict := range copies {
+						fmt.Printf("   Conflict: 🔥 %s conflict copy %s\n", conflict.Provider, conflict.Key)
+					}
+				}
+
+				if sync.IsLinked(localConfig, item) {
+					fmt.Printf("   Status: 🔗 Linked to the cloud copy\n\n")
+					continue
+				}
+				if item.Deploy == config.DeployLink {
+					fmt.Printf("   Deploy: 🔗 Link pending, run 'syncstation sync \"%s\"'\n", item.Name)
+				}
 
 				// Get detailed status if both exist
-				if config.PathExists(localPath) && config.PathExists(cloudPath) {
+				if config.PathExists(localPath) && cloudExists {
 					if item.Type == "file" {
-						fileDiff, err := diffEngine.CompareFiles(localPath, cloudPath)
+						fileDiff, err := newDiffEngine(localConfig, item).CompareFiles(localPath, cloudKey)
 						if err != nil {
 							fmt.Printf("   Status: ❌ Error checking: %v\n", err)
 						} else {
@@ -481,7 +644,7 @@ Shows whether files are in sync, have conflicts, or need updates.`,
 					} else {
 						fmt.Printf("   Status: 📁 Directory (detailed comparison not implemented)\n")
 					}
-				} else if !config.PathExists(localPath) && !config.PathExists(cloudPath) {
+				} else if !config.PathExists(localPath) && !cloudExists {
 					fmt.Printf("   Status: ⚠️  Neither exists\n")
 				} else if !config.PathExists(localPath) {
 					fmt.Printf("   Status: ⬇️  Need to pull from cloud\n")
@@ -496,14 +659,19 @@ Shows whether files are in sync, have conflicts, or need updates.`,
 		},
 	}
 
+	addSelectorFlags(cmd, &selector)
 	return cmd
 }
 
 func listCmd() *cobra.Command {
+	var selector itemSelector
+
 	cmd := &cobra.Command{
-		Use:   "list",
+		Use:   "list [item-name...]",
 		Short: "List all sync items",
-		Long:  `Display all configured sync items with their paths and status.`,
+		Long: `Display all configured sync items with their paths and status.
+Items can be selected by name, glob ("nvim*") or --tag.`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Load configuration
 			localConfig, err := loadConfig()
@@ -512,7 +680,7 @@ func listCmd() *cobra.Command {
 			}
 
 			// Load sync items
-			syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+			syncItems, err := config.LoadSyncItemsData(localConfig)
 			if err != nil {
 				return fmt.Errorf("failed to load sync items: %w", err)
 			}
@@ -523,15 +691,39 @@ func listCmd() *cobra.Command {
 				return nil
 			}
 
-			fmt.Printf("📦 Sync Items (%d total)\n\n", len(syncItems.SyncItems))
+			// Encryption settings are optional, ignore errors
+			encryptionData, err := config.LoadEncryptionData(localConfig)
+			if err != nil {
+				encryptionData = &config.EncryptionData{}
+			}
 
-			for _, item := range syncItems.SyncItems {
+			items, err := selector.selectItems(localConfig, syncItems, args)
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				fmt.Println("📭 No sync items selected")
+				return nil
+			}
+
+			if len(items) == len(syncItems.SyncItems) {
+				fmt.Printf("📦 Sync Items (%d total)\n\n", len(items))
+			} else {
+				fmt.Printf("📦 Sync Items (%d of %d)\n\n", len(items), len(syncItems.SyncItems))
+			}
+
+			for _, item := range items {
 				typeIcon := "📄"
 				if item.Type == "folder" {
 					typeIcon = "📁"
 				}
 
-				fmt.Printf("%s %s\n", typeIcon, item.Name)
+				lockIcon := ""
+				if encryptionData.IsItemEncrypted(item) {
+					lockIcon = " 🔒"
+				}
+
+				fmt.Printf("%s %s%s\n", typeIcon, item.Name, lockIcon)
 
 				// Show paths for all computers
 				if len(item.Paths) > 0 {
@@ -544,11 +736,28 @@ func listCmd() *cobra.Command {
 					}
 				}
 
+				// Show default path rules if any
+				for _, rule := range item.PathRules {
+					fmt.Printf("   🧭 %s: %s\n", rule, rule.Path)
+				}
+
 				// Show exclude patterns if any
 				if len(item.ExcludePatterns) > 0 {
 					fmt.Printf("   🚫 Excludes: %s\n", strings.Join(item.ExcludePatterns, ", "))
 				}
 
+				if item.Template {
+					fmt.Printf("   🧩 Template (%d variables on this computer)\n", len(syncItems.TemplateVars(item, localConfig.CurrentComputer)))
+				}
+
+				if len(item.Tags) > 0 {
+					fmt.Printf("   🏷️  Tags: %s\n", strings.Join(item.Tags, ", "))
+				}
+
+				if item.Deploy == config.DeployLink {
+					fmt.Printf("   🔗 Deployed as a symlink to the cloud copy\n")
+				}
+
 				fmt.Println()
 			}
 
@@ -556,6 +765,7 @@ func listCmd() *cobra.Command {
 		},
 	}
 
+	addSelectorFlags(cmd, &selector)
 	return cmd
 }
 
@@ -575,23 +785,26 @@ func tuiCmd() *cobra.Command {
 func removeCmd() *cobra.Command {
 	var global bool
 	var deleteCloud bool
+	var selector itemSelector
 
 	cmd := &cobra.Command{
-		Use:   "remove <name>",
-		Short: "Remove a sync item",
-		Long: `Remove a sync item from synchronization.
+		Use:   "remove <name...>",
+		Short: "Remove sync items",
+		Long: `Remove sync items from synchronization.
+Items can be selected by name, glob ("nvim*") or --tag.
 
 By default, only disables sync on this computer (other computers keep the item).
 Use --global to remove from all computers' configurations.
 Use --delete-cloud to also delete the cloud backup files.`,
-		Args: cobra.ExactArgs(1),
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			name := args[0]
-
 			// Validate flags
 			if global && deleteCloud {
 				return fmt.Errorf("cannot use --global and --delete-cloud together")
 			}
+			if selector.isEmpty(args) {
+				return fmt.Errorf("specify the items to remove by name, glob or --tag")
+			}
 
 			// Load configuration
 			localConfig, err := loadConfig()
@@ -600,101 +813,105 @@ Use --delete-cloud to also delete the cloud backup files.`,
 			}
 
 			// Load sync items
-			syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+			syncItems, err := config.LoadSyncItemsData(localConfig)
 			if err != nil {
 				return fmt.Errorf("failed to load sync items: %w", err)
 			}
 
-			// Find the item
-			var targetItem *config.SyncItem
-			var itemIndex int
-			for i, item := range syncItems.SyncItems {
-				if item.Name == name {
-					targetItem = item
-					itemIndex = i
-					break
-				}
+			// Find the items
+			targetItems, err := selector.selectItems(localConfig, syncItems, args)
+			if err != nil {
+				return err
 			}
-
-			if targetItem == nil {
-				return fmt.Errorf("sync item not found: %s", name)
+			if len(targetItems) == 0 {
+				fmt.Println("📭 No sync items selected")
+				return nil
 			}
 
-			if deleteCloud {
-				// Complete deletion: remove item + delete cloud files
-				cloudPath := targetItem.GetCloudPath(localConfig.GetCloudConfigsPath())
-				if config.PathExists(cloudPath) {
-					if err := deleteCloudFiles(cloudPath, targetItem.Type); err != nil {
-						fmt.Printf("⚠️  Warning: failed to delete cloud files at %s: %v\n", cloudPath, err)
-					} else {
-						fmt.Printf("🗑️  Deleted cloud backup files at: %s\n", cloudPath)
-					}
+			changed := false
+			for _, targetItem := range targetItems {
+				if removeItem(localConfig, syncItems, targetItem, global, deleteCloud) {
+					changed = true
 				}
+			}
 
-				// Clean up metadata for this item
-				if err := cleanupItemMetadata(localConfig, targetItem); err != nil {
-					fmt.Printf("⚠️  Warning: failed to cleanup metadata: %v\n", err)
+			// Save updated sync items
+			if changed {
+				if err := syncItems.SaveSyncItemsData(localConfig); err != nil {
+					return fmt.Errorf("failed to save sync items: %w", err)
 				}
+			}
 
-				// Remove item from configuration
-				syncItems.SyncItems = append(syncItems.SyncItems[:itemIndex], syncItems.SyncItems[itemIndex+1:]...)
+			return nil
+		},
+	}
 
-				// Save updated sync items
-				if err := syncItems.SaveSyncItemsData(localConfig.GetSyncItemsPath()); err != nil {
-					return fmt.Errorf("failed to save sync items: %w", err)
-				}
+	cmd.Flags().BoolVar(&global, "global", false, "Remove from all computers (instead of just this computer)")
+	cmd.Flags().BoolVar(&deleteCloud, "delete-cloud", false, "Completely remove and delete cloud backup files (WARNING: permanent deletion)")
+	addSelectorFlags(cmd, &selector)
+	return cmd
+}
 
-				fmt.Printf("✅ Completely removed '%s' and deleted cloud backup files\n", name)
-				return nil
+// removeItem removes a sync item from this computer, from all computers (global) or
+// entirely with its cloud files (deleteCloud). It reports whether syncItems changed.
+func removeItem(localConfig *config.LocalConfig, syncItems *config.SyncItemsData, targetItem *config.SyncItem, global, deleteCloud bool) bool {
+	name := targetItem.Name
+
+	if deleteCloud {
+		// Complete deletion: remove item + delete cloud files
+		cloudStorage := sync.ItemStorage(localConfig, targetItem)
+		cloudPath := cloudStorage.Location(targetItem.CloudKey())
+		if storage.Exists(cloudStorage, targetItem.CloudKey()) {
+			if err := targetItem.DeleteCloudFiles(cloudStorage); err != nil {
+				fmt.Printf("⚠️  Warning: failed to delete cloud files at %s: %v\n", cloudPath, err)
+			} else {
+				fmt.Printf("🗑️  Deleted cloud backup files at: %s\n", cloudPath)
 			}
+		}
 
-			if global {
-				// Global removal: remove item from all computers but preserve cloud files
-				// Clean up metadata for this item
-				if err := cleanupItemMetadata(localConfig, targetItem); err != nil {
-					fmt.Printf("⚠️  Warning: failed to cleanup metadata: %v\n", err)
-				}
-
-				syncItems.SyncItems = append(syncItems.SyncItems[:itemIndex], syncItems.SyncItems[itemIndex+1:]...)
+		// Clean up metadata for this item
+		if err := config.CleanupItemMetadata(localConfig, getFileStatesPath(), targetItem.Name); err != nil {
+			fmt.Printf("⚠️  Warning: failed to cleanup metadata: %v\n", err)
+		}
 
-				// Save updated sync items
-				if err := syncItems.SaveSyncItemsData(localConfig.GetSyncItemsPath()); err != nil {
-					return fmt.Errorf("failed to save sync items: %w", err)
-				}
+		// Remove item from configuration
+		syncItems.RemoveSyncItem(targetItem.Name)
 
-				fmt.Printf("✅ Removed sync item '%s' from all computers (cloud backup files preserved)\n", name)
-				return nil
-			}
+		fmt.Printf("✅ Completely removed '%s' and deleted cloud backup files\n", name)
+		return true
+	}
 
-			// Default: Local-only removal
-			if len(targetItem.Paths) <= 1 {
-				fmt.Printf("⚠️  Warning: '%s' only has one computer configured.\n", name)
-				fmt.Printf("💡 Use 'syncstation remove \"%s\" --global' to remove completely.\n", name)
-				return nil
-			}
+	if global {
+		// Global removal: remove item from all computers but preserve cloud files
+		// Clean up metadata for this item
+		if err := config.CleanupItemMetadata(localConfig, getFileStatesPath(), targetItem.Name); err != nil {
+			fmt.Printf("⚠️  Warning: failed to cleanup metadata: %v\n", err)
+		}
 
-			if _, exists := targetItem.Paths[localConfig.CurrentComputer]; !exists {
-				fmt.Printf("ℹ️  '%s' is not configured for this computer (%s)\n", name, localConfig.CurrentComputer)
-				return nil
-			}
+		syncItems.RemoveSyncItem(targetItem.Name)
 
-			// Remove only this computer's path
-			delete(targetItem.Paths, localConfig.CurrentComputer)
+		fmt.Printf("✅ Removed sync item '%s' from all computers (cloud backup files preserved)\n", name)
+		return true
+	}
 
-			// Save updated sync items
-			if err := syncItems.SaveSyncItemsData(localConfig.GetSyncItemsPath()); err != nil {
-				return fmt.Errorf("failed to save sync items: %w", err)
-			}
+	// Default: Local-only removal
+	if len(targetItem.Paths) <= 1 && len(targetItem.PathRules) == 0 {
+		fmt.Printf("⚠️  Warning: '%s' only has one computer configured.\n", name)
+		fmt.Printf("💡 Use 'syncstation remove \"%s\" --global' to remove completely.\n", name)
+		return false
+	}
 
-			fmt.Printf("✅ Disabled sync for '%s' on this computer (%s)\n", name, localConfig.CurrentComputer)
-			fmt.Printf("💡 Item remains active on other computers: %v\n", getComputerList(targetItem.Paths))
-			return nil
-		},
+	if targetItem.GetCurrentComputerPath(localConfig.CurrentComputer) == "" {
+		fmt.Printf("ℹ️  '%s' is not configured for this computer (%s)\n", name, localConfig.CurrentComputer)
+		return false
 	}
 
-	cmd.Flags().BoolVar(&global, "global", false, "Remove from all computers (instead of just this computer)")
-	cmd.Flags().BoolVar(&deleteCloud, "delete-cloud", false, "Completely remove and delete cloud backup files (WARNING: permanent deletion)")
-	return cmd
+	// Remove only this computer's path
+	targetItem.DisableOnComputer(localConfig.CurrentComputer)
+
+	fmt.Printf("✅ Disabled sync for '%s' on this computer (%s)\n", name, localConfig.CurrentComputer)
+	fmt.Printf("💡 Item remains active on other computers: %v\n", getComputerList(targetItem.Paths))
+	return true
 }
 
 func configCmd() *cobra.Command {
@@ -727,10 +944,28 @@ func configCmd() *cobra.Command {
 
 			// Show sync files
 			fmt.Printf("\n📄 Data Files:\n")
-			fmt.Printf("   Items: %s\n", localConfig.GetSyncItemsPath())
-			fmt.Printf("   Metadata: %s\n", localConfig.GetFileMetadataPath())
+			fmt.Printf("   Items: %s\n", localConfig.CloudStorage().Location(config.SyncItemsKey))
+			fmt.Printf("   Metadata: %s\n", localConfig.CloudStorage().Location(config.FileMetadataKey))
 			fmt.Printf("   Configs: %s\n", localConfig.GetCloudConfigsPath())
 
+			// Show encryption setup
+			settings, err := config.LoadEncryptionData(localConfig)
+			if err == nil && settings.Enabled() {
+				fmt.Printf("\n🔒 Encryption: key %s", settings.KeyID)
+				if settings.KDF != "" {
+					fmt.Printf(" (passphrase)")
+				}
+				if settings.EncryptAll {
+					fmt.Printf(", all items encrypted")
+				}
+				fmt.Println()
+				if localConfig.KeyFile != "" {
+					fmt.Printf("   Key File: %s\n", localConfig.KeyFile)
+				} else {
+					fmt.Printf("   ⚠️  No key on this computer - run 'syncstation keys init'\n")
+				}
+			}
+
 			return nil
 		},
 	}
@@ -845,7 +1080,7 @@ func setupLocalPathsForItems(localConfig *config.LocalConfig, syncItemsData *con
 
 	// Save changes if any were made
 	if modified {
-		if err := syncItemsData.SaveSyncItemsData(localConfig.GetSyncItemsPath()); err != nil {
+		if err := syncItemsData.SaveSyncItemsData(localConfig); err != nil {
 			return fmt.Errorf("failed to save sync items: %w", err)
 		}
 		fmt.Printf("✅ Local path configuration completed and saved!\n")
@@ -856,43 +1091,57 @@ func setupLocalPathsForItems(localConfig *config.LocalConfig, syncItemsData *con
 	return nil
 }
 
-func checkForConflicts(localConfig *config.LocalConfig, items []*config.SyncItem) ([]string, error) {
+// checkForConflicts returns the selected items changed both locally and in the cloud, and
+// their provider conflict copies unless they are going to be resolved
+func checkForConflicts(localConfig *config.LocalConfig, syncItems *config.SyncItemsData, items []*config.SyncItem, resolveCopies bool) ([]string, error) {
 	var conflicts []string
-	diffEngine := diff.NewDiffEngine()
 
+	conflictCopies := syncItems.NewConflictCopyFinder()
 	for _, item := range items {
+		// Conflict copies made by the cloud provider are conflicts whatever the local files
+		if !resolveCopies {
+			copies, err := conflictCopies.Find(sync.ItemStorage(localConfig, item), item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look for conflict copies of %s: %w", item.Name, err)
+			}
+			for _, conflict := range copies {
+				conflicts = append(conflicts, fmt.Sprintf("%s (%s conflict copy %s)", item.Name, conflict.Provider, conflict.Key))
+			}
+		}
+
 		localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
 		if localPath == "" {
 			continue // Skip items without paths configured for this computer
 		}
 
-		cloudPath := item.GetCloudPath(localConfig.GetCloudConfigsPath())
+		cloudKey := item.CloudKey()
+		cloudStorage := sync.ItemStorage(localConfig, item)
 
 		// Both must exist to have a conflict
-		if !config.PathExists(localPath) || !config.PathExists(cloudPath) {
+		if !config.PathExists(localPath) || !storage.Exists(cloudStorage, cloudKey) {
 			continue
 		}
 
 		// For files, check if they differ and both have been modified
 		if item.Type == "file" {
-			fileDiff, err := diffEngine.CompareFiles(localPath, cloudPath)
+			fileDiff, err := newDiffEngine(localConfig, item).CompareFiles(localPath, cloudKey)
 			if err != nil {
 				continue // Skip files we can't compare
 			}
 
 			// Check if it's a conflict (both modified since last known sync)
 			if fileDiff.Status == "conflict" ||
-				(fileDiff.Status == "local_newer" && hasCloudChangedSinceLastSync(localConfig, item.Name, localPath, cloudPath)) ||
+				(fileDiff.Status == "local_newer" && hasCloudChangedSinceLastSync(localConfig, item.Name, localPath, cloudKey)) ||
 				(fileDiff.Status == "cloud_newer" && hasLocalChangedSinceLastSync(localConfig, item.Name, localPath)) {
 				conflicts = append(conflicts, item.Name)
 			}
 		} else {
 			// For directories, do a simple timestamp check
 			localInfo, err1 := os.Stat(localPath)
-			cloudInfo, err2 := os.Stat(cloudPath)
+			cloudInfo, err2 := cloudStorage.Stat(cloudKey)
 			if err1 == nil && err2 == nil {
 				// If both directories have been modified recently, consider it a potential conflict
-				if !localInfo.ModTime().Equal(cloudInfo.ModTime()) {
+				if !localInfo.ModTime().Equal(cloudInfo.ModTime) {
 					conflicts = append(conflicts, item.Name+" (directory - manual check recommended)")
 				}
 			}
@@ -902,9 +1151,9 @@ func checkForConflicts(localConfig *config.LocalConfig, items []*config.SyncItem
 	return conflicts, nil
 }
 
-func hasCloudChangedSinceLastSync(localConfig *config.LocalConfig, itemName, localPath, cloudPath string) bool {
+func hasCloudChangedSinceLastSync(localConfig *config.LocalConfig, itemName, localPath, cloudKey string) bool {
 	// Load cloud metadata to check if cloud file changed since last sync
-	cloudMetadata, err := config.LoadFileMetadataDataGitAware(localConfig, localConfig.GetFileMetadataPath())
+	cloudMetadata, err := config.LoadCloudFileMetadata(localConfig)
 	if err != nil {
 		return true // Assume conflict if we can't load metadata
 	}
@@ -912,7 +1161,7 @@ func hasCloudChangedSinceLastSync(localConfig *config.LocalConfig, itemName, loc
 	if itemMetadata, exists := cloudMetadata.Metadata[itemName]; exists {
 		if fileMetadata, exists := itemMetadata[localPath]; exists {
 			// Compare current cloud hash with last known cloud hash
-			currentCloudHash, err := config.CalculateFileHash(cloudPath)
+			currentCloudHash, err := encryption.NewCodec(localConfig).HashFile(localConfig.CloudStorage(), cloudKey)
 			if err != nil {
 				return true // Assume conflict if we can't calculate hash
 			}
@@ -925,8 +1174,7 @@ func hasCloudChangedSinceLastSync(localConfig *config.LocalConfig, itemName, loc
 
 func hasLocalChangedSinceLastSync(localConfig *config.LocalConfig, itemName, localPath string) bool {
 	// Load local file states to check if local file changed since last sync
-	fileStatesPath := filepath.Join(getConfigDir(), "file-states.json")
-	fileStates, err := config.LoadFileStatesData(fileStatesPath)
+	fileStates, err := config.LoadFileStatesData(getFileStatesPath())
 	if err != nil {
 		return true // Assume conflict if we can't load states
 	}
@@ -944,53 +1192,14 @@ func hasLocalChangedSinceLastSync(localConfig *config.LocalConfig, itemName, loc
 
 func getComputerList(paths map[string]string) []string {
 	var computers []string
-	for computerID := range paths {
-		computers = append(computers, computerID)
+	for computerID, path := range paths {
+		if path != "" {
+			computers = append(computers, computerID)
+		}
 	}
 	return computers
 }
 
-func deleteCloudFiles(cloudPath, itemType string) error {
-	if itemType == "file" {
-		return os.Remove(cloudPath)
-	} else {
-		return os.RemoveAll(cloudPath)
-	}
-}
-
-func cleanupItemMetadata(localConfig *config.LocalConfig, item *config.SyncItem) error {
-	// Load cloud metadata
-	cloudMetadata, err := config.LoadFileMetadataDataGitAware(localConfig, localConfig.GetFileMetadataPath())
-	if err != nil {
-		return fmt.Errorf("failed to load cloud metadata: %w", err)
-	}
-
-	// Remove metadata for this item
-	delete(cloudMetadata.Metadata, item.Name)
-
-	// Save updated metadata
-	if err := cloudMetadata.SaveFileMetadataDataGitAware(localConfig, localConfig.GetFileMetadataPath()); err != nil {
-		return fmt.Errorf("failed to save updated metadata: %w", err)
-	}
-
-	// Load and clean up local file states
-	fileStatesPath := filepath.Join(getConfigDir(), "file-states.json")
-	fileStates, err := config.LoadFileStatesData(fileStatesPath)
-	if err != nil {
-		return fmt.Errorf("failed to load file states: %w", err)
-	}
-
-	// Remove local states for this item
-	delete(fileStates.States, item.Name)
-
-	// Save updated file states
-	if err := fileStates.SaveFileStatesData(fileStatesPath); err != nil {
-		return fmt.Errorf("failed to save updated file states: %w", err)
-	}
-
-	return nil
-}
-
 func loadConfig() (*config.LocalConfig, error) {
 	configPath := filepath.Join(getConfigDir(), "config.json")
 	localConfig, err := config.LoadLocalConfig(configPath)
@@ -1010,15 +1219,15 @@ func loadConfig() (*config.LocalConfig, error) {
 	return localConfig, nil
 }
 
-func performSyncWithConflictCheck(operation sync.SyncOperation, args []string, force bool) error {
-	// Load configuration
-	localConfig, err := loadConfig()
+func performSyncWithConflictCheck(operation sync.SyncOperation, args []string, selector *itemSelector, force, resolveCopies bool) error {
+	// Load configuration and bring the git repository of git mode up to date
+	localConfig, repo, err := loadConfigForSync()
 	if err != nil {
 		return err
 	}
 
 	// Load sync items
-	syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+	syncItems, err := config.LoadSyncItemsData(localConfig)
 	if err != nil {
 		return fmt.Errorf("failed to load sync items: %w", err)
 	}
@@ -1028,20 +1237,15 @@ func performSyncWithConflictCheck(operation sync.SyncOperation, args []string, f
 		return nil
 	}
 
-	// Filter items if specific item requested
-	itemsToSync := syncItems.SyncItems
-	if len(args) > 0 {
-		itemName := args[0]
-		item := syncItems.FindSyncItem(itemName)
-		if item == nil {
-			return fmt.Errorf("sync item not found: %s", itemName)
-		}
-		itemsToSync = []*config.SyncItem{item}
+	// Filter items by the selection
+	itemsToSync, err := selector.selectItems(localConfig, syncItems, args)
+	if err != nil {
+		return err
 	}
 
 	// Check for conflicts if not forced
 	if !force {
-		conflicts, err := checkForConflicts(localConfig, itemsToSync)
+		conflicts, err := checkForConflicts(localConfig, syncItems, itemsToSync, resolveCopies)
 		if err != nil {
 			return fmt.Errorf("failed to check for conflicts: %w", err)
 		}
@@ -1060,23 +1264,29 @@ func performSyncWithConflictCheck(operation sync.SyncOperation, args []string, f
 			fmt.Printf("💡 Options:\n")
 			fmt.Printf("   • Run 'syncstation sync' to see detailed conflict information\n")
 			fmt.Printf("   • Use 'syncstation %s --force' to proceed anyway\n", operationName)
-			fmt.Printf("   • Resolve conflicts manually first\n")
+			fmt.Printf("   • Merge conflict copies into the local files, then use 'syncstation %s --resolve-copies' to delete them\n", operationName)
+			fmt.Printf("   • Resolve conflicts manually first, merging and deleting conflict copies\n")
 			return fmt.Errorf("operation cancelled due to conflicts")
 		}
 	}
 
-	return performSync(operation, args)
+	return syncSelectedItems(localConfig, repo, operation, args, selector, resolveCopies)
 }
 
-func performSync(operation sync.SyncOperation, args []string) error {
-	// Load configuration
-	localConfig, err := loadConfig()
+func performSync(operation sync.SyncOperation, args []string, selector *itemSelector) error {
+	// Load configuration and bring the git repository of git mode up to date
+	localConfig, repo, err := loadConfigForSync()
 	if err != nil {
 		return err
 	}
+	return syncSelectedItems(localConfig, repo, operation, args, selector, false)
+}
 
+// syncSelectedItems syncs the selected items and, in git mode, commits and pushes the changes.
+// With resolveCopies, pushes and pulls resolve provider conflict copies by deleting them.
+func syncSelectedItems(localConfig *config.LocalConfig, repo *gitrepo.Repo, operation sync.SyncOperation, args []string, selector *itemSelector, resolveCopies bool) error {
 	// Load sync items
-	syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+	syncItems, err := config.LoadSyncItemsData(localConfig)
 	if err != nil {
 		return fmt.Errorf("failed to load sync items: %w", err)
 	}
@@ -1087,18 +1297,22 @@ func performSync(operation sync.SyncOperation, args []string) error {
 	}
 
 	// Create sync engine
-	diffEngine := diff.NewDiffEngine()
+	diffEngine := newDiffEngine(localConfig, nil)
 	syncEngine := sync.NewSyncEngine(localConfig, diffEngine)
+	if repo != nil {
+		syncEngine.SetGitCallback(repo.OperationCallback)
+		syncEngine.SetGitSafeCallback(repo.SafeOperationCallback)
+	}
+	syncEngine.SetResolveConflictCopies(resolveCopies && operation != sync.SyncSmart)
 
-	// Filter items if specific item requested
-	itemsToSync := syncItems.SyncItems
-	if len(args) > 0 {
-		itemName := args[0]
-		item := syncItems.FindSyncItem(itemName)
-		if item == nil {
-			return fmt.Errorf("sync item not found: %s", itemName)
-		}
-		itemsToSync = []*config.SyncItem{item}
+	// Filter items by the selection
+	itemsToSync, err := selector.selectItems(localConfig, syncItems, args)
+	if err != nil {
+		return err
+	}
+	if len(itemsToSync) == 0 {
+		fmt.Println("📭 No sync items selected")
+		return nil
 	}
 
 	// Show operation header
@@ -1116,7 +1330,7 @@ func performSync(operation sync.SyncOperation, args []string) error {
 	fmt.Printf("%s %s - %d items\n\n", operationIcon, operationName, len(itemsToSync))
 
 	if dryRun {
-		fmt.Println("🔍 DRY RUN MODE - No changes will be made\n")
+		fmt.Print("🔍 DRY RUN MODE - No changes will be made\n\n")
 	}
 
 	// Perform sync
@@ -1125,12 +1339,33 @@ func performSync(operation sync.SyncOperation, args []string) error {
 		return fmt.Errorf("sync failed: %w", err)
 	}
 
+	if !dryRun {
+		if err := config.RecordComputerSeen(localConfig); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to update computer info: %v", err))
+		}
+	}
+
+	// Share the changes through the git remote
+	gitLines := finishGitSync(repo, result)
+
 	// Display results
 	if result.Success {
 		fmt.Printf("✅ %s\n", result.Message)
 	} else {
 		fmt.Printf("⚠️  %s\n", result.Message)
 	}
+	for _, line := range gitLines {
+		fmt.Println(line)
+	}
+	for _, outcome := range result.Files {
+		if outcome.Action == "resolved" {
+			fmt.Printf("🧹 %s: %s\n", outcome.ItemName, outcome.Message)
+		}
+	}
+
+	if len(result.Hooks) > 0 {
+		printHookRuns(result.Hooks)
+	}
 
 	if len(result.Errors) > 0 {
 		fmt.Println("\n❌ Errors:")
@@ -1167,6 +1402,22 @@ func getConfigDir() string {
 	}
 }
 
+// newDiffEngine creates a diff engine that compares the plaintext of encrypted cloud copies
+// and, for templates, their rendering for this computer. item may be nil.
+func newDiffEngine(localConfig *config.LocalConfig, item *config.SyncItem) *diff.DiffEngine {
+	diffEngine := diff.NewDiffEngine()
+	diffEngine.SetCloudDecoder(sync.CloudDecoder(localConfig, item))
+	diffEngine.SetStorage(sync.ItemStorage(localConfig, item))
+	if item != nil {
+		diffEngine.SetExclude(item.IsExcluded)
+	}
+	return diffEngine
+}
+
+func getFileStatesPath() string {
+	return filepath.Join(getConfigDir(), "file-states.json")
+}
+
 func getComputerID() string {
 	// Try hostname first
 	if hostname, err := os.Hostname(); err == nil && hostname != "" {
@@ -1177,26 +1428,6 @@ func getComputerID() string {
 	return fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH)
 }
 
-func isGitRepository(path string) bool {
-	gitDir := filepath.Join(path, ".git")
-	return config.PathExists(gitDir)
-}
-
-func findGitRoot(path string) string {
-	current := path
-	for {
-		if isGitRepository(current) {
-			return current
-		}
-		parent := filepath.Dir(current)
-		if parent == current {
-			break
-		}
-		current = parent
-	}
-	return path
-}
-
 func getPathStatus(path string) string {
 	if path == "" {
 		return "❌ Not configured"
@@ -1210,6 +1441,15 @@ func getPathStatus(path string) string {
 	return fmt.Sprintf("✅ %s", expandedPath)
 }
 
+// getCloudStatus describes whether the cloud copy of an item exists
+func getCloudStatus(localConfig *config.LocalConfig, item *config.SyncItem) string {
+	cloudStorage, key := sync.ItemStorage(localConfig, item), item.CloudKey()
+	if !storage.Exists(cloudStorage, key) {
+		return fmt.Sprintf("❌ Missing: %s", cloudStorage.Location(key))
+	}
+	return fmt.Sprintf("✅ %s", cloudStorage.Location(key))
+}
+
 func getStatusIcon(status string) string {
 	switch status {
 	case "same":
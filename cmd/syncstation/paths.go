@@ -0,0 +1,129 @@
+package syncstation
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+func pathsCmd() *cobra.Command {
+	var rules []string
+	var removeRules []string
+
+	cmd := &cobra.Command{
+		Use:   "paths <item-name>",
+		Short: "Show or set the default paths of an item",
+		Long: `Show the explicit paths, default path rules and resolved path of every computer
+for an item, or change its path rules.
+
+Computers without an explicit path use the most specific matching rule, so new computers
+work right after 'syncstation init'. Rule keys are an OS (linux, darwin, windows),
+tag:<tag>, tag:<tag>:<os> or * for any computer. Paths may use ~ and $VARIABLES,
+which are expanded on each computer.
+
+Example:
+  syncstation paths "Neovim Config" --rule linux='~/.config/nvim' \
+    --rule darwin='~/.config/nvim' --rule windows='$LOCALAPPDATA/nvim'`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			// Update rules if requested
+			if len(rules) > 0 || len(removeRules) > 0 {
+				var pathRules []config.PathRule
+				for _, value := range rules {
+					rule, err := config.ParsePathRule(value)
+					if err != nil {
+						return err
+					}
+					pathRules = append(pathRules, rule)
+				}
+
+				var syncItems *config.SyncItemsData
+				var item *config.SyncItem
+				err := config.UpdateSyncItemsData(localConfig, func(updated *config.SyncItemsData) error {
+					syncItems, item = updated, updated.FindSyncItem(args[0])
+					if item == nil {
+						return fmt.Errorf("sync item not found: %s", args[0])
+					}
+					for _, key := range removeRules {
+						if !item.RemovePathRule(key) {
+							return fmt.Errorf("no path rule for %s", key)
+						}
+					}
+					for _, rule := range pathRules {
+						item.SetPathRule(rule)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("✅ Updated path rules of %s\n\n", item.Name)
+				printItemPaths(localConfig, syncItems, item)
+				return nil
+			}
+
+			syncItems, err := config.LoadSyncItemsData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load sync items: %w", err)
+			}
+
+			item := syncItems.FindSyncItem(args[0])
+			if item == nil {
+				return fmt.Errorf("sync item not found: %s", args[0])
+			}
+
+			printItemPaths(localConfig, syncItems, item)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&rules, "rule", []string{}, "Add or replace a path rule (<key>=<path>)")
+	cmd.Flags().StringArrayVar(&removeRules, "remove-rule", []string{}, "Remove the path rule with the given key")
+	return cmd
+}
+
+// printItemPaths prints the explicit paths, path rules and resolved path per computer of an item
+func printItemPaths(localConfig *config.LocalConfig, syncItems *config.SyncItemsData, item *config.SyncItem) {
+	fmt.Printf("📦 %s (%s)\n", item.Name, item.Type)
+
+	fmt.Printf("\n🧭 Path rules\n")
+	if len(item.PathRules) == 0 {
+		fmt.Printf("   (none)\n")
+	}
+	for _, rule := range item.PathRules {
+		fmt.Printf("   %s: %s\n", rule, rule.Path)
+	}
+
+	fmt.Printf("\n💻 Computers\n")
+	for _, computerID := range syncItems.ComputerIDs() {
+		marker := "  "
+		if computerID == localConfig.CurrentComputer {
+			marker = "▶ "
+		}
+
+		path, explicit := item.Paths[computerID]
+		switch {
+		case explicit && path == "":
+			fmt.Printf("%s%s: disabled\n", marker, computerID)
+		case explicit:
+			fmt.Printf("%s%s: %s\n", marker, computerID, path)
+		case item.MatchPathRule(computerID) != nil:
+			rule := item.MatchPathRule(computerID)
+			resolved := rule.Path
+			if computerID == localConfig.CurrentComputer {
+				resolved = item.GetCurrentComputerPath(computerID)
+			}
+			fmt.Printf("%s%s: %s (rule %s)\n", marker, computerID, resolved, rule)
+		default:
+			fmt.Printf("%s%s: not configured\n", marker, computerID)
+		}
+	}
+}
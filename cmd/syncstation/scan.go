@@ -0,0 +1,188 @@
+package syncstation
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/encryption"
+	"github.com/AntoineArt/syncstation/internal/secrets"
+)
+
+func scanCmd() *cobra.Command {
+	var setPolicy string
+	var addPatterns []string
+
+	cmd := &cobra.Command{
+		Use:   "scan [item-name]",
+		Short: "Scan items for secrets",
+		Long: `Scan the local files of sync items for secrets such as API tokens, private keys
+and high-entropy strings. The same scan runs before every push and applies the
+item's policy: "warn" pushes and reports, "block" refuses to push, "encrypt" pushes
+the item encrypted, and "off" disables scanning.
+
+Use --set-policy to change the policy of an item, or the default policy of this
+computer when no item is given. Add a "syncstation:ignore" comment to a line to
+exclude it from scanning.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			syncItems, err := config.LoadSyncItemsData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load sync items: %w", err)
+			}
+
+			// Filter items if specific item requested
+			itemsToScan := syncItems.SyncItems
+			if len(args) > 0 {
+				item := syncItems.FindSyncItem(args[0])
+				if item == nil {
+					return fmt.Errorf("sync item not found: %s", args[0])
+				}
+				itemsToScan = []*config.SyncItem{item}
+			}
+
+			// Update policies and patterns
+			if setPolicy != "" || len(addPatterns) > 0 {
+				return updateScanSettings(localConfig, args, setPolicy, addPatterns)
+			}
+
+			if len(itemsToScan) == 0 {
+				fmt.Println("📭 No sync items configured")
+				return nil
+			}
+
+			codec := encryption.NewCodec(localConfig)
+			total := 0
+
+			fmt.Printf("🔍 Scanning %d items for secrets\n\n", len(itemsToScan))
+			for _, item := range itemsToScan {
+				policy := getSecretPolicy(localConfig, item)
+				localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
+
+				if localPath == "" || !config.PathExists(localPath) {
+					fmt.Printf("⏭️  %s: no local files on this computer\n", item.Name)
+					continue
+				}
+
+				scanner, err := secrets.NewDefaultScanner(item.SecretPatterns)
+				if err != nil {
+					fmt.Printf("❌ %s: %v\n", item.Name, err)
+					continue
+				}
+				scanner.SetExclude(item.IsExcluded)
+
+				findings, err := scanner.ScanPath(localPath)
+				if err != nil {
+					fmt.Printf("❌ %s: failed to scan: %v\n", item.Name, err)
+					continue
+				}
+
+				if len(findings) == 0 {
+					fmt.Printf("✅ %s: no secrets found\n", item.Name)
+					continue
+				}
+
+				total += len(findings)
+				fmt.Printf("🔑 %s (policy: %s)\n", item.Name, policy)
+				for _, finding := range findings {
+					path := finding.Path
+					if rel, err := filepath.Rel(localPath, path); err == nil && rel != "." {
+						path = rel
+					}
+					fmt.Printf("   %s:%d  %s  %s\n", path, finding.Line, finding.Reason, finding.Match)
+				}
+				if codec.ShouldEncrypt(item) {
+					fmt.Printf("   🔒 Cloud copy is encrypted\n")
+				}
+				fmt.Println()
+			}
+
+			if total > 0 {
+				fmt.Printf("💡 Add '%s' to a line to ignore it, or change the policy with --set-policy\n", secrets.IgnoreMarker)
+				return fmt.Errorf("found %d possible secrets", total)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&setPolicy, "set-policy", "", "Set the secret policy (off, warn, block, encrypt) of the item, or of this computer")
+	cmd.Flags().StringSliceVar(&addPatterns, "add-pattern", []string{}, "Add a custom secret regex to the item")
+	return cmd
+}
+
+// updateScanSettings changes the secret policy and custom patterns of an item or this computer
+func updateScanSettings(localConfig *config.LocalConfig, args []string, policy string, patterns []string) error {
+	if policy != "" && !secrets.ValidPolicy(policy) {
+		return fmt.Errorf("invalid policy %q: use off, warn, block or encrypt", policy)
+	}
+
+	// Without an item, set the default policy of this computer
+	if len(args) == 0 {
+		if len(patterns) > 0 {
+			return fmt.Errorf("custom patterns are set per item")
+		}
+
+		// Reload from disk so flag overrides such as --computer are not persisted
+		configPath := filepath.Join(getConfigDir(), "config.json")
+		storedConfig, err := config.LoadLocalConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		storedConfig.SecretPolicy = policy
+		if err := storedConfig.SaveLocalConfig(configPath); err != nil {
+			return fmt.Errorf("failed to save local config: %w", err)
+		}
+
+		fmt.Printf("✅ Default secret policy on %s: %s\n", localConfig.CurrentComputer, policy)
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		if _, err := secrets.NewDefaultScanner([]string{pattern}); err != nil {
+			return err
+		}
+	}
+
+	var item config.SyncItem
+	err := config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+		found := syncItems.FindSyncItem(args[0])
+		if found == nil {
+			return fmt.Errorf("sync item not found: %s", args[0])
+		}
+		found.SecretPatterns = append(found.SecretPatterns, patterns...)
+		if policy != "" {
+			found.SecretPolicy = policy
+		}
+		item = *found
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ %s: secret policy %s", item.Name, getSecretPolicy(localConfig, &item))
+	if len(item.SecretPatterns) > 0 {
+		fmt.Printf(", %d custom patterns", len(item.SecretPatterns))
+	}
+	fmt.Println()
+	return nil
+}
+
+// getSecretPolicy returns the secret policy of an item, falling back to the local default
+func getSecretPolicy(localConfig *config.LocalConfig, item *config.SyncItem) string {
+	if item.SecretPolicy != "" {
+		return item.SecretPolicy
+	}
+	if localConfig.SecretPolicy != "" {
+		return localConfig.SecretPolicy
+	}
+	return secrets.DefaultPolicy
+}
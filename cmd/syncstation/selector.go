@@ -0,0 +1,71 @@
+package syncstation
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+// itemSelector holds the item selection flags shared by sync, push, pull, status, list and remove
+type itemSelector struct {
+	tags        []string
+	onlyPending bool
+}
+
+// addSelectorFlags registers the item selection flags on a command
+func addSelectorFlags(cmd *cobra.Command, selector *itemSelector) {
+	cmd.Flags().StringSliceVar(&selector.tags, "tag", []string{}, "Select items with any of these tags")
+	cmd.Flags().BoolVar(&selector.onlyPending, "only-pending", false, "Select only items with changes to sync")
+}
+
+// isEmpty reports whether no names, globs or tags were given
+func (selector *itemSelector) isEmpty(args []string) bool {
+	return len(args) == 0 && len(selector.tags) == 0
+}
+
+// selectItems returns the items selected by names or globs in args and the selector flags
+func (selector *itemSelector) selectItems(localConfig *config.LocalConfig, syncItems *config.SyncItemsData, args []string) ([]*config.SyncItem, error) {
+	items, err := syncItems.SelectItems(config.ItemSelector{Patterns: args, Tags: selector.tags}, localConfig.CurrentComputer)
+	if err != nil {
+		return nil, err
+	}
+
+	if !selector.onlyPending {
+		return items, nil
+	}
+
+	var pending []*config.SyncItem
+	for _, item := range items {
+		if isItemPending(localConfig, item) {
+			pending = append(pending, item)
+		}
+	}
+	return pending, nil
+}
+
+// isItemPending reports whether an item configured on this computer has changes to sync
+func isItemPending(localConfig *config.LocalConfig, item *config.SyncItem) bool {
+	localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
+	if localPath == "" {
+		return false
+	}
+
+	cloudKey := item.CloudKey()
+	localExists, cloudExists := config.PathExists(localPath), storage.Exists(sync.ItemStorage(localConfig, item), cloudKey)
+	if !localExists || !cloudExists {
+		return localExists || cloudExists
+	}
+
+	diffs, err := newDiffEngine(localConfig, item).GetSyncItemDiff(localPath, cloudKey)
+	if err != nil {
+		return true // Let the sync report the error
+	}
+	for _, fileDiff := range diffs {
+		if fileDiff.Status != "same" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package syncstation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+func TestSelectItemsOnlyPending(t *testing.T) {
+	localConfig := &config.LocalConfig{CloudSyncDir: t.TempDir(), CurrentComputer: "laptop"}
+	localDir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	syncItems := &config.SyncItemsData{Computers: map[string]*config.ComputerInfo{}}
+	addItem := func(name, local, cloud string, tags ...string) {
+		item := &config.SyncItem{Name: name, Type: "file", Paths: map[string]string{"laptop": filepath.Join(localDir, name)}, Tags: tags}
+		if local != "" {
+			write(item.Paths["laptop"], local)
+		}
+		if cloud != "" {
+			write(item.GetCloudPath(localConfig.GetCloudConfigsPath()), cloud)
+		}
+		syncItems.SyncItems = append(syncItems.SyncItems, item)
+	}
+	addItem("same", "set number", "set number", "editor")
+	addItem("changed", "set number", "set nonumber", "editor")
+	addItem("local-only", "alias ll='ls -l'", "", "shell")
+	addItem("cloud-only", "", "export EDITOR=nvim", "shell")
+	addItem("missing", "", "")
+	syncItems.SyncItems = append(syncItems.SyncItems, &config.SyncItem{Name: "elsewhere", Type: "file", Paths: map[string]string{"desktop": "/b"}})
+	write((&config.SyncItem{Name: "elsewhere"}).GetCloudPath(localConfig.GetCloudConfigsPath()), "desktop only")
+
+	tests := []struct {
+		name     string
+		selector itemSelector
+		args     []string
+		want     []string
+	}{
+		{name: "every item", want: []string{"same", "changed", "local-only", "cloud-only", "missing", "elsewhere"}},
+		{name: "only pending", selector: itemSelector{onlyPending: true}, want: []string{"changed", "local-only", "cloud-only"}},
+		{name: "pending among a tag", selector: itemSelector{tags: []string{"editor"}, onlyPending: true}, want: []string{"changed"}},
+		{name: "pending among names", selector: itemSelector{onlyPending: true}, args: []string{"same", "*-only"}, want: []string{"local-only", "cloud-only"}},
+		{name: "nothing pending", selector: itemSelector{onlyPending: true}, args: []string{"same", "missing", "elsewhere"}, want: []string{}},
+	}
+	for _, test := range tests {
+		items, err := test.selector.selectItems(localConfig, syncItems, test.args)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		names := []string{}
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%s: selected %v, want %v", test.name, names, test.want)
+		}
+	}
+}
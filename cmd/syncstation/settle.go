@@ -0,0 +1,50 @@
+package syncstation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+// noSettle skips the wait for the cloud drive client before a sync
+var noSettle bool
+
+// addSettleFlag adds the flag skipping the settle check to a sync command
+func addSettleFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&noSettle, "no-settle", false, "Sync without waiting for the cloud drive client to finish syncing")
+}
+
+// waitForCloudSettle waits until the cloud drive client has finished syncing the cloud
+// directory, so that a sync right after a laptop wakes doesn't read stale files
+func waitForCloudSettle(localConfig *config.LocalConfig) error {
+	if noSettle {
+		return nil
+	}
+
+	waiting := false
+	err := sync.WaitForSettle(localConfig, func(activity sync.CloudActivity) {
+		if waiting {
+			return
+		}
+		waiting = true
+		if len(activity.Pending) > 0 {
+			fmt.Printf("⏳ Waiting for the cloud drive client to download %d files...\n", len(activity.Pending))
+		} else {
+			fmt.Println("⏳ Waiting for the cloud drive client to finish syncing...")
+		}
+	})
+	if errors.Is(err, sync.ErrNotSettled) {
+		return fmt.Errorf("%w\n💡 Run again once it is done, or use --no-settle to sync anyway", err)
+	}
+	if err != nil {
+		return err
+	}
+	if waiting {
+		fmt.Print("✅ Cloud directory is up to date\n\n")
+	}
+	return nil
+}
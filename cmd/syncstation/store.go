@@ -0,0 +1,219 @@
+package syncstation
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/objects"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+func storeCmd() *cobra.Command {
+	var mode string
+
+	cmd := &cobra.Command{
+		Use:   "store <item-name...>",
+		Short: "Show or change how the cloud copy of items is stored",
+		Long: `Show or change how the cloud copy of folder items is stored.
+
+In files mode (the default) the cloud copy is a tree of files. In objects mode
+the files are kept in a content-addressed object store, compressed with zstd
+and named after their SHA-256, and the item becomes a manifest of paths to
+hashes. Identical files are stored once across items and versions, unchanged
+files are never uploaded again and every push keeps the previous manifest in
+the item history (see 'syncstation history').
+
+The cloud copy is converted at once. Encrypted items, templates and items
+deployed as a symlink can't use the object store.
+
+Example:
+  syncstation store "VS Code Extensions" "Fonts" --mode objects`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			syncItems, err := config.LoadSyncItemsData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load sync items: %w", err)
+			}
+
+			items, err := syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer)
+			if err != nil {
+				return err
+			}
+
+			if mode != "" {
+				if mode != config.StoreFiles && mode != config.StoreObjects {
+					return fmt.Errorf("invalid store mode %q: use files or objects", mode)
+				}
+				conflictCopies := syncItems.NewConflictCopyFinder()
+				for _, item := range items {
+					if mode == config.StoreObjects {
+						if err := sync.CheckObjectStore(localConfig, item); err != nil {
+							return err
+						}
+					}
+					// Conflict copies would be stored as files of their own
+					copies, err := conflictCopies.Find(sync.ItemStorage(localConfig, item), item)
+					if err != nil {
+						return fmt.Errorf("failed to look for conflict copies of %s: %w", item.Name, err)
+					}
+					if len(copies) > 0 {
+						return fmt.Errorf("%s has %s conflict copy %s: resolve it first", item.Name, copies[0].Provider, copies[0].Key)
+					}
+				}
+
+				changed := 0
+				for _, item := range items {
+					if item.UsesObjectStore() == (mode == config.StoreObjects) {
+						continue
+					}
+					if err := convertItemStore(localConfig, item, mode); err != nil {
+						return err
+					}
+					changed++
+				}
+				fmt.Printf("✅ Converted the cloud copy of %d items\n\n", changed)
+			}
+
+			for _, item := range items {
+				if !item.UsesObjectStore() {
+					fmt.Printf("📄 %s: files\n", item.Name)
+					continue
+				}
+				versions, err := objects.History(localConfig.CloudStorage(), item.CloudKey())
+				if err != nil || len(versions) == 0 {
+					fmt.Printf("🧱 %s: objects\n", item.Name)
+					continue
+				}
+				latest := versions[len(versions)-1]
+				fmt.Printf("🧱 %s: objects (%d files, %s, %d versions)\n", item.Name, latest.Files, formatSize(latest.Size), len(versions))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&mode, "mode", "", "Store mode: files or objects")
+	return cmd
+}
+
+// convertItemStore moves the cloud copy of an item to the files or objects store mode. The
+// new copy is complete before the item is switched to it, and the old one is only deleted
+// once the item is saved, so a failure leaves the item usable.
+func convertItemStore(localConfig *config.LocalConfig, item *config.SyncItem, mode string) error {
+	cloudStorage := localConfig.CloudStorage()
+	var cleanup func() error
+	if mode == config.StoreObjects {
+		if err := objects.Import(cloudStorage, item.CloudKey()); err != nil {
+			return fmt.Errorf("failed to move %s to the object store: %w", item.Name, err)
+		}
+		item.Store = config.StoreObjects
+		cleanup = func() error { return cloudStorage.Delete(item.CloudKey()) }
+	} else {
+		if err := objects.Export(cloudStorage, item.CloudKey()); err != nil {
+			return fmt.Errorf("failed to move %s out of the object store: %w", item.Name, err)
+		}
+		item.Store = "" // files is the default
+		cleanup = func() error { return objects.Remove(cloudStorage, item.CloudKey()) }
+	}
+
+	_, err := config.UpdateSyncItem(localConfig, item.Name, func(saved *config.SyncItem) error {
+		saved.Store = item.Store
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := cleanup(); err != nil {
+		fmt.Printf("⚠️  Warning: failed to delete the previous cloud copy of %s: %v\n", item.Name, err)
+	}
+	return nil
+}
+
+func historyCmd() *cobra.Command {
+	var restore string
+
+	cmd := &cobra.Command{
+		Use:   "history <item-name>",
+		Short: "Show or restore the versions of an item in the object store",
+		Long: `Show the versions of an item kept in the object store, one for each push
+that changed it, or make an earlier version the current cloud copy. Restoring
+only changes the cloud copy: pull the item to apply it on this computer.
+
+Example:
+  syncstation history "Fonts"
+  syncstation history "Fonts" --restore 20260102-150405.000
+  syncstation pull "Fonts"`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			syncItems, err := config.LoadSyncItemsData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load sync items: %w", err)
+			}
+			item := syncItems.FindSyncItem(args[0])
+			if item == nil {
+				return fmt.Errorf("sync item not found: %s", args[0])
+			}
+			if !item.UsesObjectStore() {
+				return fmt.Errorf("%s is not kept in the object store. Move it there with 'syncstation store \"%s\" --mode objects'", item.Name, item.Name)
+			}
+
+			cloudStorage := localConfig.CloudStorage()
+			if restore != "" {
+				if err := objects.Restore(cloudStorage, item.CloudKey(), restore); err != nil {
+					return fmt.Errorf("failed to restore %s: %w", item.Name, err)
+				}
+				fmt.Printf("✅ Restored %s to version %s\n", item.Name, restore)
+				fmt.Printf("💡 Run 'syncstation pull \"%s\"' to apply it on this computer\n", item.Name)
+				return nil
+			}
+
+			versions, err := objects.History(cloudStorage, item.CloudKey())
+			if err != nil {
+				return fmt.Errorf("failed to read the history of %s: %w", item.Name, err)
+			}
+			if len(versions) == 0 {
+				fmt.Printf("📭 No versions of %s yet\n", item.Name)
+				return nil
+			}
+
+			fmt.Printf("🕘 %s - %d versions\n\n", item.Name, len(versions))
+			for i, version := range versions {
+				current := ""
+				if i == len(versions)-1 {
+					current = " (latest)"
+				}
+				fmt.Printf("   %s  %s  %d files, %s%s\n", version.Name, version.Time.Local().Format("2006-01-02 15:04:05"),
+					version.Files, formatSize(version.Size), current)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&restore, "restore", "", "Make this version the current cloud copy")
+	return cmd
+}
+
+// formatSize describes a size in bytes with a binary unit
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,146 @@
+package syncstation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+func tagsCmd() *cobra.Command {
+	var add []string
+	var remove []string
+
+	cmd := &cobra.Command{
+		Use:   "tags [item-name...]",
+		Short: "Show or change item tags",
+		Long: `Show every tag in use, or show and change the tags of items selected by name or
+glob. Tags select items in sync, push, pull, status, list and remove with --tag,
+and computers can subscribe to tags with 'syncstation computers set --subscribe'.
+
+Example:
+  syncstation tags "Bash Config" "Zsh Config" --add shell
+  syncstation sync --tag shell`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 0 {
+				if len(add) > 0 || len(remove) > 0 {
+					return fmt.Errorf("specify the items to tag by name or glob")
+				}
+				syncItems, err := config.LoadSyncItemsData(localConfig)
+				if err != nil {
+					return fmt.Errorf("failed to load sync items: %w", err)
+				}
+				printTags(localConfig, syncItems)
+				return nil
+			}
+
+			var items []*config.SyncItem
+			if len(add) > 0 || len(remove) > 0 {
+				err = config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+					var err error
+					if items, err = syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer); err != nil {
+						return err
+					}
+					for _, item := range items {
+						item.Tags = addTags(item.Tags, add)
+						for _, tag := range remove {
+							item.Tags = removeString(item.Tags, tag)
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("✅ Updated tags of %d items\n\n", len(items))
+			} else {
+				syncItems, err := config.LoadSyncItemsData(localConfig)
+				if err != nil {
+					return fmt.Errorf("failed to load sync items: %w", err)
+				}
+				if items, err = syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer); err != nil {
+					return err
+				}
+			}
+
+			for _, item := range items {
+				tags := "(none)"
+				if len(item.Tags) > 0 {
+					tags = strings.Join(item.Tags, ", ")
+				}
+				fmt.Printf("🏷️  %s: %s\n", item.Name, tags)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&add, "add", []string{}, "Add tags to the items")
+	cmd.Flags().StringSliceVar(&remove, "remove", []string{}, "Remove tags from the items")
+	return cmd
+}
+
+// printTags prints every item tag with its item count and whether this computer subscribes to it
+func printTags(localConfig *config.LocalConfig, syncItems *config.SyncItemsData) {
+	tags := syncItems.ItemTags()
+	if len(tags) == 0 {
+		fmt.Println("📭 No tags in use")
+		fmt.Println("💡 Tag items with: syncstation tags \"Name\" --add shell")
+		return
+	}
+
+	var subscriptions []string
+	if info := syncItems.GetComputer(localConfig.CurrentComputer); info != nil {
+		subscriptions = info.Subscriptions
+	}
+
+	fmt.Printf("🏷️  Tags (%d total)\n\n", len(tags))
+	for _, tag := range tags {
+		count := 0
+		for _, item := range syncItems.SyncItems {
+			if item.HasTag(tag) {
+				count++
+			}
+		}
+
+		marker := "  "
+		for _, subscribed := range subscriptions {
+			if subscribed == tag {
+				marker = "▶ "
+			}
+		}
+		fmt.Printf("%s%s (%d items)\n", marker, tag, count)
+	}
+
+	if len(subscriptions) > 0 {
+		fmt.Printf("\n💻 This computer only syncs untagged items and items tagged: %s\n", strings.Join(subscriptions, ", "))
+	}
+}
+
+// addTags returns values with the new tags appended, skipping empty and duplicate tags
+func addTags(values []string, tags []string) []string {
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		exists := false
+		for _, existing := range values {
+			if existing == tag {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			values = append(values, tag)
+		}
+	}
+	return values
+}
@@ -0,0 +1,409 @@
+package syncstation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/encryption"
+	"github.com/AntoineArt/syncstation/internal/storage"
+	"github.com/AntoineArt/syncstation/internal/sync"
+	"github.com/AntoineArt/syncstation/internal/templating"
+)
+
+func templateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Manage per-computer templates",
+		Long: `Template items store a Go text/template in the cloud instead of a plain copy.
+On pull the template is rendered for this computer; on push local edits to
+literal lines are carried back into the template.
+
+Templates can use {{ .Computer }}, {{ .Hostname }}, {{ .OS }}, {{ .Arch }},
+{{ .User }}, {{ .Home }}, {{ .Vars.<name> }} and {{ env "NAME" }}. Variables
+set on the computer with 'syncstation computers set' are available to every
+template; item variables take precedence.`,
+	}
+
+	cmd.AddCommand(templateEnableCmd())
+	cmd.AddCommand(templateDisableCmd())
+	cmd.AddCommand(templateVarsCmd())
+	cmd.AddCommand(templateShowCmd())
+	cmd.AddCommand(templateEditCmd())
+	return cmd
+}
+
+func templateEnableCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "enable <item-name>",
+		Short: "Store an item as a template",
+		Long: `Mark an item as a template. The current cloud copy becomes the template;
+use 'syncstation template edit' to add template actions to it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			item, err := config.UpdateSyncItem(localConfig, args[0], func(item *config.SyncItem) error {
+				if item.Type != "file" {
+					return fmt.Errorf("templates are only supported for file items")
+				}
+				if item.Deploy == config.DeployLink {
+					return fmt.Errorf("templates are not supported for items deployed as a symlink")
+				}
+				item.Template = true
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ %s is now a template\n", item.Name)
+			fmt.Printf("💡 Edit it with 'syncstation template edit %s'\n", item.Name)
+			return nil
+		},
+	}
+}
+
+func templateDisableCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable <item-name>",
+		Short: "Replace a template with its rendering for this computer",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, item, err := loadTemplateItem(args[0])
+			if err != nil {
+				return err
+			}
+			if !item.Template {
+				return fmt.Errorf("%s is not a template", item.Name)
+			}
+
+			// Render the cloud copy so other computers get this computer's version
+			data := sync.TemplateData(localConfig, item)
+			err = rewriteTemplate(localConfig, item, func(content []byte) ([]byte, error) {
+				return templating.Render(item.Name, content, data)
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = config.UpdateSyncItem(localConfig, item.Name, func(item *config.SyncItem) error {
+				item.Template = false
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ %s is no longer a template (rendered for %s)\n", item.Name, localConfig.CurrentComputer)
+			return nil
+		},
+	}
+}
+
+func templateVarsCmd() *cobra.Command {
+	var unset []string
+
+	cmd := &cobra.Command{
+		Use:   "vars <item-name> [name=value...]",
+		Short: "Show or set the template variables of this computer",
+		Long: `Show the template variables of every computer for an item, or set variables
+for this computer (or the one given with --computer).
+
+Example:
+  syncstation template vars "Git Config" email=me@work.com signingkey=ABC123`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, item, err := loadTemplateItem(args[0])
+			if err != nil {
+				return err
+			}
+
+			// Show variables when nothing is being changed
+			if len(args) == 1 && len(unset) == 0 {
+				printTemplateVars(item, localConfig.CurrentComputer)
+				return nil
+			}
+
+			assignments, err := parseTemplateVars(args[1:])
+			if err != nil {
+				return err
+			}
+			item, err = config.UpdateSyncItem(localConfig, item.Name, func(item *config.SyncItem) error {
+				setTemplateVars(item, localConfig.CurrentComputer, assignments)
+				for _, name := range unset {
+					delete(item.Vars[localConfig.CurrentComputer], name)
+				}
+				if len(item.Vars[localConfig.CurrentComputer]) == 0 {
+					delete(item.Vars, localConfig.CurrentComputer)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ Updated template variables of %s on %s\n", item.Name, localConfig.CurrentComputer)
+			if item.Template {
+				fmt.Printf("💡 Run 'syncstation pull %s' to render the file again\n", item.Name)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&unset, "unset", []string{}, "Remove variables")
+	return cmd
+}
+
+func templateShowCmd() *cobra.Command {
+	var raw bool
+
+	cmd := &cobra.Command{
+		Use:   "show <item-name>",
+		Short: "Show a template rendered for this computer",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, item, err := loadTemplateItem(args[0])
+			if err != nil {
+				return err
+			}
+
+			content, err := readTemplate(localConfig, item)
+			if err != nil {
+				return err
+			}
+
+			if !raw {
+				data := sync.TemplateData(localConfig, item)
+				if content, err = templating.Render(item.Name, content, data); err != nil {
+					return err
+				}
+			}
+
+			fmt.Print(string(content))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&raw, "raw", false, "Show the template instead of its rendering")
+	return cmd
+}
+
+func templateEditCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "edit <item-name>",
+		Short: "Edit a template in $EDITOR",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, item, err := loadTemplateItem(args[0])
+			if err != nil {
+				return err
+			}
+			if !item.Template {
+				return fmt.Errorf("%s is not a template. Run 'syncstation template enable %s' first", item.Name, item.Name)
+			}
+
+			content, err := readTemplate(localConfig, item)
+			if err != nil {
+				return err
+			}
+
+			edited, err := editContent(item.Name, content)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(edited, content) {
+				fmt.Println("ℹ️  Template unchanged")
+				return nil
+			}
+
+			// Refuse templates that don't render on this computer
+			data := sync.TemplateData(localConfig, item)
+			if _, err := templating.Render(item.Name, edited, data); err != nil {
+				return fmt.Errorf("template not saved: %w", err)
+			}
+
+			err = rewriteTemplate(localConfig, item, func(content []byte) ([]byte, error) {
+				return edited, nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ Updated template of %s\n", item.Name)
+			fmt.Printf("💡 Run 'syncstation pull %s' to render it on this computer\n", item.Name)
+			return nil
+		},
+	}
+}
+
+// loadTemplateItem loads the config and the named sync item
+func loadTemplateItem(name string) (*config.LocalConfig, *config.SyncItem, error) {
+	localConfig, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	syncItems, err := config.LoadSyncItemsData(localConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sync items: %w", err)
+	}
+
+	item := syncItems.FindSyncItem(name)
+	if item == nil {
+		return nil, nil, fmt.Errorf("sync item not found: %s", name)
+	}
+
+	return localConfig, item, nil
+}
+
+// readTemplate reads the decrypted cloud copy of an item
+func readTemplate(localConfig *config.LocalConfig, item *config.SyncItem) ([]byte, error) {
+	cloudStorage := localConfig.CloudStorage()
+	if !storage.Exists(cloudStorage, item.CloudKey()) {
+		return nil, fmt.Errorf("%s has not been pushed yet", item.Name)
+	}
+	return encryption.NewCodec(localConfig).ReadFile(cloudStorage, item.CloudKey())
+}
+
+// rewriteTemplate replaces the cloud copy of an item with transform applied to its
+// plaintext, keeping it encrypted if it was
+func rewriteTemplate(localConfig *config.LocalConfig, item *config.SyncItem, transform func(content []byte) ([]byte, error)) error {
+	cloudStorage := localConfig.CloudStorage()
+	if !storage.Exists(cloudStorage, item.CloudKey()) {
+		return fmt.Errorf("%s has not been pushed yet", item.Name)
+	}
+
+	codec := encryption.NewCodec(localConfig)
+	_, err := encryption.RewriteFiles(cloudStorage, item.CloudKey(), func(data []byte) ([]byte, error) {
+		content, err := codec.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = transform(content); err != nil {
+			return nil, err
+		}
+		if encryption.IsEncrypted(data) {
+			return codec.Encrypt(content)
+		}
+		return codec.Encode(item, content)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update cloud copy of %s: %w", item.Name, err)
+	}
+
+	return nil
+}
+
+// editContent opens content in $VISUAL or $EDITOR and returns the edited content
+func editContent(name string, content []byte) ([]byte, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// Keep the extension so editors pick the right syntax highlighting
+	pattern := "syncstation-template-*" + filepath.Ext(name)
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if err := os.Chmod(file.Name(), 0600); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to protect temporary file: %w", err)
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	fields := strings.Fields(editor)
+	editorCmd := exec.Command(fields[0], append(fields[1:], file.Name())...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+	if err := editorCmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor failed: %w", err)
+	}
+
+	return os.ReadFile(file.Name())
+}
+
+// parseTemplateVars parses name=value assignments
+func parseTemplateVars(assignments []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, assignment := range assignments {
+		name, value, found := strings.Cut(assignment, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid variable %q: use name=value", assignment)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// setTemplateVars sets template variables of an item for a computer
+func setTemplateVars(item *config.SyncItem, computerID string, vars map[string]string) {
+	if len(vars) == 0 {
+		return
+	}
+	if item.Vars == nil {
+		item.Vars = make(map[string]map[string]string)
+	}
+	if item.Vars[computerID] == nil {
+		item.Vars[computerID] = make(map[string]string)
+	}
+	for name, value := range vars {
+		item.Vars[computerID][name] = value
+	}
+}
+
+// printTemplateVars prints the template variables of every computer for an item
+func printTemplateVars(item *config.SyncItem, currentComputer string) {
+	if len(item.Vars) == 0 {
+		fmt.Printf("📭 No template variables for %s\n", item.Name)
+		return
+	}
+
+	computers := make([]string, 0, len(item.Vars))
+	for computerID := range item.Vars {
+		computers = append(computers, computerID)
+	}
+	sort.Strings(computers)
+
+	for _, computerID := range computers {
+		marker := ""
+		if computerID == currentComputer {
+			marker = " (current)"
+		}
+		fmt.Printf("💻 %s%s\n", computerID, marker)
+
+		names := make([]string, 0, len(item.Vars[computerID]))
+		for name := range item.Vars[computerID] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("   %s = %s\n", name, item.Vars[computerID][name])
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package syncstation
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+func trustCmd() *cobra.Command {
+	var revoke bool
+
+	cmd := &cobra.Command{
+		Use:   "trust [item-name...]",
+		Short: "Approve the hooks and validator commands of items on this computer",
+		Long: `Approve the commands of items selected by name or glob to run on this computer,
+or show which commands of every item are approved.
+
+Item hooks and validator commands are stored in the shared sync items, so anyone
+able to write the cloud copy could change them. Each computer only runs the
+commands it approved: a command that is new or was changed is skipped with a
+warning until it is approved here. Commands set with 'syncstation hooks' or
+'syncstation validate' on this computer are approved on it at once. Global hooks
+are local and always run.
+
+Example:
+  syncstation trust                  # Show the commands of every item
+  syncstation trust "Tmux Config"    # Approve the commands of an item
+  syncstation trust "Tmux Config" --revoke`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			syncItems, err := config.LoadSyncItemsData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load sync items: %w", err)
+			}
+
+			if len(args) == 0 {
+				if revoke {
+					return fmt.Errorf("specify the items to revoke by name or glob")
+				}
+				printItemCommands(localConfig, syncItems.SyncItems)
+				return nil
+			}
+
+			items, err := syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer)
+			if err != nil {
+				return err
+			}
+
+			var commands []string
+			for _, item := range items {
+				commands = append(commands, sync.ItemCommands(item)...)
+			}
+			if len(commands) == 0 {
+				fmt.Println("📭 The selected items have no commands")
+				return nil
+			}
+
+			changed, err := updateTrustedCommands(commands, !revoke)
+			if err != nil {
+				return err
+			}
+			if revoke {
+				fmt.Printf("✅ Revoked %d commands\n\n", changed)
+			} else {
+				fmt.Printf("✅ Approved %d commands\n\n", changed)
+			}
+
+			if localConfig, err = loadConfig(); err != nil {
+				return err
+			}
+			printItemCommands(localConfig, items)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&revoke, "revoke", false, "Withdraw the approval of the commands instead")
+	return cmd
+}
+
+// updateTrustedCommands approves or revokes commands in the stored configuration of this
+// computer and returns how many changed
+func updateTrustedCommands(commands []string, trust bool) (int, error) {
+	// Reload from disk so flag overrides such as --computer are not persisted
+	configPath := filepath.Join(getConfigDir(), "config.json")
+	storedConfig, err := config.LoadLocalConfig(configPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	changed := 0
+	for _, command := range commands {
+		if trust && storedConfig.TrustCommand(command) || !trust && storedConfig.DistrustCommand(command) {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	if err := storedConfig.SaveLocalConfig(configPath); err != nil {
+		return 0, fmt.Errorf("failed to save local config: %w", err)
+	}
+	return changed, nil
+}
+
+// printItemCommands prints the commands of items and whether they are approved on this computer
+func printItemCommands(localConfig *config.LocalConfig, items []*config.SyncItem) {
+	found := false
+	for _, item := range items {
+		commands := sync.ItemCommands(item)
+		if len(commands) == 0 {
+			continue
+		}
+		found = true
+		fmt.Printf("🪝 %s\n", item.Name)
+		for _, command := range commands {
+			status := "⚠️  not approved"
+			if localConfig.IsTrusted(command) {
+				status = "✅ approved"
+			}
+			fmt.Printf("   %s: %s\n", status, command)
+		}
+	}
+	if !found {
+		fmt.Println("📭 No item has commands")
+	}
+}
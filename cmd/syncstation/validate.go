@@ -0,0 +1,173 @@
+package syncstation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/sync"
+	"github.com/AntoineArt/syncstation/internal/validation"
+)
+
+func validateCmd() *cobra.Command {
+	var add []string
+	var remove []string
+	var onInvalid string
+
+	cmd := &cobra.Command{
+		Use:   "validate [item-name...]",
+		Short: "Check or set the validators run before a pull",
+		Long: `Check the cloud copy of items with their validators, or change the validators of
+items selected by name or glob.
+
+Pull runs the validators on the incoming version before it replaces the local files.
+A validator is a built-in parser (json, yaml, toml, ini), auto to pick the parser from
+the file extension, or a command where {file} is replaced by the incoming file and
+{dir} by the incoming copy of the folder. Invalid versions are refused, or with
+--on-invalid quarantine kept aside while the valid files of a folder are pulled.
+Like item hooks, validator commands only run on computers that approved them with
+'syncstation trust'; commands added here are approved on this computer.
+
+Example:
+  syncstation validate "VS Code Settings" --add json
+  syncstation validate "Nginx" --add 'nginx -t -c {file}' --on-invalid quarantine
+  syncstation validate`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			localConfig, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			changed := len(add) > 0 || len(remove) > 0 || onInvalid != ""
+			if changed && len(args) == 0 {
+				return fmt.Errorf("specify the items by name or glob")
+			}
+			if onInvalid != "" && !validation.ValidPolicy(onInvalid) {
+				return fmt.Errorf("invalid policy %q: use refuse or quarantine", onInvalid)
+			}
+			for _, spec := range add {
+				if _, err := validation.Parse(spec); err != nil {
+					return err
+				}
+			}
+
+			if changed {
+				var items []*config.SyncItem
+				err := config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+					var err error
+					if items, err = syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer); err != nil {
+						return err
+					}
+					for _, item := range items {
+						item.Validators = addTags(item.Validators, add)
+						for _, spec := range remove {
+							item.Validators = removeString(item.Validators, spec)
+						}
+						if onInvalid != "" {
+							item.OnInvalid = onInvalid
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+
+				// Commands added here are approved on this computer, other computers approve them with trust
+				var commands []string
+				for _, spec := range add {
+					if validation.IsCommand(spec) {
+						commands = append(commands, strings.TrimSpace(spec))
+					}
+				}
+				if _, err := updateTrustedCommands(commands, true); err != nil {
+					return err
+				}
+				fmt.Printf("✅ Updated validators of %d items\n\n", len(items))
+				for _, item := range items {
+					printValidators(item)
+				}
+				return nil
+			}
+
+			syncItems, err := config.LoadSyncItemsData(localConfig)
+			if err != nil {
+				return fmt.Errorf("failed to load sync items: %w", err)
+			}
+			items, err := syncItems.SelectItems(config.ItemSelector{Patterns: args}, localConfig.CurrentComputer)
+			if err != nil {
+				return err
+			}
+			return checkItems(localConfig, items, len(args) > 0)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&add, "add", []string{}, "Add a validator (auto, json, yaml, toml, ini or a command with {file} or {dir})")
+	cmd.Flags().StringArrayVar(&remove, "remove", []string{}, "Remove a validator")
+	cmd.Flags().StringVar(&onInvalid, "on-invalid", "", "What pull does with invalid versions: refuse or quarantine")
+	return cmd
+}
+
+// printValidators prints the validators and invalid-version policy of an item
+func printValidators(item *config.SyncItem) {
+	if len(item.Validators) == 0 {
+		fmt.Printf("🧪 %s: no validators\n", item.Name)
+		return
+	}
+
+	policy := item.OnInvalid
+	if policy == "" {
+		policy = validation.DefaultPolicy
+	}
+	fmt.Printf("🧪 %s: %s (%s invalid versions)\n", item.Name, strings.Join(item.Validators, ", "), policy)
+}
+
+// checkItems runs the validators of items on their cloud copies. Items without validators
+// are only reported when they were named.
+func checkItems(localConfig *config.LocalConfig, items []*config.SyncItem, named bool) error {
+	syncEngine := sync.NewSyncEngine(localConfig, newDiffEngine(localConfig, nil))
+
+	checked, invalid := 0, 0
+	for _, item := range items {
+		if len(item.Validators) == 0 {
+			if named {
+				printValidators(item)
+			}
+			continue
+		}
+
+		checked++
+		failures, warnings, err := syncEngine.ValidateIncoming(item)
+		for _, warning := range warnings {
+			fmt.Printf("⚠️  %s\n", strings.TrimPrefix(warning, "warning: "))
+		}
+		switch {
+		case err != nil:
+			invalid++
+			fmt.Printf("❌ %s: %v\n", item.Name, err)
+		case len(failures) > 0:
+			invalid++
+			fmt.Printf("❌ %s: cloud copy is invalid\n", item.Name)
+			for _, path := range validation.SortedPaths(failures) {
+				fmt.Printf("   %s: %v\n", path, failures[path])
+			}
+		default:
+			fmt.Printf("✅ %s: %s\n", item.Name, strings.Join(item.Validators, ", "))
+		}
+	}
+
+	if checked == 0 {
+		if !named {
+			fmt.Println("📭 No items have validators")
+			fmt.Println("💡 Add one with: syncstation validate \"Name\" --add auto")
+		}
+		return nil
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d items failed validation", invalid, checked)
+	}
+	return nil
+}
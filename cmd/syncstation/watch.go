@@ -0,0 +1,72 @@
+package syncstation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+// defaultWatchInterval is how often sync --watch checks for changes
+const defaultWatchInterval = 30 * time.Second
+
+// watchSync syncs the selected items, then checks for changes every interval and syncs
+// again when the cloud copy changed and settled, or the local files of a selected item
+// changed. It runs until interrupted; failed syncs are reported and retried at the next
+// change.
+func watchSync(args []string, selector *itemSelector, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval %s", interval)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	localConfig, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	watcher := sync.NewWatcher(localConfig)
+	for {
+		if err := performSync(sync.SyncSmart, args, selector); err != nil {
+			fmt.Printf("❌ %v\n", err)
+		}
+		items, err := watchedItems(localConfig, selector, args)
+		if err == nil {
+			err = watcher.Synced(items)
+		}
+		if err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		}
+		fmt.Printf("\n👀 Watching for changes every %s, press Ctrl+C to stop\n\n", interval)
+
+		for changed := false; !changed; {
+			select {
+			case <-ctx.Done():
+				fmt.Println("👋 Stopped watching")
+				return nil
+			case <-time.After(interval):
+			}
+			items, err := watchedItems(localConfig, selector, args)
+			if err == nil {
+				changed, err = watcher.Changed(items)
+			}
+			if err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+			}
+		}
+	}
+}
+
+// watchedItems returns the items selected for sync --watch, which change as items are
+// added and removed
+func watchedItems(localConfig *config.LocalConfig, selector *itemSelector, args []string) ([]*config.SyncItem, error) {
+	syncItems, err := config.LoadSyncItemsData(localConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync items: %w", err)
+	}
+	return syncItems.SelectItems(config.ItemSelector{Patterns: args, Tags: selector.tags}, localConfig.CurrentComputer)
+}
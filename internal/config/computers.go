@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// ComputerInfo represents cloud-stored metadata about a computer
+type ComputerInfo struct {
+	Hostname      string            `json:"hostname"`
+	OS            string            `json:"os"`   // "linux", "darwin", "windows", ...
+	Arch          string            `json:"arch"` // "amd64", "arm64", ...
+	Tags          []string          `json:"tags"`
+	LastSeen      string            `json:"lastSeen"`      // RFC3339 format
+	Vars          map[string]string `json:"vars"`          // custom variables available to templates
+	Subscriptions []string          `json:"subscriptions"` // item tags synced on this computer; empty syncs every item
+}
+
+// HasTag reports whether the computer has the given tag
+func (c *ComputerInfo) HasTag(tag string) bool {
+	for _, existing := range c.Tags {
+		if existing == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TouchComputer records that a computer was seen now, along with its OS, architecture and hostname
+func (s *SyncItemsData) TouchComputer(computerID string) *ComputerInfo {
+	info := s.EnsureComputer(computerID)
+	info.OS = runtime.GOOS
+	info.Arch = runtime.GOARCH
+	if hostname, err := os.Hostname(); err == nil {
+		info.Hostname = hostname
+	}
+	info.LastSeen = time.Now().Format(time.RFC3339)
+	return info
+}
+
+// EnsureComputer returns the metadata of a computer, creating it if needed
+func (s *SyncItemsData) EnsureComputer(computerID string) *ComputerInfo {
+	if s.Computers == nil {
+		s.Computers = make(map[string]*ComputerInfo)
+	}
+	info := s.Computers[computerID]
+	if info == nil {
+		info = &ComputerInfo{Vars: make(map[string]string)}
+		s.Computers[computerID] = info
+	}
+	if info.Vars == nil {
+		info.Vars = make(map[string]string)
+	}
+	return info
+}
+
+// GetComputer returns the metadata of a computer, or nil if it was never recorded
+func (s *SyncItemsData) GetComputer(computerID string) *ComputerInfo {
+	return s.Computers[computerID]
+}
+
+// ComputerIDs returns every known computer ID, from computer metadata and item paths, sorted
+func (s *SyncItemsData) ComputerIDs() []string {
+	seen := make(map[string]bool)
+	for computerID := range s.Computers {
+		seen[computerID] = true
+	}
+	for _, item := range s.SyncItems {
+		for computerID := range item.Paths {
+			seen[computerID] = true
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for computerID := range seen {
+		ids = append(ids, computerID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// HasComputer reports whether a computer ID is known
+func (s *SyncItemsData) HasComputer(computerID string) bool {
+	for _, id := range s.ComputerIDs() {
+		if id == computerID {
+			return true
+		}
+	}
+	return false
+}
+
+// CountComputerItems returns the number of items with a path for a computer
+func (s *SyncItemsData) CountComputerItems(computerID string) int {
+	count := 0
+	for _, item := range s.SyncItems {
+		if _, exists := item.Paths[computerID]; exists {
+			count++
+		}
+	}
+	return count
+}
+
+// TemplateVars returns the template variables of a computer for an item.
+// Item variables override the computer's own variables.
+func (s *SyncItemsData) TemplateVars(item *SyncItem, computerID string) map[string]string {
+	vars := make(map[string]string)
+	if info := s.GetComputer(computerID); info != nil {
+		for name, value := range info.Vars {
+			vars[name] = value
+		}
+	}
+	for name, value := range item.GetComputerVars(computerID) {
+		vars[name] = value
+	}
+	return vars
+}
+
+// RenameComputer moves every per-computer entry from oldID to newID
+func (s *SyncItemsData) RenameComputer(oldID, newID string) error {
+	if s.HasComputer(newID) {
+		return fmt.Errorf("computer '%s' already exists", newID)
+	}
+
+	for _, item := range s.SyncItems {
+		if path, exists := item.Paths[oldID]; exists {
+			item.Paths[newID] = path
+			delete(item.Paths, oldID)
+		}
+		if vars, exists := item.Vars[oldID]; exists {
+			item.Vars[newID] = vars
+			delete(item.Vars, oldID)
+		}
+	}
+
+	if info, exists := s.Computers[oldID]; exists {
+		s.Computers[newID] = info
+		delete(s.Computers, oldID)
+	}
+
+	return nil
+}
+
+// ForgetComputer removes every per-computer entry of a computer
+func (s *SyncItemsData) ForgetComputer(computerID string) {
+	for _, item := range s.SyncItems {
+		delete(item.Paths, computerID)
+		delete(item.Vars, computerID)
+	}
+	delete(s.Computers, computerID)
+}
+
+// RenameComputer moves the file info recorded for oldID to newID
+func (f *FileMetadataData) RenameComputer(oldID, newID string) {
+	for _, itemMetadata := range f.Metadata {
+		for _, fileMetadata := range itemMetadata {
+			if info, exists := fileMetadata.Computers[oldID]; exists {
+				fileMetadata.Computers[newID] = info
+				delete(fileMetadata.Computers, oldID)
+			}
+			if fileMetadata.UpdatedBy == oldID {
+				fileMetadata.UpdatedBy = newID
+			}
+		}
+	}
+}
+
+// ForgetComputer removes the file info recorded for a computer. Files no other
+// computer has recorded are removed from the metadata entirely.
+func (f *FileMetadataData) ForgetComputer(computerID string) {
+	for itemName, itemMetadata := range f.Metadata {
+		for filePath, fileMetadata := range itemMetadata {
+			if _, exists := fileMetadata.Computers[computerID]; !exists {
+				continue
+			}
+			delete(fileMetadata.Computers, computerID)
+			if len(fileMetadata.Computers) == 0 {
+				delete(itemMetadata, filePath)
+			}
+		}
+		if len(itemMetadata) == 0 {
+			delete(f.Metadata, itemName)
+		}
+	}
+}
+
+// RecordComputerSeen updates the metadata of the current computer in cloud storage. Only
+// the computer entry changes, so edits made meanwhile by other computers are kept.
+func RecordComputerSeen(localConfig *LocalConfig) error {
+	return UpdateSyncItemsData(localConfig, func(syncItems *SyncItemsData) error {
+		syncItems.TouchComputer(localConfig.CurrentComputer)
+		return nil
+	})
+}
+
+// RenameCloudComputer renames a computer in the sync items and the file metadata in cloud
+// storage, holding the lock of each while it is updated
+func RenameCloudComputer(localConfig *LocalConfig, oldID, newID string) error {
+	err := UpdateSyncItemsData(localConfig, func(syncItems *SyncItemsData) error {
+		if !syncItems.HasComputer(oldID) {
+			return fmt.Errorf("computer not found: %s", oldID)
+		}
+		return syncItems.RenameComputer(oldID, newID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := UpdateCloudFileMetadata(localConfig, func(metadata *FileMetadataData) {
+		metadata.RenameComputer(oldID, newID)
+	}); err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+	return nil
+}
+
+// ForgetCloudComputer removes a departed computer from the sync items and the file metadata in
+// cloud storage and returns the number of items it had a path for. The current computer can't
+// be forgotten.
+func ForgetCloudComputer(localConfig *LocalConfig, computerID string) (int, error) {
+	if computerID == localConfig.CurrentComputer {
+		return 0, fmt.Errorf("cannot forget this computer (%s)", computerID)
+	}
+
+	itemCount := 0
+	err := UpdateSyncItemsData(localConfig, func(syncItems *SyncItemsData) error {
+		if !syncItems.HasComputer(computerID) {
+			return fmt.Errorf("computer not found: %s", computerID)
+		}
+		itemCount = syncItems.CountComputerItems(computerID)
+		syncItems.ForgetComputer(computerID)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := UpdateCloudFileMetadata(localConfig, func(metadata *FileMetadataData) {
+		metadata.ForgetComputer(computerID)
+	}); err != nil {
+		return 0, fmt.Errorf("failed to update metadata: %w", err)
+	}
+	return itemCount, nil
+}
@@ -0,0 +1,539 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testSyncItems returns sync items with paths, template variables and metadata for the laptop and desktop computers
+func testSyncItems() *SyncItemsData {
+	return &SyncItemsData{
+		SyncItems: []*SyncItem{
+			{
+				Name:  "Nvim",
+				Type:  "folder",
+				Paths: map[string]string{"laptop": "~/.config/nvim", "desktop": "/home/me/.config/nvim"},
+				Vars:  map[string]map[string]string{"laptop": {"font": "small"}, "desktop": {"font": "large"}},
+			},
+			{
+				Name:  "Git",
+				Type:  "file",
+				Paths: map[string]string{"laptop": "~/.gitconfig"},
+				Vars:  map[string]map[string]string{"laptop": {"email": "me@laptop.example"}},
+			},
+			{
+				Name:  "Desktop only",
+				Type:  "file",
+				Paths: map[string]string{"desktop": "~/.xinitrc"},
+			},
+		},
+		Computers: map[string]*ComputerInfo{
+			"laptop":  {OS: "darwin", Tags: []string{"work"}, Vars: map[string]string{"theme": "light"}},
+			"desktop": {OS: "linux", Vars: map[string]string{"theme": "dark"}},
+		},
+	}
+}
+
+// testFileMetadata returns file metadata recorded by the laptop and desktop computers
+func testFileMetadata() *FileMetadataData {
+	return &FileMetadataData{Metadata: map[string]map[string]*FileMetadata{
+		"Nvim": {
+			"init.lua": {
+				Computers: map[string]*ComputerFileInfo{"laptop": {Hash: "a"}, "desktop": {Hash: "b"}},
+				UpdatedBy: "laptop",
+			},
+			"laptop.lua": {
+				Computers: map[string]*ComputerFileInfo{"laptop": {Hash: "c"}},
+				UpdatedBy: "laptop",
+			},
+		},
+		"Git": {
+			".gitconfig": {
+				Computers: map[string]*ComputerFileInfo{"laptop": {Hash: "d"}},
+				UpdatedBy: "laptop",
+			},
+		},
+		"Desktop only": {
+			".xinitrc": {
+				Computers: map[string]*ComputerFileInfo{"desktop": {Hash: "e"}},
+				UpdatedBy: "desktop",
+			},
+		},
+	}}
+}
+
+// computerEntries lists every per-computer entry of sync items as "<place>:<computer ID>"
+func computerEntries(s *SyncItemsData) []string {
+	var entries []string
+	for _, item := range s.SyncItems {
+		for computerID, path := range item.Paths {
+			entries = append(entries, item.Name+" path:"+computerID+"="+path)
+		}
+		for computerID, vars := range item.Vars {
+			for name, value := range vars {
+				entries = append(entries, item.Name+" var:"+computerID+"="+name+"="+value)
+			}
+		}
+	}
+	for computerID, info := range s.Computers {
+		entries = append(entries, "computer:"+computerID+"="+info.OS)
+	}
+	return sortedStrings(entries)
+}
+
+// metadataEntries lists every per-computer file info of file metadata as "<item>/<file>:<computer ID>"
+func metadataEntries(f *FileMetadataData) []string {
+	var entries []string
+	for itemName, itemMetadata := range f.Metadata {
+		for filePath, fileMetadata := range itemMetadata {
+			for computerID, info := range fileMetadata.Computers {
+				entries = append(entries, itemName+"/"+filePath+":"+computerID+"="+info.Hash)
+			}
+			entries = append(entries, itemName+"/"+filePath+" by "+fileMetadata.UpdatedBy)
+		}
+	}
+	return sortedStrings(entries)
+}
+
+// sortedStrings sorts values in place and returns them
+func sortedStrings(values []string) []string {
+	sort.Strings(values)
+	return values
+}
+
+func TestRenameComputer(t *testing.T) {
+	tests := []struct {
+		name         string
+		setup        func(s *SyncItemsData)
+		oldID, newID string
+		wantErr      string
+		want         []string
+	}{
+		{
+			name:  "every entry moves",
+			oldID: "laptop", newID: "work-laptop",
+			want: []string{
+				"Desktop only path:desktop=~/.xinitrc",
+				"Git path:work-laptop=~/.gitconfig",
+				"Git var:work-laptop=email=me@laptop.example",
+				"Nvim path:desktop=/home/me/.config/nvim",
+				"Nvim path:work-laptop=~/.config/nvim",
+				"Nvim var:desktop=font=large",
+				"Nvim var:work-laptop=font=small",
+				"computer:desktop=linux",
+				"computer:work-laptop=darwin",
+			},
+		},
+		{
+			name:  "a computer only known from item paths",
+			setup: func(s *SyncItemsData) { delete(s.Computers, "laptop") },
+			oldID: "laptop", newID: "work-laptop",
+			want: []string{
+				"Desktop only path:desktop=~/.xinitrc",
+				"Git path:work-laptop=~/.gitconfig",
+				"Git var:work-laptop=email=me@laptop.example",
+				"Nvim path:desktop=/home/me/.config/nvim",
+				"Nvim path:work-laptop=~/.config/nvim",
+				"Nvim var:desktop=font=large",
+				"Nvim var:work-laptop=font=small",
+				"computer:desktop=linux",
+			},
+		},
+		{name: "an unknown computer", oldID: "server", newID: "nas", want: computerEntries(testSyncItems())},
+		{name: "to an existing computer", oldID: "laptop", newID: "desktop", wantErr: "computer 'desktop' already exists"},
+		{
+			name:  "to a computer only known from item paths",
+			setup: func(s *SyncItemsData) { delete(s.Computers, "desktop") },
+			oldID: "laptop", newID: "desktop",
+			wantErr: "computer 'desktop' already exists",
+		},
+		{name: "to itself", oldID: "laptop", newID: "laptop", wantErr: "computer 'laptop' already exists"},
+	}
+	for _, test := range tests {
+		syncItems := testSyncItems()
+		if test.setup != nil {
+			test.setup(syncItems)
+		}
+		before := computerEntries(syncItems)
+
+		err := syncItems.RenameComputer(test.oldID, test.newID)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			if after := computerEntries(syncItems); !reflect.DeepEqual(after, before) {
+				t.Errorf("%s: a failed rename changed the sync items:\n%v", test.name, after)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := computerEntries(syncItems); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: entries =\n%v\nwant\n%v", test.name, got, test.want)
+		}
+	}
+
+	// Renamed computers keep their metadata object and tags
+	syncItems := testSyncItems()
+	laptop := syncItems.Computers["laptop"]
+	if err := syncItems.RenameComputer("laptop", "work-laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if syncItems.GetComputer("work-laptop") != laptop || !laptop.HasTag("work") || syncItems.HasComputer("laptop") {
+		t.Errorf("computers after the rename = %v", syncItems.ComputerIDs())
+	}
+}
+
+func TestForgetComputer(t *testing.T) {
+	tests := []struct {
+		computerID string
+		want       []string
+	}{
+		{
+			computerID: "laptop",
+			want: []string{
+				"Desktop only path:desktop=~/.xinitrc",
+				"Nvim path:desktop=/home/me/.config/nvim",
+				"Nvim var:desktop=font=large",
+				"computer:desktop=linux",
+			},
+		},
+		{
+			computerID: "desktop",
+			want: []string{
+				"Git path:laptop=~/.gitconfig",
+				"Git var:laptop=email=me@laptop.example",
+				"Nvim path:laptop=~/.config/nvim",
+				"Nvim var:laptop=font=small",
+				"computer:laptop=darwin",
+			},
+		},
+		{computerID: "unknown", want: computerEntries(testSyncItems())},
+	}
+	for _, test := range tests {
+		syncItems := testSyncItems()
+		syncItems.ForgetComputer(test.computerID)
+		if got := computerEntries(syncItems); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("forgetting %s: entries =\n%v\nwant\n%v", test.computerID, got, test.want)
+		}
+		if syncItems.HasComputer(test.computerID) {
+			t.Errorf("%s is still known after being forgotten", test.computerID)
+		}
+		// Items are kept even when no computer is left to sync them
+		if len(syncItems.SyncItems) != 3 {
+			t.Errorf("forgetting %s left %d items", test.computerID, len(syncItems.SyncItems))
+		}
+	}
+}
+
+func TestFileMetadataRenameComputer(t *testing.T) {
+	tests := []struct {
+		oldID, newID string
+		want         []string
+	}{
+		{
+			oldID: "laptop", newID: "work-laptop",
+			want: []string{
+				"Desktop only/.xinitrc by desktop",
+				"Desktop only/.xinitrc:desktop=e",
+				"Git/.gitconfig by work-laptop",
+				"Git/.gitconfig:work-laptop=d",
+				"Nvim/init.lua by work-laptop",
+				"Nvim/init.lua:desktop=b",
+				"Nvim/init.lua:work-laptop=a",
+				"Nvim/laptop.lua by work-laptop",
+				"Nvim/laptop.lua:work-laptop=c",
+			},
+		},
+		{oldID: "server", newID: "nas", want: metadataEntries(testFileMetadata())},
+	}
+	for _, test := range tests {
+		metadata := testFileMetadata()
+		metadata.RenameComputer(test.oldID, test.newID)
+		if got := metadataEntries(metadata); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("renaming %s: entries =\n%v\nwant\n%v", test.oldID, got, test.want)
+		}
+	}
+}
+
+func TestFileMetadataForgetComputer(t *testing.T) {
+	tests := []struct {
+		computerID string
+		want       []string
+		wantItems  []string
+	}{
+		{
+			// Files only the laptop recorded are dropped, and so is the Git item left empty
+			computerID: "laptop",
+			want: []string{
+				"Desktop only/.xinitrc by desktop",
+				"Desktop only/.xinitrc:desktop=e",
+				"Nvim/init.lua by laptop",
+				"Nvim/init.lua:desktop=b",
+			},
+			wantItems: []string{"Desktop only", "Nvim"},
+		},
+		{
+			computerID: "desktop",
+			want: []string{
+				"Git/.gitconfig by laptop",
+				"Git/.gitconfig:laptop=d",
+				"Nvim/init.lua by laptop",
+				"Nvim/init.lua:laptop=a",
+				"Nvim/laptop.lua by laptop",
+				"Nvim/laptop.lua:laptop=c",
+			},
+			wantItems: []string{"Git", "Nvim"},
+		},
+		{computerID: "unknown", want: metadataEntries(testFileMetadata()), wantItems: []string{"Desktop only", "Git", "Nvim"}},
+	}
+	for _, test := range tests {
+		metadata := testFileMetadata()
+		metadata.ForgetComputer(test.computerID)
+		if got := metadataEntries(metadata); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("forgetting %s: entries =\n%v\nwant\n%v", test.computerID, got, test.want)
+		}
+		var items []string
+		for itemName := range metadata.Metadata {
+			items = append(items, itemName)
+		}
+		if got := sortedStrings(items); !reflect.DeepEqual(got, test.wantItems) {
+			t.Errorf("forgetting %s: items = %v, want %v", test.computerID, got, test.wantItems)
+		}
+	}
+}
+
+// saveTestComputers saves the test sync items and file metadata to cloud storage
+func saveTestComputers(t *testing.T, localConfig *LocalConfig) {
+	t.Helper()
+	if err := testSyncItems().SaveSyncItemsData(localConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := testFileMetadata().SaveCloudFileMetadata(localConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadTestComputers returns the entries of the sync items and file metadata in cloud storage
+func loadTestComputers(t *testing.T, localConfig *LocalConfig) ([]string, []string) {
+	t.Helper()
+	syncItems, err := LoadSyncItemsData(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := LoadCloudFileMetadata(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return computerEntries(syncItems), metadataEntries(metadata)
+}
+
+func TestRenameCloudComputer(t *testing.T) {
+	tests := []struct {
+		name         string
+		oldID, newID string
+		wantErr      string
+		want         []string
+		wantMetadata []string
+	}{
+		{
+			name:  "this computer",
+			oldID: "laptop", newID: "work-laptop",
+			want: []string{
+				"Desktop only path:desktop=~/.xinitrc",
+				"Git path:work-laptop=~/.gitconfig",
+				"Git var:work-laptop=email=me@laptop.example",
+				"Nvim path:desktop=/home/me/.config/nvim",
+				"Nvim path:work-laptop=~/.config/nvim",
+				"Nvim var:desktop=font=large",
+				"Nvim var:work-laptop=font=small",
+				"computer:desktop=linux",
+				"computer:work-laptop=darwin",
+			},
+			wantMetadata: []string{
+				"Desktop only/.xinitrc by desktop",
+				"Desktop only/.xinitrc:desktop=e",
+				"Git/.gitconfig by work-laptop",
+				"Git/.gitconfig:work-laptop=d",
+				"Nvim/init.lua by work-laptop",
+				"Nvim/init.lua:desktop=b",
+				"Nvim/init.lua:work-laptop=a",
+				"Nvim/laptop.lua by work-laptop",
+				"Nvim/laptop.lua:work-laptop=c",
+			},
+		},
+		{
+			name:  "another computer",
+			oldID: "desktop", newID: "tower",
+			want: []string{
+				"Desktop only path:tower=~/.xinitrc",
+				"Git path:laptop=~/.gitconfig",
+				"Git var:laptop=email=me@laptop.example",
+				"Nvim path:laptop=~/.config/nvim",
+				"Nvim path:tower=/home/me/.config/nvim",
+				"Nvim var:laptop=font=small",
+				"Nvim var:tower=font=large",
+				"computer:laptop=darwin",
+				"computer:tower=linux",
+			},
+			wantMetadata: []string{
+				"Desktop only/.xinitrc by tower",
+				"Desktop only/.xinitrc:tower=e",
+				"Git/.gitconfig by laptop",
+				"Git/.gitconfig:laptop=d",
+				"Nvim/init.lua by laptop",
+				"Nvim/init.lua:laptop=a",
+				"Nvim/init.lua:tower=b",
+				"Nvim/laptop.lua by laptop",
+				"Nvim/laptop.lua:laptop=c",
+			},
+		},
+		{name: "to an existing computer", oldID: "laptop", newID: "desktop", wantErr: "computer 'desktop' already exists"},
+		{name: "an unknown computer", oldID: "server", newID: "nas", wantErr: "computer not found: server"},
+	}
+	for _, test := range tests {
+		localConfig, _ := newVersionedConfig(t)
+		saveTestComputers(t, localConfig)
+		before, beforeMetadata := loadTestComputers(t, localConfig)
+
+		err := RenameCloudComputer(localConfig, test.oldID, test.newID)
+		got, gotMetadata := loadTestComputers(t, localConfig)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, before) || !reflect.DeepEqual(gotMetadata, beforeMetadata) {
+				t.Errorf("%s: a failed rename changed cloud storage:\n%v\n%v", test.name, got, gotMetadata)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: entries =\n%v\nwant\n%v", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(gotMetadata, test.wantMetadata) {
+			t.Errorf("%s: metadata entries =\n%v\nwant\n%v", test.name, gotMetadata, test.wantMetadata)
+		}
+	}
+}
+
+func TestRenameCloudComputerKeepsConcurrentEdits(t *testing.T) {
+	localConfig, versioned := newVersionedConfig(t)
+	saveTestComputers(t, localConfig)
+
+	// Another computer adds an item for the laptop while it is renamed
+	other := &LocalConfig{CloudSyncDir: localConfig.CloudSyncDir, CurrentComputer: "desktop"}
+	versioned.race = []func(){func() {
+		syncItems, err := LoadSyncItemsData(other)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := syncItems.AddSyncItem("Shell", "file", map[string]string{"laptop": "~/.zshrc"}, nil); err != nil {
+			t.Error(err)
+		}
+		if err := syncItems.SaveSyncItemsData(other); err != nil {
+			t.Error(err)
+		}
+	}}
+
+	if err := RenameCloudComputer(localConfig, "laptop", "work-laptop"); err != nil {
+		t.Fatal(err)
+	}
+	syncItems, err := LoadSyncItemsData(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell := syncItems.FindSyncItem("Shell")
+	if shell == nil {
+		t.Fatal("the item added by the other computer was lost")
+	}
+	if !reflect.DeepEqual(shell.Paths, map[string]string{"work-laptop": "~/.zshrc"}) {
+		t.Errorf("paths of the added item = %v", shell.Paths)
+	}
+}
+
+func TestForgetCloudComputer(t *testing.T) {
+	tests := []struct {
+		name         string
+		computerID   string
+		wantErr      string
+		wantCount    int
+		want         []string
+		wantMetadata []string
+	}{
+		{
+			name:       "another computer",
+			computerID: "desktop",
+			wantCount:  2,
+			want: []string{
+				"Git path:laptop=~/.gitconfig",
+				"Git var:laptop=email=me@laptop.example",
+				"Nvim path:laptop=~/.config/nvim",
+				"Nvim var:laptop=font=small",
+				"computer:laptop=darwin",
+			},
+			wantMetadata: []string{
+				"Git/.gitconfig by laptop",
+				"Git/.gitconfig:laptop=d",
+				"Nvim/init.lua by laptop",
+				"Nvim/init.lua:laptop=a",
+				"Nvim/laptop.lua by laptop",
+				"Nvim/laptop.lua:laptop=c",
+			},
+		},
+		{name: "this computer", computerID: "laptop", wantErr: "cannot forget this computer (laptop)"},
+		{name: "an unknown computer", computerID: "server", wantErr: "computer not found: server"},
+	}
+	for _, test := range tests {
+		localConfig, _ := newVersionedConfig(t)
+		saveTestComputers(t, localConfig)
+		before, beforeMetadata := loadTestComputers(t, localConfig)
+
+		count, err := ForgetCloudComputer(localConfig, test.computerID)
+		got, gotMetadata := loadTestComputers(t, localConfig)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, before) || !reflect.DeepEqual(gotMetadata, beforeMetadata) {
+				t.Errorf("%s: a failed forget changed cloud storage:\n%v\n%v", test.name, got, gotMetadata)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if count != test.wantCount {
+			t.Errorf("%s: removed from %d items, want %d", test.name, count, test.wantCount)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: entries =\n%v\nwant\n%v", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(gotMetadata, test.wantMetadata) {
+			t.Errorf("%s: metadata entries =\n%v\nwant\n%v", test.name, gotMetadata, test.wantMetadata)
+		}
+	}
+}
+
+func TestTemplateVars(t *testing.T) {
+	syncItems := testSyncItems()
+	syncItems.Computers["laptop"].Vars["font"] = "medium"
+	item := syncItems.FindSyncItem("Nvim")
+
+	// Item variables override the computer's own
+	if got, want := syncItems.TemplateVars(item, "laptop"), map[string]string{"theme": "light", "font": "small"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("laptop vars = %v, want %v", got, want)
+	}
+	if got, want := syncItems.TemplateVars(item, "server"), map[string]string{}; !reflect.DeepEqual(got, want) {
+		t.Errorf("vars of an unknown computer = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// ConflictCopy is a copy of a cloud file made by the cloud provider when two computers
+// changed it at the same time, such as "init (Alice's conflicted copy 2026-01-02).lua"
+type ConflictCopy struct {
+	Key      string // key of the copy
+	Original string // key of the file it is a copy of
+	Provider string // "Dropbox", "Nextcloud", "OneDrive" or "Syncthing"
+}
+
+var (
+	// conflictedCopyPattern matches Dropbox and Nextcloud copies, with the marker in
+	// parentheses before the extension
+	conflictedCopyPattern = regexp.MustCompile(`(?i)^(.+?) \(([^()]*(?:conflicted copy|conflict copy|case conflict|selective sync conflict)[^()]*(?:\(\d+\))?)\)(\.[^. ]*)?$`)
+
+	// syncthingPattern matches Syncthing copies, "<name>.sync-conflict-<date>-<time>-<device><ext>"
+	syncthingPattern = regexp.MustCompile(`^(.*)\.sync-conflict-\d{8}-\d{6}(?:-[A-Z0-9]{7})?(\.[^.]*)?$`)
+
+	// oneDriveSuffixPattern matches the numbered suffix OneDrive adds to repeated copies
+	oneDriveSuffixPattern = regexp.MustCompile(`-\d+$`)
+)
+
+// ParseConflictCopy recognises the file name of a provider conflict copy and returns the
+// name of the original file. OneDrive copies are named after the host name of the computer
+// that made them, "<name>-<host><ext>", so they are only recognised for the given host names.
+func ParseConflictCopy(name string, hosts []string) (original, provider string, ok bool) {
+	if match := conflictedCopyPattern.FindStringSubmatch(name); match != nil {
+		// Nextcloud copies don't name the computer, nor have the other Dropbox markers
+		marker := strings.ToLower(match[2])
+		provider = "Nextcloud"
+		if strings.Contains(marker, "'s conflicted copy") || strings.Contains(marker, "sync conflict") || strings.Contains(marker, "case conflict") {
+			provider = "Dropbox"
+		}
+		return match[1] + match[3], provider, true
+	}
+	if match := syncthingPattern.FindStringSubmatch(name); match != nil && match[1]+match[2] != "" {
+		return match[1] + match[2], "Syncthing", true
+	}
+
+	ext := path.Ext(name)
+	stem := oneDriveSuffixPattern.ReplaceAllString(strings.TrimSuffix(name, ext), "")
+	for _, host := range hosts {
+		suffix := "-" + strings.ToLower(host)
+		if host != "" && len(stem) > len(suffix) && strings.HasSuffix(strings.ToLower(stem), suffix) {
+			return stem[:len(stem)-len(suffix)] + ext, "OneDrive", true
+		}
+	}
+	return "", "", false
+}
+
+// ConflictCopies returns the conflict copies among storage entries, sorted by key. OneDrive
+// copies only count when their original is listed too, since their names could be those
+// of ordinary files.
+func ConflictCopies(entries []storage.FileInfo, hosts []string) []ConflictCopy {
+	keys := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		keys[entry.Key] = true
+	}
+
+	var copies []ConflictCopy
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		dir, name := path.Split(entry.Key)
+		original, provider, ok := ParseConflictCopy(name, hosts)
+		if !ok {
+			continue
+		}
+		original = dir + original
+		if provider == "OneDrive" && !keys[original] {
+			continue
+		}
+		copies = append(copies, ConflictCopy{Key: entry.Key, Original: original, Provider: provider})
+	}
+
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Key < copies[j].Key })
+	return copies
+}
+
+// oneDriveHosts returns the names OneDrive gives to the conflict copies of computers: the
+// short host names of the Windows and macOS computers, which OneDrive runs on. Computer IDs
+// aren't used, as files named after them are usually per-computer variants of a file.
+func (s *SyncItemsData) oneDriveHosts() []string {
+	var hosts []string
+	for _, info := range s.Computers {
+		if info.OS != "windows" && info.OS != "darwin" {
+			continue
+		}
+		if hostname, _, _ := strings.Cut(info.Hostname, "."); hostname != "" {
+			hosts = append(hosts, hostname)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// ConflictCopyFinder finds the conflict copies of the cloud files of items. Copies of a
+// file item sit next to it in the configs directory, which is listed once for all the file
+// items, so a finder is meant for a single sync.
+type ConflictCopyFinder struct {
+	syncItems *SyncItemsData
+	configs   []storage.FileInfo // listing of the configs directory, once listed
+	listed    bool
+}
+
+// NewConflictCopyFinder returns a finder of the conflict copies of the items of s
+func (s *SyncItemsData) NewConflictCopyFinder() *ConflictCopyFinder {
+	return &ConflictCopyFinder{syncItems: s}
+}
+
+// Find returns the conflict copies of the cloud files of an item. Copies of a file item sit
+// next to it in the configs directory, those of a folder item inside it. The cloud copies
+// of the other items are never taken for conflict copies.
+func (f *ConflictCopyFinder) Find(store storage.Storage, item *SyncItem) ([]ConflictCopy, error) {
+	var entries []storage.FileInfo
+	if item.Type == "file" {
+		if !f.listed {
+			configs, err := store.List(CloudConfigsKey)
+			if err != nil {
+				return nil, err
+			}
+			f.configs, f.listed = configs, true
+		}
+		entries = f.configs
+	} else {
+		var err error
+		if entries, err = store.List(item.CloudKey()); err != nil {
+			return nil, err
+		}
+	}
+
+	itemKeys := make(map[string]bool, len(f.syncItems.SyncItems))
+	for _, other := range f.syncItems.SyncItems {
+		itemKeys[other.CloudKey()] = true
+	}
+
+	var copies []ConflictCopy
+	for _, conflict := range ConflictCopies(entries, f.syncItems.oneDriveHosts()) {
+		if itemKeys[conflict.Key] {
+			continue
+		}
+		if item.Type == "file" && conflict.Original != item.CloudKey() {
+			continue
+		}
+		if _, inside := storage.Rel(item.CloudKey(), conflict.Original); item.Type != "file" && !inside {
+			continue
+		}
+		copies = append(copies, conflict)
+	}
+	return copies, nil
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+func TestParseConflictCopy(t *testing.T) {
+	hosts := []string{"DESKTOP-4F2K", "Alices-MacBook"}
+	tests := []struct {
+		name     string
+		original string
+		provider string
+	}{
+		{"init (Alice's conflicted copy 2026-01-02).lua", "init.lua", "Dropbox"},
+		{"init (Case Conflict).lua", "init.lua", "Dropbox"},
+		{"init (Selective Sync Conflict (1)).lua", "init.lua", "Dropbox"},
+		{".zshrc (conflicted copy 2026-01-02 101010)", ".zshrc", "Nextcloud"},
+		{"init (conflicted copy 2026-01-02 101010).lua", "init.lua", "Nextcloud"},
+		{"init.sync-conflict-20260102-101010-ABCDEFG.lua", "init.lua", "Syncthing"},
+		{".zshrc.sync-conflict-20260102-101010-ABCDEFG", ".zshrc", "Syncthing"},
+		{"init-DESKTOP-4F2K.lua", "init.lua", "OneDrive"},
+		{"init-desktop-4f2k-2.lua", "init.lua", "OneDrive"},
+		{"settings-Alices-MacBook.json", "settings.json", "OneDrive"},
+		// Ordinary files, including per-computer variants named after computer IDs
+		{"init.lua", "", ""},
+		{"init-laptop.lua", "", ""},
+		{"gitconfig-work", "", ""},
+		{"DESKTOP-4F2K.lua", "", ""},
+		{"notes (draft).md", "", ""},
+	}
+	for _, test := range tests {
+		original, provider, ok := ParseConflictCopy(test.name, hosts)
+		if ok != (test.provider != "") || original != test.original || provider != test.provider {
+			t.Errorf("ParseConflictCopy(%q) = %q, %q, %v, want %q, %q", test.name, original, provider, ok, test.original, test.provider)
+		}
+	}
+}
+
+func TestOneDriveHostsAreThoseOfWindowsAndMacComputers(t *testing.T) {
+	syncItems := &SyncItemsData{Computers: map[string]*ComputerInfo{
+		"laptop": {Hostname: "DESKTOP-4F2K", OS: "windows"},
+		"mac":    {Hostname: "Alices-MacBook.local", OS: "darwin"},
+		"server": {Hostname: "server", OS: "linux"},
+		"new":    {},
+	}}
+	want := []string{"Alices-MacBook", "DESKTOP-4F2K"}
+	if got := syncItems.oneDriveHosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("oneDriveHosts = %v, want %v", got, want)
+	}
+}
+
+// listCountingStorage counts the listings of each key
+type listCountingStorage struct {
+	storage.Storage
+	lists map[string]int
+}
+
+func (l *listCountingStorage) List(key string) ([]storage.FileInfo, error) {
+	l.lists[key]++
+	return l.Storage.List(key)
+}
+
+func TestConflictCopyFinder(t *testing.T) {
+	store := &listCountingStorage{Storage: storage.NewLocal(t.TempDir()), lists: make(map[string]int)}
+	for _, key := range []string{
+		"configs/Shell",
+		"configs/Shell (Alice's conflicted copy 2026-01-02)",
+		"configs/Shell-DESKTOP-4F2K",
+		"configs/Shell-server",
+		"configs/Git",
+		"configs/Git-work",
+		"configs/Nvim/init.lua",
+		"configs/Nvim/init.sync-conflict-20260102-101010-ABCDEFG.lua",
+		"configs/Nvim/lua/plugins.lua",
+	} {
+		if err := store.Write(key, []byte(key), storage.WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	syncItems := &SyncItemsData{
+		SyncItems: []*SyncItem{
+			{Name: "Shell", Type: "file"},
+			{Name: "Git", Type: "file"},
+			// The cloud copy of another item is never a conflict copy
+			{Name: "Git-work", Type: "file"},
+			{Name: "Nvim", Type: "folder"},
+		},
+		Computers: map[string]*ComputerInfo{
+			"laptop": {Hostname: "DESKTOP-4F2K", OS: "windows"},
+			"work":   {Hostname: "work", OS: "windows"},
+			"server": {Hostname: "server", OS: "linux"},
+		},
+	}
+
+	finder := syncItems.NewConflictCopyFinder()
+	want := map[string]string{
+		"Shell":    "configs/Shell (Alice's conflicted copy 2026-01-02) configs/Shell-DESKTOP-4F2K",
+		"Git":      "",
+		"Git-work": "",
+		"Nvim":     "configs/Nvim/init.sync-conflict-20260102-101010-ABCDEFG.lua",
+	}
+	for _, item := range syncItems.SyncItems {
+		copies, err := finder.Find(store, item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, conflict := range copies {
+			keys = append(keys, conflict.Key)
+		}
+		if got := strings.Join(keys, " "); got != want[item.Name] {
+			t.Errorf("conflict copies of %s = %s, want %s", item.Name, got, want[item.Name])
+		}
+	}
+
+	if store.lists[CloudConfigsKey] != 1 {
+		t.Errorf("the configs directory was listed %d times, want once", store.lists[CloudConfigsKey])
+	}
+	if store.lists["configs/Nvim"] != 1 {
+		t.Errorf("the folder item was listed %d times, want once", store.lists["configs/Nvim"])
+	}
+}
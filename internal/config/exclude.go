@@ -0,0 +1,55 @@
+package config
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchExclude reports whether the slash-separated path rel inside an item matches one of
+// the exclude patterns, or lies below a directory that does. Patterns use path.Match
+// syntax: a pattern without a slash matches the name of a file or directory at any depth,
+// e.g. "*.log", a pattern with a slash matches the whole path from the item root, e.g.
+// "cache/*.tmp" or "/build", and a trailing slash only matches directories, e.g. ".cache/".
+func MatchExclude(patterns []string, rel string, isDir bool) bool {
+	if len(patterns) == 0 || rel == "" || rel == "." {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		// Every ancestor of rel is a directory
+		if matchExcludePath(patterns, strings.Join(parts[:i+1], "/"), isDir || i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExcludePath reports whether rel itself matches one of the exclude patterns
+func matchExcludePath(patterns []string, rel string, isDir bool) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimSuffix(pattern, "/")
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if pattern == "" || (dirOnly && !isDir) {
+			continue
+		}
+
+		name := rel
+		if !anchored {
+			name = path.Base(rel)
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExcluded reports whether the slash-separated path rel inside a folder item matches its
+// exclude patterns
+func (item *SyncItem) IsExcluded(rel string, isDir bool) bool {
+	return MatchExclude(item.ExcludePatterns, rel, isDir)
+}
@@ -0,0 +1,40 @@
+package config
+
+import "testing"
+
+func TestMatchExclude(t *testing.T) {
+	patterns := []string{"*.log", ".cache/", "build/*.o", " tmp "}
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"logs/app.log", false, true},
+		{"app.log.txt", false, false},
+		{".cache", true, true},
+		{".cache", false, false}, // directory-only pattern
+		{".cache/index", false, true},
+		{"sub/.cache/index", false, true},
+		{"build/main.o", false, true},
+		{"src/build/main.o", false, false}, // patterns with a slash are anchored
+		{"build", true, false},
+		{"tmp", false, true},
+		{"tmp/file", false, true},
+		{"settings.json", false, false},
+		{".", true, false},
+	}
+	for _, tt := range tests {
+		if got := MatchExclude(patterns, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("MatchExclude(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+
+	if MatchExclude(nil, "app.log", false) {
+		t.Error("no patterns should exclude nothing")
+	}
+	item := &SyncItem{ExcludePatterns: []string{"/secrets/"}}
+	if !item.IsExcluded("secrets/token", false) || item.IsExcluded("a/secrets/token", false) {
+		t.Error("a leading slash should anchor the pattern to the item root")
+	}
+}
@@ -0,0 +1,316 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+// GitMetadataRef holds the file metadata in git mode, as file-metadata.json in a chain of
+// commits of its own. Unlike notes on HEAD, it survives new commits, branch switches and
+// detached HEAD, and is shared with the remote like a branch.
+const GitMetadataRef = "refs/syncstation/metadata"
+
+// LegacyNotesRef held the file metadata as a note on HEAD before GitMetadataRef
+const LegacyNotesRef = "refs/notes/syncstation/file-metadata"
+
+// ErrNotGitRepository is returned when a directory isn't inside a git working tree
+var ErrNotGitRepository = errors.New("not a git repository")
+
+// ErrGitMetadataChanged is returned when GitMetadataRef moved while new metadata was
+// committed, e.g. by a concurrent sync. The metadata must be read again and merged.
+var ErrGitMetadataChanged = errors.New("git metadata was updated concurrently")
+
+// OpenGitRepository opens the git repository whose working tree holds path. Parent
+// directories are searched, and linked worktrees and submodules, whose .git is a file,
+// share the objects and refs of their main repository.
+func OpenGitRepository(path string) (*git.Repository, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("%w: %s", ErrNotGitRepository, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository of %s: %w", path, err)
+	}
+	return repo, nil
+}
+
+// FindGitRoot returns the top level of the git working tree holding path
+func FindGitRoot(path string) (string, error) {
+	repo, err := OpenGitRepository(path)
+	if err != nil {
+		return "", err
+	}
+	worktree, err := repo.Worktree()
+	if errors.Is(err, git.ErrIsBareRepository) {
+		return "", fmt.Errorf("%w: %s is a bare repository", ErrNotGitRepository, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return worktree.Filesystem.Root(), nil
+}
+
+// gitMetadataSignature returns the author of metadata commits, which are made by
+// syncstation whatever the git identity of the user
+func gitMetadataSignature() object.Signature {
+	return object.Signature{Name: "syncstation", Email: "syncstation@localhost", When: time.Now()}
+}
+
+// storeGitObject encodes an object into the repository and returns its hash
+func storeGitObject(repo *git.Repository, encode func(plumbing.EncodedObject) error) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	if err := encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+// readGitBlob returns the content of a blob
+func readGitBlob(repo *git.Repository, hash plumbing.Hash) ([]byte, error) {
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// readGitMetadata returns the file metadata stored at ref and the commit holding it. The
+// commit is zero when the ref doesn't exist.
+func readGitMetadata(repo *git.Repository, ref plumbing.ReferenceName) ([]byte, plumbing.Hash, error) {
+	reference, err := repo.Reference(ref, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, plumbing.ZeroHash, nil
+	}
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+
+	commit, err := repo.CommitObject(reference.Hash())
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to read metadata of %s: %w", ref, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to read metadata of %s: %w", ref, err)
+	}
+	entry, err := tree.FindEntry(FileMetadataKey)
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to read metadata of %s: %w", ref, err)
+	}
+	content, err := readGitBlob(repo, entry.Hash)
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to read metadata of %s: %w", ref, err)
+	}
+	return content, commit.Hash, nil
+}
+
+// writeGitMetadata commits content on top of parents and moves GitMetadataRef to the
+// commit, only if it still points to expected, or doesn't exist when expected is zero
+func writeGitMetadata(repo *git.Repository, content []byte, message string, parents []plumbing.Hash, expected plumbing.Hash) error {
+	blob, err := storeGitObject(repo, func(obj plumbing.EncodedObject) error {
+		obj.SetType(plumbing.BlobObject)
+		writer, err := obj.Writer()
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(content); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store metadata: %w", err)
+	}
+
+	tree := &object.Tree{Entries: []object.TreeEntry{{Name: FileMetadataKey, Mode: filemode.Regular, Hash: blob}}}
+	treeHash, err := storeGitObject(repo, tree.Encode)
+	if err != nil {
+		return fmt.Errorf("failed to store metadata tree: %w", err)
+	}
+
+	signature := gitMetadataSignature()
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+	commitHash, err := storeGitObject(repo, commit.Encode)
+	if err != nil {
+		return fmt.Errorf("failed to store metadata commit: %w", err)
+	}
+	return moveGitMetadataRef(repo, commitHash, expected)
+}
+
+// moveGitMetadataRef points GitMetadataRef to commit if it still points to expected
+func moveGitMetadataRef(repo *git.Repository, commit, expected plumbing.Hash) error {
+	var old *plumbing.Reference
+	if expected.IsZero() {
+		if _, err := repo.Reference(GitMetadataRef, false); err == nil {
+			return ErrGitMetadataChanged
+		}
+	} else {
+		old = plumbing.NewHashReference(GitMetadataRef, expected)
+	}
+
+	err := repo.Storer.CheckAndSetReference(plumbing.NewHashReference(GitMetadataRef, commit), old)
+	if errors.Is(err, storage.ErrReferenceHasChanged) {
+		return ErrGitMetadataChanged
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", GitMetadataRef, err)
+	}
+	return nil
+}
+
+// loadGitMetadata loads the file metadata of git mode. Repositories that kept it in notes
+// load the note of the most recent commit having one, and move to GitMetadataRef on the
+// next save.
+func loadGitMetadata(repoPath string) ([]byte, error) {
+	repo, err := OpenGitRepository(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	content, commit, err := readGitMetadata(repo, GitMetadataRef)
+	if err != nil || !commit.IsZero() {
+		return content, err
+	}
+	return loadLatestGitNote(repo)
+}
+
+// saveGitMetadata saves the file metadata of git mode as a new commit of GitMetadataRef
+func saveGitMetadata(repoPath, computer string, content []byte) error {
+	repo, err := OpenGitRepository(repoPath)
+	if err != nil {
+		return err
+	}
+	_, commit, err := readGitMetadata(repo, GitMetadataRef)
+	if err != nil {
+		return err
+	}
+	var parents []plumbing.Hash
+	if !commit.IsZero() {
+		parents = append(parents, commit)
+	}
+	return writeGitMetadata(repo, content, "Update file metadata from "+computer, parents, commit)
+}
+
+// loadLatestGitNote returns the legacy metadata note of the most recently committed
+// commit, or nothing when the repository has no notes
+func loadLatestGitNote(repo *git.Repository) ([]byte, error) {
+	reference, err := repo.Reference(LegacyNotesRef, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", LegacyNotesRef, err)
+	}
+	notes, err := repo.CommitObject(reference.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata notes: %w", err)
+	}
+	tree, err := notes.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata notes: %w", err)
+	}
+
+	var latestNote plumbing.Hash
+	var latestTime time.Time
+	err = tree.Files().ForEach(func(file *object.File) error {
+		// Notes of large trees are fanned out in directories named after the hash prefix
+		hash := plumbing.NewHash(strings.ReplaceAll(file.Name, "/", ""))
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			// Notes of commits that were never fetched can't be dated
+			return nil
+		}
+		if latestNote.IsZero() || commit.Committer.When.After(latestTime) {
+			latestNote, latestTime = file.Hash, commit.Committer.When
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata notes: %w", err)
+	}
+	if latestNote.IsZero() {
+		return nil, nil
+	}
+	content, err := readGitBlob(repo, latestNote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata note: %w", err)
+	}
+	return content, nil
+}
+
+// MergeGitMetadata brings GitMetadataRef up to date with the metadata fetched at remoteRef.
+// It fast-forwards when only the remote changed, and otherwise commits the merge of both.
+func MergeGitMetadata(repo *git.Repository, computer string, remoteRef plumbing.ReferenceName) error {
+	remoteContent, remoteCommit, err := readGitMetadata(repo, remoteRef)
+	if err != nil || remoteCommit.IsZero() {
+		return err
+	}
+	localContent, localCommit, err := readGitMetadata(repo, GitMetadataRef)
+	if err != nil {
+		return err
+	}
+
+	fastForward, err := isGitAncestor(repo, localCommit, remoteCommit)
+	if err != nil {
+		return err
+	}
+	if fastForward {
+		return moveGitMetadataRef(repo, remoteCommit, localCommit)
+	}
+	upToDate, err := isGitAncestor(repo, remoteCommit, localCommit)
+	if err != nil || upToDate {
+		return err
+	}
+
+	local, err := ParseFileMetadataData(localContent)
+	if err != nil {
+		return fmt.Errorf("failed to parse local metadata: %w", err)
+	}
+	remote, err := ParseFileMetadataData(remoteContent)
+	if err != nil {
+		return fmt.Errorf("failed to parse remote metadata: %w", err)
+	}
+	local.Merge(remote)
+	data, err := json.MarshalIndent(local, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeGitMetadata(repo, data, "Merge file metadata on "+computer, []plumbing.Hash{localCommit, remoteCommit}, localCommit)
+}
+
+// isGitAncestor reports whether commit ancestor is reachable from commit. A zero ancestor,
+// for a ref that doesn't exist yet, is reachable from anything.
+func isGitAncestor(repo *git.Repository, ancestor, commit plumbing.Hash) (bool, error) {
+	if ancestor.IsZero() || ancestor == commit {
+		return true, nil
+	}
+	ancestorCommit, err := repo.CommitObject(ancestor)
+	if err != nil {
+		return false, err
+	}
+	descendant, err := repo.CommitObject(commit)
+	if err != nil {
+		return false, err
+	}
+	return ancestorCommit.IsAncestor(descendant)
+}
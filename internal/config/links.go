@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsSymlink reports whether path is a symlink, without following it
+func IsSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// IsWithin reports whether path is root or inside root, comparing cleaned paths
+func IsWithin(root, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// ReadItemLink reads the target of the symlink at linkPath inside the item rooted at root.
+// Absolute targets inside the item are made relative so the link stays valid in other
+// copies of the item. inside is false when the target escapes root.
+func ReadItemLink(root, linkPath string) (target string, inside bool, err error) {
+	target, err = os.Readlink(linkPath)
+	if err != nil {
+		return "", false, err
+	}
+
+	resolved := target
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(linkPath), resolved)
+	}
+	if !IsWithin(root, resolved) {
+		return target, false, nil
+	}
+
+	if filepath.IsAbs(target) {
+		target, err = filepath.Rel(filepath.Dir(linkPath), resolved)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	return target, true, nil
+}
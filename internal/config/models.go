@@ -3,13 +3,17 @@ package config
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/AntoineArt/syncstation/internal/storage"
 )
 
 // GitOperationCallback represents a callback function for git operations
@@ -22,19 +26,117 @@ type LocalConfig struct {
 	LastSyncTimes   map[string]string `json:"lastSyncTimes"`   // item name -> last sync timestamp
 	GitMode         bool              `json:"gitMode"`         // Whether cloud directory is a git repository
 	GitRepoRoot     string            `json:"gitRepoRoot"`     // Root of git repository (if gitMode is true)
+	KeyFile         string            `json:"keyFile"`         // Path to the encryption key of this computer
+	SecretPolicy    string            `json:"secretPolicy"`    // Default policy when a push finds secrets: "off", "warn", "block" or "encrypt"
+	Hooks           Hooks             `json:"hooks"`           // Hooks run for every item on this computer
+	HookTimeout     int               `json:"hookTimeout"`     // Seconds before a hook is killed, 0 for the default
+	Storage         storage.Config    `json:"storage"`         // Backend holding the cloud copy, the cloud sync directory by default
+	Settle          SettleConfig      `json:"settle"`          // Wait for the cloud drive client before syncing
+	RestoreOwners   bool              `json:"restoreOwners"`   // Give pulled files back to the user recorded on push, when running as root
+	TrustedCommands []string          `json:"trustedCommands"` // Hashes of the item hooks and validators approved to run on this computer
+
+	store     storage.Storage // storage opened by CloudStorage
+	storeRoot string          // cloud sync directory the storage was opened for
+}
+
+// SettleConfig configures the wait for the cloud drive client to finish syncing the cloud
+// sync directory, e.g. after a laptop wakes, so that a sync doesn't read stale files
+type SettleConfig struct {
+	Disabled bool `json:"disabled"` // Sync without waiting
+	Window   int  `json:"window"`   // Seconds the cloud directory must stay unchanged, 0 for the default
+	Timeout  int  `json:"timeout"`  // Seconds to wait before giving up, 0 for the default
+}
+
+// Hooks are shell commands run before and after an item is pushed or pulled
+type Hooks struct {
+	PrePush  string `json:"prePush"`
+	PostPush string `json:"postPush"`
+	PrePull  string `json:"prePull"`
+	PostPull string `json:"postPull"`
+}
+
+// Command returns the command of the named hook ("prePush", "postPush", "prePull" or "postPull")
+func (h Hooks) Command(hook string) string {
+	switch hook {
+	case "prePush":
+		return h.PrePush
+	case "postPush":
+		return h.PostPush
+	case "prePull":
+		return h.PrePull
+	case "postPull":
+		return h.PostPull
+	default:
+		return ""
+	}
+}
+
+// IsEmpty reports whether no hook is set
+func (h Hooks) IsEmpty() bool {
+	return h == Hooks{}
 }
 
 // SyncItem represents a configuration item that can be synced (stored in cloud)
 type SyncItem struct {
-	Name            string            `json:"name"`
-	Type            string            `json:"type"`            // "file" or "folder"
-	Paths           map[string]string `json:"paths"`           // computerID -> path
-	ExcludePatterns []string          `json:"excludePatterns"` // patterns to exclude during sync
+	Name            string                       `json:"name"`
+	Type            string                       `json:"type"`            // "file" or "folder"
+	Paths           map[string]string            `json:"paths"`           // computerID -> path
+	ExcludePatterns []string                     `json:"excludePatterns"` // patterns to exclude during sync
+	Encrypt         bool                         `json:"encrypt"`         // encrypt the cloud copy
+	SecretPolicy    string                       `json:"secretPolicy"`    // overrides the local secret policy for this item
+	SecretPatterns  []string                     `json:"secretPatterns"`  // extra regexes reported as secrets
+	Template        bool                         `json:"template"`        // cloud copy is a template rendered for each computer
+	Vars            map[string]map[string]string `json:"vars"`            // computerID -> template variables
+	PathRules       []PathRule                   `json:"pathRules"`       // default paths for computers without an entry in Paths
+	Tags            []string                     `json:"tags"`            // tags used to select items, e.g. "shell" or "work"
+	Deploy          string                       `json:"deploy"`          // "copy" (default) or "link" to symlink the local path to the cloud copy
+	Hooks           Hooks                        `json:"hooks"`           // commands run before and after the item is pushed or pulled
+	Validators      []string                     `json:"validators"`      // checks run on incoming files before a pull: auto, json, yaml, toml, ini or a command with {file}
+	OnInvalid       string                       `json:"onInvalid"`       // "refuse" (default) or "quarantine" when an incoming file fails validation
+	Store           string                       `json:"store"`           // "files" (default) or "objects" to keep a folder item in the content-addressed object store
+
+	computers map[string]*ComputerInfo // computer metadata used to match path rules
+}
+
+// Deploy modes of a sync item
+const (
+	DeployCopy = "copy" // the local path holds a copy of the cloud files
+	DeployLink = "link" // the local path is a symlink to the cloud copy
+)
+
+// Store modes of a sync item
+const (
+	StoreFiles   = "files"   // the cloud copy is a tree of files
+	StoreObjects = "objects" // the cloud copy is a manifest of objects in the object store
+)
+
+// UsesObjectStore reports whether the cloud copy of an item is kept in the object store
+func (item *SyncItem) UsesObjectStore() bool {
+	return item.Store == StoreObjects
+}
+
+// PathRule is a default path for computers matching an OS and/or a tag
+type PathRule struct {
+	OS   string `json:"os"`   // "linux", "darwin", "windows", ...; empty matches any OS
+	Tag  string `json:"tag"`  // computer tag; empty matches any computer
+	Path string `json:"path"` // path with ~ and $VAR expansion
 }
 
 // SyncItemsData represents the cloud-stored sync items configuration
 type SyncItemsData struct {
-	SyncItems []*SyncItem `json:"syncItems"`
+	SyncItems []*SyncItem              `json:"syncItems"`
+	Computers map[string]*ComputerInfo `json:"computers"` // computer ID -> computer metadata
+}
+
+// EncryptionData represents the cloud-stored encryption settings shared by all computers
+type EncryptionData struct {
+	KeyID      string `json:"keyId"`      // fingerprint of the current key, empty if encryption is not set up
+	KDF        string `json:"kdf"`        // "argon2id" for passphrase-derived keys, empty for key files
+	Salt       string `json:"salt"`       // base64 salt for the KDF
+	Time       uint32 `json:"time"`       // KDF iterations
+	Memory     uint32 `json:"memory"`     // KDF memory in KiB
+	Threads    uint8  `json:"threads"`    // KDF parallelism
+	EncryptAll bool   `json:"encryptAll"` // encrypt every sync item, not only those marked encrypt
 }
 
 // FileState represents the local state tracking for a file
@@ -61,13 +163,16 @@ type FileMetadata struct {
 	Computers    map[string]*ComputerFileInfo `json:"computers"`    // computer ID -> file info
 	CloudHash    string                       `json:"cloudHash"`    // hash of current cloud file
 	CloudModTime string                       `json:"cloudModTime"` // RFC3339 format
+	CloudETag    string                       `json:"cloudETag"`    // ETag of the cloud file, for storages having them
 	LastUpdated  string                       `json:"lastUpdated"`  // RFC3339 format
 	UpdatedBy    string                       `json:"updatedBy"`    // computer ID that last updated
+	Mode         string                       `json:"mode"`         // permission bits of the pushed file, e.g. "0600"
+	Owner        string                       `json:"owner"`        // name of the user owning the pushed file, restored when pulling as root with restoreOwners
 }
 
 // FileMetadataData represents all cloud-stored file metadata
 type FileMetadataData struct {
-	Metadata map[string]map[string]*FileMetadata `json:"metadata"` // item name -> file path -> metadata
+	Metadata map[string]map[string]*FileMetadata `json:"metadata"` // item name -> file path -> metadata; files of folder items are keyed by their path inside the item
 }
 
 // FileStatus represents the status of a file during sync operations
@@ -113,7 +218,8 @@ func LoadLocalConfig(filename string) (*LocalConfig, error) {
 	return &config, nil
 }
 
-// SaveLocalConfig saves local configuration to file
+// SaveLocalConfig saves local configuration to file. The file can hold storage credentials,
+// so it is only readable by its owner, including when an existing file had wider permissions.
 func (c *LocalConfig) SaveLocalConfig(filename string) error {
 	// Ensure directory exists
 	dir := filepath.Dir(filename)
@@ -126,69 +232,126 @@ func (c *LocalConfig) SaveLocalConfig(filename string) error {
 		return err
 	}
 
-	return os.WriteFile(filename, data, 0644)
-}
-
-// GetSyncItemsPath returns the path to sync items in cloud storage
-func (c *LocalConfig) GetSyncItemsPath() string {
-	return filepath.Join(c.CloudSyncDir, "sync-items.json")
-}
-
-// GetFileMetadataPath returns the path to file metadata in cloud storage
-func (c *LocalConfig) GetFileMetadataPath() string {
-	return filepath.Join(c.CloudSyncDir, "file-metadata.json")
+	// WriteFile keeps the permissions of existing files, so restrict them before writing
+	if err := os.Chmod(filename, 0600); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
 }
 
 // GetCloudConfigsPath returns the path to configs folder in cloud storage
 func (c *LocalConfig) GetCloudConfigsPath() string {
-	return filepath.Join(c.CloudSyncDir, "configs")
+	return filepath.Join(c.CloudSyncDir, CloudConfigsKey)
 }
 
 // NewSyncItemsData creates a new sync items data structure
 func NewSyncItemsData() *SyncItemsData {
 	return &SyncItemsData{
 		SyncItems: make([]*SyncItem, 0),
+		Computers: make(map[string]*ComputerInfo),
 	}
 }
 
 // LoadSyncItemsData loads sync items from cloud storage
-func LoadSyncItemsData(filename string) (*SyncItemsData, error) {
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
+func LoadSyncItemsData(localConfig *LocalConfig) (*SyncItemsData, error) {
+	data, err := localConfig.CloudStorage().Read(SyncItemsKey)
+	if errors.Is(err, storage.ErrNotExist) {
 		return NewSyncItemsData(), nil
 	}
-
-	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
+	return parseSyncItemsData(data)
+}
+
+// parseSyncItemsData parses the sync items configuration
+func parseSyncItemsData(data []byte) (*SyncItemsData, error) {
 	var syncData SyncItemsData
 	if err := json.Unmarshal(data, &syncData); err != nil {
 		return nil, err
 	}
 
-	// Initialize slice if nil
+	// Initialize slice and map if nil
 	if syncData.SyncItems == nil {
 		syncData.SyncItems = make([]*SyncItem, 0)
 	}
+	if syncData.Computers == nil {
+		syncData.Computers = make(map[string]*ComputerInfo)
+	}
+	for _, item := range syncData.SyncItems {
+		item.computers = syncData.Computers
+	}
 
 	return &syncData, nil
 }
 
 // SaveSyncItemsData saves sync items to cloud storage
-func (s *SyncItemsData) SaveSyncItemsData(filename string) error {
-	// Ensure directory exists
-	dir := filepath.Dir(filename)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+func (s *SyncItemsData) SaveSyncItemsData(localConfig *LocalConfig) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
 		return err
 	}
 
-	data, err := json.MarshalIndent(s, "", "  ")
+	return localConfig.CloudStorage().Write(SyncItemsKey, data, storage.WriteOptions{})
+}
+
+// UpdateSyncItemsData loads the sync items, applies update and saves them while holding the
+// sync items lock, like UpdateCloudFileMetadata, so that computers saving the sync items at
+// the same time don't lose each other's changes. An error from update cancels the save.
+func UpdateSyncItemsData(localConfig *LocalConfig, update func(syncItems *SyncItemsData) error) error {
+	cloudStorage := localConfig.CloudStorage()
+	unlock, err := cloudStorage.Lock("sync-items", metadataLockTimeout)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	return os.WriteFile(filename, data, 0644)
+	if versioned, ok := cloudStorage.(storage.Versioned); ok {
+		return updateVersioned(versioned, SyncItemsKey, func(content []byte) ([]byte, error) {
+			syncItems := NewSyncItemsData()
+			if len(content) > 0 {
+				var err error
+				if syncItems, err = parseSyncItemsData(content); err != nil {
+					return nil, err
+				}
+			}
+			if err := update(syncItems); err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(syncItems, "", "  ")
+		})
+	}
+
+	syncItems, err := LoadSyncItemsData(localConfig)
+	if err != nil {
+		return err
+	}
+	if err := update(syncItems); err != nil {
+		return err
+	}
+	return syncItems.SaveSyncItemsData(localConfig)
+}
+
+// UpdateSyncItem applies update to the named sync item with UpdateSyncItemsData and returns
+// the updated item
+func UpdateSyncItem(localConfig *LocalConfig, name string, update func(item *SyncItem) error) (*SyncItem, error) {
+	var updated *SyncItem
+	err := UpdateSyncItemsData(localConfig, func(syncItems *SyncItemsData) error {
+		item := syncItems.FindSyncItem(name)
+		if item == nil {
+			return fmt.Errorf("sync item not found: %s", name)
+		}
+		if err := update(item); err != nil {
+			return err
+		}
+		updated = item
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 
 // AddSyncItem adds a new sync item
@@ -205,6 +368,7 @@ func (s *SyncItemsData) AddSyncItem(name, itemType string, paths map[string]stri
 		Type:            itemType,
 		Paths:           paths,
 		ExcludePatterns: excludePatterns,
+		computers:       s.Computers,
 	}
 
 	s.SyncItems = append(s.SyncItems, syncItem)
@@ -221,20 +385,247 @@ func (s *SyncItemsData) FindSyncItem(name string) *SyncItem {
 	return nil
 }
 
-// GetCurrentComputerPath returns the path for the current computer for a given sync item
+// RemoveSyncItem removes a sync item by name, returning false if it doesn't exist
+func (s *SyncItemsData) RemoveSyncItem(name string) bool {
+	for i, item := range s.SyncItems {
+		if item.Name == name {
+			s.SyncItems = append(s.SyncItems[:i], s.SyncItems[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GetCurrentComputerPath returns the path for the current computer for a given sync item.
+// Computers without an explicit path fall back to the most specific matching path rule;
+// an explicit empty path disables the item on that computer.
 func (item *SyncItem) GetCurrentComputerPath(computerID string) string {
 	if path, exists := item.Paths[computerID]; exists {
 		return ExpandPath(path)
 	}
+	if rule := item.MatchPathRule(computerID); rule != nil {
+		return ExpandPath(os.ExpandEnv(rule.Path))
+	}
 	return ""
 }
 
+// MatchPathRule returns the most specific path rule matching a computer, or nil.
+// Tag rules win over OS rules, which win over catch-all rules; ties go to the first rule.
+// The computer's recorded OS is used, or the OS of this computer if none was recorded.
+func (item *SyncItem) MatchPathRule(computerID string) *PathRule {
+	info := item.computers[computerID]
+	osName := runtime.GOOS
+	if info != nil && info.OS != "" {
+		osName = info.OS
+	}
+
+	var best *PathRule
+	bestScore := -1
+	for i := range item.PathRules {
+		rule := &item.PathRules[i]
+		if rule.OS != "" && rule.OS != osName {
+			continue
+		}
+		if rule.Tag != "" && (info == nil || !info.HasTag(rule.Tag)) {
+			continue
+		}
+
+		score := 0
+		if rule.Tag != "" {
+			score += 2
+		}
+		if rule.OS != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+	return best
+}
+
+// SetPathRule adds a path rule, replacing any rule with the same OS and tag
+func (item *SyncItem) SetPathRule(rule PathRule) {
+	for i, existing := range item.PathRules {
+		if existing.OS == rule.OS && existing.Tag == rule.Tag {
+			item.PathRules[i] = rule
+			return
+		}
+	}
+	item.PathRules = append(item.PathRules, rule)
+}
+
+// RemovePathRule removes the path rule with the given key, returning false if there is none
+func (item *SyncItem) RemovePathRule(key string) bool {
+	for i, rule := range item.PathRules {
+		if rule.String() == key {
+			item.PathRules = append(item.PathRules[:i], item.PathRules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// DisableOnComputer stops syncing an item on a computer. An empty path is kept
+// when a path rule would otherwise apply to the computer.
+func (item *SyncItem) DisableOnComputer(computerID string) {
+	delete(item.Paths, computerID)
+	if item.MatchPathRule(computerID) != nil {
+		if item.Paths == nil {
+			item.Paths = make(map[string]string)
+		}
+		item.Paths[computerID] = ""
+	}
+}
+
+// String formats a path rule key as "linux", "tag:work", "tag:work:linux" or "*"
+func (r PathRule) String() string {
+	switch {
+	case r.Tag != "" && r.OS != "":
+		return "tag:" + r.Tag + ":" + r.OS
+	case r.Tag != "":
+		return "tag:" + r.Tag
+	case r.OS != "":
+		return r.OS
+	default:
+		return "*"
+	}
+}
+
+// ParsePathRule parses a "key=path" rule where key is an OS, "tag:<tag>", "tag:<tag>:<os>" or "*"
+func ParsePathRule(rule string) (PathRule, error) {
+	key, path, found := strings.Cut(rule, "=")
+	key = strings.TrimSpace(key)
+	path = strings.TrimSpace(path)
+	if !found || key == "" || path == "" {
+		return PathRule{}, fmt.Errorf("invalid path rule %q: use <os>=<path>, tag:<tag>=<path> or *=<path>", rule)
+	}
+
+	parsed := PathRule{Path: path}
+	switch {
+	case key == "*":
+	case strings.HasPrefix(key, "tag:"):
+		parts := strings.SplitN(strings.TrimPrefix(key, "tag:"), ":", 2)
+		parsed.Tag = parts[0]
+		if len(parts) == 2 {
+			parsed.OS = parts[1]
+		}
+		if parsed.Tag == "" {
+			return PathRule{}, fmt.Errorf("invalid path rule %q: empty tag", rule)
+		}
+	default:
+		parsed.OS = key
+	}
+
+	return parsed, nil
+}
+
+// GetComputerVars returns the template variables of a computer for a given sync item
+func (item *SyncItem) GetComputerVars(computerID string) map[string]string {
+	if vars, exists := item.Vars[computerID]; exists {
+		return vars
+	}
+	return map[string]string{}
+}
+
 // GetCloudPath returns the cloud storage path for a sync item
 func (item *SyncItem) GetCloudPath(cloudConfigsPath string) string {
+	return filepath.Join(cloudConfigsPath, item.safeName())
+}
+
+// CloudKey returns the storage key of the cloud copy of a sync item
+func (item *SyncItem) CloudKey() string {
+	return storage.Join(CloudConfigsKey, item.safeName())
+}
+
+// safeName returns the item name as used in cloud file names
+func (item *SyncItem) safeName() string {
 	// Replace spaces and special characters with safe alternatives
 	safeName := strings.ReplaceAll(item.Name, " ", "-")
-	safeName = strings.ReplaceAll(safeName, "/", "-")
-	return filepath.Join(cloudConfigsPath, safeName)
+	return strings.ReplaceAll(safeName, "/", "-")
+}
+
+// DeleteCloudFiles deletes the cloud copy of a sync item if it exists
+func (item *SyncItem) DeleteCloudFiles(store storage.Storage) error {
+	return store.Delete(item.CloudKey())
+}
+
+// DetectItemType returns "file" or "folder" depending on what exists at path
+func DetectItemType(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "folder", nil
+	}
+	return "file", nil
+}
+
+// CleanupItemMetadata removes the cloud metadata and local file states of a sync item
+func CleanupItemMetadata(localConfig *LocalConfig, fileStatesPath, itemName string) error {
+	// Load cloud metadata
+	err := UpdateCloudFileMetadata(localConfig, func(cloudMetadata *FileMetadataData) {
+		// Remove metadata for this item
+		delete(cloudMetadata.Metadata, itemName)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+
+	// Load and clean up local file states
+	fileStates, err := LoadFileStatesData(fileStatesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load file states: %w", err)
+	}
+
+	// Remove local states for this item
+	delete(fileStates.States, itemName)
+
+	// Save updated file states
+	if err := fileStates.SaveFileStatesData(fileStatesPath); err != nil {
+		return fmt.Errorf("failed to save updated file states: %w", err)
+	}
+
+	return nil
+}
+
+// LoadEncryptionData loads encryption settings from cloud storage
+func LoadEncryptionData(localConfig *LocalConfig) (*EncryptionData, error) {
+	data, err := localConfig.CloudStorage().Read(EncryptionKey)
+	if errors.Is(err, storage.ErrNotExist) {
+		return &EncryptionData{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var encryptionData EncryptionData
+	if err := json.Unmarshal(data, &encryptionData); err != nil {
+		return nil, err
+	}
+
+	return &encryptionData, nil
+}
+
+// SaveEncryptionData saves encryption settings to cloud storage
+func (e *EncryptionData) SaveEncryptionData(localConfig *LocalConfig) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return localConfig.CloudStorage().Write(EncryptionKey, data, storage.WriteOptions{})
+}
+
+// Enabled reports whether an encryption key has been set up
+func (e *EncryptionData) Enabled() bool {
+	return e.KeyID != ""
+}
+
+// IsItemEncrypted reports whether the cloud copy of an item should be encrypted
+func (e *EncryptionData) IsItemEncrypted(item *SyncItem) bool {
+	return e.Enabled() && (e.EncryptAll || item.Encrypt)
 }
 
 // NewFileStatesData creates a new file states data structure
@@ -313,17 +704,8 @@ func NewFileMetadataData() *FileMetadataData {
 	}
 }
 
-// LoadFileMetadataData loads file metadata from cloud storage
-func LoadFileMetadataData(filename string) (*FileMetadataData, error) {
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return NewFileMetadataData(), nil
-	}
-
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-
+// ParseFileMetadataData parses file metadata stored as JSON
+func ParseFileMetadataData(data []byte) (*FileMetadataData, error) {
 	var metadataData FileMetadataData
 	if err := json.Unmarshal(data, &metadataData); err != nil {
 		return nil, err
@@ -337,22 +719,6 @@ func LoadFileMetadataData(filename string) (*FileMetadataData, error) {
 	return &metadataData, nil
 }
 
-// SaveFileMetadataData saves file metadata to cloud storage
-func (f *FileMetadataData) SaveFileMetadataData(filename string) error {
-	// Ensure directory exists
-	dir := filepath.Dir(filename)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-
-	data, err := json.MarshalIndent(f, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(filename, data, 0644)
-}
-
 // UpdateFileMetadata updates metadata for a specific file
 func (f *FileMetadataData) UpdateFileMetadata(itemName, filePath, computerID, hash string, modTime time.Time) {
 	if f.Metadata[itemName] == nil {
@@ -382,6 +748,103 @@ func (f *FileMetadataData) GetFileMetadata(itemName, filePath string) *FileMetad
 	return nil
 }
 
+// Merge adds the metadata of other, which was changed concurrently, e.g. by another
+// computer in git mode. Files known on both sides keep the most recently updated cloud
+// state, and each computer keeps its most recent file state.
+func (f *FileMetadataData) Merge(other *FileMetadataData) {
+	for itemName, files := range other.Metadata {
+		if f.Metadata[itemName] == nil {
+			f.Metadata[itemName] = make(map[string]*FileMetadata)
+		}
+		for filePath, theirs := range files {
+			ours := f.Metadata[itemName][filePath]
+			if ours == nil {
+				f.Metadata[itemName][filePath] = theirs
+				continue
+			}
+
+			newer, older := ours, theirs
+			if laterTime(theirs.LastUpdated, ours.LastUpdated) {
+				newer, older = theirs, ours
+			}
+			merged := *newer
+			merged.Computers = make(map[string]*ComputerFileInfo)
+			for _, side := range []*FileMetadata{older, newer} {
+				for computerID, info := range side.Computers {
+					if current := merged.Computers[computerID]; current == nil || !laterTime(current.ModTime, info.ModTime) {
+						merged.Computers[computerID] = info
+					}
+				}
+			}
+			f.Metadata[itemName][filePath] = &merged
+		}
+	}
+}
+
+// laterTime reports whether the RFC3339 time a is after b. Unparsable times are the oldest.
+func laterTime(a, b string) bool {
+	timeA, err := time.Parse(time.RFC3339, a)
+	if err != nil {
+		return false
+	}
+	timeB, err := time.Parse(time.RFC3339, b)
+	return err != nil || timeA.After(timeB)
+}
+
+// SetFileAttributes records the permission bits and owner of a pushed file
+func (f *FileMetadataData) SetFileAttributes(itemName, filePath string, mode os.FileMode, owner string) {
+	if f.Metadata[itemName] == nil {
+		f.Metadata[itemName] = make(map[string]*FileMetadata)
+	}
+	if f.Metadata[itemName][filePath] == nil {
+		f.Metadata[itemName][filePath] = &FileMetadata{
+			Computers: make(map[string]*ComputerFileInfo),
+		}
+	}
+
+	metadata := f.Metadata[itemName][filePath]
+	metadata.Mode = fmt.Sprintf("%04o", mode.Perm())
+	metadata.Owner = owner
+}
+
+// GetFileMode returns the permission bits recorded for a file, and false if none were recorded
+func (f *FileMetadataData) GetFileMode(itemName, filePath string) (os.FileMode, string, bool) {
+	metadata := f.GetFileMetadata(itemName, filePath)
+	if metadata == nil {
+		return 0, "", false
+	}
+	return parseFileMode(metadata)
+}
+
+// LatestFileMode returns the permission bits of the most recently updated file of an item that has them,
+// used for file items whose metadata is keyed by the path on each computer
+func (f *FileMetadataData) LatestFileMode(itemName string) (os.FileMode, string, bool) {
+	var latest *FileMetadata
+	for _, metadata := range f.Metadata[itemName] {
+		if metadata.Mode != "" && (latest == nil || metadata.LastUpdated > latest.LastUpdated) {
+			latest = metadata
+		}
+	}
+	if latest == nil {
+		return 0, "", false
+	}
+	return parseFileMode(latest)
+}
+
+// parseFileMode parses the permission bits and owner recorded in metadata
+func parseFileMode(metadata *FileMetadata) (os.FileMode, string, bool) {
+	mode, err := strconv.ParseUint(metadata.Mode, 8, 32)
+	if err != nil {
+		return 0, "", false
+	}
+	return os.FileMode(mode).Perm(), metadata.Owner, true
+}
+
+// CalculateHash calculates SHA256 hash of in-memory content
+func CalculateHash(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
 // CalculateFileHash calculates SHA256 hash of a file
 func CalculateFileHash(filePath string) (string, error) {
 	file, err := os.Open(filePath)
@@ -426,85 +889,3 @@ func GetFileInfo(path string) (int64, time.Time, error) {
 	}
 	return info.Size(), info.ModTime(), nil
 }
-
-// saveToGitNotes saves content to git notes
-func saveToGitNotes(repoPath, notesRef, content string) error {
-	cmd := exec.Command("git", "notes", "--ref", notesRef, "add", "-f", "-m", content, "HEAD")
-	cmd.Dir = repoPath
-	_, err := cmd.Output()
-	if err != nil {
-		// If HEAD doesn't exist (empty repo), create an initial commit
-		if strings.Contains(err.Error(), "bad revision 'HEAD'") {
-			// Create initial commit
-			initCmd := exec.Command("git", "commit", "--allow-empty", "-m", "Initial commit for syncstation metadata")
-			initCmd.Dir = repoPath
-			if initErr := initCmd.Run(); initErr != nil {
-				return fmt.Errorf("failed to create initial commit: %w", initErr)
-			}
-			// Retry adding notes
-			cmd = exec.Command("git", "notes", "--ref", notesRef, "add", "-f", "-m", content, "HEAD")
-			cmd.Dir = repoPath
-			_, err = cmd.Output()
-		}
-	}
-	return err
-}
-
-// loadFromGitNotes loads content from git notes
-func loadFromGitNotes(repoPath, notesRef string) (string, error) {
-	cmd := exec.Command("git", "notes", "--ref", notesRef, "show", "HEAD")
-	cmd.Dir = repoPath
-	output, err := cmd.Output()
-	if err != nil {
-		// Notes don't exist yet, return empty content
-		return "", nil
-	}
-	return string(output), nil
-}
-
-// SaveFileMetadataDataGitAware saves file metadata using git notes when in git mode
-func (f *FileMetadataData) SaveFileMetadataDataGitAware(localConfig *LocalConfig, filename string) error {
-	if localConfig.GitMode && localConfig.GitRepoRoot != "" {
-		// Save to git notes
-		data, err := json.MarshalIndent(f, "", "  ")
-		if err != nil {
-			return err
-		}
-
-		return saveToGitNotes(localConfig.GitRepoRoot, "syncstation/file-metadata", string(data))
-	}
-
-	// Fall back to regular file storage
-	return f.SaveFileMetadataData(filename)
-}
-
-// LoadFileMetadataDataGitAware loads file metadata using git notes when in git mode
-func LoadFileMetadataDataGitAware(localConfig *LocalConfig, filename string) (*FileMetadataData, error) {
-	if localConfig.GitMode && localConfig.GitRepoRoot != "" {
-		// Load from git notes
-		content, err := loadFromGitNotes(localConfig.GitRepoRoot, "syncstation/file-metadata")
-		if err != nil {
-			return nil, err
-		}
-
-		if content == "" {
-			// No notes exist yet, return new data
-			return NewFileMetadataData(), nil
-		}
-
-		var metadataData FileMetadataData
-		if err := json.Unmarshal([]byte(content), &metadataData); err != nil {
-			return nil, err
-		}
-
-		// Initialize map if nil
-		if metadataData.Metadata == nil {
-			metadataData.Metadata = make(map[string]map[string]*FileMetadata)
-		}
-
-		return &metadataData, nil
-	}
-
-	// Fall back to regular file loading
-	return LoadFileMetadataData(filename)
-}
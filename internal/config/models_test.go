@@ -0,0 +1,295 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// loadTestItems saves sync items and loads them back, as every command does before using them
+func loadTestItems(t *testing.T, syncItems *SyncItemsData) *SyncItemsData {
+	t.Helper()
+	localConfig := &LocalConfig{CloudSyncDir: t.TempDir()}
+	if err := syncItems.SaveSyncItemsData(localConfig); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSyncItemsData(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestMatchPathRule(t *testing.T) {
+	rules := []PathRule{
+		{Path: "/any"},
+		{OS: "linux", Path: "/linux"},
+		{OS: "darwin", Path: "/darwin"},
+		{Tag: "work", Path: "/work"},
+		{Tag: "work", OS: "darwin", Path: "/work-darwin"},
+		{Tag: "server", OS: "linux", Path: "/server-linux"},
+		{OS: "linux", Path: "/linux-duplicate"},
+	}
+	syncItems := loadTestItems(t, &SyncItemsData{
+		SyncItems: []*SyncItem{{Name: "Shell", Type: "file", PathRules: rules}},
+		Computers: map[string]*ComputerInfo{
+			"linux-box":   {OS: "linux"},
+			"mac":         {OS: "darwin"},
+			"work-linux":  {OS: "linux", Tags: []string{"work"}},
+			"work-mac":    {OS: "darwin", Tags: []string{"work"}},
+			"server-mac":  {OS: "darwin", Tags: []string{"server"}},
+			"windows":     {OS: "windows"},
+			"no-os":       {},
+			"server-box":  {OS: "linux", Tags: []string{"server", "work"}},
+			"work-window": {OS: "windows", Tags: []string{"work"}},
+		},
+	})
+	item := syncItems.FindSyncItem("Shell")
+
+	// Computers without a recorded OS are matched with the OS of this computer
+	thisOS := map[string]string{"linux": "/linux", "darwin": "/darwin"}[runtime.GOOS]
+	if thisOS == "" {
+		thisOS = "/any"
+	}
+
+	tests := []struct {
+		computerID string
+		want       string
+	}{
+		{"linux-box", "/linux"}, // OS rules win over the catch-all; ties go to the first rule
+		{"mac", "/darwin"},
+		{"windows", "/any"},     // only the catch-all matches
+		{"work-linux", "/work"}, // tag rules win over OS rules
+		{"work-mac", "/work-darwin"},
+		{"work-window", "/work"},
+		{"server-mac", "/darwin"}, // the server rule is for another OS
+		{"server-box", "/server-linux"},
+		{"no-os", thisOS},
+		{"unknown", thisOS}, // computers never recorded have no tags
+	}
+	for _, test := range tests {
+		rule := item.MatchPathRule(test.computerID)
+		if rule == nil || rule.Path != test.want {
+			t.Errorf("rule for %s = %+v, want %s", test.computerID, rule, test.want)
+		}
+	}
+
+	noCatchAll := loadTestItems(t, &SyncItemsData{
+		SyncItems: []*SyncItem{{Name: "Shell", Type: "file", PathRules: []PathRule{{Tag: "work", Path: "/work"}}}},
+	}).FindSyncItem("Shell")
+	if rule := noCatchAll.MatchPathRule("unknown"); rule != nil {
+		t.Errorf("a computer without tags matched %+v", rule)
+	}
+}
+
+func TestGetCurrentComputerPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	t.Setenv("SYNCSTATION_TEST_DIR", "/srv/configs")
+
+	syncItems := loadTestItems(t, &SyncItemsData{
+		SyncItems: []*SyncItem{{
+			Name: "Shell",
+			Type: "file",
+			Paths: map[string]string{
+				"explicit": "~/.bashrc",
+				"env":      "$SYNCSTATION_TEST_DIR/bashrc",
+				"tagged":   "/explicit/wins",
+				"disabled": "",
+			},
+			PathRules: []PathRule{
+				{Path: "~/.profile"},
+				{Tag: "work", Path: "$SYNCSTATION_TEST_DIR/work/${SYNCSTATION_TEST_MISSING}bashrc"},
+			},
+		}},
+		Computers: map[string]*ComputerInfo{
+			"tagged":   {Tags: []string{"work"}},
+			"work":     {Tags: []string{"work"}},
+			"disabled": {Tags: []string{"work"}},
+		},
+	})
+	item := syncItems.FindSyncItem("Shell")
+
+	tests := []struct {
+		computerID string
+		want       string
+	}{
+		{"explicit", filepath.Join(home, ".bashrc")},
+		{"env", "/srv/configs/bashrc"},
+		{"tagged", "/explicit/wins"}, // explicit paths win over every rule
+		{"disabled", ""},             // an explicit empty path disables the item
+		{"work", "/srv/configs/work/bashrc"},
+		{"other", filepath.Join(home, ".profile")},
+	}
+	for _, test := range tests {
+		if got := item.GetCurrentComputerPath(test.computerID); got != test.want {
+			t.Errorf("path for %s = %q, want %q", test.computerID, got, test.want)
+		}
+	}
+
+	withoutRules := &SyncItem{Paths: map[string]string{"laptop": "/a"}}
+	if got := withoutRules.GetCurrentComputerPath("desktop"); got != "" {
+		t.Errorf("path of a computer without entry or rule = %q", got)
+	}
+}
+
+func TestDisableOnComputer(t *testing.T) {
+	item := &SyncItem{Paths: map[string]string{"laptop": "/a", "desktop": "/b"}}
+	item.DisableOnComputer("laptop")
+	if _, exists := item.Paths["laptop"]; exists {
+		t.Errorf("without rules the path should be removed: %v", item.Paths)
+	}
+
+	item.PathRules = []PathRule{{Path: "/default"}}
+	item.DisableOnComputer("desktop")
+	if path, exists := item.Paths["desktop"]; !exists || path != "" {
+		t.Errorf("with a matching rule an empty path should be kept: %v", item.Paths)
+	}
+	if got := item.GetCurrentComputerPath("desktop"); got != "" {
+		t.Errorf("disabled computer path = %q", got)
+	}
+	if got := item.GetCurrentComputerPath("laptop"); got != "/default" {
+		t.Errorf("laptop path = %q, want the rule path", got)
+	}
+}
+
+func TestParsePathRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    PathRule
+		wantKey string
+		wantErr bool
+	}{
+		{rule: "linux=~/.bashrc", want: PathRule{OS: "linux", Path: "~/.bashrc"}, wantKey: "linux"},
+		{rule: "tag:work=/work", want: PathRule{Tag: "work", Path: "/work"}, wantKey: "tag:work"},
+		{rule: "tag:work:darwin = /work", want: PathRule{Tag: "work", OS: "darwin", Path: "/work"}, wantKey: "tag:work:darwin"},
+		{rule: "*=/any", want: PathRule{Path: "/any"}, wantKey: "*"},
+		{rule: "linux", wantErr: true},
+		{rule: "=/path", wantErr: true},
+		{rule: "linux=", wantErr: true},
+		{rule: "tag:=/path", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParsePathRule(test.rule)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParsePathRule(%q) error = %v", test.rule, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParsePathRule(%q) = %+v, want %+v", test.rule, got, test.want)
+		}
+		if !test.wantErr && got.String() != test.wantKey {
+			t.Errorf("%+v formats as %q, want %q", got, got.String(), test.wantKey)
+		}
+	}
+}
+
+func TestSetAndRemovePathRule(t *testing.T) {
+	item := &SyncItem{}
+	item.SetPathRule(PathRule{OS: "linux", Path: "/a"})
+	item.SetPathRule(PathRule{Tag: "work", OS: "linux", Path: "/b"})
+	item.SetPathRule(PathRule{OS: "linux", Path: "/c"}) // replaces the first rule
+
+	if len(item.PathRules) != 2 || item.PathRules[0].Path != "/c" {
+		t.Fatalf("rules = %+v", item.PathRules)
+	}
+	if item.RemovePathRule("tag:work") || !item.RemovePathRule("tag:work:linux") {
+		t.Error("rules should be removed by their exact key")
+	}
+	if len(item.PathRules) != 1 || item.PathRules[0].String() != "linux" {
+		t.Errorf("rules after removal = %+v", item.PathRules)
+	}
+}
+
+func TestFileModes(t *testing.T) {
+	metadata := NewFileMetadataData()
+	metadata.SetFileAttributes("Nvim", "init.lua", 0640|os.ModeSetuid, "me")
+	if mode, owner, ok := metadata.GetFileMode("Nvim", "init.lua"); !ok || mode != 0640 || owner != "me" {
+		t.Errorf("mode of init.lua = %o, %q, %v", mode, owner, ok)
+	}
+	if _, _, ok := metadata.GetFileMode("Nvim", "missing.lua"); ok {
+		t.Error("a file without metadata has a mode")
+	}
+
+	// File items get the mode of the most recently updated path that has one
+	metadata.SetFileAttributes("Deploy", "/home/me/deploy.sh", 0700, "")
+	metadata.Metadata["Deploy"]["/home/me/deploy.sh"].LastUpdated = "2024-01-01T00:00:00Z"
+	metadata.SetFileAttributes("Deploy", "/Users/me/deploy.sh", 0750, "")
+	metadata.Metadata["Deploy"]["/Users/me/deploy.sh"].LastUpdated = "2024-02-01T00:00:00Z"
+	metadata.Metadata["Deploy"]["/srv/deploy.sh"] = &FileMetadata{LastUpdated: "2024-03-01T00:00:00Z"}
+	if mode, _, ok := metadata.LatestFileMode("Deploy"); !ok || mode != 0750 {
+		t.Errorf("latest mode = %o, %v, want 750", mode, ok)
+	}
+	if _, _, ok := metadata.LatestFileMode("Nothing"); ok {
+		t.Error("an item without metadata has a mode")
+	}
+}
+
+func TestFileMetadataMerge(t *testing.T) {
+	ours := NewFileMetadataData()
+	ours.Metadata["Shell"] = map[string]*FileMetadata{
+		".zshrc": {
+			CloudHash:   "ours",
+			LastUpdated: "2024-01-02T00:00:00Z",
+			Computers: map[string]*ComputerFileInfo{
+				"laptop":  {Hash: "ours", ModTime: "2024-01-02T00:00:00Z"},
+				"desktop": {Hash: "old", ModTime: "2024-01-01T00:00:00Z"},
+			},
+		},
+		".bashrc": {CloudHash: "only ours", LastUpdated: "2024-01-01T00:00:00Z"},
+	}
+	theirs := NewFileMetadataData()
+	theirs.Metadata["Shell"] = map[string]*FileMetadata{
+		".zshrc": {
+			CloudHash:   "theirs",
+			LastUpdated: "2024-01-03T00:00:00Z",
+			Computers: map[string]*ComputerFileInfo{
+				"desktop": {Hash: "theirs", ModTime: "2024-01-03T00:00:00Z"},
+				"laptop":  {Hash: "stale", ModTime: "2024-01-01T00:00:00Z"},
+			},
+		},
+	}
+	theirs.Metadata["Nvim"] = map[string]*FileMetadata{"init.lua": {CloudHash: "only theirs"}}
+
+	ours.Merge(theirs)
+	zshrc := ours.Metadata["Shell"][".zshrc"]
+	if zshrc.CloudHash != "theirs" {
+		t.Errorf("merged cloud hash = %s, want the most recently updated", zshrc.CloudHash)
+	}
+	if zshrc.Computers["laptop"].Hash != "ours" || zshrc.Computers["desktop"].Hash != "theirs" {
+		t.Errorf("merged computers = laptop %s, desktop %s, want the most recent state of each", zshrc.Computers["laptop"].Hash, zshrc.Computers["desktop"].Hash)
+	}
+	if ours.Metadata["Shell"][".bashrc"].CloudHash != "only ours" || ours.Metadata["Nvim"]["init.lua"].CloudHash != "only theirs" {
+		t.Error("files known on one side only were lost")
+	}
+}
+
+func TestSaveLocalConfigIsOnlyReadableByItsOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permissions")
+	}
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.json")
+	if err := os.WriteFile(existing, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{filepath.Join(dir, "config", "config.json"), existing} {
+		localConfig := &LocalConfig{CurrentComputer: "laptop", Storage: storage.Config{Type: "s3", S3: storage.S3Config{SecretKey: "secret"}}}
+		if err := localConfig.SaveLocalConfig(filename); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s has permissions %o, want 600", filepath.Base(filename), perm)
+		}
+	}
+}
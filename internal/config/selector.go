@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ItemSelector selects sync items by name, glob pattern or tag.
+// An item is selected when it matches any pattern or any tag.
+type ItemSelector struct {
+	Patterns []string // item names or glob patterns such as "nvim*"
+	Tags     []string // item tags
+}
+
+// IsEmpty reports whether the selector has no patterns or tags, i.e. selects every item
+func (sel ItemSelector) IsEmpty() bool {
+	return len(sel.Patterns) == 0 && len(sel.Tags) == 0
+}
+
+// isGlobPattern reports whether a pattern contains glob characters
+func isGlobPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// SelectItems returns the items matching a selector, in configuration order.
+// An empty selector selects every item the computer is subscribed to.
+func (s *SyncItemsData) SelectItems(sel ItemSelector, computerID string) ([]*SyncItem, error) {
+	if sel.IsEmpty() {
+		var items []*SyncItem
+		for _, item := range s.SyncItems {
+			if s.IsSubscribed(item, computerID) {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+
+	matched := make(map[string]bool)
+
+	for _, pattern := range sel.Patterns {
+		if !isGlobPattern(pattern) {
+			item := s.FindSyncItem(pattern)
+			if item == nil {
+				return nil, fmt.Errorf("sync item not found: %s", pattern)
+			}
+			matched[item.Name] = true
+			continue
+		}
+
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		found := false
+		for _, item := range s.SyncItems {
+			if ok, _ := filepath.Match(pattern, item.Name); ok {
+				matched[item.Name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no sync items match: %s", pattern)
+		}
+	}
+
+	for _, tag := range sel.Tags {
+		for _, item := range s.SyncItems {
+			if item.HasTag(tag) {
+				matched[item.Name] = true
+			}
+		}
+	}
+
+	var items []*SyncItem
+	for _, item := range s.SyncItems {
+		if matched[item.Name] {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// IsSubscribed reports whether a computer syncs an item. Computers without
+// subscriptions sync every item, and untagged items are synced everywhere;
+// otherwise the item needs one of the computer's subscribed tags.
+func (s *SyncItemsData) IsSubscribed(item *SyncItem, computerID string) bool {
+	info := s.GetComputer(computerID)
+	if info == nil || len(info.Subscriptions) == 0 || len(item.Tags) == 0 {
+		return true
+	}
+	for _, tag := range info.Subscriptions {
+		if item.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag reports whether the item has the given tag
+func (item *SyncItem) HasTag(tag string) bool {
+	for _, existing := range item.Tags {
+		if existing == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemTags returns every tag used by an item, sorted
+func (s *SyncItemsData) ItemTags() []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, item := range s.SyncItems {
+		for _, tag := range item.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// itemNames returns the names of items
+func itemNames(items []*SyncItem) []string {
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+// taggedSyncItems returns sync items with tags and computers subscribed to some of them
+func taggedSyncItems() *SyncItemsData {
+	return &SyncItemsData{
+		SyncItems: []*SyncItem{
+			{Name: "nvim", Tags: []string{"editor", "dev"}},
+			{Name: "nvim-lsp", Tags: []string{"dev"}},
+			{Name: "bashrc", Tags: []string{"shell"}},
+			{Name: "zshrc", Tags: []string{"shell", "work"}},
+			{Name: "gitconfig"},
+		},
+		Computers: map[string]*ComputerInfo{
+			"laptop":  {},
+			"server":  {Subscriptions: []string{"shell"}},
+			"work":    {Subscriptions: []string{"work", "dev"}},
+			"nothing": {Subscriptions: []string{"games"}},
+		},
+	}
+}
+
+func TestSelectItems(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector ItemSelector
+		computer string
+		want     []string
+		wantErr  string
+	}{
+		{name: "empty selector on a computer without subscriptions", computer: "laptop", want: []string{"nvim", "nvim-lsp", "bashrc", "zshrc", "gitconfig"}},
+		{name: "empty selector on an unknown computer", computer: "unknown", want: []string{"nvim", "nvim-lsp", "bashrc", "zshrc", "gitconfig"}},
+		{name: "subscribed tags plus untagged items", computer: "server", want: []string{"bashrc", "zshrc", "gitconfig"}},
+		{name: "several subscriptions", computer: "work", want: []string{"nvim", "nvim-lsp", "zshrc", "gitconfig"}},
+		{name: "no subscribed item", computer: "nothing", want: []string{"gitconfig"}},
+		{name: "name", selector: ItemSelector{Patterns: []string{"zshrc"}}, computer: "laptop", want: []string{"zshrc"}},
+		{name: "names keep configuration order", selector: ItemSelector{Patterns: []string{"zshrc", "nvim"}}, computer: "laptop", want: []string{"nvim", "zshrc"}},
+		{name: "unknown name", selector: ItemSelector{Patterns: []string{"fishrc"}}, computer: "laptop", wantErr: "sync item not found: fishrc"},
+		{name: "glob", selector: ItemSelector{Patterns: []string{"nvim*"}}, computer: "laptop", want: []string{"nvim", "nvim-lsp"}},
+		{name: "character class", selector: ItemSelector{Patterns: []string{"[bz]*rc"}}, computer: "laptop", want: []string{"bashrc", "zshrc"}},
+		{name: "glob without match", selector: ItemSelector{Patterns: []string{"emacs*"}}, computer: "laptop", wantErr: "no sync items match: emacs*"},
+		{name: "invalid glob", selector: ItemSelector{Patterns: []string{"[nvim"}}, computer: "laptop", wantErr: "invalid pattern"},
+		{name: "tag", selector: ItemSelector{Tags: []string{"shell"}}, computer: "laptop", want: []string{"bashrc", "zshrc"}},
+		{name: "any of several tags", selector: ItemSelector{Tags: []string{"editor", "work"}}, computer: "laptop", want: []string{"nvim", "zshrc"}},
+		{name: "unused tag", selector: ItemSelector{Tags: []string{"games"}}, computer: "laptop", want: []string{}},
+		{name: "names and tags", selector: ItemSelector{Patterns: []string{"gitconfig"}, Tags: []string{"dev"}}, computer: "laptop", want: []string{"nvim", "nvim-lsp", "gitconfig"}},
+		{name: "overlapping selections are listed once", selector: ItemSelector{Patterns: []string{"nvim", "nvim*"}, Tags: []string{"editor"}}, computer: "laptop", want: []string{"nvim", "nvim-lsp"}},
+		// Explicit selections ignore subscriptions
+		{name: "name outside of subscriptions", selector: ItemSelector{Patterns: []string{"nvim"}}, computer: "server", want: []string{"nvim"}},
+		{name: "tag outside of subscriptions", selector: ItemSelector{Tags: []string{"dev"}}, computer: "server", want: []string{"nvim", "nvim-lsp"}},
+	}
+	for _, test := range tests {
+		items, err := taggedSyncItems().SelectItems(test.selector, test.computer)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := itemNames(items); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: selected %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsSubscribed(t *testing.T) {
+	syncItems := taggedSyncItems()
+	tests := []struct {
+		item, computer string
+		want           bool
+	}{
+		{"bashrc", "laptop", true},    // no subscriptions
+		{"bashrc", "unknown", true},   // no computer info
+		{"bashrc", "server", true},    // subscribed tag
+		{"nvim", "server", false},     // only unsubscribed tags
+		{"gitconfig", "server", true}, // untagged items are synced everywhere
+		{"zshrc", "work", true},       // one of several tags is subscribed
+		{"bashrc", "work", false},
+		{"gitconfig", "nothing", true},
+		{"nvim-lsp", "nothing", false},
+	}
+	for _, test := range tests {
+		item := syncItems.FindSyncItem(test.item)
+		if got := syncItems.IsSubscribed(item, test.computer); got != test.want {
+			t.Errorf("IsSubscribed(%s, %s) = %v, want %v", test.item, test.computer, got, test.want)
+		}
+	}
+}
+
+func TestItemTags(t *testing.T) {
+	if got, want := taggedSyncItems().ItemTags(), []string{"dev", "editor", "shell", "work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ItemTags() = %v, want %v", got, want)
+	}
+	if got := NewSyncItemsData().ItemTags(); len(got) != 0 {
+		t.Errorf("tags without items = %v", got)
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// Keys of the shared files in the cloud storage
+const (
+	SyncItemsKey    = "sync-items.json"
+	FileMetadataKey = "file-metadata.json"
+	EncryptionKey   = "encryption.json"
+	CloudConfigsKey = "configs"
+)
+
+// metadataLockTimeout is how long metadata updates wait for another sync to finish
+const metadataLockTimeout = 30 * time.Second
+
+// metadataUpdateAttempts is how many times a conditional metadata update is retried when
+// another computer changed the metadata in between
+const metadataUpdateAttempts = 10
+
+// CloudStorage returns the storage holding the cloud copy. When the configured backend
+// can't be opened, every storage operation returns the error.
+func (c *LocalConfig) CloudStorage() storage.Storage {
+	if c.store == nil || c.storeRoot != c.CloudSyncDir {
+		store, err := storage.Open(c.Storage, c.CloudSyncDir)
+		if err != nil {
+			store = storage.Unavailable{Err: fmt.Errorf("failed to open storage: %w", err)}
+		}
+		c.store, c.storeRoot = store, c.CloudSyncDir
+	}
+	return c.store
+}
+
+// LoadCloudFileMetadata loads the file metadata from the cloud storage, or from
+// GitMetadataRef in git mode. Missing metadata loads as empty data.
+func LoadCloudFileMetadata(localConfig *LocalConfig) (*FileMetadataData, error) {
+	var data []byte
+	if localConfig.GitMode && localConfig.GitRepoRoot != "" {
+		var err error
+		data, err = loadGitMetadata(localConfig.GitRepoRoot)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		data, err = localConfig.CloudStorage().Read(FileMetadataKey)
+		if err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if len(data) == 0 {
+		return NewFileMetadataData(), nil
+	}
+	return ParseFileMetadataData(data)
+}
+
+// SaveCloudFileMetadata saves the file metadata to the cloud storage, or to GitMetadataRef in git mode
+func (f *FileMetadataData) SaveCloudFileMetadata(localConfig *LocalConfig) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if localConfig.GitMode && localConfig.GitRepoRoot != "" {
+		return saveGitMetadata(localConfig.GitRepoRoot, localConfig.CurrentComputer, data)
+	}
+	return localConfig.CloudStorage().Write(FileMetadataKey, data, storage.WriteOptions{})
+}
+
+// UpdateCloudFileMetadata loads the file metadata, applies update and saves it while holding
+// the metadata lock, so that concurrent syncs don't lose each other's changes. Storages with
+// conditional writes also save only if the metadata is unchanged since it was loaded, and
+// retry otherwise, which guards against locks taken over after their timeout.
+func UpdateCloudFileMetadata(localConfig *LocalConfig, update func(metadata *FileMetadataData)) error {
+	unlock, err := localConfig.CloudStorage().Lock("file-metadata", metadataLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	gitMode := localConfig.GitMode && localConfig.GitRepoRoot != ""
+	if versioned, ok := localConfig.CloudStorage().(storage.Versioned); ok && !gitMode {
+		return updateVersionedFileMetadata(versioned, update)
+	}
+
+	metadata, err := LoadCloudFileMetadata(localConfig)
+	if err != nil {
+		return err
+	}
+	update(metadata)
+	return metadata.SaveCloudFileMetadata(localConfig)
+}
+
+// updateVersionedFileMetadata applies update to the file metadata with conditional writes
+func updateVersionedFileMetadata(versioned storage.Versioned, update func(metadata *FileMetadataData)) error {
+	return updateVersioned(versioned, FileMetadataKey, func(content []byte) ([]byte, error) {
+		metadata := NewFileMetadataData()
+		if len(content) > 0 {
+			var err error
+			if metadata, err = ParseFileMetadataData(content); err != nil {
+				return nil, err
+			}
+		}
+		update(metadata)
+		return json.MarshalIndent(metadata, "", "  ")
+	})
+}
+
+// updateVersioned replaces the file at key with the result of update applied to its content,
+// empty if it doesn't exist, only if the file is unchanged in between, retrying otherwise
+func updateVersioned(versioned storage.Versioned, key string, update func(content []byte) ([]byte, error)) error {
+	for attempt := 1; ; attempt++ {
+		content, etag, err := versioned.ReadVersion(key)
+		if err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return err
+		}
+
+		data, err := update(content)
+		if err != nil {
+			return err
+		}
+
+		err = versioned.WriteIfMatch(key, data, etag, storage.WriteOptions{})
+		if !errors.Is(err, storage.ErrConflict) || attempt == metadataUpdateAttempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+}
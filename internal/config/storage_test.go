@@ -0,0 +1,301 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// versionedStorage is a local storage with conditional writes. Before each conditional
+// write it runs the next function of race, if any, as if another computer had written in
+// between.
+type versionedStorage struct {
+	*storage.Local
+	mu     sync.Mutex
+	race   []func()
+	writes int // conditional writes that succeeded
+}
+
+func (v *versionedStorage) etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (v *versionedStorage) ReadVersion(key string) ([]byte, string, error) {
+	data, err := v.Read(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, v.etag(data), nil
+}
+
+func (v *versionedStorage) WriteIfMatch(key string, data []byte, etag string, opts storage.WriteOptions) error {
+	v.mu.Lock()
+	var race func()
+	if len(v.race) > 0 {
+		race, v.race = v.race[0], v.race[1:]
+	}
+	v.mu.Unlock()
+	if race != nil {
+		race()
+	}
+
+	current, err := v.Read(key)
+	switch {
+	case errors.Is(err, storage.ErrNotExist):
+		if etag != "" {
+			return fmt.Errorf("%s was deleted: %w", key, storage.ErrConflict)
+		}
+	case err != nil:
+		return err
+	case v.etag(current) != etag:
+		return fmt.Errorf("%s changed: %w", key, storage.ErrConflict)
+	}
+	v.writes++
+	return v.Write(key, data, opts)
+}
+
+// newVersionedConfig returns a local configuration whose cloud storage has conditional writes
+func newVersionedConfig(t *testing.T) (*LocalConfig, *versionedStorage) {
+	t.Helper()
+	localConfig := &LocalConfig{CloudSyncDir: t.TempDir(), CurrentComputer: "laptop"}
+	versioned := &versionedStorage{Local: storage.NewLocal(localConfig.CloudSyncDir)}
+	localConfig.store, localConfig.storeRoot = versioned, localConfig.CloudSyncDir
+	return localConfig, versioned
+}
+
+func TestCloudStorage(t *testing.T) {
+	localConfig := &LocalConfig{CloudSyncDir: t.TempDir()}
+	st := localConfig.CloudStorage()
+	if st != localConfig.CloudStorage() {
+		t.Error("the storage was opened again")
+	}
+	if got := st.Location(SyncItemsKey); got != filepath.Join(localConfig.CloudSyncDir, SyncItemsKey) {
+		t.Errorf("location = %s", got)
+	}
+
+	// Changing the cloud directory reopens the storage
+	localConfig.CloudSyncDir = t.TempDir()
+	if got := localConfig.CloudStorage().Location(SyncItemsKey); got != filepath.Join(localConfig.CloudSyncDir, SyncItemsKey) {
+		t.Errorf("location after the move = %s", got)
+	}
+
+	// Backends that can't be opened fail where the storage is used
+	broken := &LocalConfig{CloudSyncDir: t.TempDir(), Storage: storage.Config{Type: "ftp"}}
+	if _, err := broken.CloudStorage().Read(SyncItemsKey); err == nil {
+		t.Error("an unknown storage type was opened")
+	}
+}
+
+func TestCloudFileMetadata(t *testing.T) {
+	localConfig := &LocalConfig{CloudSyncDir: t.TempDir()}
+	metadata, err := LoadCloudFileMetadata(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata.Metadata) != 0 {
+		t.Errorf("missing metadata loaded as %v", metadata.Metadata)
+	}
+
+	err = UpdateCloudFileMetadata(localConfig, func(metadata *FileMetadataData) {
+		metadata.Metadata["Shell"] = map[string]*FileMetadata{"laptop": {CloudHash: "abc"}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storage.Exists(localConfig.CloudStorage(), FileMetadataKey) {
+		t.Fatal("the metadata was not saved to the cloud storage")
+	}
+	metadata, err = LoadCloudFileMetadata(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metadata.Metadata["Shell"]["laptop"]; got == nil || got.CloudHash != "abc" {
+		t.Errorf("saved metadata = %+v", metadata.Metadata)
+	}
+
+	// Updates wait for the metadata lock
+	unlock, err := localConfig.CloudStorage().Lock("file-metadata", metadataLockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- UpdateCloudFileMetadata(localConfig, func(metadata *FileMetadataData) {})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("the update didn't wait for the lock: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordComputerSeenKeepsConcurrentEdits(t *testing.T) {
+	localConfig, versioned := newVersionedConfig(t)
+	syncItems := NewSyncItemsData()
+	if err := syncItems.AddSyncItem("Shell", "file", map[string]string{"laptop": "/home/me/.zshrc"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncItems.SaveSyncItemsData(localConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another computer adds an item while this one records that it was seen
+	other := &LocalConfig{CloudSyncDir: localConfig.CloudSyncDir, CurrentComputer: "desktop"}
+	versioned.race = []func(){func() {
+		items, err := LoadSyncItemsData(other)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := items.AddSyncItem("Git", "file", map[string]string{"desktop": "/home/me/.gitconfig"}, nil); err != nil {
+			t.Error(err)
+		}
+		if err := items.SaveSyncItemsData(other); err != nil {
+			t.Error(err)
+		}
+	}}
+
+	if err := RecordComputerSeen(localConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := LoadSyncItemsData(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.FindSyncItem("Git") == nil {
+		t.Error("the item added by the other computer was lost")
+	}
+	if saved.FindSyncItem("Shell") == nil {
+		t.Error("the existing item was lost")
+	}
+	if info := saved.GetComputer("laptop"); info == nil || info.LastSeen == "" {
+		t.Error("the computer was not recorded")
+	}
+	if versioned.writes != 1 {
+		t.Errorf("%d conditional writes succeeded, want 1", versioned.writes)
+	}
+}
+
+func TestUpdateSyncItemsDataErrorCancelsSave(t *testing.T) {
+	localConfig, _ := newVersionedConfig(t)
+	err := UpdateSyncItemsData(localConfig, func(syncItems *SyncItemsData) error {
+		syncItems.TouchComputer("laptop")
+		return errors.New("cancelled")
+	})
+	if err == nil {
+		t.Fatal("the update error was not returned")
+	}
+	if storage.Exists(localConfig.CloudStorage(), SyncItemsKey) {
+		t.Error("sync items were saved after the update failed")
+	}
+}
+
+func TestUpdateSyncItem(t *testing.T) {
+	localConfig, versioned := newVersionedConfig(t)
+	syncItems := NewSyncItemsData()
+	if err := syncItems.AddSyncItem("Shell", "file", map[string]string{"laptop": "/home/me/.zshrc"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncItems.SaveSyncItemsData(localConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		item    string
+		update  func(item *SyncItem) error
+		wantErr string
+		want    []string
+	}{
+		{
+			name:   "an item",
+			item:   "Shell",
+			update: func(item *SyncItem) error { item.Tags = []string{"shell"}; return nil },
+			want:   []string{"shell"},
+		},
+		{
+			name:    "an update error",
+			item:    "Shell",
+			update:  func(item *SyncItem) error { item.Tags = nil; return errors.New("cancelled") },
+			wantErr: "cancelled",
+			want:    []string{"shell"},
+		},
+		{
+			name:    "an unknown item",
+			item:    "Git",
+			update:  func(item *SyncItem) error { return nil },
+			wantErr: "sync item not found: Git",
+			want:    []string{"shell"},
+		},
+	}
+	for _, test := range tests {
+		writes := versioned.writes
+		updated, err := UpdateSyncItem(localConfig, test.item, test.update)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			if versioned.writes != writes {
+				t.Errorf("%s: the sync items were saved after the update failed", test.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if updated.Name != test.item || !reflect.DeepEqual(updated.Tags, test.want) {
+			t.Errorf("%s: updated item = %+v", test.name, updated)
+		}
+
+		saved, err := LoadSyncItemsData(localConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags := saved.FindSyncItem("Shell").Tags; !reflect.DeepEqual(tags, test.want) {
+			t.Errorf("%s: saved tags = %v, want %v", test.name, tags, test.want)
+		}
+	}
+}
+
+func TestUpdateCloudFileMetadataRetriesOnConflict(t *testing.T) {
+	localConfig, versioned := newVersionedConfig(t)
+	other := &LocalConfig{CloudSyncDir: localConfig.CloudSyncDir, CurrentComputer: "desktop"}
+	versioned.race = []func(){func() {
+		metadata := NewFileMetadataData()
+		metadata.Metadata["Git"] = map[string]*FileMetadata{}
+		if err := metadata.SaveCloudFileMetadata(other); err != nil {
+			t.Error(err)
+		}
+	}}
+
+	err := UpdateCloudFileMetadata(localConfig, func(metadata *FileMetadataData) {
+		metadata.Metadata["Shell"] = map[string]*FileMetadata{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := LoadCloudFileMetadata(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := metadata.Metadata["Git"]; !ok {
+		t.Error("the metadata written by the other computer was lost")
+	}
+	if _, ok := metadata.Metadata["Shell"]; !ok {
+		t.Error("the update was lost")
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+// Commands from the shared sync items, such as item hooks and validators, can be written by
+// anyone with access to the cloud copy. Each computer only runs those it approved, by
+// keeping their hash in its local configuration.
+
+// CommandHash returns the hash under which a command is approved
+func CommandHash(command string) string {
+	return CalculateHash([]byte(command))
+}
+
+// IsTrusted reports whether a command from the shared sync items was approved on this computer
+func (c *LocalConfig) IsTrusted(command string) bool {
+	hash := CommandHash(command)
+	for _, trusted := range c.TrustedCommands {
+		if trusted == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustCommand approves a command from the shared sync items on this computer. It returns
+// false if it already was.
+func (c *LocalConfig) TrustCommand(command string) bool {
+	if c.IsTrusted(command) {
+		return false
+	}
+	c.TrustedCommands = append(c.TrustedCommands, CommandHash(command))
+	return true
+}
+
+// DistrustCommand withdraws the approval of a command. It returns false if it wasn't approved.
+func (c *LocalConfig) DistrustCommand(command string) bool {
+	hash := CommandHash(command)
+	for i, trusted := range c.TrustedCommands {
+		if trusted == hash {
+			c.TrustedCommands = append(c.TrustedCommands[:i], c.TrustedCommands[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
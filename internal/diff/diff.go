@@ -2,11 +2,16 @@ package diff
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
 )
 
 // DiffLine represents a line in a diff
@@ -19,7 +24,7 @@ type DiffLine struct {
 // FileDiff represents the difference between two files
 type FileDiff struct {
 	LocalPath    string
-	CloudPath    string
+	CloudPath    string // Key of the cloud copy in the cloud storage
 	LocalExists  bool
 	CloudExists  bool
 	LocalModTime time.Time
@@ -28,26 +33,75 @@ type FileDiff struct {
 	Lines        []DiffLine
 }
 
+// ErrBinaryFile is returned when a line diff is requested for binary content
+var ErrBinaryFile = errors.New("binary file")
+
+// ErrFileTooLarge is returned when a file exceeds maxDiffFileSize
+var ErrFileTooLarge = errors.New("file too large to diff")
+
+// maxDiffFileSize is the largest file for which a line diff is generated
+const maxDiffFileSize = 4 * 1024 * 1024
+
+// ContentDecoder turns stored cloud content into plaintext (e.g. decrypts it)
+type ContentDecoder func(data []byte) ([]byte, error)
+
 // DiffEngine handles file comparison and diff generation
 type DiffEngine struct {
 	// No longer needs config - operates independently
+	cloudDecoder ContentDecoder  // Optional decoder applied to cloud file contents
+	cloud        storage.Storage // Storage holding the cloud files
+	exclude      ExcludeFunc     // Optional filter of the paths inside items left out of the diff
 }
 
-// NewDiffEngine creates a new diff engine
+// ExcludeFunc reports whether the slash-separated path rel inside an item is left out
+type ExcludeFunc func(rel string, isDir bool) bool
+
+// NewDiffEngine creates a new diff engine. Until a storage is set, cloud keys are read as
+// paths on this computer.
 func NewDiffEngine() *DiffEngine {
-	return &DiffEngine{}
+	return &DiffEngine{cloud: storage.NewLocal("")}
+}
+
+// SetStorage sets the storage the cloud files are read from
+func (d *DiffEngine) SetStorage(cloud storage.Storage) {
+	d.cloud = cloud
+}
+
+// SetCloudDecoder sets the decoder applied to cloud file contents before comparing them
+func (d *DiffEngine) SetCloudDecoder(decoder ContentDecoder) {
+	d.cloudDecoder = decoder
+}
+
+// SetExclude sets the filter of the paths inside items that are not synced, and so left out
+// of item diffs
+func (d *DiffEngine) SetExclude(exclude ExcludeFunc) {
+	d.exclude = exclude
+}
+
+// excluded reports whether the path rel inside an item is left out of its diff
+func (d *DiffEngine) excluded(rel string, isDir bool) bool {
+	return d.exclude != nil && rel != "." && d.exclude(filepath.ToSlash(rel), isDir)
 }
 
-// CompareFiles compares two files and returns their diff
-func (d *DiffEngine) CompareFiles(localPath, cloudPath string) (*FileDiff, error) {
+// readCloudFile reads a cloud file and decodes it
+func (d *DiffEngine) readCloudFile(key string) ([]byte, error) {
+	data, err := d.cloud.Read(key)
+	if err != nil || d.cloudDecoder == nil {
+		return data, err
+	}
+	return d.cloudDecoder(data)
+}
+
+// CompareFiles compares a local file with the cloud file at cloudKey and returns their diff
+func (d *DiffEngine) CompareFiles(localPath, cloudKey string) (*FileDiff, error) {
 	diff := &FileDiff{
 		LocalPath: localPath,
-		CloudPath: cloudPath,
+		CloudPath: cloudKey,
 	}
 
 	// Check if files exist
 	localInfo, localErr := os.Stat(localPath)
-	cloudInfo, cloudErr := os.Stat(cloudPath)
+	cloudInfo, cloudErr := d.cloud.Stat(cloudKey)
 
 	diff.LocalExists = localErr == nil
 	diff.CloudExists = cloudErr == nil
@@ -56,7 +110,7 @@ func (d *DiffEngine) CompareFiles(localPath, cloudPath string) (*FileDiff, error
 		diff.LocalModTime = localInfo.ModTime()
 	}
 	if diff.CloudExists {
-		diff.CloudModTime = cloudInfo.ModTime()
+		diff.CloudModTime = cloudInfo.ModTime
 	}
 
 	// Determine status
@@ -74,7 +128,7 @@ func (d *DiffEngine) CompareFiles(localPath, cloudPath string) (*FileDiff, error
 	}
 
 	// Both files exist, compare content and timestamps
-	contentSame, err := d.compareFileContent(localPath, cloudPath)
+	contentSame, err := d.compareFileContent(localPath, cloudKey)
 	if err != nil {
 		return nil, err
 	}
@@ -93,8 +147,8 @@ func (d *DiffEngine) CompareFiles(localPath, cloudPath string) (*FileDiff, error
 	}
 
 	// Generate line-by-line diff for text files
-	if d.isTextFile(localPath) && d.isTextFile(cloudPath) {
-		diff.Lines, err = d.generateLineDiff(localPath, cloudPath)
+	if d.isTextFile(localPath) && d.isTextFile(cloudKey) {
+		diff.Lines, err = d.generateLineDiff(localPath, cloudKey)
 		if err != nil {
 			return nil, err
 		}
@@ -103,14 +157,68 @@ func (d *DiffEngine) CompareFiles(localPath, cloudPath string) (*FileDiff, error
 	return diff, nil
 }
 
-// compareFileContent compares the content of two files
-func (d *DiffEngine) compareFileContent(path1, path2 string) (bool, error) {
-	content1, err := os.ReadFile(path1)
+// compareEntries compares the entry file below the local and cloud item roots. Symlinks
+// are compared by their target, as stored in the cloud, instead of being followed.
+func (d *DiffEngine) compareEntries(localRoot, cloudRoot, file string) (*FileDiff, error) {
+	localPath := filepath.Join(localRoot, file)
+	cloudKey := storage.Join(cloudRoot, filepath.ToSlash(file))
+
+	localInfo, localErr := os.Lstat(localPath)
+	cloudInfo, cloudErr := d.cloud.Stat(cloudKey)
+	localLink := localErr == nil && localInfo.Mode()&os.ModeSymlink != 0
+	cloudLink := cloudErr == nil && cloudInfo.IsLink()
+	if !localLink && !cloudLink {
+		return d.CompareFiles(localPath, cloudKey)
+	}
+
+	diff := &FileDiff{
+		LocalPath:   localPath,
+		CloudPath:   cloudKey,
+		LocalExists: localErr == nil,
+		CloudExists: cloudErr == nil,
+	}
+	if diff.LocalExists {
+		diff.LocalModTime = localInfo.ModTime()
+	}
+	if diff.CloudExists {
+		diff.CloudModTime = cloudInfo.ModTime
+	}
+
+	switch {
+	case !diff.LocalExists:
+		diff.Status = "cloud_only"
+	case !diff.CloudExists:
+		diff.Status = "local_only"
+	case localLink && cloudLink && readLink(localRoot, localPath) == cloudInfo.Link:
+		diff.Status = "same"
+	case diff.LocalModTime.After(diff.CloudModTime):
+		diff.Status = "local_newer"
+	case diff.CloudModTime.After(diff.LocalModTime):
+		diff.Status = "cloud_newer"
+	default:
+		diff.Status = "conflict"
+	}
+
+	return diff, nil
+}
+
+// readLink returns the target of a symlink below root as it is stored, or "" if it can't be read
+func readLink(root, path string) string {
+	target, _, err := config.ReadItemLink(root, path)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// compareFileContent compares the content of a local and a cloud file
+func (d *DiffEngine) compareFileContent(localPath, cloudKey string) (bool, error) {
+	content1, err := os.ReadFile(localPath)
 	if err != nil {
 		return false, err
 	}
 
-	content2, err := os.ReadFile(path2)
+	content2, err := d.readCloudFile(cloudKey)
 	if err != nil {
 		return false, err
 	}
@@ -118,31 +226,96 @@ func (d *DiffEngine) compareFileContent(path1, path2 string) (bool, error) {
 	return string(content1) == string(content2), nil
 }
 
-// generateLineDiff generates a line-by-line diff between two files
-func (d *DiffEngine) generateLineDiff(path1, path2 string) ([]DiffLine, error) {
-	lines1, err := d.readFileLines(path1)
+// generateLineDiff generates a line-by-line diff between a local and a cloud file
+func (d *DiffEngine) generateLineDiff(localPath, cloudKey string) ([]DiffLine, error) {
+	content1, err := os.ReadFile(localPath)
 	if err != nil {
 		return nil, err
 	}
 
-	lines2, err := d.readFileLines(path2)
+	content2, err := d.readCloudFile(cloudKey)
 	if err != nil {
 		return nil, err
 	}
 
-	return d.computeDiff(lines1, lines2), nil
-}
+	lines1, err := d.splitLines(content1)
+	if err != nil {
+		return nil, err
+	}
 
-// readFileLines reads a file and returns its lines
-func (d *DiffEngine) readFileLines(path string) ([]string, error) {
-	file, err := os.Open(path)
+	lines2, err := d.splitLines(content2)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
+	return d.computeDiff(lines1, lines2), nil
+}
+
+// GenerateFileDiff returns a line diff between a local file and the cloud file at cloudKey
+// for display. A missing file is treated as empty. Binary files and files larger than
+// maxDiffFileSize return ErrBinaryFile and ErrFileTooLarge respectively.
+func (d *DiffEngine) GenerateFileDiff(localPath, cloudKey string) ([]DiffLine, error) {
+	var contents [2][]string
+
+	for i := range contents {
+		var size int64
+		var err error
+		if i == 0 {
+			var info os.FileInfo
+			if info, err = os.Stat(localPath); err == nil {
+				size = info.Size()
+			}
+		} else {
+			var info storage.FileInfo
+			if info, err = d.cloud.Stat(cloudKey); err == nil {
+				size = info.Size
+			}
+		}
+		if errors.Is(err, storage.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if size > maxDiffFileSize {
+			return nil, ErrFileTooLarge
+		}
+
+		var data []byte
+		if i == 0 {
+			data, err = os.ReadFile(localPath)
+		} else {
+			data, err = d.readCloudFile(cloudKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if d.isBinaryContent(data) {
+			return nil, ErrBinaryFile
+		}
+		contents[i], err = d.splitLines(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d.computeDiff(contents[0], contents[1]), nil
+}
+
+// isBinaryContent reports whether content looks binary by checking for NUL bytes near its start
+func (d *DiffEngine) isBinaryContent(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// splitLines splits content into lines
+func (d *DiffEngine) splitLines(data []byte) ([]string, error) {
 	var lines []string
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDiffFileSize)
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
 	}
@@ -150,60 +323,143 @@ func (d *DiffEngine) readFileLines(path string) ([]string, error) {
 	return lines, scanner.Err()
 }
 
-// computeDiff computes the diff between two sets of lines
-// This is a simple implementation - in a real application you'd want to use a proper diff algorithm
+// DiffLines computes the line diff between two sets of lines. Line numbers of
+// "same" and "removed" lines refer to lines1, those of "added" lines to lines2.
+func (d *DiffEngine) DiffLines(lines1, lines2 []string) []DiffLine {
+	return d.computeDiff(lines1, lines2)
+}
+
+// computeDiff computes the diff between two sets of lines using Myers' algorithm.
+// Common prefix and suffix lines are trimmed first so that typical config edits stay cheap.
 func (d *DiffEngine) computeDiff(lines1, lines2 []string) []DiffLine {
 	var diff []DiffLine
 
-	maxLen := len(lines1)
-	if len(lines2) > maxLen {
-		maxLen = len(lines2)
+	// Trim common prefix
+	prefix := 0
+	for prefix < len(lines1) && prefix < len(lines2) && lines1[prefix] == lines2[prefix] {
+		prefix++
+	}
+
+	// Trim common suffix
+	suffix := 0
+	for suffix < len(lines1)-prefix && suffix < len(lines2)-prefix &&
+		lines1[len(lines1)-1-suffix] == lines2[len(lines2)-1-suffix] {
+		suffix++
+	}
+
+	for i := 0; i < prefix; i++ {
+		diff = append(diff, DiffLine{LineNumber: i + 1, Content: lines1[i], Type: "same"})
 	}
 
-	for i := 0; i < maxLen; i++ {
-		line1 := ""
-		line2 := ""
+	middle1 := lines1[prefix : len(lines1)-suffix]
+	middle2 := lines2[prefix : len(lines2)-suffix]
+	diff = append(diff, d.myersDiff(middle1, middle2, prefix)...)
+
+	for i := len(lines1) - suffix; i < len(lines1); i++ {
+		diff = append(diff, DiffLine{LineNumber: i + 1, Content: lines1[i], Type: "same"})
+	}
 
-		if i < len(lines1) {
-			line1 = lines1[i]
+	return diff
+}
+
+// maxEditDistance bounds the work done by myersDiff; beyond it the changed
+// region is reported as a single removed block followed by an added block
+const maxEditDistance = 1000
+
+// myersDiff computes the shortest edit script between two sets of lines.
+// offset is added to line numbers so they refer to positions in the original files.
+func (d *DiffEngine) myersDiff(lines1, lines2 []string, offset int) []DiffLine {
+	n, m := len(lines1), len(lines2)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	maxD := n + m
+	if maxD > maxEditDistance {
+		maxD = maxEditDistance
+	}
+
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+	found := false
+
+	for dist := 0; dist <= maxD && !found; dist++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -dist; k <= dist; k += 2 {
+			var x int
+			if k == -dist || (k != dist && v[maxD+k-1] < v[maxD+k+1]) {
+				x = v[maxD+k+1] // move down (insertion)
+			} else {
+				x = v[maxD+k-1] + 1 // move right (deletion)
+			}
+			y := x - k
+			for x < n && y < m && lines1[x] == lines2[y] {
+				x++
+				y++
+			}
+			v[maxD+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		// Too many changes for a precise diff - report the whole region as replaced
+		var diff []DiffLine
+		for i, line := range lines1 {
+			diff = append(diff, DiffLine{LineNumber: offset + i + 1, Content: line, Type: "removed"})
 		}
-		if i < len(lines2) {
-			line2 = lines2[i]
+		for i, line := range lines2 {
+			diff = append(diff, DiffLine{LineNumber: offset + i + 1, Content: line, Type: "added"})
 		}
+		return diff
+	}
+
+	// Backtrack through the trace to recover the edit script
+	var reversed []DiffLine
+	x, y := n, m
+	for dist := len(trace) - 1; dist >= 0; dist-- {
+		snapshot := trace[dist]
+		k := x - y
 
-		if line1 == line2 {
-			diff = append(diff, DiffLine{
-				LineNumber: i + 1,
-				Content:    line1,
-				Type:       "same",
-			})
-		} else if line1 == "" {
-			diff = append(diff, DiffLine{
-				LineNumber: i + 1,
-				Content:    line2,
-				Type:       "added",
-			})
-		} else if line2 == "" {
-			diff = append(diff, DiffLine{
-				LineNumber: i + 1,
-				Content:    line1,
-				Type:       "removed",
-			})
+		var prevK int
+		if k == -dist || (k != dist && snapshot[maxD+k-1] < snapshot[maxD+k+1]) {
+			prevK = k + 1
 		} else {
-			// Both lines exist but are different
-			diff = append(diff, DiffLine{
-				LineNumber: i + 1,
-				Content:    "- " + line1,
-				Type:       "removed",
-			})
-			diff = append(diff, DiffLine{
-				LineNumber: i + 1,
-				Content:    "+ " + line2,
-				Type:       "added",
-			})
+			prevK = k - 1
+		}
+		prevX := 0
+		if dist > 0 {
+			prevX = snapshot[maxD+prevK]
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, DiffLine{LineNumber: offset + x + 1, Content: lines1[x], Type: "same"})
+		}
+
+		if dist > 0 {
+			if x == prevX {
+				y--
+				reversed = append(reversed, DiffLine{LineNumber: offset + y + 1, Content: lines2[y], Type: "added"})
+			} else {
+				x--
+				reversed = append(reversed, DiffLine{LineNumber: offset + x + 1, Content: lines1[x], Type: "removed"})
+			}
 		}
 	}
 
+	diff := make([]DiffLine, len(reversed))
+	for i, line := range reversed {
+		diff[len(reversed)-1-i] = line
+	}
 	return diff
 }
 
@@ -221,8 +477,8 @@ func (d *DiffEngine) isTextFile(path string) bool {
 	return false
 }
 
-// GetSyncItemDiff returns the diff for all files in a sync item
-func (d *DiffEngine) GetSyncItemDiff(localPath, cloudPath string) (map[string]*FileDiff, error) {
+// GetSyncItemDiff returns the diff for all files in a sync item, whose cloud copy is at cloudKey
+func (d *DiffEngine) GetSyncItemDiff(localPath, cloudKey string) (map[string]*FileDiff, error) {
 	diffs := make(map[string]*FileDiff)
 
 	if localPath == "" {
@@ -235,8 +491,8 @@ func (d *DiffEngine) GetSyncItemDiff(localPath, cloudPath string) (map[string]*F
 		return nil, err
 	}
 
-	cloudFiles, err := d.getFilesInDirectory(cloudPath)
-	if err != nil && !os.IsNotExist(err) {
+	cloudFiles, err := d.getCloudFiles(cloudKey)
+	if err != nil {
 		return nil, err
 	}
 
@@ -251,10 +507,13 @@ func (d *DiffEngine) GetSyncItemDiff(localPath, cloudPath string) (map[string]*F
 
 	// Compare each file
 	for file := range allFiles {
-		localFilePath := filepath.Join(localPath, file)
-		cloudFilePath := filepath.Join(cloudPath, file)
-
-		diff, err := d.CompareFiles(localFilePath, cloudFilePath)
+		// The item root is followed; links below it are compared as links
+		var diff *FileDiff
+		if file == "." {
+			diff, err = d.CompareFiles(localPath, cloudKey)
+		} else {
+			diff, err = d.compareEntries(localPath, cloudKey, file)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -265,20 +524,44 @@ func (d *DiffEngine) GetSyncItemDiff(localPath, cloudPath string) (map[string]*F
 	return diffs, nil
 }
 
-// getFilesInDirectory returns all files in a directory (recursively)
+// getFilesInDirectory returns all files in a directory (recursively). Symlinks below the
+// directory are listed but not followed; links pointing outside it and special files are
+// left out, matching how they are synced.
 func (d *DiffEngine) getFilesInDirectory(dirPath string) ([]string, error) {
 	var files []string
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	// Follow the directory itself when it is a link, e.g. a local path deployed as a symlink
+	root := dirPath
+	if resolved, err := filepath.EvalSymlinks(dirPath); err == nil {
+		root = resolved
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if !info.IsDir() {
-			relPath, err := filepath.Rel(dirPath, path)
-			if err != nil {
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if d.excluded(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if _, inside, err := config.ReadItemLink(root, path); err != nil || !inside {
 				return err
 			}
+		case !info.IsDir() && !info.Mode().IsRegular():
+			return nil // Special files are not synced
+		}
+
+		if !info.IsDir() {
 			files = append(files, relPath)
 		}
 
@@ -287,3 +570,38 @@ func (d *DiffEngine) getFilesInDirectory(dirPath string) ([]string, error) {
 
 	return files, err
 }
+
+// getCloudFiles returns all files below key in the cloud storage, as paths relative to key
+// like getFilesInDirectory. A file at key is returned as ".". Provider conflict copies and
+// excluded files are left out, since they are never pulled.
+func (d *DiffEngine) getCloudFiles(key string) ([]string, error) {
+	entries, err := d.cloud.List(key)
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make(map[string]bool)
+	for _, conflict := range config.ConflictCopies(entries, nil) {
+		copies[conflict.Key] = true
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir || copies[entry.Key] {
+			continue
+		}
+		if entry.IsLink() {
+			if _, inside := storage.LinkTarget(key, entry); !inside {
+				continue
+			}
+		}
+
+		rel, ok := storage.Rel(key, entry.Key)
+		if !ok || d.excluded(rel, false) {
+			continue
+		}
+		files = append(files, filepath.FromSlash(rel))
+	}
+
+	return files, nil
+}
@@ -0,0 +1,333 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// format renders diff lines one per line as "<type marker><line number> <content>", the
+// marker being " " for same, "-" for removed and "+" for added lines
+func format(lines []DiffLine) string {
+	var b strings.Builder
+	for _, line := range lines {
+		marker := " "
+		switch line.Type {
+		case "removed":
+			marker = "-"
+		case "added":
+			marker = "+"
+		}
+		fmt.Fprintf(&b, "%s%d %s\n", marker, line.LineNumber, line.Content)
+	}
+	return b.String()
+}
+
+// lines splits text into lines, an empty text having none
+func lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func TestComputeDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{name: "both empty", want: ""},
+		{name: "same", before: "a\nb", after: "a\nb", want: " 1 a\n 2 b\n"},
+		{name: "created", after: "a\nb", want: "+1 a\n+2 b\n"},
+		{name: "emptied", before: "a\nb", want: "-1 a\n-2 b\n"},
+		{
+			name:   "changed line keeps its context",
+			before: "set number\nset nowrap\nsyntax on",
+			after:  "set number\nset wrap\nsyntax on",
+			want:   " 1 set number\n-2 set nowrap\n+2 set wrap\n 3 syntax on\n",
+		},
+		{
+			name:   "inserted lines are numbered in the new file",
+			before: "a\nd",
+			after:  "a\nb\nc\nd",
+			want:   " 1 a\n+2 b\n+3 c\n 2 d\n",
+		},
+		{
+			name:   "removed lines are numbered in the old file",
+			before: "a\nb\nc\nd",
+			after:  "a\nd",
+			want:   " 1 a\n-2 b\n-3 c\n 4 d\n",
+		},
+		{
+			name:   "changes at both ends",
+			before: "old first\nkept\nold last",
+			after:  "new first\nkept\nnew last",
+			want:   "-1 old first\n+1 new first\n 2 kept\n-3 old last\n+3 new last\n",
+		},
+		{
+			// The example of Myers' paper, whose shortest edit script has 5 edits
+			name:   "shortest edit script",
+			before: "A\nB\nC\nA\nB\nB\nA",
+			after:  "C\nB\nA\nB\nA\nC",
+			want:   "-1 A\n-2 B\n 3 C\n+2 B\n 4 A\n 5 B\n-6 B\n 7 A\n+6 C\n",
+		},
+	}
+
+	engine := NewDiffEngine()
+	for _, test := range tests {
+		if got := format(engine.computeDiff(lines(test.before), lines(test.after))); got != test.want {
+			t.Errorf("%s: diff =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence of two sets of lines
+func lcsLength(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] > lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	return lengths[0][0]
+}
+
+func TestComputeDiffIsAShortestEditScript(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return lines
+	}
+
+	engine := NewDiffEngine()
+	for i := 0; i < 500; i++ {
+		before, after := randomLines(), randomLines()
+		diff := engine.computeDiff(before, after)
+
+		var old, new []string
+		same := 0
+		for _, line := range diff {
+			switch line.Type {
+			case "same":
+				old, new = append(old, line.Content), append(new, line.Content)
+				same++
+			case "removed":
+				old = append(old, line.Content)
+			case "added":
+				new = append(new, line.Content)
+			}
+		}
+		if strings.Join(old, "\n") != strings.Join(before, "\n") || strings.Join(new, "\n") != strings.Join(after, "\n") {
+			t.Fatalf("the diff of %q and %q doesn't rebuild them:\n%s", before, after, format(diff))
+		}
+		if want := lcsLength(before, after); same != want {
+			t.Fatalf("the diff of %q and %q keeps %d lines, want %d", before, after, same, want)
+		}
+	}
+}
+
+func TestComputeDiffBoundsTheEditDistance(t *testing.T) {
+	before, after := make([]string, 800), make([]string, 800)
+	for i := range before {
+		before[i], after[i] = fmt.Sprintf("old %d", i), fmt.Sprintf("new %d", i)
+	}
+	before = append([]string{"header"}, before...)
+	after = append([]string{"header"}, after...)
+
+	diff := NewDiffEngine().computeDiff(before, after)
+	if len(diff) != 1+800+800 {
+		t.Fatalf("diff has %d lines, want %d", len(diff), 1+800+800)
+	}
+	if diff[0].Type != "same" || diff[1].Type != "removed" || diff[1].LineNumber != 2 ||
+		diff[800].Type != "removed" || diff[801].Type != "added" || diff[801].LineNumber != 2 {
+		t.Errorf("a region beyond the edit distance isn't reported as removed then added:\n%s", format(diff[:3]))
+	}
+}
+
+// writeFile writes a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGenerateFileDiff(t *testing.T) {
+	engine := NewDiffEngine()
+	local := writeFile(t, "local", []byte("a\nb\n"))
+	cloud := writeFile(t, "cloud", []byte("a\nc\n"))
+	missing := filepath.Join(t.TempDir(), "missing")
+	empty := writeFile(t, "empty", nil)
+
+	tests := []struct {
+		name         string
+		local, cloud string
+		want         string
+	}{
+		{"changed", local, cloud, " 1 a\n-2 b\n+2 c\n"},
+		{"missing cloud file", local, missing, "-1 a\n-2 b\n"},
+		{"missing local file", missing, cloud, "+1 a\n+2 c\n"},
+		{"empty file", empty, cloud, "+1 a\n+2 c\n"},
+		{"both missing", missing, missing, ""},
+	}
+	for _, test := range tests {
+		diff, err := engine.GenerateFileDiff(test.local, test.cloud)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := format(diff); got != test.want {
+			t.Errorf("%s: diff =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGenerateFileDiffRefusesBinaryAndLargeFiles(t *testing.T) {
+	engine := NewDiffEngine()
+	text := writeFile(t, "text", []byte("a\n"))
+
+	binary := writeFile(t, "binary", append([]byte("PNG"), 0, 1, 2))
+	if _, err := engine.GenerateFileDiff(text, binary); !errors.Is(err, ErrBinaryFile) {
+		t.Errorf("diff with a binary file returned %v, want ErrBinaryFile", err)
+	}
+
+	// NUL bytes past the start of a file don't make it binary
+	late := writeFile(t, "late", append([]byte(strings.Repeat("a\n", 5000)), 0))
+	if _, err := engine.GenerateFileDiff(late, text); err != nil {
+		t.Errorf("diff with a NUL byte after 8000 bytes returned %v", err)
+	}
+
+	limit := []byte(strings.Repeat(strings.Repeat("x", 63)+"\n", maxDiffFileSize/64))
+	atLimit := writeFile(t, "at-limit", limit)
+	if diff, err := engine.GenerateFileDiff(atLimit, atLimit); err != nil || len(diff) != maxDiffFileSize/64 {
+		t.Errorf("diff of a file of %d bytes returned %d lines, %v", len(limit), len(diff), err)
+	}
+	tooLarge := writeFile(t, "too-large", append(limit, 'x'))
+	if _, err := engine.GenerateFileDiff(text, tooLarge); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("diff with a file over %d bytes returned %v, want ErrFileTooLarge", maxDiffFileSize, err)
+	}
+
+	// Lines longer than the default scanner buffer are read whole
+	long := strings.Repeat("y", 200*1024)
+	longLine := writeFile(t, "long-line", []byte(long+"\n"))
+	if diff, err := engine.GenerateFileDiff(longLine, text); err != nil || len(diff) != 2 || diff[0].Content != long {
+		t.Errorf("diff with a %d byte line returned %d lines, %v", len(long), len(diff), err)
+	}
+}
+
+func TestGetSyncItemDiff(t *testing.T) {
+	local, cloud := t.TempDir(), t.TempDir()
+	files := map[string][2]string{ // path -> local and cloud content, empty if missing
+		"same.conf":          {"same", "same"},
+		"edited/local.conf":  {"edited here", "old"},
+		"edited/cloud.conf":  {"old", "edited there"},
+		"local-only.conf":    {"new", ""},
+		"cloud/only/in.conf": {"", "new"},
+	}
+	older, newer := time.Now().Add(-time.Hour), time.Now()
+	for name, contents := range files {
+		for i, root := range []string{local, cloud} {
+			if contents[i] == "" {
+				continue
+			}
+			path := filepath.Join(root, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(contents[i]), 0644); err != nil {
+				t.Fatal(err)
+			}
+			modTime := older
+			if (name == "edited/local.conf") == (root == local) {
+				modTime = newer
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	diffs, err := NewDiffEngine().GetSyncItemDiff(local, cloud)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"same.conf":          "same",
+		"edited/local.conf":  "local_newer",
+		"edited/cloud.conf":  "cloud_newer",
+		"local-only.conf":    "local_only",
+		"cloud/only/in.conf": "cloud_only",
+	}
+	if len(diffs) != len(want) {
+		t.Errorf("GetSyncItemDiff returned %d files, want %d", len(diffs), len(want))
+	}
+	for name, status := range want {
+		if diff := diffs[filepath.FromSlash(name)]; diff == nil || diff.Status != status {
+			t.Errorf("status of %s = %+v, want %s", name, diff, status)
+		}
+	}
+	if got := format(diffs["same.conf"].Lines); got != " 1 same\n" {
+		t.Errorf("lines of same.conf = %q", got)
+	}
+}
+
+func TestGetFilesInDirectoryWithSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"init.lua": "set number", "lua/plugins.lua": "return {}"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{"alias.lua": "init.lua", "self": ".", "lua/parent": "..", "escaping": "/etc/passwd"}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A local path deployed as a link to the item is listed like the item itself
+	linked := filepath.Join(t.TempDir(), "linked")
+	if err := os.Symlink(dir, linked); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range []string{dir, linked} {
+		files, err := NewDiffEngine().getFilesInDirectory(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, len(files))
+		for i, file := range files {
+			got[i] = filepath.ToSlash(file)
+		}
+		if want := "alias.lua init.lua lua/parent lua/plugins.lua self"; strings.Join(got, " ") != want {
+			t.Errorf("files of %s = %v, want %s", root, got, want)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// PassphraseEnv is the environment variable read for passphrase-derived keys
+const PassphraseEnv = "SYNCSTATION_PASSPHRASE"
+
+// KeySize is the size of an encryption key in bytes
+const KeySize = chacha20poly1305.KeySize
+
+// Argon2id parameters used for new passphrase-derived keys
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024
+	kdfThreads = 4
+	saltSize   = 16
+)
+
+// magic identifies encrypted files: "SSENC" followed by the format version
+var magic = []byte("SSENC\x01")
+
+// keyIDSize is the number of key fingerprint bytes stored in each file header
+const keyIDSize = 8
+
+// headerSize is the size of the header preceding the ciphertext
+var headerSize = len(magic) + keyIDSize + chacha20poly1305.NonceSizeX
+
+var (
+	// ErrNoKey is returned when encrypted content is found but no key is available
+	ErrNoKey = errors.New("no encryption key available on this computer")
+
+	// ErrWrongKey is returned when content was encrypted with a different key
+	ErrWrongKey = errors.New("content was encrypted with a different key")
+
+	// ErrCorrupted is returned when encrypted content fails authentication
+	ErrCorrupted = errors.New("encrypted content is corrupted or was tampered with")
+)
+
+// Cipher encrypts and decrypts file contents with XChaCha20-Poly1305
+type Cipher struct {
+	key   []byte
+	keyID string
+}
+
+// NewCipher creates a cipher from a 32-byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size: %d bytes, expected %d", len(key), KeySize)
+	}
+	return &Cipher{key: key, keyID: KeyID(key)}, nil
+}
+
+// KeyID returns the fingerprint identifying a key
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("syncstation-key-id:"), key...))
+	return hex.EncodeToString(sum[:keyIDSize])
+}
+
+// KeyID returns the fingerprint of the cipher's key
+func (c *Cipher) KeyID() string {
+	return c.keyID
+}
+
+// Encrypt encrypts plaintext into the syncstation encrypted file format
+func (c *Cipher) Encrypt(plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := hex.DecodeString(c.keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, keyID...)
+
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header = append(header, nonce...)
+
+	// The header is authenticated so the key ID and nonce can't be swapped
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// Decrypt decrypts content produced by Encrypt
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) || len(data) < headerSize {
+		return nil, ErrCorrupted
+	}
+
+	keyID := hex.EncodeToString(data[len(magic) : len(magic)+keyIDSize])
+	if keyID != c.keyID {
+		return nil, fmt.Errorf("%w (file key %s, current key %s)", ErrWrongKey, keyID, c.keyID)
+	}
+
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := data[:headerSize]
+	nonce := header[len(magic)+keyIDSize:]
+	plaintext, err := aead.Open(nil, nonce, data[headerSize:], header)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether content starts with the encrypted file header
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// GenerateKey returns a new random key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// NewPassphraseSettings generates a salt and KDF parameters for a passphrase-derived key
+func NewPassphraseSettings() (*config.EncryptionData, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return &config.EncryptionData{
+		KDF:     "argon2id",
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Time:    kdfTime,
+		Memory:  kdfMemory,
+		Threads: kdfThreads,
+	}, nil
+}
+
+// DeriveKey derives a key from a passphrase using the KDF settings
+func DeriveKey(passphrase string, settings *config.EncryptionData) ([]byte, error) {
+	if settings.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation function: %q", settings.KDF)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(settings.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+
+	return argon2.IDKey([]byte(passphrase), salt, settings.Time, settings.Memory, settings.Threads, KeySize), nil
+}
+
+// LoadKeyFile reads a base64-encoded key file
+func LoadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(config.ExpandPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key file %s: wrong key size", path)
+	}
+	return key, nil
+}
+
+// SaveKeyFile writes a key as base64 to a file only readable by the current user
+func SaveKeyFile(path string, key []byte) error {
+	path = config.ExpandPath(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	content := base64.StdEncoding.EncodeToString(key) + "\n"
+	if err := writeFileAtomic(path, []byte(content), 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+// LoadCipher loads the key of this computer and checks it against the cloud settings.
+// The key file configured in localConfig is used first, then a passphrase from PassphraseEnv.
+func LoadCipher(localConfig *config.LocalConfig, settings *config.EncryptionData) (*Cipher, error) {
+	var key []byte
+
+	if localConfig.KeyFile != "" && config.PathExists(config.ExpandPath(localConfig.KeyFile)) {
+		fileKey, err := LoadKeyFile(localConfig.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = fileKey
+	} else if passphrase := os.Getenv(PassphraseEnv); passphrase != "" && settings.KDF != "" {
+		derivedKey, err := DeriveKey(passphrase, settings)
+		if err != nil {
+			return nil, err
+		}
+		key = derivedKey
+	} else {
+		return nil, fmt.Errorf("%w: run 'syncstation keys init' or set %s", ErrNoKey, PassphraseEnv)
+	}
+
+	cipher, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.KeyID != "" && cipher.KeyID() != settings.KeyID {
+		return nil, fmt.Errorf("%w: this computer has key %s but the cloud uses %s", ErrWrongKey, cipher.KeyID(), settings.KeyID)
+	}
+
+	return cipher, nil
+}
+
+// Codec applies the encryption settings to cloud file contents.
+// Settings and keys are loaded lazily on first use, so computers without a key
+// can still work with unencrypted items.
+type Codec struct {
+	localConfig *config.LocalConfig
+
+	once     gosync.Once
+	settings *config.EncryptionData
+	cipher   *Cipher
+	err      error
+}
+
+// NewCodec creates a codec for the cloud directory of localConfig
+func NewCodec(localConfig *config.LocalConfig) *Codec {
+	return &Codec{localConfig: localConfig}
+}
+
+// load reads the cloud encryption settings and the key of this computer
+func (c *Codec) load() {
+	c.once.Do(func() {
+		settings, err := config.LoadEncryptionData(c.localConfig)
+		if err != nil {
+			c.settings = &config.EncryptionData{}
+			c.err = fmt.Errorf("failed to load encryption settings: %w", err)
+			return
+		}
+		c.settings = settings
+
+		if settings.Enabled() {
+			c.cipher, c.err = LoadCipher(c.localConfig, settings)
+		}
+	})
+}
+
+// ShouldEncrypt reports whether the cloud copy of an item is stored encrypted
+func (c *Codec) ShouldEncrypt(item *config.SyncItem) bool {
+	c.load()
+	return c.settings.IsItemEncrypted(item)
+}
+
+// Encode encrypts content for an item's cloud copy if the item is encrypted
+func (c *Codec) Encode(item *config.SyncItem, data []byte) ([]byte, error) {
+	if !c.ShouldEncrypt(item) {
+		return data, nil
+	}
+	return c.Encrypt(data)
+}
+
+// Encrypt encrypts content regardless of the item settings
+func (c *Codec) Encrypt(data []byte) ([]byte, error) {
+	if err := c.CanEncrypt(); err != nil {
+		return nil, err
+	}
+	return c.cipher.Encrypt(data)
+}
+
+// CanEncrypt returns an error if encryption is not set up or no key is available
+func (c *Codec) CanEncrypt() error {
+	c.load()
+	if c.err != nil {
+		return c.err
+	}
+	if c.cipher == nil {
+		return fmt.Errorf("encryption is not set up. Run 'syncstation keys init' first")
+	}
+	return nil
+}
+
+// Decode decrypts cloud content if it is encrypted, returning plaintext content unchanged
+func (c *Codec) Decode(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	c.load()
+	if c.cipher == nil {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, fmt.Errorf("%w: run 'syncstation keys init'", ErrNoKey)
+	}
+	return c.cipher.Decrypt(data)
+}
+
+// ReadFile reads the cloud file at key and returns its plaintext content
+func (c *Codec) ReadFile(st storage.Storage, key string) ([]byte, error) {
+	data, err := st.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decode(data)
+}
+
+// HashFile returns the hash of the plaintext content of the cloud file at key
+func (c *Codec) HashFile(st storage.Storage, key string) (string, error) {
+	data, err := c.ReadFile(st, key)
+	if err != nil {
+		return "", err
+	}
+	return config.CalculateHash(data), nil
+}
+
+// RewriteFiles applies transform to the content of every file at or below key in a storage.
+// All files are transformed in memory first so that a failure leaves the tree untouched.
+func RewriteFiles(st storage.Storage, key string, transform func(data []byte) ([]byte, error)) (int, error) {
+	entries, err := st.List(key)
+	if err != nil {
+		return 0, err
+	}
+
+	contents := make(map[string][]byte)
+	modes := make(map[string]os.FileMode)
+	for _, entry := range entries {
+		// Directories and symlinks are left as they are
+		if entry.IsDir || entry.IsLink() {
+			continue
+		}
+
+		data, err := st.Read(entry.Key)
+		if err != nil {
+			return 0, err
+		}
+
+		transformed, err := transform(data)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", st.Location(entry.Key), err)
+		}
+		if !bytes.Equal(data, transformed) {
+			contents[entry.Key] = transformed
+			modes[entry.Key] = entry.Mode
+		}
+	}
+
+	for key, data := range contents {
+		if err := st.Write(key, data, storage.WriteOptions{Mode: modes[key]}); err != nil {
+			return 0, fmt.Errorf("failed to write %s: %w", st.Location(key), err)
+		}
+	}
+
+	return len(contents), nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
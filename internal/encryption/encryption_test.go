@@ -0,0 +1,342 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// fastSettings are passphrase settings with cheap KDF parameters, to keep tests fast
+func fastSettings(salt string) *config.EncryptionData {
+	return &config.EncryptionData{
+		KDF:     "argon2id",
+		Salt:    base64.StdEncoding.EncodeToString([]byte(salt)),
+		Time:    1,
+		Memory:  1024,
+		Threads: 1,
+	}
+}
+
+// newTestCipher returns a cipher with a new random key
+func newTestCipher(t *testing.T) *Cipher {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	cipher := newTestCipher(t)
+	for _, plaintext := range [][]byte{nil, []byte("export EDITOR=nvim\n"), bytes.Repeat([]byte{0, 1, 2}, 100000)} {
+		encrypted, err := cipher.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(encrypted) {
+			t.Error("encrypted content has no header")
+		}
+		if len(plaintext) > 0 && bytes.Contains(encrypted, plaintext) {
+			t.Error("encrypted content contains the plaintext")
+		}
+		decrypted, err := cipher.Decrypt(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Decrypt returned %d bytes, want %d", len(decrypted), len(plaintext))
+		}
+	}
+
+	// Each encryption uses a new nonce
+	first, _ := cipher.Encrypt([]byte("same"))
+	second, _ := cipher.Encrypt([]byte("same"))
+	if bytes.Equal(first, second) {
+		t.Error("the same content was encrypted twice to the same bytes")
+	}
+	if IsEncrypted([]byte("SSENC")) || IsEncrypted([]byte("plain text")) {
+		t.Error("IsEncrypted accepted content without the header")
+	}
+}
+
+func TestDecryptRejectsOtherKeysAndChangedContent(t *testing.T) {
+	cipher := newTestCipher(t)
+	encrypted, err := cipher.Encrypt([]byte("secret token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestCipher(t).Decrypt(encrypted); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Decrypt with another key returned %v, want ErrWrongKey", err)
+	}
+
+	tests := map[string]func([]byte){
+		"ciphertext": func(data []byte) { data[len(data)-1] ^= 1 },
+		"nonce":      func(data []byte) { data[len(magic)+keyIDSize] ^= 1 },
+	}
+	for name, change := range tests {
+		changed := append([]byte(nil), encrypted...)
+		change(changed)
+		if _, err := cipher.Decrypt(changed); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("Decrypt with a changed %s returned %v, want ErrCorrupted", name, err)
+		}
+	}
+	for _, data := range [][]byte{encrypted[:headerSize-1], []byte("secret token")} {
+		if _, err := cipher.Decrypt(data); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("Decrypt(%q) returned %v, want ErrCorrupted", data, err)
+		}
+	}
+}
+
+func TestNewCipherRejectsInvalidKeys(t *testing.T) {
+	for _, size := range []int{0, 16, KeySize + 1} {
+		if _, err := NewCipher(make([]byte, size)); err == nil {
+			t.Errorf("NewCipher accepted a %d byte key", size)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	key, err := DeriveKey("correct horse", fastSettings("salt of the cloud"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != KeySize {
+		t.Fatalf("DeriveKey returned %d bytes, want %d", len(key), KeySize)
+	}
+	again, _ := DeriveKey("correct horse", fastSettings("salt of the cloud"))
+	if !bytes.Equal(key, again) {
+		t.Error("the same passphrase and settings derived different keys")
+	}
+	otherPassphrase, _ := DeriveKey("battery staple", fastSettings("salt of the cloud"))
+	otherSalt, _ := DeriveKey("correct horse", fastSettings("salt of another cloud"))
+	if bytes.Equal(key, otherPassphrase) || bytes.Equal(key, otherSalt) {
+		t.Error("another passphrase or salt derived the same key")
+	}
+
+	settings := fastSettings("salt")
+	settings.KDF = "scrypt"
+	if _, err := DeriveKey("correct horse", settings); err == nil {
+		t.Error("DeriveKey accepted an unsupported KDF")
+	}
+	settings = fastSettings("salt")
+	settings.Salt = "not base64!"
+	if _, err := DeriveKey("correct horse", settings); err == nil {
+		t.Error("DeriveKey accepted an invalid salt")
+	}
+}
+
+func TestKeyFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "syncstation.key")
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveKeyFile(path, key); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+	loaded, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded, key) {
+		t.Error("LoadKeyFile returned another key")
+	}
+
+	for name, content := range map[string]string{
+		"invalid": "not base64!",
+		"short":   base64.StdEncoding.EncodeToString(key[:16]),
+	} {
+		path := filepath.Join(t.TempDir(), name+".key")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadKeyFile(path); err == nil {
+			t.Errorf("LoadKeyFile accepted a %s key file", name)
+		}
+	}
+}
+
+func TestLoadCipher(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	keyFile := filepath.Join(t.TempDir(), "syncstation.key")
+	key, _ := GenerateKey()
+	if err := SaveKeyFile(keyFile, key); err != nil {
+		t.Fatal(err)
+	}
+
+	withKeyFile := &config.LocalConfig{KeyFile: keyFile}
+	cipher, err := LoadCipher(withKeyFile, &config.EncryptionData{KeyID: KeyID(key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cipher.KeyID() != KeyID(key) {
+		t.Errorf("LoadCipher loaded key %s, want %s", cipher.KeyID(), KeyID(key))
+	}
+	if _, err := LoadCipher(withKeyFile, &config.EncryptionData{KeyID: "0123456789abcdef"}); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("LoadCipher with another cloud key returned %v, want ErrWrongKey", err)
+	}
+
+	settings := fastSettings("salt of the cloud")
+	withoutKey := &config.LocalConfig{KeyFile: filepath.Join(t.TempDir(), "missing.key")}
+	if _, err := LoadCipher(withoutKey, settings); !errors.Is(err, ErrNoKey) {
+		t.Errorf("LoadCipher without a key returned %v, want ErrNoKey", err)
+	}
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	derived, _ := DeriveKey("correct horse", settings)
+	settings.KeyID = KeyID(derived)
+	cipher, err = LoadCipher(withoutKey, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cipher.KeyID() != settings.KeyID {
+		t.Errorf("LoadCipher derived key %s, want %s", cipher.KeyID(), settings.KeyID)
+	}
+}
+
+// newTestConfig returns a local configuration with a cloud directory and a key file, and
+// the cipher of the key
+func newTestConfig(t *testing.T) (*config.LocalConfig, *Cipher) {
+	t.Helper()
+	t.Setenv(PassphraseEnv, "")
+	localConfig := &config.LocalConfig{
+		CloudSyncDir: t.TempDir(),
+		KeyFile:      filepath.Join(t.TempDir(), "syncstation.key"),
+	}
+	cipher := newTestCipher(t)
+	if err := SaveKeyFile(localConfig.KeyFile, cipher.key); err != nil {
+		t.Fatal(err)
+	}
+	return localConfig, cipher
+}
+
+func TestCodecEncryptsOnlyEncryptedItems(t *testing.T) {
+	localConfig, cipher := newTestConfig(t)
+	settings := &config.EncryptionData{KeyID: cipher.KeyID()}
+	if err := settings.SaveEncryptionData(localConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	codec := NewCodec(localConfig)
+	secret := &config.SyncItem{Name: "SSH", Encrypt: true}
+	plain := &config.SyncItem{Name: "Shell"}
+	encoded, err := codec.Encode(secret, []byte("Host *"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encoded) {
+		t.Error("the content of an encrypted item wasn't encrypted")
+	}
+	if decoded, err := codec.Decode(encoded); err != nil || string(decoded) != "Host *" {
+		t.Errorf("Decode returned %q, %v", decoded, err)
+	}
+	if encoded, err := codec.Encode(plain, []byte("set -o vi")); err != nil || string(encoded) != "set -o vi" {
+		t.Errorf("Encode of an unencrypted item returned %q, %v", encoded, err)
+	}
+	if decoded, err := codec.Decode([]byte("set -o vi")); err != nil || string(decoded) != "set -o vi" {
+		t.Errorf("Decode of plaintext returned %q, %v", decoded, err)
+	}
+
+	// Encrypting every item
+	settings.EncryptAll = true
+	if err := settings.SaveEncryptionData(localConfig); err != nil {
+		t.Fatal(err)
+	}
+	if !NewCodec(localConfig).ShouldEncrypt(plain) {
+		t.Error("an item isn't encrypted with encryptAll")
+	}
+}
+
+func TestCodecWithoutEncryption(t *testing.T) {
+	localConfig, cipher := newTestConfig(t)
+	codec := NewCodec(localConfig)
+	item := &config.SyncItem{Name: "SSH", Encrypt: true}
+
+	if encoded, err := codec.Encode(item, []byte("Host *")); err != nil || string(encoded) != "Host *" {
+		t.Errorf("Encode without encryption set up returned %q, %v", encoded, err)
+	}
+	if err := codec.CanEncrypt(); err == nil {
+		t.Error("CanEncrypt succeeded without encryption set up")
+	}
+
+	// Content encrypted by another computer can't be read without the key
+	encrypted, _ := cipher.Encrypt([]byte("Host *"))
+	if _, err := codec.Decode(encrypted); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Decode without encryption set up returned %v, want ErrNoKey", err)
+	}
+}
+
+func TestRewriteFiles(t *testing.T) {
+	root := t.TempDir()
+	st := storage.NewLocal(root)
+	files := map[string]string{
+		"configs/Shell/zshrc":        "zshrc",
+		"configs/Shell/env/secrets":  "secrets",
+		"configs/Shell/already-done": "DONE",
+	}
+	for key, content := range files {
+		if err := st.Write(key, []byte(content), storage.WriteOptions{Mode: 0600}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upper := func(data []byte) ([]byte, error) { return bytes.ToUpper(data), nil }
+	count, err := RewriteFiles(st, "configs/Shell", upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("RewriteFiles rewrote %d files, want 2", count)
+	}
+	for key, content := range files {
+		data, err := st.Read(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(bytes.ToUpper([]byte(content))) {
+			t.Errorf("%s = %q after the rewrite", key, data)
+		}
+	}
+	info, err := st.Stat("configs/Shell/zshrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode.Perm() != 0600 {
+		t.Errorf("the rewrite changed the mode to %v", info.Mode.Perm())
+	}
+
+	// A failure leaves every file as it was
+	failing := func(data []byte) ([]byte, error) {
+		if string(data) == "SECRETS" {
+			return nil, ErrCorrupted
+		}
+		return bytes.ToLower(data), nil
+	}
+	if _, err := RewriteFiles(st, "configs/Shell", failing); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("RewriteFiles returned %v, want ErrCorrupted", err)
+	}
+	for key := range files {
+		if data, _ := st.Read(key); !bytes.Equal(data, bytes.ToUpper(data)) {
+			t.Errorf("%s was rewritten by a failed rewrite: %q", key, data)
+		}
+	}
+}
@@ -0,0 +1,928 @@
+package gitrepo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/objects"
+)
+
+// remoteMetadataRef holds the file metadata fetched from the remote before it is merged
+const remoteMetadataRef plumbing.ReferenceName = "refs/syncstation-remote/metadata"
+
+// pushAttempts is how many times a push rejected because the remote moved on is retried
+// after rebasing onto it
+const pushAttempts = 3
+
+// ErrUnreachable is returned when the remote can't be fetched, e.g. when offline. Syncs can
+// go on and the commits are pushed by the next sync.
+var ErrUnreachable = errors.New("git remote is unreachable")
+
+// ErrDetachedHead is returned when HEAD isn't on a branch. Files are still synced, but the
+// changes are neither committed nor rebased until a branch is checked out.
+var ErrDetachedHead = errors.New("HEAD is detached, check out a branch to commit syncs")
+
+// ErrUnresolvedConflict is returned when a file to sync still has conflicts of a merge
+// made outside of syncstation
+var ErrUnresolvedConflict = errors.New("unresolved git conflicts")
+
+// ConflictError is returned when the commits pulled from the remote change files that were
+// also changed locally, by commits or uncommitted changes. Nothing is changed, the files
+// must be reconciled manually.
+type ConflictError struct {
+	Paths []string // relative to the top level of the working tree
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting changes to %s", strings.Join(e.Paths, ", "))
+}
+
+// Repo is the git repository holding the cloud directory in git mode. Each sync fetches and
+// rebases onto the upstream branch, commits the changed cloud files and pushes them, along
+// with config.GitMetadataRef holding the file metadata, which all branches share.
+type Repo struct {
+	repo     *git.Repository
+	worktree *git.Worktree
+	dir      string // cloud sync directory, somewhere in the repository
+	root     string // top level of the working tree
+	computer string
+	mu       sync.Mutex
+}
+
+// treeFile is a file of a commit tree, as its mode and blob
+type treeFile struct {
+	mode filemode.FileMode
+	hash plumbing.Hash
+}
+
+// Open returns the repository holding the cloud directory of localConfig
+func Open(localConfig *config.LocalConfig) (*Repo, error) {
+	repo, err := config.OpenGitRepository(localConfig.CloudSyncDir)
+	if err != nil {
+		return nil, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git working tree: %w", err)
+	}
+	// The top level is found by walking up the cloud directory, which keeps it comparable
+	// with synced paths when the cloud directory is reached through a symlink
+	return &Repo{
+		repo:     repo,
+		worktree: worktree,
+		dir:      localConfig.CloudSyncDir,
+		root:     worktree.Filesystem.Root(),
+		computer: localConfig.CurrentComputer,
+	}, nil
+}
+
+// Root returns the top level of the working tree
+func (r *Repo) Root() string {
+	return r.root
+}
+
+// hasRef reports whether a ref exists
+func (r *Repo) hasRef(name plumbing.ReferenceName) bool {
+	_, err := r.repo.Reference(name, true)
+	return err == nil
+}
+
+// upstream returns the remote and branch ref the current branch is pushed to, along with
+// the current branch. Branches without upstream use the only remote of the repository and
+// a branch of the same name. The branches are empty on detached HEAD, and remote is empty
+// when there is no remote to use.
+func (r *Repo) upstream() (remote string, branch, branchRef plumbing.ReferenceName) {
+	cfg, err := r.repo.Config()
+	if err != nil {
+		return "", "", ""
+	}
+	if head, err := r.repo.Reference(plumbing.HEAD, false); err == nil && head.Type() == plumbing.SymbolicReference {
+		branch, branchRef = head.Target(), head.Target()
+		if upstream, ok := cfg.Branches[branch.Short()]; ok {
+			remote = upstream.Remote
+			if upstream.Merge != "" {
+				branchRef = upstream.Merge
+			}
+		}
+	}
+	if remote == "" || remote == "." {
+		remote = ""
+		if len(cfg.Remotes) == 1 {
+			for name := range cfg.Remotes {
+				remote = name
+			}
+		}
+	}
+	return remote, branch, branchRef
+}
+
+// trackingRef returns the remote-tracking ref of branchRef on remote
+func trackingRef(remote string, branchRef plumbing.ReferenceName) plumbing.ReferenceName {
+	return plumbing.NewRemoteReferenceName(remote, branchRef.Short())
+}
+
+// signature returns the git identity of the user, or one naming this computer when there
+// is none, so that computers without a git identity can still commit
+func (r *Repo) signature() object.Signature {
+	name, email := "syncstation ("+r.computer+")", "syncstation@"+r.computer
+	if cfg, err := r.repo.ConfigScoped(gitconfig.SystemScope); err == nil {
+		if cfg.User.Name != "" {
+			name = cfg.User.Name
+		}
+		if cfg.User.Email != "" {
+			email = cfg.User.Email
+		}
+	}
+	return object.Signature{Name: name, Email: email, When: time.Now()}
+}
+
+// fetch fetches the branches and the file metadata of remote, and merges the metadata
+// into the local one
+func (r *Repo) fetch(remote string) error {
+	rem, err := r.repo.Remote(remote)
+	if err != nil {
+		return fmt.Errorf("failed to find git remote %s: %w", remote, err)
+	}
+	refs, err := rem.List(&git.ListOptions{})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	advertised := make(map[plumbing.ReferenceName]bool)
+	for _, ref := range refs {
+		advertised[ref.Name()] = true
+	}
+
+	specs := append([]gitconfig.RefSpec{}, rem.Config().Fetch...)
+	if advertised[config.GitMetadataRef] {
+		specs = append(specs, gitconfig.RefSpec("+"+config.GitMetadataRef+":"+remoteMetadataRef))
+	} else if advertised[config.LegacyNotesRef] && !r.hasRef(config.GitMetadataRef) && !r.hasRef(config.LegacyNotesRef) {
+		// Computers that didn't migrate yet share the metadata as notes, which the next
+		// save moves to config.GitMetadataRef
+		specs = append(specs, gitconfig.RefSpec(config.LegacyNotesRef+":"+config.LegacyNotesRef))
+	}
+	err = r.repo.Fetch(&git.FetchOptions{RemoteName: remote, RefSpecs: specs})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+
+	if advertised[config.GitMetadataRef] {
+		if err := config.MergeGitMetadata(r.repo, r.computer, remoteMetadataRef); err != nil {
+			return fmt.Errorf("failed to merge file metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// Pull fetches the upstream branch and the file metadata, merges the metadata and rebases
+// local commits onto the branch. Uncommitted changes are kept, unless the rebase changes
+// the same files. A rebase that conflicts returns a ConflictError, leaving the repository
+// as it was. On detached HEAD, only the metadata is updated and ErrDetachedHead is returned.
+func (r *Repo) Pull() error {
+	remote, branch, branchRef := r.upstream()
+	if remote != "" {
+		if err := r.fetch(remote); err != nil {
+			return err
+		}
+	}
+	if branch == "" {
+		return ErrDetachedHead
+	}
+	if remote == "" {
+		return nil
+	}
+
+	tracking := trackingRef(remote, branchRef)
+	upstream, err := r.repo.Reference(tracking, true)
+	if err != nil {
+		// The remote branch doesn't exist until the first push
+		return nil
+	}
+	head := plumbing.ZeroHash
+	if ref, err := r.repo.Reference(branch, true); err == nil {
+		head = ref.Hash()
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return fmt.Errorf("failed to resolve %s: %w", branch.Short(), err)
+	}
+
+	target, err := r.rebase(head, upstream.Hash())
+	if err == nil && target != head {
+		err = r.checkout(branch, head, target)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rebase onto %s in %s: %w", tracking.Short(), r.root, err)
+	}
+	return nil
+}
+
+// rebase returns the local branch at head brought onto upstream: upstream itself when
+// there are no local commits, head when it already contains upstream, and otherwise copies
+// of the local commits since the merge base replayed onto upstream. Local history holding
+// merges can't be replayed commit by commit without losing their other parents, so it is
+// merged with upstream instead. Files changed on both sides are merged line by line, and
+// changes that overlap return a ConflictError.
+func (r *Repo) rebase(head, upstream plumbing.Hash) (plumbing.Hash, error) {
+	if head.IsZero() {
+		return upstream, nil
+	}
+	headCommit, err := r.repo.CommitObject(head)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	upstreamCommit, err := r.repo.CommitObject(upstream)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if head == upstream {
+		return head, nil
+	}
+	if upToDate, err := upstreamCommit.IsAncestor(headCommit); err != nil || upToDate {
+		return head, err
+	}
+
+	local, err := localCommits(headCommit, upstreamCommit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	files, err := commitFiles(upstreamCommit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for _, commit := range local {
+		if commit.NumParents() > 1 {
+			return r.merge(headCommit, upstreamCommit, files)
+		}
+	}
+
+	onto := upstream
+	for _, commit := range local {
+		before := make(map[string]treeFile)
+		if commit.NumParents() > 0 {
+			parent, err := commit.Parent(0)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			if before, err = commitFiles(parent); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+		after, err := commitFiles(commit)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if err := applyChanges(r.repo, files, before, after); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		tree, err := writeTree(r.repo, files)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to store rebased tree: %w", err)
+		}
+		replayed := &object.Commit{
+			Author:       commit.Author,
+			Committer:    r.signature(),
+			Message:      commit.Message,
+			TreeHash:     tree,
+			ParentHashes: []plumbing.Hash{onto},
+		}
+		if onto, err = storeObject(r.repo, replayed.Encode); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to store rebased commit: %w", err)
+		}
+	}
+	return onto, nil
+}
+
+// merge returns a commit merging head into upstream, whose files are given. The changes
+// of head are those since the first merge base.
+func (r *Repo) merge(headCommit, upstreamCommit *object.Commit, files map[string]treeFile) (plumbing.Hash, error) {
+	bases, err := headCommit.MergeBase(upstreamCommit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	before := make(map[string]treeFile)
+	if len(bases) > 0 {
+		if before, err = commitFiles(bases[0]); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	after, err := commitFiles(headCommit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := applyChanges(r.repo, files, before, after); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tree, err := writeTree(r.repo, files)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store merged tree: %w", err)
+	}
+	signature := r.signature()
+	merged := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      fmt.Sprintf("Merge changes from the remote on %s", r.computer),
+		TreeHash:     tree,
+		ParentHashes: []plumbing.Hash{headCommit.Hash, upstreamCommit.Hash},
+	}
+	hash, err := storeObject(r.repo, merged.Encode)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store merge commit: %w", err)
+	}
+	return hash, nil
+}
+
+// localCommits returns the commits reachable from head but not from upstream. Without
+// merges they are a chain, which is returned oldest first.
+func localCommits(headCommit, upstreamCommit *object.Commit) ([]*object.Commit, error) {
+	var upstreamHistory []plumbing.Hash
+	err := object.NewCommitPreorderIter(upstreamCommit, nil, nil).ForEach(func(commit *object.Commit) error {
+		upstreamHistory = append(upstreamHistory, commit.Hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var local []*object.Commit
+	err = object.NewCommitPreorderIter(headCommit, nil, upstreamHistory).ForEach(func(commit *object.Commit) error {
+		local = append(local, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(local)-1; i < j; i, j = i+1, j-1 {
+		local[i], local[j] = local[j], local[i]
+	}
+	return local, nil
+}
+
+// applyChanges applies the changes from before to after to files. Files that changed on
+// both sides are merged, and a ConflictError lists those that can't be.
+func applyChanges(repo *git.Repository, files, before, after map[string]treeFile) error {
+	var conflicts []string
+	for _, path := range changedPaths(before, after) {
+		switch files[path] {
+		case after[path]:
+		case before[path]:
+			if after[path] == (treeFile{}) {
+				delete(files, path)
+			} else {
+				files[path] = after[path]
+			}
+		default:
+			// Both sides changed the file, as sync-items.json on every sync
+			if merged, ok := mergeFile(repo, before[path], after[path], files[path]); ok {
+				files[path] = merged
+			} else {
+				conflicts = append(conflicts, path)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Paths: conflicts}
+	}
+	return nil
+}
+
+// checkout moves branch from head to target and updates the files that differ between
+// them. Staged, uncommitted or untracked changes to these files return a ConflictError,
+// leaving everything as it was.
+func (r *Repo) checkout(branch plumbing.ReferenceName, head, target plumbing.Hash) error {
+	before := make(map[string]treeFile)
+	if !head.IsZero() {
+		commit, err := r.repo.CommitObject(head)
+		if err != nil {
+			return err
+		}
+		if before, err = commitFiles(commit); err != nil {
+			return err
+		}
+	}
+	commit, err := r.repo.CommitObject(target)
+	if err != nil {
+		return err
+	}
+	after, err := commitFiles(commit)
+	if err != nil {
+		return err
+	}
+	changed := changedPaths(before, after)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status, err := r.worktree.Status()
+	if err != nil {
+		return fmt.Errorf("failed to read git status: %w", err)
+	}
+	// Uncommitted changes are merged into the checked out files, and left uncommitted
+	var conflicts []string
+	uncommitted := make(map[string][]byte)
+	for _, path := range changed {
+		if file, ok := status[path]; !ok || (file.Staging == git.Unmodified && file.Worktree == git.Unmodified) {
+			continue
+		}
+		merged, ok := r.mergeUncommitted(path, before[path], after[path])
+		if !ok {
+			conflicts = append(conflicts, path)
+			continue
+		}
+		uncommitted[path] = merged
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Paths: conflicts}
+	}
+
+	if err := r.repo.Storer.SetReference(plumbing.NewHashReference(branch, target)); err != nil {
+		return fmt.Errorf("failed to update %s: %w", branch.Short(), err)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	// Git only records whether files are executable, so checking out would make private
+	// files readable by everyone
+	modes := make(map[string]os.FileMode)
+	for _, path := range changed {
+		if info, err := os.Lstat(filepath.Join(r.root, filepath.FromSlash(path))); err == nil && info.Mode().IsRegular() {
+			modes[path] = keptMode(info.Mode().Perm(), before[path].mode, after[path].mode)
+		}
+	}
+	// Reset applies to every file when none is given
+	if err := r.worktree.Reset(&git.ResetOptions{Commit: target, Mode: git.HardReset, Files: changed}); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", target, err)
+	}
+	for path, content := range uncommitted {
+		if err := os.WriteFile(filepath.Join(r.root, filepath.FromSlash(path)), content, 0644); err != nil {
+			return fmt.Errorf("failed to restore uncommitted changes of %s: %w", path, err)
+		}
+	}
+	for path, mode := range modes {
+		file := filepath.Join(r.root, filepath.FromSlash(path))
+		if info, err := os.Lstat(file); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if err := os.Chmod(file, mode); err != nil {
+			return fmt.Errorf("failed to restore the mode of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// keptMode returns the permissions of a file checked out over one with permissions perm.
+// They are kept, except the executable bits when the git mode changed between before and
+// after.
+func keptMode(perm os.FileMode, before, after filemode.FileMode) os.FileMode {
+	switch {
+	case after == filemode.Executable && before != filemode.Executable:
+		return perm | (perm&0444)>>2
+	case after == filemode.Regular && before == filemode.Executable:
+		return perm &^ 0111
+	}
+	return perm
+}
+
+// mergeUncommitted returns the file of the working tree at path, with the changes from
+// before to after merged into its uncommitted changes
+func (r *Repo) mergeUncommitted(path string, before, after treeFile) ([]byte, bool) {
+	local, err := os.ReadFile(filepath.Join(r.root, filepath.FromSlash(path)))
+	if err != nil || after == (treeFile{}) {
+		return nil, false
+	}
+	checkedOut, err := readBlob(r.repo, after.hash)
+	if err != nil {
+		return nil, false
+	}
+	// Untracked files are only kept when they already match
+	if bytes.Equal(local, checkedOut) {
+		return local, true
+	}
+	if before == (treeFile{}) {
+		return nil, false
+	}
+	base, err := readBlob(r.repo, before.hash)
+	if err != nil {
+		return nil, false
+	}
+	return mergeContents(base, local, checkedOut)
+}
+
+// commitFiles returns the files of a commit by path
+func commitFiles(commit *object.Commit) (map[string]treeFile, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]treeFile)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		path, entry, err := walker.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return files, nil
+			}
+			return nil, err
+		}
+		if entry.Mode != filemode.Dir {
+			files[path] = treeFile{mode: entry.Mode, hash: entry.Hash}
+		}
+	}
+}
+
+// changedPaths returns the sorted paths of the files that differ between before and after
+func changedPaths(before, after map[string]treeFile) []string {
+	var paths []string
+	for path, file := range before {
+		if after[path] != file {
+			paths = append(paths, path)
+		}
+	}
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// writeTree stores the trees holding files and returns the hash of the top one
+func writeTree(repo *git.Repository, files map[string]treeFile) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	dirs := make(map[string]map[string]treeFile)
+	for path, file := range files {
+		dir, rest, nested := strings.Cut(path, "/")
+		if !nested {
+			tree.Entries = append(tree.Entries, object.TreeEntry{Name: path, Mode: file.mode, Hash: file.hash})
+			continue
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]treeFile)
+		}
+		dirs[dir][rest] = file
+	}
+	for dir, dirFiles := range dirs {
+		hash, err := writeTree(repo, dirFiles)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash})
+	}
+
+	// Git sorts directories as if their name ended with a slash
+	sortName := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return sortName(tree.Entries[i]) < sortName(tree.Entries[j])
+	})
+	return storeObject(repo, tree.Encode)
+}
+
+// storeObject encodes an object into the repository and returns its hash
+func storeObject(repo *git.Repository, encode func(plumbing.EncodedObject) error) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	if err := encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+// relative returns the path of file relative to the top level, as used by git, or false
+// when it is outside the repository
+func (r *Repo) relative(file string) (string, bool) {
+	rel, err := filepath.Rel(r.root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// add updates the index entry of a file to its content, or removes it when the file was
+// deleted. The caller holds r.mu.
+func (r *Repo) add(rel string) error {
+	if _, err := r.worktree.Filesystem.Lstat(rel); err == nil {
+		return r.worktree.AddWithOptions(&git.AddOptions{Path: rel, SkipStatus: true})
+	}
+
+	idx, err := r.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	if _, err := idx.Remove(rel); errors.Is(err, index.ErrEntryNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return r.repo.Storer.SetIndex(idx)
+}
+
+// Stage adds a file of the repository to the index. Files outside of it are ignored.
+func (r *Repo) Stage(file string) error {
+	rel, ok := r.relative(file)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.add(rel); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", rel, err)
+	}
+	return nil
+}
+
+// Commit stages and commits the cloud copies of items, the sync items, the encryption
+// settings and the object store, with a message naming this computer and items. Other
+// changes, staged or not, are left out of the commit. It returns the abbreviated hash of
+// the commit, or an empty string when nothing changed.
+func (r *Repo) Commit(items []string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, branch, _ := r.upstream()
+	if branch == "" {
+		return "", ErrDetachedHead
+	}
+
+	keys := []string{config.SyncItemsKey, config.EncryptionKey, objects.StoreKey}
+	for _, item := range items {
+		keys = append(keys, (&config.SyncItem{Name: item}).CloudKey())
+	}
+	var paths []string
+	for _, key := range keys {
+		if rel, ok := r.relative(filepath.Join(r.dir, filepath.FromSlash(key))); ok {
+			paths = append(paths, rel)
+		}
+	}
+	status, err := r.worktree.Status()
+	if err != nil {
+		return "", fmt.Errorf("failed to read git status: %w", err)
+	}
+	for path, file := range status {
+		if file.Worktree == git.Unmodified || !underAny(path, paths) {
+			continue
+		}
+		if err := r.add(path); err != nil {
+			return "", fmt.Errorf("failed to stage %s: %w", path, err)
+		}
+	}
+
+	// The tree is the one of HEAD with the staged files under paths
+	head := plumbing.ZeroHash
+	files := make(map[string]treeFile)
+	var headTree plumbing.Hash
+	if ref, err := r.repo.Reference(branch, true); err == nil {
+		commit, err := r.repo.CommitObject(ref.Hash())
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", branch.Short(), err)
+		}
+		if files, err = commitFiles(commit); err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", branch.Short(), err)
+		}
+		head, headTree = commit.Hash, commit.TreeHash
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", fmt.Errorf("failed to resolve %s: %w", branch.Short(), err)
+	}
+	for path := range files {
+		if underAny(path, paths) {
+			delete(files, path)
+		}
+	}
+	idx, err := r.repo.Storer.Index()
+	if err != nil {
+		return "", fmt.Errorf("failed to read git index: %w", err)
+	}
+	for _, entry := range idx.Entries {
+		if !underAny(entry.Name, paths) {
+			continue
+		}
+		if unmerged(entry) {
+			return "", fmt.Errorf("%s has %w", entry.Name, ErrUnresolvedConflict)
+		}
+		files[entry.Name] = treeFile{mode: entry.Mode, hash: entry.Hash}
+	}
+
+	tree, err := writeTree(r.repo, files)
+	if err != nil {
+		return "", fmt.Errorf("failed to store tree: %w", err)
+	}
+	if tree == headTree || (head.IsZero() && len(files) == 0) {
+		return "", nil
+	}
+	signature := r.signature()
+	commit := &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   CommitMessage(r.computer, items),
+		TreeHash:  tree,
+	}
+	if !head.IsZero() {
+		commit.ParentHashes = []plumbing.Hash{head}
+	}
+	hash, err := storeObject(r.repo, commit.Encode)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+	if err := r.repo.Storer.SetReference(plumbing.NewHashReference(branch, hash)); err != nil {
+		return "", fmt.Errorf("failed to update %s: %w", branch.Short(), err)
+	}
+	return hash.String()[:7], nil
+}
+
+// unmerged reports whether an index entry is a side of a conflict. Entries without
+// conflicts are at stage 0, although go-git names stage 1 index.Merged.
+func unmerged(entry *index.Entry) bool {
+	return entry.Stage != 0
+}
+
+// underAny reports whether path is one of paths or inside one of them
+func underAny(path string, paths []string) bool {
+	for _, parent := range paths {
+		if path == parent || strings.HasPrefix(path, parent+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CommitMessage returns the message of a sync commit naming the computer and the items
+func CommitMessage(computer string, items []string) string {
+	if len(items) == 0 {
+		return fmt.Sprintf("Update sync items from %s", computer)
+	}
+
+	subject := strings.Join(items, ", ")
+	if len(items) > 3 {
+		subject = fmt.Sprintf("%s and %d more", strings.Join(items[:3], ", "), len(items)-3)
+	}
+	message := fmt.Sprintf("Sync %s from %s", subject, computer)
+	if len(items) > 3 {
+		message += "\n\n" + "- " + strings.Join(items, "\n- ")
+	}
+	return message
+}
+
+// push updates ref dst of remote to the local ref src
+func (r *Repo) push(remote string, src, dst plumbing.ReferenceName) error {
+	spec := gitconfig.RefSpec(src.String() + ":" + dst.String())
+	err := r.repo.Push(&git.PushOptions{RemoteName: remote, RefSpecs: []gitconfig.RefSpec{spec}})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+// Push pushes the current branch and the file metadata to the upstream. A push rejected
+// because another computer pushed first is retried after pulling. It returns the pushed
+// branch, or an empty string when the repository has no remote or HEAD is detached.
+func (r *Repo) Push() (string, error) {
+	remote, branch, branchRef := r.upstream()
+	if remote == "" {
+		return "", nil
+	}
+
+	pushed := ""
+	if branch != "" && r.hasRef(branch) {
+		var err error
+		for attempt := 1; attempt <= pushAttempts; attempt++ {
+			if err = r.push(remote, branch, branchRef); err == nil {
+				break
+			}
+			if pullErr := r.Pull(); pullErr != nil {
+				return "", pullErr
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to push to %s: %w", remote, err)
+		}
+		pushed = remote + "/" + branchRef.Short()
+	}
+
+	if r.hasRef(config.GitMetadataRef) {
+		var err error
+		for attempt := 1; attempt <= pushAttempts; attempt++ {
+			if err = r.push(remote, config.GitMetadataRef, config.GitMetadataRef); err == nil {
+				break
+			}
+			if fetchErr := r.fetch(remote); fetchErr != nil {
+				return "", fetchErr
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to push file metadata to %s: %w", remote, err)
+		}
+	}
+	return pushed, nil
+}
+
+// OperationCallback implements config.GitOperationCallback. "pre_sync_backup" refuses to
+// overwrite a file of the repository with unresolved conflicts, and "sync_add" stages it.
+func (r *Repo) OperationCallback(localConfig *config.LocalConfig, filePath string, operation string) error {
+	switch operation {
+	case "pre_sync_backup":
+		rel, ok := r.relative(filePath)
+		if !ok {
+			return nil
+		}
+		idx, err := r.repo.Storer.Index()
+		if err != nil {
+			return fmt.Errorf("failed to read git index: %w", err)
+		}
+		for _, entry := range idx.Entries {
+			if entry.Name == rel && unmerged(entry) {
+				return fmt.Errorf("%s has %w", filePath, ErrUnresolvedConflict)
+			}
+		}
+		return nil
+	case "sync_add":
+		return r.Stage(filePath)
+	default:
+		return nil
+	}
+}
+
+// SafeOperationCallback implements sync.GitSafeOperationCallback. It runs operation and,
+// when it fails halfway, restores a file of the repository to its staged content.
+func (r *Repo) SafeOperationCallback(localConfig *config.LocalConfig, filePath string, operation func() error) error {
+	err := operation()
+	if err == nil {
+		return nil
+	}
+	rel, ok := r.relative(filePath)
+	if !ok {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if restoreErr := r.restore(filePath, rel); restoreErr != nil {
+		return fmt.Errorf("%w (and failed to restore it: %v)", err, restoreErr)
+	}
+	return err
+}
+
+// restore writes the staged content of a tracked file back to it. Untracked files are left
+// as they are.
+func (r *Repo) restore(file, rel string) error {
+	idx, err := r.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	entry, err := idx.Entry(rel)
+	if errors.Is(err, index.ErrEntryNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	content, err := readBlob(r.repo, entry.Hash)
+	if err != nil {
+		return err
+	}
+
+	mode, err := entry.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+	// The file keeps its permissions, which git doesn't record beyond the executable bit
+	perm := mode.Perm()
+	if info, err := os.Lstat(file); err == nil && info.Mode().IsRegular() {
+		perm = info.Mode().Perm()
+	}
+
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if entry.Mode == filemode.Symlink {
+		return os.Symlink(string(content), file)
+	}
+	if err := os.WriteFile(file, content, perm); err != nil {
+		return err
+	}
+	// The umask doesn't apply to the permissions of the file being restored
+	return os.Chmod(file, perm)
+}
@@ -0,0 +1,708 @@
+package gitrepo
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+// seedSyncItems is the sync-items.json of the first commit, with enough lines for changes
+// of separate computers to merge
+const seedSyncItems = "{\n  \"items\": [],\n  \"computers\": {},\n  \"version\": 1\n}\n"
+
+// testSignature is the identity of the commits made by the tests themselves
+var testSignature = object.Signature{Name: "test", Email: "test@example.com", When: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+// newTestRemote returns the path of a bare repository holding a first commit
+func newTestRemote(t *testing.T) string {
+	t.Helper()
+	remote := filepath.Join(t.TempDir(), "cloud.git")
+	if _, err := git.PlainInit(remote, true); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := t.TempDir()
+	repo, err := git.PlainInit(seed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seed, config.SyncItemsKey), []byte(seedSyncItems), 0644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, _ := repo.Worktree()
+	if _, err := worktree.Add(config.SyncItemsKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Commit("Initial sync items", &git.CommitOptions{Author: &testSignature}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{remote}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Push(&git.PushOptions{RemoteName: "origin"}); err != nil {
+		t.Fatal(err)
+	}
+	return remote
+}
+
+// testComputer is a clone of the remote used as the cloud directory of a computer
+type testComputer struct {
+	t      *testing.T
+	dir    string
+	repo   *Repo
+	config *config.LocalConfig
+}
+
+func newTestComputer(t *testing.T, remote, name string) *testComputer {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := git.PlainClone(dir, false, &git.CloneOptions{URL: remote}); err != nil {
+		t.Fatal(err)
+	}
+	localConfig := &config.LocalConfig{CloudSyncDir: dir, CurrentComputer: name, GitMode: true, GitRepoRoot: dir}
+	repo, err := Open(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testComputer{t: t, dir: dir, repo: repo, config: localConfig}
+}
+
+func (c *testComputer) write(rel, content string, mode os.FileMode) {
+	c.t.Helper()
+	file := filepath.Join(c.dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), mode); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := os.Chmod(file, mode); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testComputer) read(rel string) string {
+	c.t.Helper()
+	data, err := os.ReadFile(filepath.Join(c.dir, filepath.FromSlash(rel)))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func (c *testComputer) commit(items ...string) {
+	c.t.Helper()
+	if hash, err := c.repo.Commit(items); err != nil || hash == "" {
+		c.t.Fatalf("Commit(%v) = %q, %v", items, hash, err)
+	}
+}
+
+func (c *testComputer) push() {
+	c.t.Helper()
+	if _, err := c.repo.Push(); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testComputer) head() *object.Commit {
+	c.t.Helper()
+	ref, err := c.repo.repo.Head()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	commit, err := c.repo.repo.CommitObject(ref.Hash())
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return commit
+}
+
+// metadataSaves counts the metadata saved by the tests
+var metadataSaves int
+
+// saveMetadata records hash as the cloud hash of a file in the metadata of git mode
+func (c *testComputer) saveMetadata(item, path, hash string) {
+	c.t.Helper()
+	metadata, err := config.LoadCloudFileMetadata(c.config)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	metadata.UpdateFileMetadata(item, path, c.config.CurrentComputer, hash, time.Now())
+	// Metadata times have a resolution of a second, which later saves must exceed
+	metadataSaves++
+	file := metadata.GetFileMetadata(item, path)
+	file.CloudHash = hash
+	file.LastUpdated = testSignature.When.Add(time.Duration(metadataSaves) * time.Minute).Format(time.RFC3339)
+	if err := metadata.SaveCloudFileMetadata(c.config); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testComputer) metadataHash(item, path string) string {
+	c.t.Helper()
+	metadata, err := config.LoadCloudFileMetadata(c.config)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if file := metadata.GetFileMetadata(item, path); file != nil {
+		return file.CloudHash
+	}
+	return ""
+}
+
+// remoteRef returns the commit of a ref of the remote
+func remoteRef(t *testing.T, remote string, name plumbing.ReferenceName) plumbing.Hash {
+	t.Helper()
+	repo, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := repo.Reference(name, true)
+	if err != nil {
+		t.Fatalf("remote %s: %v", name, err)
+	}
+	return ref.Hash()
+}
+
+func treePaths(t *testing.T, commit *object.Commit) []string {
+	t.Helper()
+	files, err := commitFiles(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestPullRebasesLocalCommits(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+
+	desktop.write("configs/Shell/.zshrc", "export EDITOR=nvim\n", 0644)
+	desktop.commit("Shell")
+	desktop.push()
+	laptop.write("configs/Nvim/init.lua", "vim.o.number = true\n", 0644)
+	laptop.commit("Nvim")
+
+	if err := laptop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	head := laptop.head()
+	if head.NumParents() != 1 || head.ParentHashes[0] != desktop.head().Hash {
+		t.Errorf("rebased commit has parents %v, want the desktop commit %s", head.ParentHashes, desktop.head().Hash)
+	}
+	if head.Message != "Sync Nvim from laptop" {
+		t.Errorf("rebased commit message = %q", head.Message)
+	}
+	if got := laptop.read("configs/Shell/.zshrc"); got != "export EDITOR=nvim\n" {
+		t.Errorf("pulled file = %q", got)
+	}
+
+	laptop.push()
+	if got := remoteRef(t, remote, plumbing.Master); got != head.Hash {
+		t.Errorf("remote master = %s, want %s", got, head.Hash)
+	}
+}
+
+func TestPullMergesChangesToTheSameFile(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+
+	desktop.write(config.SyncItemsKey, strings.Replace(seedSyncItems, "\"version\": 1", "\"version\": 2", 1), 0644)
+	desktop.commit()
+	desktop.push()
+	laptop.write(config.SyncItemsKey, strings.Replace(seedSyncItems, "\"items\": []", "\"items\": [\"Shell\"]", 1), 0644)
+	laptop.commit()
+
+	if err := laptop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"items\": [\"Shell\"],\n  \"computers\": {},\n  \"version\": 2\n}\n"
+	if got := laptop.read(config.SyncItemsKey); got != want {
+		t.Errorf("merged sync items = %q, want %q", got, want)
+	}
+}
+
+func TestPullConflictLeavesRepository(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+
+	desktop.write(config.SyncItemsKey, strings.Replace(seedSyncItems, "\"version\": 1", "\"version\": 2", 1), 0644)
+	desktop.commit()
+	desktop.push()
+	laptop.write(config.SyncItemsKey, strings.Replace(seedSyncItems, "\"version\": 1", "\"version\": 3", 1), 0644)
+	laptop.commit()
+	head := laptop.head().Hash
+
+	var conflict *ConflictError
+	if err := laptop.repo.Pull(); !errors.As(err, &conflict) {
+		t.Fatalf("Pull = %v, want a ConflictError", err)
+	}
+	if strings.Join(conflict.Paths, " ") != config.SyncItemsKey {
+		t.Errorf("conflicting paths = %v", conflict.Paths)
+	}
+	if laptop.head().Hash != head {
+		t.Error("a conflicting pull moved the branch")
+	}
+	if got := laptop.read(config.SyncItemsKey); !strings.Contains(got, "\"version\": 3") {
+		t.Errorf("a conflicting pull changed the file to %q", got)
+	}
+}
+
+func TestPullKeepsMergedHistory(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+	seed := laptop.head()
+
+	// The laptop merged a side branch before syncing
+	laptop.write("configs/Shell/.zshrc", "export EDITOR=nvim\n", 0644)
+	laptop.commit("Shell")
+	main := laptop.head()
+	files, err := commitFiles(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := storeObject(laptop.repo.repo, func(obj plumbing.EncodedObject) error {
+		obj.SetType(plumbing.BlobObject)
+		writer, err := obj.Writer()
+		if err != nil {
+			return err
+		}
+		writer.Write([]byte("set -g mouse on\n"))
+		return writer.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["configs/Tmux/tmux.conf"] = treeFile{mode: filemode.Regular, hash: blob}
+	sideTree, err := writeTree(laptop.repo.repo, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	side, err := storeObject(laptop.repo.repo, (&object.Commit{Author: testSignature, Committer: testSignature, Message: "Add tmux", TreeHash: sideTree, ParentHashes: []plumbing.Hash{seed.Hash}}).Encode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainFiles, _ := commitFiles(main)
+	mainFiles["configs/Tmux/tmux.conf"] = files["configs/Tmux/tmux.conf"]
+	mergeTree, err := writeTree(laptop.repo.repo, mainFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merge, err := storeObject(laptop.repo.repo, (&object.Commit{Author: testSignature, Committer: testSignature, Message: "Merge tmux", TreeHash: mergeTree, ParentHashes: []plumbing.Hash{main.Hash, side}}).Encode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := laptop.repo.worktree.Reset(&git.ResetOptions{Commit: merge, Mode: git.HardReset}); err != nil {
+		t.Fatal(err)
+	}
+
+	desktop.write("configs/Nvim/init.lua", "vim.o.number = true\n", 0644)
+	desktop.commit("Nvim")
+	desktop.push()
+
+	if err := laptop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	head := laptop.head()
+	for _, ancestor := range []plumbing.Hash{side, merge, desktop.head().Hash} {
+		commit, _ := laptop.repo.repo.CommitObject(ancestor)
+		if ok, err := commit.IsAncestor(head); err != nil || !ok {
+			t.Errorf("commit %q isn't in the history after pulling", strings.TrimSpace(commit.Message))
+		}
+	}
+	want := "configs/Nvim/init.lua configs/Shell/.zshrc configs/Tmux/tmux.conf sync-items.json"
+	if got := strings.Join(treePaths(t, head), " "); got != want {
+		t.Errorf("files after pulling = %s, want %s", got, want)
+	}
+	if got := laptop.read("configs/Nvim/init.lua"); got != "vim.o.number = true\n" {
+		t.Errorf("pulled file = %q", got)
+	}
+}
+
+func TestPullKeepsFileModes(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+	laptop.write("configs/SSH/config", "Host *\n", 0600)
+	laptop.commit("SSH")
+	laptop.push()
+	if err := desktop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+
+	desktop.write("configs/SSH/config", "Host *\n  ForwardAgent no\n", 0644)
+	desktop.write(config.SyncItemsKey, strings.Replace(seedSyncItems, "\"version\": 1", "\"version\": 2", 1), 0644)
+	desktop.commit("SSH")
+	desktop.push()
+	// Uncommitted changes are merged into the pulled file
+	laptop.write(config.SyncItemsKey, strings.Replace(seedSyncItems, "\"items\": []", "\"items\": [\"SSH\"]", 1), 0600)
+
+	if err := laptop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"configs/SSH/config", config.SyncItemsKey} {
+		info, err := os.Stat(filepath.Join(laptop.dir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode of %s after pulling = %v, want 0600", path, info.Mode().Perm())
+		}
+	}
+	if got := laptop.read("configs/SSH/config"); got != "Host *\n  ForwardAgent no\n" {
+		t.Errorf("pulled file = %q", got)
+	}
+	if got := laptop.read(config.SyncItemsKey); !strings.Contains(got, "[\"SSH\"]") || !strings.Contains(got, "\"version\": 2") {
+		t.Errorf("merged uncommitted file = %q", got)
+	}
+}
+
+func TestKeptMode(t *testing.T) {
+	tests := []struct {
+		perm          os.FileMode
+		before, after filemode.FileMode
+		want          os.FileMode
+	}{
+		{0600, filemode.Regular, filemode.Regular, 0600},
+		{0700, filemode.Executable, filemode.Executable, 0700},
+		{0600, filemode.Regular, filemode.Executable, 0700},
+		{0644, filemode.Regular, filemode.Executable, 0755},
+		{0750, filemode.Executable, filemode.Regular, 0640},
+		{0600, filemode.Empty, filemode.Regular, 0600},
+	}
+	for _, test := range tests {
+		if got := keptMode(test.perm, test.before, test.after); got != test.want {
+			t.Errorf("keptMode(%v, %v, %v) = %v, want %v", test.perm, test.before, test.after, got, test.want)
+		}
+	}
+}
+
+func TestSafeOperationCallbackRestoresFileWithItsMode(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop := newTestComputer(t, remote, "laptop")
+	laptop.write("configs/SSH/config", "Host *\n", 0600)
+	file := filepath.Join(laptop.dir, "configs", "SSH", "config")
+	if err := laptop.repo.Stage(file); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("disk full")
+	err := laptop.repo.SafeOperationCallback(laptop.config, file, func() error {
+		os.WriteFile(file, []byte("Ho"), 0600)
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("SafeOperationCallback = %v, want the operation error", err)
+	}
+	if got := laptop.read("configs/SSH/config"); got != "Host *\n" {
+		t.Errorf("restored file = %q", got)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("restored file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+}
+
+func TestOperationCallbackRefusesUnresolvedConflicts(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop := newTestComputer(t, remote, "laptop")
+	file := filepath.Join(laptop.dir, config.SyncItemsKey)
+	if err := laptop.repo.OperationCallback(laptop.config, file, "pre_sync_backup"); err != nil {
+		t.Errorf("OperationCallback of a tracked file = %v", err)
+	}
+
+	idx, err := laptop.repo.repo.Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := idx.Entry(config.SyncItemsKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours := *entry
+	entry.Stage, ours.Stage = index.AncestorMode, index.OurMode
+	idx.Entries = append(idx.Entries, &ours)
+	if err := laptop.repo.repo.Storer.SetIndex(idx); err != nil {
+		t.Fatal(err)
+	}
+	if err := laptop.repo.OperationCallback(laptop.config, file, "pre_sync_backup"); !errors.Is(err, ErrUnresolvedConflict) {
+		t.Errorf("OperationCallback of a conflicting file = %v, want ErrUnresolvedConflict", err)
+	}
+}
+
+func TestCommitOnlySyncedItems(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop := newTestComputer(t, remote, "laptop")
+	laptop.write("configs/Shell/.zshrc", "export EDITOR=nvim\n", 0644)
+	laptop.write("configs/Nvim/init.lua", "vim.o.number = true\n", 0644)
+	laptop.write("store/manifests/Shell.json", "{}\n", 0644)
+	// The user staged a file of their own
+	laptop.write("notes.txt", "remember the milk\n", 0644)
+	if _, err := laptop.repo.worktree.Add("notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	laptop.commit("Shell")
+	want := "configs/Shell/.zshrc store/manifests/Shell.json sync-items.json"
+	if got := strings.Join(treePaths(t, laptop.head()), " "); got != want {
+		t.Errorf("committed files = %s, want %s", got, want)
+	}
+	status, err := laptop.repo.worktree.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file := status.File("notes.txt"); file.Staging != git.Added {
+		t.Errorf("status of the user's file = %+v, want still staged", file)
+	}
+	if file := status.File("configs/Nvim/init.lua"); file.Worktree != git.Untracked {
+		t.Errorf("status of an item that wasn't synced = %+v, want untracked", file)
+	}
+
+	if hash, err := laptop.repo.Commit([]string{"Shell"}); err != nil || hash != "" {
+		t.Errorf("Commit without changes = %q, %v, want no commit", hash, err)
+	}
+}
+
+func TestPushRetriesAfterAnotherComputerPushed(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+
+	laptop.write("configs/Shell/.zshrc", "export EDITOR=nvim\n", 0644)
+	laptop.commit("Shell")
+	desktop.write("configs/Nvim/init.lua", "vim.o.number = true\n", 0644)
+	desktop.commit("Nvim")
+	desktop.push()
+
+	pushed, err := laptop.repo.Push()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed != "origin/master" {
+		t.Errorf("Push = %q, want origin/master", pushed)
+	}
+	head := laptop.head()
+	if got := remoteRef(t, remote, plumbing.Master); got != head.Hash {
+		t.Errorf("remote master = %s, want the rebased commit %s", got, head.Hash)
+	}
+	if head.NumParents() != 1 || head.ParentHashes[0] != desktop.head().Hash {
+		t.Errorf("pushed commit has parents %v, want the desktop commit", head.ParentHashes)
+	}
+}
+
+func TestFileMetadataIsSharedAndMerged(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+
+	laptop.saveMetadata("Shell", ".zshrc", "hash-1")
+	laptop.push()
+	if err := desktop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if got := desktop.metadataHash("Shell", ".zshrc"); got != "hash-1" {
+		t.Fatalf("pulled metadata = %q, want hash-1", got)
+	}
+
+	// Both computers update the metadata before pushing
+	laptop.saveMetadata("Shell", ".zshrc", "hash-2")
+	desktop.saveMetadata("Nvim", "init.lua", "hash-3")
+	laptop.push()
+	desktop.push()
+
+	merged := remoteRef(t, remote, config.GitMetadataRef)
+	repo, _ := git.PlainOpen(remote)
+	commit, err := repo.CommitObject(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.NumParents() != 2 {
+		t.Errorf("remote metadata commit has %d parents, want a merge", commit.NumParents())
+	}
+	if err := laptop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if got := laptop.metadataHash("Shell", ".zshrc"); got != "hash-2" {
+		t.Errorf("merged metadata of Shell = %q, want hash-2", got)
+	}
+	if got := laptop.metadataHash("Nvim", "init.lua"); got != "hash-3" {
+		t.Errorf("merged metadata of Nvim = %q, want hash-3", got)
+	}
+}
+
+func TestLegacyNotesAreMigrated(t *testing.T) {
+	remote := newTestRemote(t)
+
+	// A computer of an older version kept the metadata as a note on its last commit
+	old := newTestComputer(t, remote, "old")
+	legacy := config.NewFileMetadataData()
+	legacy.UpdateFileMetadata("Shell", ".zshrc", "old", "hash-legacy", time.Now())
+	legacy.GetFileMetadata("Shell", ".zshrc").CloudHash = "hash-legacy"
+	data, err := json.MarshalIndent(legacy, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := old.repo.repo
+	blob, err := storeObject(repo, func(obj plumbing.EncodedObject) error {
+		obj.SetType(plumbing.BlobObject)
+		writer, err := obj.Writer()
+		if err != nil {
+			return err
+		}
+		writer.Write(data)
+		return writer.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := storeObject(repo, (&object.Tree{Entries: []object.TreeEntry{{Name: old.head().Hash.String(), Mode: filemode.Regular, Hash: blob}}}).Encode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := storeObject(repo, (&object.Commit{Author: testSignature, Committer: testSignature, Message: "Notes added", TreeHash: tree}).Encode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(config.LegacyNotesRef, notes)); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.repo.push("origin", config.LegacyNotesRef, config.LegacyNotesRef); err != nil {
+		t.Fatal(err)
+	}
+
+	laptop := newTestComputer(t, remote, "laptop")
+	if err := laptop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if got := laptop.metadataHash("Shell", ".zshrc"); got != "hash-legacy" {
+		t.Fatalf("metadata from notes = %q, want hash-legacy", got)
+	}
+
+	laptop.saveMetadata("Nvim", "init.lua", "hash-new")
+	laptop.push()
+	desktop := newTestComputer(t, remote, "desktop")
+	if err := desktop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if !desktop.repo.hasRef(config.GitMetadataRef) {
+		t.Fatal("the metadata ref wasn't fetched")
+	}
+	if desktop.repo.hasRef(config.LegacyNotesRef) {
+		t.Error("notes were fetched although the metadata ref exists")
+	}
+	if got := desktop.metadataHash("Shell", ".zshrc"); got != "hash-legacy" {
+		t.Errorf("migrated metadata of Shell = %q, want hash-legacy", got)
+	}
+	if got := desktop.metadataHash("Nvim", "init.lua"); got != "hash-new" {
+		t.Errorf("migrated metadata of Nvim = %q, want hash-new", got)
+	}
+}
+
+func TestDetachedHead(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop, desktop := newTestComputer(t, remote, "laptop"), newTestComputer(t, remote, "desktop")
+	desktop.saveMetadata("Shell", ".zshrc", "hash-1")
+	desktop.push()
+
+	if err := laptop.repo.worktree.Checkout(&git.CheckoutOptions{Hash: laptop.head().Hash}); err != nil {
+		t.Fatal(err)
+	}
+	if err := laptop.repo.Pull(); !errors.Is(err, ErrDetachedHead) {
+		t.Fatalf("Pull = %v, want ErrDetachedHead", err)
+	}
+	if got := laptop.metadataHash("Shell", ".zshrc"); got != "hash-1" {
+		t.Errorf("metadata pulled on detached HEAD = %q, want hash-1", got)
+	}
+
+	laptop.write("configs/Shell/.zshrc", "export EDITOR=nvim\n", 0644)
+	if _, err := laptop.repo.Commit([]string{"Shell"}); !errors.Is(err, ErrDetachedHead) {
+		t.Errorf("Commit = %v, want ErrDetachedHead", err)
+	}
+	laptop.saveMetadata("Shell", ".zshrc", "hash-2")
+	pushed, err := laptop.repo.Push()
+	if err != nil || pushed != "" {
+		t.Errorf("Push = %q, %v, want only the metadata pushed", pushed, err)
+	}
+	if err := desktop.repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if got := desktop.metadataHash("Shell", ".zshrc"); got != "hash-2" {
+		t.Errorf("metadata pushed on detached HEAD = %q, want hash-2", got)
+	}
+}
+
+func TestPullUnreachableRemote(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop := newTestComputer(t, remote, "laptop")
+	if err := os.RemoveAll(remote); err != nil {
+		t.Fatal(err)
+	}
+	if err := laptop.repo.Pull(); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Pull = %v, want ErrUnreachable", err)
+	}
+}
+
+func TestCommitWithoutIdentity(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	remote := newTestRemote(t)
+	laptop := newTestComputer(t, remote, "laptop")
+	laptop.write("configs/Shell/.zshrc", "export EDITOR=nvim\n", 0644)
+	laptop.commit("Shell")
+	if author := laptop.head().Author; author.Name != "syncstation (laptop)" || author.Email != "syncstation@laptop" {
+		t.Errorf("commit author = %s <%s>", author.Name, author.Email)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	tests := []struct {
+		items []string
+		want  string
+	}{
+		{nil, "Update sync items from laptop"},
+		{[]string{"Shell"}, "Sync Shell from laptop"},
+		{[]string{"Shell", "Nvim", "Git"}, "Sync Shell, Nvim, Git from laptop"},
+		{[]string{"Shell", "Nvim", "Git", "Tmux"}, "Sync Shell, Nvim, Git and 1 more from laptop\n\n- Shell\n- Nvim\n- Git\n- Tmux"},
+	}
+	for _, test := range tests {
+		if got := CommitMessage("laptop", test.items); got != test.want {
+			t.Errorf("CommitMessage(%v) = %q, want %q", test.items, got, test.want)
+		}
+	}
+}
+
+func TestOperationCallbackStagesFiles(t *testing.T) {
+	remote := newTestRemote(t)
+	laptop := newTestComputer(t, remote, "laptop")
+	laptop.write("configs/Shell/.zshrc", "export EDITOR=nvim\n", 0644)
+	file := filepath.Join(laptop.dir, "configs", "Shell", ".zshrc")
+
+	if err := laptop.repo.OperationCallback(laptop.config, file, "pre_sync_backup"); err != nil {
+		t.Errorf("OperationCallback before a sync = %v", err)
+	}
+	if err := laptop.repo.OperationCallback(laptop.config, file, "sync_add"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := laptop.repo.worktree.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file := status.File("configs/Shell/.zshrc"); file.Staging != git.Added {
+		t.Errorf("status of the synced file = %+v, want staged", file)
+	}
+}
@@ -0,0 +1,178 @@
+package gitrepo
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// hunk replaces the lines [start, end) of a base text
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// equal reports whether two hunks make the same change
+func (h hunk) equal(other hunk) bool {
+	if h.start != other.start || h.end != other.end || len(h.lines) != len(other.lines) {
+		return false
+	}
+	for i := range h.lines {
+		if h.lines[i] != other.lines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLines splits text after each newline
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunks returns the changes turning base into changed
+func hunks(base, changed string) []hunk {
+	var result []hunk
+	var current *hunk
+	line := 0
+	for _, d := range diff.Do(base, changed) {
+		lines := splitLines(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			if current != nil {
+				result = append(result, *current)
+				current = nil
+			}
+			line += len(lines)
+			continue
+		}
+		if current == nil {
+			current = &hunk{start: line, end: line}
+		}
+		if d.Type == diffmatchpatch.DiffDelete {
+			line += len(lines)
+			current.end = line
+		} else {
+			current.lines = append(current.lines, lines...)
+		}
+	}
+	if current != nil {
+		result = append(result, *current)
+	}
+	return result
+}
+
+// mergeLines merges the changes from base to ours and from base to theirs, line by line.
+// Like git, it fails when both sides change the same or adjacent lines differently.
+func mergeLines(base, ours, theirs string) (string, bool) {
+	baseLines := splitLines(base)
+	a, b := hunks(base, ours), hunks(base, theirs)
+
+	var merged strings.Builder
+	line := 0
+	for len(a) > 0 || len(b) > 0 {
+		var next hunk
+		switch {
+		case len(b) == 0:
+			next, a = a[0], a[1:]
+		case len(a) == 0:
+			next, b = b[0], b[1:]
+		case a[0].equal(b[0]):
+			next, a, b = a[0], a[1:], b[1:]
+		case a[0].start <= b[0].end && b[0].start <= a[0].end:
+			return "", false
+		case a[0].start < b[0].start:
+			next, a = a[0], a[1:]
+		default:
+			next, b = b[0], b[1:]
+		}
+		merged.WriteString(strings.Join(baseLines[line:next.start], ""))
+		merged.WriteString(strings.Join(next.lines, ""))
+		line = next.end
+	}
+	merged.WriteString(strings.Join(baseLines[line:], ""))
+	return merged.String(), true
+}
+
+// mergeContents merges text files like mergeLines. Binary files can't be merged.
+func mergeContents(base, ours, theirs []byte) ([]byte, bool) {
+	if bytes.Equal(ours, theirs) {
+		return ours, true
+	}
+	for _, content := range [][]byte{base, ours, theirs} {
+		if bytes.IndexByte(content, 0) >= 0 {
+			return nil, false
+		}
+	}
+	merged, ok := mergeLines(string(base), string(ours), string(theirs))
+	return []byte(merged), ok
+}
+
+// mergeFile merges a file changed both from base to ours and from base to theirs. It fails
+// for binary files, files added or deleted on either side, and changes that overlap.
+func mergeFile(repo *git.Repository, base, ours, theirs treeFile) (treeFile, bool) {
+	if base == (treeFile{}) || ours == (treeFile{}) || theirs == (treeFile{}) {
+		return treeFile{}, false
+	}
+	mode := ours.mode
+	if ours.mode == base.mode {
+		mode = theirs.mode
+	} else if theirs.mode != base.mode && theirs.mode != ours.mode {
+		return treeFile{}, false
+	}
+	if mode != filemode.Regular && mode != filemode.Executable {
+		return treeFile{}, false
+	}
+
+	var contents [3][]byte
+	for i, file := range []treeFile{base, ours, theirs} {
+		content, err := readBlob(repo, file.hash)
+		if err != nil {
+			return treeFile{}, false
+		}
+		contents[i] = content
+	}
+	merged, ok := mergeContents(contents[0], contents[1], contents[2])
+	if !ok {
+		return treeFile{}, false
+	}
+
+	hash, err := storeObject(repo, func(obj plumbing.EncodedObject) error {
+		obj.SetType(plumbing.BlobObject)
+		writer, err := obj.Writer()
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(merged); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+	if err != nil {
+		return treeFile{}, false
+	}
+	return treeFile{mode: mode, hash: hash}, true
+}
+
+// readBlob returns the content of a blob
+func readBlob(repo *git.Repository, hash plumbing.Hash) ([]byte, error) {
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
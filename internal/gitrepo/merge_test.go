@@ -0,0 +1,27 @@
+package gitrepo
+
+import "testing"
+
+func TestMergeLines(t *testing.T) {
+	const base = "a\nb\nc\nd\n"
+	tests := []struct {
+		ours, theirs string
+		want         string
+		ok           bool
+	}{
+		{base, base, base, true},
+		{"a\nB\nc\nd\n", base, "a\nB\nc\nd\n", true},
+		{base, "a\nb\nc\nD\n", "a\nb\nc\nD\n", true},
+		{"A\nb\nc\nd\n", "a\nb\nc\nD\n", "A\nb\nc\nD\n", true},
+		{"a\nb\nc\nd\ne\n", "z\na\nb\nc\nd\n", "z\na\nb\nc\nd\ne\n", true},
+		{"a\nB\nc\nd\n", "a\nB\nc\nd\n", "a\nB\nc\nd\n", true}, // the same change on both sides
+		{"a\nB\nc\nd\n", "a\nX\nc\nd\n", "", false},
+		{"a\nc\nd\n", "a\nB\nc\nd\n", "", false},
+	}
+	for _, test := range tests {
+		got, ok := mergeLines(base, test.ours, test.theirs)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("mergeLines(%q, %q) = %q, %v, want %q, %v", test.ours, test.theirs, got, ok, test.want, test.ok)
+		}
+	}
+}
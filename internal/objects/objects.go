@@ -0,0 +1,273 @@
+package objects
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// Layout of the object store in the cloud storage
+const (
+	StoreKey     = "store"           // root of the object store
+	objectsKey   = "store/objects"   // file contents, "<2 hex digits>/<SHA-256>.zst"
+	manifestsKey = "store/manifests" // current manifest of each item, "<item key>.json"
+	historyKey   = "store/history"   // every manifest committed, "<item key>/<time>.json"
+)
+
+// manifestWriteAttempts is how many times a manifest changed by another computer since it
+// was read is merged and written again
+const manifestWriteAttempts = 10
+
+// historyTimeFormat names the manifests kept in the history of an item
+const historyTimeFormat = "20060102-150405.000"
+
+var (
+	// encoder and decoder compress objects, they are safe for concurrent use
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	decoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+// Entry describes a file, directory or symlink of an item in a manifest
+type Entry struct {
+	Hash    string    `json:"hash,omitempty"` // "sha256:<hex>" of the content of files
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime"`
+	Mode    uint32    `json:"mode,omitempty"` // permission bits
+	Dir     bool      `json:"dir,omitempty"`
+	Link    string    `json:"link,omitempty"` // target of symlinks
+}
+
+// Manifest lists the files of an item kept in the object store and the objects holding them
+type Manifest struct {
+	Entries   map[string]Entry `json:"entries"` // slash-separated path inside the item -> entry
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// NewManifest creates an empty manifest
+func NewManifest() *Manifest {
+	return &Manifest{Entries: make(map[string]Entry)}
+}
+
+// ParseManifest parses a manifest
+func ParseManifest(data []byte) (*Manifest, error) {
+	manifest := NewManifest()
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]Entry)
+	}
+	return manifest, nil
+}
+
+// Files returns the number of files of a manifest and their total size
+func (m *Manifest) Files() (int, int64) {
+	var count int
+	var size int64
+	for _, entry := range m.Entries {
+		if !entry.Dir && entry.Link == "" {
+			count++
+			size += entry.Size
+		}
+	}
+	return count, size
+}
+
+// manifestKey returns the key of the current manifest of the item at itemKey. Manifests are
+// keyed by the whole item key, so that items of the same name in different directories
+// don't share one.
+func manifestKey(itemKey string) string {
+	return storage.Join(manifestsKey, itemKey+".json")
+}
+
+// historyDir returns the key of the directory holding the manifest history of an item
+func historyDir(itemKey string) string {
+	return storage.Join(historyKey, itemKey)
+}
+
+// objectKey returns the key of the object holding the content with the given hash
+func objectKey(hash string) string {
+	hex := strings.TrimPrefix(hash, "sha256:")
+	if len(hex) < 2 {
+		return storage.Join(objectsKey, hex)
+	}
+	return storage.Join(objectsKey, hex[:2], hex+".zst")
+}
+
+// putObject stores content in the object store unless an object already holds it, and
+// returns its hash
+func putObject(base storage.Storage, data []byte) (string, error) {
+	hash := config.CalculateHash(data)
+	key := objectKey(hash)
+	if storage.Exists(base, key) {
+		return hash, nil
+	}
+	if err := base.Write(key, encoder.EncodeAll(data, nil), storage.WriteOptions{}); err != nil {
+		return "", fmt.Errorf("failed to store object %s: %w", hash, err)
+	}
+	return hash, nil
+}
+
+// readObject returns the content with the given hash from the object store
+func readObject(base storage.Storage, hash string) ([]byte, error) {
+	compressed, err := base.Read(objectKey(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", hash, err)
+	}
+	data, err := decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object %s: %w", hash, err)
+	}
+	if config.CalculateHash(data) != hash {
+		return nil, fmt.Errorf("object %s is corrupted", hash)
+	}
+	return data, nil
+}
+
+// Import copies the tree at itemKey in base into the object store. The tree stays in base
+// until the caller deletes it, once the item is switched to the object store.
+func Import(base storage.Storage, itemKey string) error {
+	overlay := NewOverlay(base)
+	overlay.Track(itemKey)
+	if err := copyTree(base, overlay, itemKey); err != nil {
+		return err
+	}
+	return overlay.Commit()
+}
+
+// Export copies an item out of the object store, back to a tree of files at itemKey in base.
+// Its manifest stays in the store until the caller removes it, once the item is switched
+// back to files.
+func Export(base storage.Storage, itemKey string) error {
+	overlay := NewOverlay(base)
+	overlay.Track(itemKey)
+	return copyTree(overlay, base, itemKey)
+}
+
+// Remove deletes the current manifest of an item. Its history and objects stay in the store.
+func Remove(base storage.Storage, itemKey string) error {
+	return base.Delete(manifestKey(itemKey))
+}
+
+// copyTree copies the tree at key from src to dst, with the attributes of its entries
+func copyTree(src, dst storage.Storage, key string) error {
+	root, err := src.Stat(key)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries := []storage.FileInfo{root}
+	if root.IsDir {
+		listed, err := src.List(key)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, listed...)
+	}
+
+	dirs, keepsDirs := dst.(storage.DirMaker)
+	linker, keepsLinks := dst.(storage.Linker)
+	for _, entry := range entries {
+		opts := storage.WriteOptions{Mode: entry.Mode, ModTime: entry.ModTime}
+		switch {
+		case entry.IsDir:
+			if keepsDirs {
+				err = dirs.MakeDir(entry.Key, opts)
+			}
+		case entry.IsLink():
+			if keepsLinks {
+				err = linker.Symlink(entry.Key, entry.Link)
+			}
+		default:
+			var data []byte
+			if data, err = src.Read(entry.Key); err == nil {
+				err = dst.Write(entry.Key, data, opts)
+			}
+		}
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return fmt.Errorf("failed to copy %s: %w", entry.Key, err)
+		}
+	}
+
+	// Directory modification times change as their content is written
+	if root.IsDir && keepsDirs {
+		return dirs.MakeDir(key, storage.WriteOptions{Mode: root.Mode, ModTime: root.ModTime})
+	}
+	return nil
+}
+
+// Version is a manifest kept in the history of an item
+type Version struct {
+	Name  string    // name of the version, used to restore it
+	Time  time.Time // when the manifest was committed
+	Files int       // number of files
+	Size  int64     // total size of the files
+}
+
+// History returns the versions of an item kept in the object store, oldest first
+func History(base storage.Storage, itemKey string) ([]Version, error) {
+	entries, err := base.List(historyDir(itemKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, entry := range entries {
+		if entry.IsDir || path.Ext(entry.Key) != ".json" {
+			continue
+		}
+		data, err := base.Read(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := ParseManifest(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", base.Location(entry.Key), err)
+		}
+		files, size := manifest.Files()
+		versions = append(versions, Version{
+			Name:  strings.TrimSuffix(path.Base(entry.Key), ".json"),
+			Time:  manifest.UpdatedAt,
+			Files: files,
+			Size:  size,
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Name < versions[j].Name })
+	return versions, nil
+}
+
+// Restore makes a version from the history of an item its current version
+func Restore(base storage.Storage, itemKey, version string) error {
+	data, err := base.Read(storage.Join(historyDir(itemKey), version+".json"))
+	if errors.Is(err, storage.ErrNotExist) {
+		return fmt.Errorf("no version %q in the history", version)
+	}
+	if err != nil {
+		return err
+	}
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse version %s: %w", version, err)
+	}
+
+	overlay := NewOverlay(base)
+	overlay.Track(itemKey)
+	state, err := overlay.manifest(itemKey)
+	if err != nil {
+		return err
+	}
+	state.manifest, state.dirty = manifest, true
+	return overlay.Commit()
+}
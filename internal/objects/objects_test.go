@@ -0,0 +1,392 @@
+package objects
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// countingStorage counts the writes of each key
+type countingStorage struct {
+	storage.Storage
+	writes map[string]int
+}
+
+func (c *countingStorage) Write(key string, data []byte, opts storage.WriteOptions) error {
+	c.writes[key]++
+	return c.Storage.Write(key, data, opts)
+}
+
+// versionedStorage is a local storage with conditional writes. Before each conditional
+// write it runs the next function of race, if any, as if another computer had written in
+// between.
+type versionedStorage struct {
+	*storage.Local
+	race []func()
+}
+
+func (v *versionedStorage) etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (v *versionedStorage) ReadVersion(key string) ([]byte, string, error) {
+	data, err := v.Read(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, v.etag(data), nil
+}
+
+func (v *versionedStorage) WriteIfMatch(key string, data []byte, etag string, opts storage.WriteOptions) error {
+	if len(v.race) > 0 {
+		race := v.race[0]
+		v.race = v.race[1:]
+		race()
+	}
+	current, err := v.Read(key)
+	switch {
+	case errors.Is(err, storage.ErrNotExist):
+		if etag != "" {
+			return fmt.Errorf("%s was deleted: %w", key, storage.ErrConflict)
+		}
+	case err != nil:
+		return err
+	case v.etag(current) != etag:
+		return fmt.Errorf("%s changed: %w", key, storage.ErrConflict)
+	}
+	return v.Write(key, data, opts)
+}
+
+// writeFiles writes files given by key to an overlay tracking their item, and commits it
+func writeFiles(t *testing.T, base storage.Storage, itemKey string, files map[string]string) {
+	t.Helper()
+	overlay := NewOverlay(base)
+	overlay.Track(itemKey)
+	for key, content := range files {
+		if err := overlay.Write(key, []byte(content), storage.WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := overlay.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFiles returns the content of the files of an item in the object store, by key
+func readFiles(t *testing.T, base storage.Storage, itemKey string) map[string]string {
+	t.Helper()
+	overlay := NewOverlay(base)
+	overlay.Track(itemKey)
+	entries, err := overlay.List(itemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir || entry.IsLink() {
+			continue
+		}
+		data, err := overlay.Read(entry.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Key] = string(data)
+	}
+	return files
+}
+
+func TestPutObjectStoresContentOnce(t *testing.T) {
+	base := &countingStorage{Storage: storage.NewLocal(t.TempDir()), writes: make(map[string]int)}
+	data := []byte(strings.Repeat("set -o vi\n", 100))
+
+	first, err := putObject(base, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := putObject(base, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("the same content was stored as %s and %s", first, second)
+	}
+	if base.writes[objectKey(first)] != 1 {
+		t.Errorf("the object was written %d times, want once", base.writes[objectKey(first)])
+	}
+
+	read, err := readObject(base, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != string(data) {
+		t.Errorf("readObject returned %q", read)
+	}
+
+	// Two files of an item with the same content share one object
+	writeFiles(t, base, "configs/Shell", map[string]string{
+		"configs/Shell/zshrc":  string(data),
+		"configs/Shell/bashrc": string(data),
+	})
+	if base.writes[objectKey(first)] != 1 {
+		t.Errorf("the object was written %d times, want once", base.writes[objectKey(first)])
+	}
+}
+
+func TestReadObjectDetectsCorruption(t *testing.T) {
+	base := storage.NewLocal(t.TempDir())
+	hash, err := putObject(base, []byte("original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Write(objectKey(hash), encoder.EncodeAll([]byte("changed"), nil), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readObject(base, hash); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("readObject of a changed object returned %v", err)
+	}
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	base := storage.NewLocal(root)
+	item := filepath.Join(root, "configs", "Nvim")
+	modTime := time.Date(2026, 1, 2, 10, 10, 10, 0, time.UTC)
+	for _, dir := range []string{item, filepath.Join(item, "lua"), filepath.Join(item, "empty")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]os.FileMode{
+		"init.lua":        0o644,
+		"lua/plugins.lua": 0o600,
+		"bin/format.sh":   0o755,
+	}
+	for rel, mode := range files {
+		name := filepath.Join(item, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("-- "+rel), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(name, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("init.lua", filepath.Join(item, "link.lua")); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := func() map[string]string {
+		t.Helper()
+		tree := make(map[string]string)
+		err := filepath.Walk(item, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(item, name)
+			switch {
+			case info.Mode()&os.ModeSymlink != 0:
+				target, err := os.Readlink(name)
+				tree[rel] = "link " + target
+				return err
+			case info.IsDir():
+				tree[rel] = fmt.Sprintf("dir %v", info.Mode().Perm())
+			default:
+				data, err := os.ReadFile(name)
+				tree[rel] = fmt.Sprintf("%v %s %s", info.Mode().Perm(), info.ModTime().UTC().Format(time.RFC3339), data)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+	want := snapshot()
+
+	if err := Import(base, "configs/Nvim"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(item); err != nil {
+		t.Fatal(err)
+	}
+	got := readFiles(t, base, "configs/Nvim")
+	if got["configs/Nvim/lua/plugins.lua"] != "-- lua/plugins.lua" || len(got) != len(files) {
+		t.Errorf("imported files = %v", got)
+	}
+
+	if err := Export(base, "configs/Nvim"); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("exported tree = %v, want %v", got, want)
+	}
+}
+
+func TestHistoryAndRestore(t *testing.T) {
+	base := storage.NewLocal(t.TempDir())
+	writeFiles(t, base, "configs/Shell", map[string]string{
+		"configs/Shell/zshrc":  "v1",
+		"configs/Shell/bashrc": "v1",
+	})
+	time.Sleep(5 * time.Millisecond)
+	overlay := NewOverlay(base)
+	overlay.Track("configs/Shell")
+	if err := overlay.Write("configs/Shell/zshrc", []byte("version 2"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.Delete("configs/Shell/bashrc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := History(base, "configs/Shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("History returned %d versions, want 2", len(versions))
+	}
+	if versions[0].Files != 2 || versions[0].Size != 4 || versions[1].Files != 1 || versions[1].Size != 9 {
+		t.Errorf("History returned %+v", versions)
+	}
+	if !versions[0].Time.Before(versions[1].Time) {
+		t.Errorf("History isn't oldest first: %+v", versions)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if err := Restore(base, "configs/Shell", versions[0].Name); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"configs/Shell/zshrc": "v1", "configs/Shell/bashrc": "v1"}
+	if got := readFiles(t, base, "configs/Shell"); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored files = %v, want %v", got, want)
+	}
+	if versions, err = History(base, "configs/Shell"); err != nil || len(versions) != 3 {
+		t.Errorf("the restore wasn't kept in the history: %+v, %v", versions, err)
+	}
+
+	if err := Restore(base, "configs/Shell", "20000101-000000.000"); err == nil {
+		t.Error("Restore of a missing version succeeded")
+	}
+}
+
+func TestManifestsAreKeyedByItemKey(t *testing.T) {
+	base := storage.NewLocal(t.TempDir())
+	writeFiles(t, base, "configs/Nvim", map[string]string{"configs/Nvim/init.lua": "config"})
+	writeFiles(t, base, "templates/Nvim", map[string]string{"templates/Nvim/init.lua": "template"})
+
+	if got := readFiles(t, base, "configs/Nvim"); got["configs/Nvim/init.lua"] != "config" || len(got) != 1 {
+		t.Errorf("files of configs/Nvim = %v", got)
+	}
+	if got := readFiles(t, base, "templates/Nvim"); got["templates/Nvim/init.lua"] != "template" || len(got) != 1 {
+		t.Errorf("files of templates/Nvim = %v", got)
+	}
+	for _, itemKey := range []string{"configs/Nvim", "templates/Nvim"} {
+		if versions, err := History(base, itemKey); err != nil || len(versions) != 1 {
+			t.Errorf("history of %s = %+v, %v", itemKey, versions, err)
+		}
+	}
+}
+
+func TestCommitKeepsConcurrentChanges(t *testing.T) {
+	base := &versionedStorage{Local: storage.NewLocal(t.TempDir())}
+	writeFiles(t, base, "configs/Shell", map[string]string{
+		"configs/Shell/zshrc":    "zshrc",
+		"configs/Shell/bashrc":   "bashrc",
+		"configs/Shell/profile":  "profile",
+		"configs/Shell/aliases":  "aliases",
+		"configs/Shell/inputrc":  "inputrc",
+		"configs/Shell/unused":   "unused",
+		"configs/Shell/obsolete": "obsolete",
+	})
+
+	overlay := NewOverlay(base)
+	overlay.Track("configs/Shell")
+	if err := overlay.Write("configs/Shell/zshrc", []byte("zshrc changed here"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.Write("configs/Shell/added-here", []byte("added here"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.Delete("configs/Shell/unused"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another computer commits other changes to the item in between, twice
+	other := func(key, content string) func() {
+		return func() {
+			overlay := NewOverlay(base.Local)
+			overlay.Track("configs/Shell")
+			var err error
+			if content == "" {
+				err = overlay.Delete(key)
+			} else {
+				err = overlay.Write(key, []byte(content), storage.WriteOptions{})
+			}
+			if err == nil {
+				err = overlay.Commit()
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	base.race = []func(){
+		other("configs/Shell/bashrc", "bashrc changed there"),
+		other("configs/Shell/obsolete", ""),
+	}
+	if err := overlay.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"configs/Shell/zshrc":      "zshrc changed here",
+		"configs/Shell/added-here": "added here",
+		"configs/Shell/bashrc":     "bashrc changed there",
+		"configs/Shell/profile":    "profile",
+		"configs/Shell/aliases":    "aliases",
+		"configs/Shell/inputrc":    "inputrc",
+	}
+	if got := readFiles(t, base, "configs/Shell"); !reflect.DeepEqual(got, want) {
+		t.Errorf("files after concurrent commits = %v, want %v", got, want)
+	}
+}
+
+func TestCommitCreatesManifestOnlyOnce(t *testing.T) {
+	base := &versionedStorage{Local: storage.NewLocal(t.TempDir())}
+	overlay := NewOverlay(base)
+	overlay.Track("configs/Git")
+	if err := overlay.Write("configs/Git/gitconfig", []byte("here"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another computer creates the item first
+	base.race = []func(){func() {
+		writeFiles(t, base.Local, "configs/Git", map[string]string{"configs/Git/ignore": "there"})
+	}}
+	if err := overlay.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"configs/Git/gitconfig": "here", "configs/Git/ignore": "there"}
+	if got := readFiles(t, base, "configs/Git"); !reflect.DeepEqual(got, want) {
+		t.Errorf("files after concurrent creations = %v, want %v", got, want)
+	}
+}
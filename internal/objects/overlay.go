@@ -0,0 +1,471 @@
+package objects
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// Default attributes of the entries written without any
+const (
+	defaultFileMode = 0644
+	defaultDirMode  = 0755
+)
+
+// itemState is the manifest of a tracked item, as loaded and changed since
+type itemState struct {
+	manifest *Manifest
+	loaded   bool
+	dirty    bool             // changed since loaded, to be committed
+	etag     string           // version of the manifest when loaded, empty if there was none
+	original map[string]Entry // entries when loaded, which the changes are made to
+}
+
+// Overlay is a storage presenting the items kept in the object store as trees of files, and
+// passing every other key through to the storage underneath. Changes to the tracked items
+// are kept in memory until Commit writes their manifests.
+type Overlay struct {
+	base  storage.Storage
+	items map[string]*itemState // tracked item key -> manifest
+}
+
+// NewOverlay creates an overlay over base, tracking no items yet
+func NewOverlay(base storage.Storage) *Overlay {
+	return &Overlay{base: base, items: make(map[string]*itemState)}
+}
+
+// Track serves the item at itemKey from the object store. Its manifest is read again on the
+// next access, unless it has uncommitted changes.
+func (o *Overlay) Track(itemKey string) {
+	if state, ok := o.items[itemKey]; ok && state.dirty {
+		return
+	}
+	o.items[itemKey] = &itemState{}
+}
+
+// Unwrap returns the storage underneath the overlay
+func (o *Overlay) Unwrap() storage.Storage {
+	return o.base
+}
+
+// Commit writes the manifests of the tracked items that changed, and keeps a copy of each in
+// the history of its item. Storages with conditional writes only replace the manifests as
+// they were loaded: the changes to a manifest another computer committed in between are
+// made again to its new version. Committed manifests are loaded again on their next use.
+func (o *Overlay) Commit() error {
+	keys := make([]string, 0, len(o.items))
+	for key, state := range o.items {
+		if state.dirty {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		state := o.items[key]
+		now := time.Now()
+		data, err := o.writeManifest(key, state, now)
+		if err != nil {
+			return fmt.Errorf("failed to write manifest of %s: %w", key, err)
+		}
+		version := storage.Join(historyDir(key), now.UTC().Format(historyTimeFormat)+".json")
+		if err := o.base.Write(version, data, storage.WriteOptions{}); err != nil {
+			return fmt.Errorf("failed to write history of %s: %w", key, err)
+		}
+		*state = itemState{}
+	}
+	return nil
+}
+
+// writeManifest writes the manifest of a tracked item updated at now, and returns it as
+// written
+func (o *Overlay) writeManifest(itemKey string, state *itemState, now time.Time) ([]byte, error) {
+	key := manifestKey(itemKey)
+	versioned, conditional := o.base.(storage.Versioned)
+	for attempt := 1; ; attempt++ {
+		state.manifest.UpdatedAt = now
+		data, err := json.MarshalIndent(state.manifest, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+		}
+		if !conditional {
+			return data, o.base.Write(key, data, storage.WriteOptions{})
+		}
+		err = versioned.WriteIfMatch(key, data, state.etag, storage.WriteOptions{})
+		if !errors.Is(err, storage.ErrConflict) || attempt == manifestWriteAttempts {
+			return data, err
+		}
+
+		// Another computer committed the item since it was loaded
+		current, etag, err := versioned.ReadVersion(key)
+		manifest := NewManifest()
+		switch {
+		case errors.Is(err, storage.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			if manifest, err = ParseManifest(current); err != nil {
+				return nil, err
+			}
+		}
+		original := copyEntries(manifest.Entries)
+		for rel, entry := range state.manifest.Entries {
+			if old, ok := state.original[rel]; !ok || old != entry {
+				manifest.Entries[rel] = entry
+			}
+		}
+		for rel := range state.original {
+			if _, ok := state.manifest.Entries[rel]; !ok {
+				delete(manifest.Entries, rel)
+			}
+		}
+		state.manifest, state.etag, state.original = manifest, etag, original
+	}
+}
+
+// copyEntries returns a copy of the entries of a manifest
+func copyEntries(entries map[string]Entry) map[string]Entry {
+	copied := make(map[string]Entry, len(entries))
+	for rel, entry := range entries {
+		copied[rel] = entry
+	}
+	return copied
+}
+
+// Discard drops the uncommitted changes to the tracked items
+func (o *Overlay) Discard() {
+	for _, state := range o.items {
+		if state.dirty {
+			*state = itemState{}
+		}
+	}
+}
+
+// tracked returns the item holding key and the slash-separated path of key inside it
+func (o *Overlay) tracked(key string) (string, string, bool) {
+	for itemKey := range o.items {
+		if rel, ok := storage.Rel(itemKey, key); ok {
+			return itemKey, rel, true
+		}
+	}
+	return "", "", false
+}
+
+// manifest returns the manifest of a tracked item, reading it on first use. Items without a
+// manifest have an empty one.
+func (o *Overlay) manifest(itemKey string) (*itemState, error) {
+	state := o.items[itemKey]
+	if state.loaded {
+		return state, nil
+	}
+
+	var data []byte
+	var err error
+	if versioned, ok := o.base.(storage.Versioned); ok {
+		data, state.etag, err = versioned.ReadVersion(manifestKey(itemKey))
+	} else {
+		data, err = o.base.Read(manifestKey(itemKey))
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotExist):
+		state.manifest, state.etag = NewManifest(), ""
+	case err != nil:
+		return nil, fmt.Errorf("failed to read manifest of %s: %w", itemKey, err)
+	default:
+		if state.manifest, err = ParseManifest(data); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest of %s: %w", itemKey, err)
+		}
+	}
+	state.original = copyEntries(state.manifest.Entries)
+	state.loaded = true
+	return state, nil
+}
+
+// fileInfo describes a manifest entry as a storage entry
+func fileInfo(itemKey, rel string, entry Entry) storage.FileInfo {
+	return storage.FileInfo{
+		Key:     storage.Join(itemKey, rel),
+		Size:    entry.Size,
+		ModTime: entry.ModTime,
+		Mode:    os.FileMode(entry.Mode),
+		IsDir:   entry.Dir,
+		Link:    entry.Link,
+		ETag:    entry.Hash,
+	}
+}
+
+// put replaces the manifest entry at rel and creates its missing parent directories
+func (state *itemState) put(rel string, entry Entry) {
+	entries := state.manifest.Entries
+	if entry.Dir {
+		// A directory replaces whatever was at rel, but keeps its content
+		if old, ok := entries[rel]; ok && !old.Dir {
+			delete(entries, rel)
+		}
+	} else {
+		state.remove(rel)
+	}
+	entries[rel] = entry
+	for dir := rel; dir != "."; {
+		dir = path.Dir(dir)
+		if parent, ok := entries[dir]; !ok || !parent.Dir {
+			entries[dir] = Entry{Dir: true, Mode: defaultDirMode, ModTime: time.Now()}
+		}
+	}
+	state.dirty = true
+}
+
+// remove deletes the manifest entry at rel with everything below it
+func (state *itemState) remove(rel string) {
+	for key := range state.manifest.Entries {
+		if key == rel || rel == "." || strings.HasPrefix(key, rel+"/") {
+			delete(state.manifest.Entries, key)
+			state.dirty = true
+		}
+	}
+}
+
+// Stat implements storage.Storage
+func (o *Overlay) Stat(key string) (storage.FileInfo, error) {
+	itemKey, rel, ok := o.tracked(key)
+	if !ok {
+		return o.base.Stat(key)
+	}
+	state, err := o.manifest(itemKey)
+	if err != nil {
+		return storage.FileInfo{}, err
+	}
+	entry, ok := state.manifest.Entries[rel]
+	if !ok {
+		return storage.FileInfo{}, fmt.Errorf("%s: %w", o.Location(key), storage.ErrNotExist)
+	}
+	return fileInfo(itemKey, rel, entry), nil
+}
+
+// Read implements storage.Storage
+func (o *Overlay) Read(key string) ([]byte, error) {
+	itemKey, rel, ok := o.tracked(key)
+	if !ok {
+		return o.base.Read(key)
+	}
+	state, err := o.manifest(itemKey)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := state.manifest.Entries[rel]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%s: %w", o.Location(key), storage.ErrNotExist)
+	case entry.Dir || entry.Link != "":
+		return nil, fmt.Errorf("%s is not a file", o.Location(key))
+	}
+	return readObject(o.base, entry.Hash)
+}
+
+// Write implements storage.Storage. Content already in the object store isn't stored again.
+func (o *Overlay) Write(key string, data []byte, opts storage.WriteOptions) error {
+	itemKey, rel, ok := o.tracked(key)
+	if !ok {
+		return o.base.Write(key, data, opts)
+	}
+	state, err := o.manifest(itemKey)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{Size: int64(len(data)), ModTime: opts.ModTime, Mode: uint32(opts.Mode.Perm())}
+	if entry.ModTime.IsZero() {
+		entry.ModTime = time.Now()
+	}
+	if entry.Mode == 0 {
+		entry.Mode = defaultFileMode
+	}
+	hash := config.CalculateHash(data)
+	if old, ok := state.manifest.Entries[rel]; ok && old.Hash == hash && !old.Dir && old.Link == "" {
+		entry.Hash = hash
+		if old.ModTime.Equal(entry.ModTime) && old.Mode == entry.Mode {
+			return nil
+		}
+	} else if entry.Hash, err = putObject(o.base, data); err != nil {
+		return err
+	}
+	state.put(rel, entry)
+	return nil
+}
+
+// List implements storage.Storage. Listing a directory above tracked items lists them too.
+func (o *Overlay) List(key string) ([]storage.FileInfo, error) {
+	if itemKey, rel, ok := o.tracked(key); ok {
+		state, err := o.manifest(itemKey)
+		if err != nil {
+			return nil, err
+		}
+		return listManifest(itemKey, rel, state.manifest), nil
+	}
+
+	entries, err := o.base.List(key)
+	if err != nil {
+		return nil, err
+	}
+	var itemKeys []string
+	for itemKey := range o.items {
+		if rel, ok := storage.Rel(key, itemKey); ok && rel != "." {
+			itemKeys = append(itemKeys, itemKey)
+		}
+	}
+	if len(itemKeys) == 0 {
+		return entries, nil
+	}
+
+	// Tracked items replace whatever is left of them in the storage underneath
+	listed := entries[:0]
+	for _, entry := range entries {
+		if _, _, ok := o.tracked(entry.Key); !ok {
+			listed = append(listed, entry)
+		}
+	}
+	for _, itemKey := range itemKeys {
+		state, err := o.manifest(itemKey)
+		if err != nil {
+			return nil, err
+		}
+		if root, ok := state.manifest.Entries["."]; ok {
+			listed = append(listed, fileInfo(itemKey, ".", root))
+			listed = append(listed, listManifest(itemKey, ".", state.manifest)...)
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Key < listed[j].Key })
+	return listed, nil
+}
+
+// listManifest lists the entries of a manifest below rel, or the entry at rel for files
+func listManifest(itemKey, rel string, manifest *Manifest) []storage.FileInfo {
+	entry, ok := manifest.Entries[rel]
+	if !ok {
+		return nil
+	}
+	if !entry.Dir {
+		return []storage.FileInfo{fileInfo(itemKey, rel, entry)}
+	}
+
+	var entries []storage.FileInfo
+	for key, entry := range manifest.Entries {
+		if key != rel && (rel == "." || strings.HasPrefix(key, rel+"/")) {
+			entries = append(entries, fileInfo(itemKey, key, entry))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Delete implements storage.Storage. Deleting a whole item deletes its manifest at once; its
+// history and objects stay in the store.
+func (o *Overlay) Delete(key string) error {
+	itemKey, rel, ok := o.tracked(key)
+	if !ok {
+		return o.base.Delete(key)
+	}
+	if rel == "." {
+		if err := o.base.Delete(manifestKey(itemKey)); err != nil {
+			return err
+		}
+		o.items[itemKey] = &itemState{manifest: NewManifest(), loaded: true}
+		return nil
+	}
+
+	state, err := o.manifest(itemKey)
+	if err != nil {
+		return err
+	}
+	state.remove(rel)
+	return nil
+}
+
+// Rename implements storage.Storage. Tracked items can't be renamed.
+func (o *Overlay) Rename(from, to string) error {
+	for _, key := range []string{from, to} {
+		if _, _, ok := o.tracked(key); ok {
+			return fmt.Errorf("failed to rename %s: %w", o.Location(key), errors.ErrUnsupported)
+		}
+	}
+	return o.base.Rename(from, to)
+}
+
+// Lock implements storage.Storage
+func (o *Overlay) Lock(name string, timeout time.Duration) (func() error, error) {
+	return o.base.Lock(name, timeout)
+}
+
+// Location implements storage.Storage. Tracked keys are described as their path in the
+// manifest of their item.
+func (o *Overlay) Location(key string) string {
+	itemKey, rel, ok := o.tracked(key)
+	if !ok {
+		return o.base.Location(key)
+	}
+	if rel == "." {
+		return o.base.Location(manifestKey(itemKey))
+	}
+	return o.base.Location(manifestKey(itemKey)) + "#" + rel
+}
+
+// MakeDir implements storage.DirMaker. It does nothing for storages without directories.
+func (o *Overlay) MakeDir(key string, opts storage.WriteOptions) error {
+	itemKey, rel, ok := o.tracked(key)
+	if !ok {
+		if dirs, ok := o.base.(storage.DirMaker); ok {
+			return dirs.MakeDir(key, opts)
+		}
+		return nil
+	}
+	state, err := o.manifest(itemKey)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{Dir: true, Mode: uint32(opts.Mode.Perm()), ModTime: opts.ModTime}
+	old, exists := state.manifest.Entries[rel]
+	if entry.ModTime.IsZero() {
+		entry.ModTime = time.Now()
+		if exists && old.Dir {
+			entry.ModTime = old.ModTime
+		}
+	}
+	if entry.Mode == 0 {
+		entry.Mode = defaultDirMode
+	}
+	if exists && old.Dir && old.Mode == entry.Mode && old.ModTime.Equal(entry.ModTime) {
+		return nil
+	}
+	state.put(rel, entry)
+	return nil
+}
+
+// Symlink implements storage.Linker. It returns an error wrapping errors.ErrUnsupported for
+// storages without symlinks.
+func (o *Overlay) Symlink(key, target string) error {
+	itemKey, rel, ok := o.tracked(key)
+	if !ok {
+		if linker, ok := o.base.(storage.Linker); ok {
+			return linker.Symlink(key, target)
+		}
+		return fmt.Errorf("failed to link %s: %w", o.Location(key), errors.ErrUnsupported)
+	}
+	state, err := o.manifest(itemKey)
+	if err != nil {
+		return err
+	}
+	if old, ok := state.manifest.Entries[rel]; ok && old.Link == target {
+		return nil
+	}
+	state.put(rel, Entry{Link: target, ModTime: time.Now()})
+	return nil
+}
@@ -0,0 +1,323 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Secret handling policies applied when a push finds possible secrets
+const (
+	PolicyOff     = "off"     // don't scan
+	PolicyWarn    = "warn"    // push and report the findings
+	PolicyBlock   = "block"   // refuse to push the item
+	PolicyEncrypt = "encrypt" // push the item encrypted
+)
+
+// DefaultPolicy is used when neither the item nor the local config sets a policy
+const DefaultPolicy = PolicyWarn
+
+// IgnoreMarker excludes a line from scanning when it appears in the line
+const IgnoreMarker = "syncstation:ignore"
+
+// maxScanFileSize is the largest file that is scanned
+const maxScanFileSize = 4 * 1024 * 1024
+
+// Finding describes a possible secret found in a file
+type Finding struct {
+	Path   string
+	Line   int
+	RuleID string
+	Reason string
+	Match  string // redacted match
+}
+
+// String formats a finding for display
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s (%s)", f.Path, f.Line, f.Reason, f.Match)
+}
+
+// Detector finds possible secrets in a single line of text
+type Detector interface {
+	// Detect returns the matched strings with the rule ID and description for each
+	Detect(line string) []Match
+}
+
+// Match is a single detection within a line
+type Match struct {
+	RuleID string
+	Reason string
+	Value  string
+}
+
+// RegexRule detects secrets matching a regular expression
+type RegexRule struct {
+	ID          string
+	Description string
+	Pattern     *regexp.Regexp
+}
+
+// Detect implements Detector
+func (r *RegexRule) Detect(line string) []Match {
+	var matches []Match
+	for _, value := range r.Pattern.FindAllString(line, -1) {
+		matches = append(matches, Match{RuleID: r.ID, Reason: r.Description, Value: value})
+	}
+	return matches
+}
+
+// EntropyDetector detects long random-looking strings such as generated tokens
+type EntropyDetector struct {
+	MinLength  int
+	MinEntropy float64 // Shannon entropy in bits per character
+}
+
+// tokenPattern splits lines into candidate tokens for entropy detection.
+// Slashes are excluded so file paths and URLs aren't reported.
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+=_\-]+`)
+
+// Detect implements Detector
+func (e *EntropyDetector) Detect(line string) []Match {
+	var matches []Match
+	for _, token := range tokenPattern.FindAllString(line, -1) {
+		if len(token) < e.MinLength || !hasMixedCharacters(token) {
+			continue
+		}
+		if shannonEntropy(token) >= e.MinEntropy {
+			matches = append(matches, Match{RuleID: "high-entropy", Reason: "high-entropy string", Value: token})
+		}
+	}
+	return matches
+}
+
+// builtinRules are the rules for common token formats and private keys
+var builtinRules = []*RegexRule{
+	{"private-key", "private key", regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{"aws-access-key-id", "AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA|AGPA|AIDA|AROA|ANPA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-access-key", "AWS secret access key", regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{"github-token", "GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"gitlab-token", "GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}\b`)},
+	{"slack-token", "Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"slack-webhook", "Slack webhook URL", regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9/]+`)},
+	{"google-api-key", "Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"stripe-key", "Stripe secret key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{20,}\b`)},
+	{"openai-key", "OpenAI API key", regexp.MustCompile(`\bsk-(proj-)?[A-Za-z0-9_\-]{32,}\b`)},
+	{"anthropic-key", "Anthropic API key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_\-]{32,}\b`)},
+	{"npm-token", "npm token", regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`)},
+	{"jwt", "JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`)},
+	{"url-credentials", "password in URL", regexp.MustCompile(`[a-z][a-z0-9+.\-]*://[^/\s:@]+:[^/\s:@]+@[^\s]+`)},
+}
+
+// Scanner runs detectors over files
+type Scanner struct {
+	detectors []Detector
+	exclude   func(rel string, isDir bool) bool // paths inside the scanned directory left out
+}
+
+// NewScanner creates a scanner with the given detectors
+func NewScanner(detectors ...Detector) *Scanner {
+	return &Scanner{detectors: detectors}
+}
+
+// SetExclude sets the filter of the slash-separated paths inside a scanned directory that are
+// not scanned, e.g. the files a sync item excludes
+func (s *Scanner) SetExclude(exclude func(rel string, isDir bool) bool) {
+	s.exclude = exclude
+}
+
+// NewDefaultScanner creates a scanner with the built-in rules, entropy detection
+// and the given custom regular expressions
+func NewDefaultScanner(customPatterns []string) (*Scanner, error) {
+	scanner := NewScanner(DefaultDetectors()...)
+
+	for i, pattern := range customPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %w", pattern, err)
+		}
+		scanner.AddDetector(&RegexRule{
+			ID:          fmt.Sprintf("custom-%d", i+1),
+			Description: fmt.Sprintf("custom pattern %s", pattern),
+			Pattern:     re,
+		})
+	}
+
+	return scanner, nil
+}
+
+// DefaultDetectors returns the built-in rules followed by entropy detection
+func DefaultDetectors() []Detector {
+	detectors := make([]Detector, 0, len(builtinRules)+1)
+	for _, rule := range builtinRules {
+		detectors = append(detectors, rule)
+	}
+	return append(detectors, &EntropyDetector{MinLength: 24, MinEntropy: 4.2})
+}
+
+// AddDetector adds a detector to the scanner
+func (s *Scanner) AddDetector(detector Detector) {
+	s.detectors = append(s.detectors, detector)
+}
+
+// ScanContent scans content line by line. path is only used to label findings.
+func (s *Scanner) ScanContent(path string, content []byte) []Finding {
+	if isBinary(content) {
+		return nil
+	}
+
+	var findings []Finding
+	lineScanner := bufio.NewScanner(bytes.NewReader(content))
+	lineScanner.Buffer(make([]byte, 0, 64*1024), maxScanFileSize)
+
+	lineNumber := 0
+	for lineScanner.Scan() {
+		lineNumber++
+		line := lineScanner.Text()
+		if strings.Contains(line, IgnoreMarker) {
+			continue
+		}
+
+		// Report each value once per line, preferring the first (most specific) detector
+		seen := make(map[string]bool)
+		for _, detector := range s.detectors {
+			for _, match := range detector.Detect(line) {
+				if seen[match.Value] || overlapsSeen(match.Value, seen) {
+					continue
+				}
+				seen[match.Value] = true
+				findings = append(findings, Finding{
+					Path:   path,
+					Line:   lineNumber,
+					RuleID: match.RuleID,
+					Reason: match.Reason,
+					Match:  Redact(match.Value),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// ScanPath scans a file, or every file in a directory
+func (s *Scanner) ScanPath(root string) ([]Finding, error) {
+	var findings []Finding
+
+	// Follow the root itself when it is a link; links below it are not followed
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if s.exclude != nil && path != root {
+			if rel, err := filepath.Rel(root, path); err == nil && s.exclude(filepath.ToSlash(rel), entry.IsDir()) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxScanFileSize {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		findings = append(findings, s.ScanContent(path, content)...)
+		return nil
+	})
+
+	return findings, err
+}
+
+// Redact hides the middle of a secret so findings can be shown safely
+func Redact(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:4]) + strings.Repeat("*", len(runes)-8) + string(runes[len(runes)-4:])
+}
+
+// ValidPolicy reports whether policy is a known secret policy
+func ValidPolicy(policy string) bool {
+	switch policy {
+	case PolicyOff, PolicyWarn, PolicyBlock, PolicyEncrypt:
+		return true
+	}
+	return false
+}
+
+// overlapsSeen reports whether value is part of, or contains, an already reported value
+func overlapsSeen(value string, seen map[string]bool) bool {
+	for existing := range seen {
+		if strings.Contains(existing, value) || strings.Contains(value, existing) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMixedCharacters reports whether a token mixes letters and digits, as generated tokens do
+func hasMixedCharacters(token string) bool {
+	var letters, digits bool
+	for _, r := range token {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			letters = true
+		}
+	}
+	return letters && digits
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	entropy := 0.0
+	length := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// isBinary reports whether content looks binary by checking for NUL bytes near its start
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
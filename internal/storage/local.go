@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// staleLockAge is how old a lock file must be before it is considered abandoned
+const staleLockAge = 10 * time.Minute
+
+// Local stores the cloud copy in a directory on this computer, typically one kept in sync
+// by a cloud drive client. An empty root uses keys as filesystem paths.
+type Local struct {
+	root string
+}
+
+// NewLocal creates a storage for the directory root
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// Path returns the filesystem path of key
+func (l *Local) Path(key string) string {
+	if l.root == "" {
+		return filepath.FromSlash(key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key))
+}
+
+// Stat implements Storage
+func (l *Local) Stat(key string) (FileInfo, error) {
+	info, err := os.Lstat(l.Path(key))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return l.fileInfo(key, l.Path(key), info), nil
+}
+
+// fileInfo converts the os information of the entry at path
+func (l *Local) fileInfo(key, path string, info os.FileInfo) FileInfo {
+	fi := FileInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Mode:    info.Mode().Perm(),
+		IsDir:   info.IsDir(),
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, _ := os.Readlink(path)
+		fi.Link = filepath.ToSlash(link)
+		fi.Size = 0
+	}
+	return fi
+}
+
+// Read implements Storage
+func (l *Local) Read(key string) ([]byte, error) {
+	return os.ReadFile(l.Path(key))
+}
+
+// Write implements Storage
+func (l *Local) Write(key string, data []byte, opts WriteOptions) error {
+	path := l.Path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Never write through a symlink left at the destination
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	mode := opts.Mode.Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if !opts.ModTime.IsZero() {
+		if err := os.Chtimes(tmp.Name(), opts.ModTime, opts.ModTime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// List implements Storage
+func (l *Local) List(key string) ([]FileInfo, error) {
+	root := l.Path(key)
+	info, err := os.Lstat(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []FileInfo{l.fileInfo(key, root, info)}, nil
+	}
+
+	var entries []FileInfo
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		// WalkDir never follows symlinks, so link loops can't recurse
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, l.fileInfo(Join(key, filepath.ToSlash(rel)), path, info))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Delete implements Storage
+func (l *Local) Delete(key string) error {
+	return os.RemoveAll(l.Path(key))
+}
+
+// Rename implements Storage
+func (l *Local) Rename(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path(to)), 0755); err != nil {
+		return err
+	}
+	return os.Rename(l.Path(from), l.Path(to))
+}
+
+// MakeDir implements DirMaker
+func (l *Local) MakeDir(key string, opts WriteOptions) error {
+	path := l.Path(key)
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	mode := opts.Mode.Perm()
+	if mode == 0 {
+		mode = 0755
+	}
+	if err := os.MkdirAll(path, mode); err != nil {
+		return err
+	}
+	// MkdirAll leaves the mode of existing directories alone
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if opts.ModTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(path, opts.ModTime, opts.ModTime)
+}
+
+// Symlink implements Linker
+func (l *Local) Symlink(key, target string) error {
+	path := l.Path(key)
+	target = filepath.FromSlash(target)
+	if info, err := os.Lstat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("refusing to replace directory %s with a symlink", path)
+		}
+		if existing, err := os.Readlink(path); err == nil && existing == target {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(target, path)
+}
+
+// Lock implements Storage. Lock files live in the temporary directory of this computer
+// rather than the cloud directory, whose client would copy them to other computers and
+// create conflict copies; they guard against concurrent syncs on this computer.
+func (l *Local) Lock(name string, timeout time.Duration) (func() error, error) {
+	dir := filepath.Join(os.TempDir(), "syncstation-locks")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(l.root))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:6])+"-"+name+".lock")
+	hostname, _ := os.Hostname()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(file, "%s %d %s\n", hostname, os.Getpid(), time.Now().Format(time.RFC3339))
+			file.Close()
+			return func() error { return os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		// Take over locks left behind by crashed processes
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s is held by another process (remove %s if it is stale)", ErrLocked, name, path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Location implements Storage
+func (l *Local) Location(key string) string {
+	return l.Path(key)
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalReadWrite(t *testing.T) {
+	root := t.TempDir()
+	l := NewLocal(root)
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := l.Write("configs/Shell/.zshrc", []byte("export EDITOR=nvim\n"), WriteOptions{Mode: 0600, ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := l.Read("configs/Shell/.zshrc")
+	if err != nil || string(data) != "export EDITOR=nvim\n" {
+		t.Fatalf("Read = %q, %v", data, err)
+	}
+	info, err := l.Stat("configs/Shell/.zshrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "configs/Shell/.zshrc" || info.Size != 19 || !info.ModTime.Equal(modTime) || info.IsDir {
+		t.Errorf("Stat = %+v", info)
+	}
+	if runtime.GOOS != "windows" && info.Mode != 0600 {
+		t.Errorf("mode = %o, want 600", info.Mode)
+	}
+
+	// Replacing keeps no temporary file behind
+	if err := l.Write("configs/Shell/.zshrc", []byte("export EDITOR=vim\n"), WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(root, "configs", "Shell")); err != nil || len(entries) != 1 {
+		t.Errorf("files in the directory = %v, %v", entries, err)
+	}
+	if _, err := l.Read("configs/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Read of missing key = %v, want ErrNotExist", err)
+	}
+	if _, err := l.Stat("configs/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat of missing key = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLocalWriteReplacesSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "outside")
+	if err := os.WriteFile(outside, []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := NewLocal(root)
+	if err := l.Symlink("link", outside); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Write("link", []byte("inside"), WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "outside" {
+		t.Errorf("the write went through the symlink: %q", data)
+	}
+	if info, err := l.Stat("link"); err != nil || info.IsLink() {
+		t.Errorf("Stat = %+v, %v, want a file", info, err)
+	}
+}
+
+func TestLocalListRenameDelete(t *testing.T) {
+	l := NewLocal(t.TempDir())
+	for _, key := range []string{"configs/Nvim/init.lua", "configs/Nvim/lua/plugins.lua", "configs/Shell/.zshrc"} {
+		if err := l.Write(key, []byte(key), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.MakeDir("configs/Nvim/after", WriteOptions{Mode: 0700}); err != nil {
+		t.Fatal(err)
+	}
+	withLink := runtime.GOOS != "windows"
+	if withLink {
+		if err := l.Symlink("configs/Nvim/current", "init.lua"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := l.List("configs/Nvim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+		switch entry.Key {
+		case "configs/Nvim/after":
+			if !entry.IsDir || (runtime.GOOS != "windows" && entry.Mode != 0700) {
+				t.Errorf("directory = %+v", entry)
+			}
+		case "configs/Nvim/current":
+			if entry.Link != "init.lua" || entry.Size != 0 {
+				t.Errorf("symlink = %+v", entry)
+			}
+		}
+	}
+	want := []string{"configs/Nvim/after", "configs/Nvim/init.lua", "configs/Nvim/lua", "configs/Nvim/lua/plugins.lua"}
+	if withLink {
+		want = append(want[:1], append([]string{"configs/Nvim/current"}, want[1:]...)...)
+	}
+	if strings.Join(keys, " ") != strings.Join(want, " ") {
+		t.Errorf("List = %v, want %v", keys, want)
+	}
+
+	// A file lists itself, a missing key nothing
+	if entries, err := l.List("configs/Shell/.zshrc"); err != nil || len(entries) != 1 || entries[0].Key != "configs/Shell/.zshrc" {
+		t.Errorf("List of a file = %+v, %v", entries, err)
+	}
+	if entries, err := l.List("configs/missing"); err != nil || len(entries) != 0 {
+		t.Errorf("List of a missing key = %+v, %v", entries, err)
+	}
+
+	if err := l.Rename("configs/Nvim", "renamed/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := l.Read("renamed/Neovim/lua/plugins.lua"); err != nil || string(data) != "configs/Nvim/lua/plugins.lua" {
+		t.Errorf("renamed file = %q, %v", data, err)
+	}
+	if err := l.Delete("renamed/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if Exists(l, "renamed/Neovim") {
+		t.Error("the deleted tree still exists")
+	}
+	if err := l.Delete("renamed/Neovim"); err != nil {
+		t.Errorf("deleting a missing key = %v", err)
+	}
+}
+
+func TestLocalSymlinkRefusesDirectories(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	l := NewLocal(t.TempDir())
+	if err := l.MakeDir("configs/Nvim", WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Symlink("configs/Nvim", "elsewhere"); err == nil {
+		t.Error("a directory was replaced with a symlink")
+	}
+}
+
+func TestLocalLock(t *testing.T) {
+	l := NewLocal(t.TempDir())
+	unlock, err := l.Lock("sync", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another storage of the same directory waits for the lock
+	if _, err := NewLocal(l.root).Lock("sync", 200*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Errorf("second Lock = %v, want ErrLocked", err)
+	}
+	// Locks are per name and per directory
+	if other, err := l.Lock("file-metadata", time.Second); err != nil {
+		t.Errorf("Lock of another name = %v", err)
+	} else {
+		other()
+	}
+	if other, err := NewLocal(t.TempDir()).Lock("sync", time.Second); err != nil {
+		t.Errorf("Lock of another directory = %v", err)
+	} else {
+		other()
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := l.Lock("sync", time.Second)
+	if err != nil {
+		t.Fatalf("Lock after unlock = %v", err)
+	}
+	again()
+}
+
+func TestLocalPathWithoutRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "init.lua"), []byte("vim.o.number = true"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Without a root, keys are paths on this computer
+	l := NewLocal("")
+	data, err := l.Read(filepath.ToSlash(filepath.Join(dir, "init.lua")))
+	if err != nil || string(data) != "vim.o.number = true" {
+		t.Errorf("Read = %q, %v", data, err)
+	}
+	if path, ok := LocalPath(l, "a/b"); !ok || path != filepath.FromSlash("a/b") {
+		t.Errorf("LocalPath = %s, %v", path, ok)
+	}
+	if _, ok := LocalPath(Unavailable{Err: errors.New("offline")}, "a/b"); ok {
+		t.Error("an unavailable storage has local paths")
+	}
+}
+
+func TestRel(t *testing.T) {
+	tests := []struct {
+		base, key string
+		want      string
+		ok        bool
+	}{
+		{"configs/Nvim", "configs/Nvim/init.lua", "init.lua", true},
+		{"configs/Nvim", "configs/Nvim/lua/plugins.lua", "lua/plugins.lua", true},
+		{"configs/Nvim", "configs/Nvim", ".", true},
+		{"configs/Nvim/", "configs/Nvim/init.lua", "init.lua", true},
+		{"configs/Nvim", "configs/Nvim-Old/init.lua", "", false},
+		{"configs/Nvim", "configs/Shell/.zshrc", "", false},
+		{".", "configs/Nvim", "configs/Nvim", true},
+		{".", "../outside", "", false}, // keys outside the base are only reported as such
+	}
+	for _, test := range tests {
+		got, ok := Rel(test.base, test.key)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("Rel(%q, %q) = %q, %v, want %q, %v", test.base, test.key, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestLinkTarget(t *testing.T) {
+	tests := []struct {
+		key, link string
+		inside    bool
+	}{
+		{"configs/Nvim/current", "init.lua", true},
+		{"configs/Nvim/lua/current", "../init.lua", true},
+		{"configs/Nvim/current", "../Shell/.zshrc", false},
+		{"configs/Nvim/lua/current", "../../../outside", false},
+		{"configs/Nvim/current", "/home/me/.config/nvim/init.lua", false},
+	}
+	for _, test := range tests {
+		target, inside := LinkTarget("configs/Nvim", FileInfo{Key: test.key, Link: test.link})
+		if target != test.link || inside != test.inside {
+			t.Errorf("LinkTarget of %s -> %s = %s, %v, want inside %v", test.key, test.link, target, inside, test.inside)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, storageType := range []string{"", TypeLocal} {
+		st, err := Open(Config{Type: storageType}, "/cloud")
+		if err != nil {
+			t.Errorf("Open(%q) = %v", storageType, err)
+			continue
+		}
+		if got := st.Location("configs/Nvim"); got != filepath.Join("/cloud", "configs", "Nvim") {
+			t.Errorf("Open(%q) location = %s", storageType, got)
+		}
+	}
+	if _, err := Open(Config{Type: "ftp"}, "/cloud"); err == nil {
+		t.Error("Open accepted an unknown storage type")
+	}
+}
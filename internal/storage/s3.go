@@ -0,0 +1,498 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// defaultS3PartSizeMB is the size of multipart upload parts, above which files are uploaded
+// in parts, when the configuration doesn't set one
+const defaultS3PartSizeMB = 16
+
+// minS3PartSizeMB is the smallest part size S3 accepts
+const minS3PartSizeMB = 5
+
+// s3LockDir is the directory below the prefix holding lock objects
+const s3LockDir = ".syncstation-locks"
+
+// s3LockRefresh is how often held locks are rewritten, so that they never become stale
+var s3LockRefresh = staleLockAge / 3
+
+// Keys of the user metadata keeping file attributes. S3 returns them canonicalized.
+const (
+	s3MetaMode    = "Mode"
+	s3MetaModTime = "Mtime"
+	s3MetaLink    = "Link"
+)
+
+// S3Config configures an S3-compatible storage such as AWS S3 or MinIO
+type S3Config struct {
+	Endpoint   string `json:"endpoint"`   // host[:port], "s3.amazonaws.com" when empty
+	Region     string `json:"region"`     // bucket region, detected when empty
+	Bucket     string `json:"bucket"`     // bucket holding the cloud copy
+	Prefix     string `json:"prefix"`     // key prefix inside the bucket, e.g. "syncstation"
+	AccessKey  string `json:"accessKey"`  // taken from the environment or ~/.aws/credentials when empty
+	SecretKey  string `json:"secretKey"`  // secret of AccessKey
+	Insecure   bool   `json:"insecure"`   // use plain HTTP, e.g. for a local MinIO
+	PartSizeMB int    `json:"partSizeMB"` // multipart upload part size, 16 when 0
+}
+
+// S3 is a storage keeping the cloud copy in an S3 bucket. Files are objects named by their
+// key below the prefix; permissions, modification times and symlink targets are kept in
+// user metadata, symlinks being empty objects. Directories are implied by the objects below
+// them, with marker objects ending in "/" keeping their attributes.
+type S3 struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	partSize uint64
+}
+
+// NewS3 returns a storage for the bucket configured by cfg
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage needs a bucket")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	partSizeMB := cfg.PartSizeMB
+	if partSizeMB == 0 {
+		partSizeMB = defaultS3PartSizeMB
+	}
+	if partSizeMB < minS3PartSizeMB {
+		return nil, fmt.Errorf("s3 part size must be at least %d MB", minS3PartSizeMB)
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+	})
+	if cfg.AccessKey != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &S3{
+		client:   client,
+		bucket:   cfg.Bucket,
+		prefix:   strings.Trim(cfg.Prefix, "/"),
+		partSize: uint64(partSizeMB) << 20,
+	}, nil
+}
+
+// object returns the name of the object holding key, empty for the storage root
+func (s *S3) object(key string) string {
+	name := path.Join(s.prefix, key)
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// dirPrefix returns the prefix of the objects below key
+func (s *S3) dirPrefix(key string) string {
+	if name := s.object(key); name != "" {
+		return name + "/"
+	}
+	return ""
+}
+
+// key returns the storage key of an object name
+func (s *S3) key(name string) string {
+	name = strings.TrimSuffix(name, "/")
+	if s.prefix == "" {
+		return name
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(name, s.prefix), "/")
+}
+
+// wrapErr converts S3 errors about key to the storage errors
+func (s *S3) wrapErr(key string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	switch {
+	case resp.Code == minio.NoSuchKey:
+		return fmt.Errorf("%s: %w", s.Location(key), ErrNotExist)
+	case resp.StatusCode == http.StatusPreconditionFailed, resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("%s: %w", s.Location(key), ErrConflict)
+	}
+	return fmt.Errorf("%s: %w", s.Location(key), err)
+}
+
+// fileInfo returns the storage information of an object
+func (s *S3) fileInfo(object minio.ObjectInfo) FileInfo {
+	info := FileInfo{
+		Key:     s.key(object.Key),
+		Size:    object.Size,
+		ModTime: object.LastModified,
+		IsDir:   strings.HasSuffix(object.Key, "/"),
+		ETag:    object.ETag,
+	}
+	meta := object.UserMetadata
+	if mode, err := strconv.ParseUint(meta[s3MetaMode], 8, 32); err == nil {
+		info.Mode = os.FileMode(mode).Perm()
+	}
+	if modTime, err := time.Parse(time.RFC3339Nano, meta[s3MetaModTime]); err == nil {
+		info.ModTime = modTime
+	}
+	if link, err := url.PathUnescape(meta[s3MetaLink]); err == nil && link != "" {
+		info.Link = link
+		info.Size = int64(len(link))
+	}
+	if info.IsDir {
+		info.Size = 0
+	}
+	return info
+}
+
+// putOptions returns the upload options keeping the attributes in opts
+func (s *S3) putOptions(opts WriteOptions) minio.PutObjectOptions {
+	meta := map[string]string{}
+	if opts.Mode != 0 {
+		meta[s3MetaMode] = strconv.FormatUint(uint64(opts.Mode.Perm()), 8)
+	}
+	if !opts.ModTime.IsZero() {
+		meta[s3MetaModTime] = opts.ModTime.UTC().Format(time.RFC3339Nano)
+	}
+	return minio.PutObjectOptions{
+		UserMetadata: meta,
+		ContentType:  "application/octet-stream",
+		PartSize:     s.partSize,
+	}
+}
+
+// put uploads data to the object holding key. Files larger than the part size are uploaded
+// in parts.
+func (s *S3) put(key, name string, data []byte, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	upload, err := s.client.PutObject(context.Background(), s.bucket, name, bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		return upload, s.wrapErr(key, err)
+	}
+	return upload, nil
+}
+
+// Stat implements Storage. Keys without an object of their own are directories when objects
+// exist below them.
+func (s *S3) Stat(key string) (FileInfo, error) {
+	name := s.object(key)
+	if name == "" {
+		return FileInfo{Key: ".", IsDir: true}, nil
+	}
+
+	// Cancelling stops the listing below once an object was seen
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	object, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err == nil {
+		return s.fileInfo(object), nil
+	}
+	if err := s.wrapErr(key, err); !errors.Is(err, ErrNotExist) {
+		return FileInfo{}, err
+	}
+
+	if object, err := s.client.StatObject(ctx, s.bucket, name+"/", minio.StatObjectOptions{}); err == nil {
+		return s.fileInfo(object), nil
+	}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: name + "/", MaxKeys: 1}) {
+		if object.Err != nil {
+			return FileInfo{}, s.wrapErr(key, object.Err)
+		}
+		return FileInfo{Key: s.key(name), IsDir: true}, nil
+	}
+	return FileInfo{}, fmt.Errorf("%s: %w", s.Location(key), ErrNotExist)
+}
+
+// Read implements Storage
+func (s *S3) Read(key string) ([]byte, error) {
+	data, _, err := s.ReadVersion(key)
+	return data, err
+}
+
+// ReadVersion implements Versioned
+func (s *S3) ReadVersion(key string) ([]byte, string, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.object(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", s.wrapErr(key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, "", s.wrapErr(key, err)
+	}
+	info, err := object.Stat()
+	if err != nil {
+		return nil, "", s.wrapErr(key, err)
+	}
+	return data, info.ETag, nil
+}
+
+// Write implements Storage. Objects are replaced atomically by S3.
+func (s *S3) Write(key string, data []byte, opts WriteOptions) error {
+	_, err := s.put(key, s.object(key), data, s.putOptions(opts))
+	return err
+}
+
+// WriteIfMatch implements Versioned with a conditional PUT
+func (s *S3) WriteIfMatch(key string, data []byte, etag string, opts WriteOptions) error {
+	_, err := s.writeIfMatch(key, data, etag, opts)
+	return err
+}
+
+// writeIfMatch is WriteIfMatch returning the ETag of the written object
+func (s *S3) writeIfMatch(key string, data []byte, etag string, opts WriteOptions) (string, error) {
+	putOpts := s.putOptions(opts)
+	putOpts.DisableMultipart = true
+	if etag == "" {
+		putOpts.SetMatchETagExcept("*")
+	} else {
+		putOpts.SetMatchETag(etag)
+	}
+	upload, err := s.put(key, s.object(key), data, putOpts)
+	if err != nil {
+		return "", err
+	}
+	return upload.ETag, nil
+}
+
+// List implements Storage. Directories without marker objects are listed from the objects
+// below them.
+func (s *S3) List(key string) ([]FileInfo, error) {
+	ctx := context.Background()
+	prefix := s.dirPrefix(key)
+	lockPrefix := s.dirPrefix(s3LockDir)
+
+	var entries []FileInfo
+	dirs := make(map[string]bool)
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, s.wrapErr(key, object.Err)
+		}
+		if object.Key == prefix || strings.HasPrefix(object.Key, lockPrefix) {
+			continue
+		}
+
+		// Listings have no user metadata, so the empty objects that may be links or
+		// directory markers are looked up
+		if object.Size == 0 {
+			stat, err := s.client.StatObject(ctx, s.bucket, object.Key, minio.StatObjectOptions{})
+			if err != nil {
+				return nil, s.wrapErr(s.key(object.Key), err)
+			}
+			object = stat
+		}
+		info := s.fileInfo(object)
+
+		if info.IsDir {
+			if dirs[info.Key] {
+				// Replace the implied entry with the marker keeping the attributes
+				for i := range entries {
+					if entries[i].Key == info.Key {
+						entries[i] = info
+					}
+				}
+				continue
+			}
+			dirs[info.Key] = true
+		}
+		entries = append(entries, info)
+
+		// Add the directories implied by the object
+		for dir := path.Dir(info.Key); ; dir = path.Dir(dir) {
+			if _, below := Rel(key, dir); !below || path.Clean(dir) == path.Clean(key) || dirs[dir] {
+				break
+			}
+			dirs[dir] = true
+			entries = append(entries, FileInfo{Key: dir, IsDir: true})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Delete implements Storage
+func (s *S3) Delete(key string) error {
+	ctx := context.Background()
+	if name := s.object(key); name != "" {
+		err := s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+		if err != nil && !errors.Is(s.wrapErr(key, err), ErrNotExist) {
+			return s.wrapErr(key, err)
+		}
+	}
+
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.dirPrefix(key), Recursive: true})
+	for result := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return s.wrapErr(s.key(result.ObjectName), result.Err)
+		}
+	}
+	return nil
+}
+
+// Rename implements Storage. S3 has no rename, so objects are copied then deleted: renaming
+// a single file is atomic for readers of to, renaming a tree is not.
+func (s *S3) Rename(from, to string) error {
+	entries, err := s.List(from)
+	if err != nil {
+		return err
+	}
+	if info, err := s.Stat(from); err != nil {
+		return err
+	} else if s.object(from) != "" {
+		entries = append(entries, info)
+	}
+
+	if err := s.Delete(to); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, entry := range entries {
+		rel, _ := Rel(from, entry.Key)
+		src := s.object(entry.Key)
+		dst := s.object(Join(to, rel))
+		if entry.IsDir {
+			// Implied directories have no object to copy
+			if _, err := s.client.StatObject(ctx, s.bucket, src+"/", minio.StatObjectOptions{}); err != nil {
+				continue
+			}
+			src, dst = src+"/", dst+"/"
+		}
+		_, err := s.client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: s.bucket, Object: dst},
+			minio.CopySrcOptions{Bucket: s.bucket, Object: src})
+		if err != nil {
+			return s.wrapErr(entry.Key, err)
+		}
+	}
+	return s.Delete(from)
+}
+
+// MakeDir implements DirMaker with a marker object keeping the directory attributes
+func (s *S3) MakeDir(key string, opts WriteOptions) error {
+	name := s.object(key)
+	if name == "" {
+		return nil
+	}
+	// Replace a link or file left at key
+	if err := s.client.RemoveObject(context.Background(), s.bucket, name, minio.RemoveObjectOptions{}); err != nil {
+		if err := s.wrapErr(key, err); !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	_, err := s.put(key, name+"/", nil, s.putOptions(opts))
+	return err
+}
+
+// Symlink implements Linker with an empty object whose metadata holds the target
+func (s *S3) Symlink(key, target string) error {
+	opts := s.putOptions(WriteOptions{Mode: 0777})
+	opts.UserMetadata[s3MetaLink] = url.PathEscape(target)
+	_, err := s.put(key, s.object(key), nil, opts)
+	return err
+}
+
+// Lock implements Storage with a lock object created by a conditional PUT, which only
+// succeeds while no other computer holds the lock. Stale locks are taken over with a PUT
+// conditional on the ETag of the stale lock, so only one computer can take over a lock.
+// Held locks are rewritten in the background until they are released.
+func (s *S3) Lock(name string, timeout time.Duration) (func() error, error) {
+	key := Join(s3LockDir, name+".lock")
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s %d %s %d\n", hostname, os.Getpid(), time.Now().Format(time.RFC3339Nano), rand.Int63())
+
+	deadline := time.Now().Add(timeout)
+	for {
+		etag, err := s.writeIfMatch(key, []byte(owner), "", WriteOptions{})
+		if err == nil {
+			return s.holdLock(key, owner, etag), nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return nil, err
+		}
+
+		// Take over locks left behind by crashed processes
+		if info, err := s.Stat(key); err == nil && info.ETag != "" && time.Since(info.ModTime) > staleLockAge {
+			etag, err := s.writeIfMatch(key, []byte(owner), info.ETag, WriteOptions{})
+			if err == nil {
+				return s.holdLock(key, owner, etag), nil
+			}
+			if !errors.Is(err, ErrConflict) && !errors.Is(err, ErrNotExist) {
+				return nil, err
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s is held by another computer (remove %s if it is stale)", ErrLocked, name, s.Location(key))
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// holdLock rewrites the lock object at key, as long as it still has etag, until the returned
+// function releases it, so that the lock never becomes stale. The release fails when a refresh
+// did, as another computer may have taken the lock over meanwhile.
+func (s *S3) holdLock(key, owner, etag string) func() error {
+	stop, done := make(chan struct{}), make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(s3LockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			case <-ticker.C:
+			}
+
+			refreshed, err := s.writeIfMatch(key, []byte(owner), etag, WriteOptions{})
+			if err != nil {
+				done <- fmt.Errorf("failed to refresh lock %s: %w", s.Location(key), err)
+				return
+			}
+			etag = refreshed
+		}
+	}()
+
+	return func() error {
+		close(stop)
+		refreshErr := <-done
+		// Leave the lock alone if another computer took it over
+		if data, err := s.Read(key); err == nil && string(data) == owner {
+			if err := s.Delete(key); err != nil {
+				return err
+			}
+		}
+		return refreshErr
+	}
+}
+
+// Location implements Storage
+func (s *S3) Location(key string) string {
+	return "s3://" + s.bucket + "/" + s.object(key)
+}
@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+// testBucket is the bucket of the fake S3 server
+const testBucket = "syncstation"
+
+// fakeS3Fixes makes the fake S3 server behave as S3 where it differs: PUT requests enforce
+// If-Match and If-None-Match, replace the user metadata of the object rather than merging
+// it and accept chunked uploads of empty objects, and listings ignore an empty delimiter.
+// Writes are serialized so the check and the write are atomic. Before each write replacing
+// or deleting an existing object it runs the next function of race, if any, as if another
+// computer had written in between.
+type fakeS3Fixes struct {
+	mu      sync.Mutex
+	backend *s3mem.Backend
+	next    http.Handler
+	race    []func()
+}
+
+func (c *fakeS3Fixes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if query := r.URL.Query(); query.Has("delimiter") && query.Get("delimiter") == "" {
+		query.Del("delimiter")
+		r.URL.RawQuery = query.Encode()
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		c.next.ServeHTTP(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete || r.Header.Get("If-Match") != "" {
+		c.mu.Lock()
+		var race func()
+		if len(c.race) > 0 {
+			race, c.race = c.race[0], c.race[1:]
+		}
+		c.mu.Unlock()
+		if race != nil {
+			race()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if r.Method == http.MethodPut && r.ContentLength < 0 {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	if r.Method == http.MethodPut && r.URL.RawQuery == "" && r.Header.Get("X-Amz-Copy-Source") == "" {
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		current := ""
+		if obj, err := c.backend.HeadObject(bucket, object); err == nil {
+			current = hex.EncodeToString(obj.Hash)
+		}
+		if (ifNoneMatch == "*" && current != "") || (ifMatch != "" && strings.Trim(ifMatch, `"`) != current) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if current != "" {
+			if _, err := c.backend.DeleteObject(bucket, object); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	c.next.ServeHTTP(w, r)
+}
+
+// newTestS3 returns a function connecting new clients, as separate computers would, to an
+// in-process fake S3 server
+func newTestS3(t *testing.T, prefix string) (func() *S3, *fakeS3Fixes) {
+	t.Helper()
+	backend := s3mem.New()
+	if err := backend.CreateBucket(testBucket); err != nil {
+		t.Fatal(err)
+	}
+	faker := gofakes3.New(backend)
+	fixes := &fakeS3Fixes{backend: backend, next: faker.Server()}
+	server := httptest.NewServer(fixes)
+	t.Cleanup(server.Close)
+
+	serverURL, _ := url.Parse(server.URL)
+	return func() *S3 {
+		s, err := NewS3(S3Config{
+			Endpoint:  serverURL.Host,
+			Region:    "us-east-1",
+			Bucket:    testBucket,
+			Prefix:    prefix,
+			AccessKey: "access",
+			SecretKey: "secret",
+			Insecure:  true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}, fixes
+}
+
+func TestS3ReadWrite(t *testing.T) {
+	connect, _ := newTestS3(t, "cloud")
+	s := connect()
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := s.Write("configs/Shell/.zshrc", []byte("export EDITOR=nvim\n"), WriteOptions{Mode: 0600, ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := s.Read("configs/Shell/.zshrc")
+	if err != nil || string(data) != "export EDITOR=nvim\n" {
+		t.Fatalf("Read = %q, %v", data, err)
+	}
+	info, err := s.Stat("configs/Shell/.zshrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "configs/Shell/.zshrc" || info.Mode != 0600 || !info.ModTime.Equal(modTime) || info.IsDir {
+		t.Errorf("Stat = %+v", info)
+	}
+	if info, err := s.Stat("configs/Shell"); err != nil || !info.IsDir {
+		t.Errorf("Stat of implied directory = %+v, %v", info, err)
+	}
+	if _, err := s.Read("configs/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Read of missing key = %v, want ErrNotExist", err)
+	}
+}
+
+func TestS3ListRenameDelete(t *testing.T) {
+	connect, _ := newTestS3(t, "")
+	s := connect()
+	for _, key := range []string{"configs/Nvim/init.lua", "configs/Nvim/lua/plugins.lua", "configs/Shell/.zshrc"} {
+		if err := s.Write(key, []byte(key), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Directory markers aren't covered: the fake S3 server strips the trailing slash of
+	// their names
+	if err := s.Symlink("configs/Nvim/current", "init.lua"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.List("configs/Nvim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Key)
+		if entry.Key == "configs/Nvim/current" && entry.Link != "init.lua" {
+			t.Errorf("symlink = %+v", entry)
+		}
+	}
+	want := "configs/Nvim/current configs/Nvim/init.lua configs/Nvim/lua configs/Nvim/lua/plugins.lua"
+	if strings.Join(got, " ") != want {
+		t.Errorf("List = %v, want %s", got, want)
+	}
+
+	if err := s.Rename("configs/Nvim", "configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := s.Read("configs/Neovim/lua/plugins.lua"); err != nil || string(data) != "configs/Nvim/lua/plugins.lua" {
+		t.Errorf("renamed file = %q, %v", data, err)
+	}
+	if _, err := s.Stat("configs/Nvim"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat after rename = %v, want ErrNotExist", err)
+	}
+
+	if err := s.Delete("configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := s.List("configs"); err != nil || len(entries) != 2 {
+		t.Errorf("List after delete = %+v, %v", entries, err)
+	}
+}
+
+func TestS3WriteIfMatch(t *testing.T) {
+	connect, _ := newTestS3(t, "")
+	s := connect()
+	if err := s.WriteIfMatch("file-metadata.json", []byte("v1"), "", WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteIfMatch("file-metadata.json", []byte("v1 again"), "", WriteOptions{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("create-only write of existing key = %v, want ErrConflict", err)
+	}
+
+	_, etag, err := s.ReadVersion("file-metadata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write("file-metadata.json", []byte("v2 from another computer"), WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteIfMatch("file-metadata.json", []byte("v2"), etag, WriteOptions{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("write with stale etag = %v, want ErrConflict", err)
+	}
+
+	_, etag, _ = s.ReadVersion("file-metadata.json")
+	if err := s.WriteIfMatch("file-metadata.json", []byte("v3"), etag, WriteOptions{}); err != nil {
+		t.Errorf("write with current etag = %v", err)
+	}
+}
+
+func TestS3LockExcludesOtherComputers(t *testing.T) {
+	connect, _ := newTestS3(t, "")
+	laptop, desktop := connect(), connect()
+
+	unlock, err := laptop.Lock("sync", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := desktop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock = %v, want ErrLocked", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err = desktop.Lock("sync", 0)
+	if err != nil {
+		t.Fatalf("Lock after unlock = %v", err)
+	}
+	unlock()
+}
+
+func TestS3StaleLockIsTakenOverOnce(t *testing.T) {
+	connect, fixes := newTestS3(t, "")
+	laptop, desktop := connect(), connect()
+	stale := WriteOptions{ModTime: time.Now().Add(-2 * staleLockAge)}
+	if err := laptop.Write(s3LockDir+"/sync.lock", []byte("crashed 1\n"), stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// The desktop takes the stale lock over after the laptop found it stale
+	var desktopUnlock func() error
+	fixes.race = []func(){func() {
+		var err error
+		if desktopUnlock, err = desktop.Lock("sync", 0); err != nil {
+			t.Errorf("desktop Lock = %v", err)
+		}
+	}}
+	if _, err := laptop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("laptop Lock = %v, want ErrLocked as the desktop took the lock over", err)
+	}
+	if desktopUnlock == nil {
+		t.Fatal("the desktop didn't take the stale lock over")
+	}
+
+	if err := desktopUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := laptop.Stat(s3LockDir + "/sync.lock"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("lock after unlock = %v, want ErrNotExist", err)
+	}
+}
+
+func TestS3LockIsRefreshedUntilUnlock(t *testing.T) {
+	refresh := s3LockRefresh
+	s3LockRefresh = 10 * time.Millisecond
+	t.Cleanup(func() { s3LockRefresh = refresh })
+
+	tests := []struct {
+		name     string
+		takeOver bool
+		wantErr  string
+		wantLock string
+	}{
+		{name: "a held lock"},
+		{name: "a lock taken over by another computer", takeOver: true, wantErr: "failed to refresh lock", wantLock: "desktop 42\n"},
+	}
+	for _, test := range tests {
+		connect, fixes := newTestS3(t, "")
+		laptop, desktop := connect(), connect()
+
+		// Refreshes are conditional writes, which run the race functions first
+		refreshed := make(chan struct{})
+		fixes.race = []func(){func() {}, func() { close(refreshed) }}
+		if test.takeOver {
+			fixes.race = []func(){func() {
+				if err := desktop.Write(s3LockDir+"/sync.lock", []byte("desktop 42\n"), WriteOptions{}); err != nil {
+					t.Error(err)
+				}
+				close(refreshed)
+			}}
+		}
+		unlock, err := laptop.Lock("sync", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-refreshed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the lock was not refreshed", test.name)
+		}
+		if _, err := desktop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+			t.Errorf("%s: desktop Lock = %v, want ErrLocked", test.name, err)
+		}
+
+		err = unlock()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unlock = %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: unlock = %v, want %q", test.name, err, test.wantErr)
+		}
+		data, err := laptop.Read(s3LockDir + "/sync.lock")
+		if test.wantLock == "" && !errors.Is(err, ErrNotExist) {
+			t.Errorf("%s: lock after unlock = %q, %v, want ErrNotExist", test.name, data, err)
+		}
+		if test.wantLock != "" && string(data) != test.wantLock {
+			t.Errorf("%s: lock after unlock = %q, %v, want the other computer's lock", test.name, data, err)
+		}
+	}
+}
+
+func TestS3UnlockKeepsLockTakenOverByOthers(t *testing.T) {
+	connect, _ := newTestS3(t, "")
+	laptop := connect()
+	unlock, err := laptop.Lock("sync", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another computer took the lock over while this one was stuck
+	if err := connect().Write(s3LockDir+"/sync.lock", []byte("desktop 42\n"), WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := laptop.Read(s3LockDir + "/sync.lock"); err != nil || string(data) != "desktop 42\n" {
+		t.Errorf("lock after unlock = %q, %v, want the other computer's lock", data, err)
+	}
+}
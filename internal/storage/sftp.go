@@ -0,0 +1,708 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpLockDir is the directory below the remote path holding lock files
+const sftpLockDir = ".syncstation-locks"
+
+// sftpPosixRename is the OpenSSH extension replacing files atomically on rename
+const sftpPosixRename = "posix-rename@openssh.com"
+
+// sftpDialTimeout is how long connecting to the server may take
+const sftpDialTimeout = 30 * time.Second
+
+// sftpLockRefresh is how often held locks are touched, so that they never become stale
+var sftpLockRefresh = staleLockAge / 3
+
+// defaultSSHKeys are the private keys tried when no key file is configured
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// SFTPConfig configures an SFTP storage on a server reachable with SSH
+type SFTPConfig struct {
+	Host           string `json:"host"`           // host[:port], port 22 when omitted
+	User           string `json:"user"`           // remote user, the local user when empty
+	Path           string `json:"path"`           // remote directory, relative to the remote home unless absolute
+	KeyFile        string `json:"keyFile"`        // private key, the SSH agent and ~/.ssh/id_* keys when empty
+	KnownHostsFile string `json:"knownHostsFile"` // known hosts verifying the server, ~/.ssh/known_hosts when empty
+}
+
+// SFTP is a storage keeping the cloud copy in a directory of an SSH server. It connects on
+// first use, and keeps the connection for the life of the process.
+type SFTP struct {
+	cfg    SFTPConfig
+	addr   string
+	root   string
+	dial   func() (*sftp.Client, error)
+	mu     sync.Mutex // guards client and err, as the engine connects from several goroutines
+	client *sftp.Client
+	err    error
+}
+
+// NewSFTP returns a storage for the remote directory configured by cfg
+func NewSFTP(cfg SFTPConfig) (*SFTP, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("sftp storage needs a host")
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	if cfg.User == "" {
+		if current, err := user.Current(); err == nil {
+			cfg.User = current.Username
+		}
+	}
+
+	// The SFTP server resolves relative paths from the home directory
+	root := strings.TrimPrefix(cfg.Path, "~/")
+	if root == "" || root == "~" {
+		root = "."
+	}
+	s := &SFTP{cfg: cfg, addr: addr, root: path.Clean(root)}
+	s.dial = s.dialSSH
+	return s, nil
+}
+
+// expandHome replaces a leading ~ with the local home directory
+func expandHome(name string) string {
+	if name != "~" && !strings.HasPrefix(name, "~/") {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, strings.TrimPrefix(name, "~"))
+}
+
+// connect returns the SFTP session, connecting on first use. A failed connection is not
+// retried, so that one sync reports it once per operation instead of waiting each time.
+func (s *SFTP) connect() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil || s.err != nil {
+		return s.client, s.err
+	}
+	s.client, s.err = s.dial()
+	if s.err != nil {
+		s.err = fmt.Errorf("failed to connect to %s: %w", s.addr, s.err)
+	}
+	return s.client, s.err
+}
+
+// dialSSH opens the SSH connection and starts the sftp subsystem
+func (s *SFTP) dialSSH() (*sftp.Client, error) {
+	knownHostsFile := s.cfg.KnownHostsFile
+	if knownHostsFile == "" {
+		knownHostsFile = "~/.ssh/known_hosts"
+	}
+	hostKeyCallback, err := knownhosts.New(expandHome(knownHostsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	auth, err := s.authMethods()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ssh.Dial("tcp", s.addr, &ssh.ClientConfig{
+		User:              s.cfg.User,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: knownHostKeyAlgorithms(hostKeyCallback, s.addr),
+		Timeout:           sftpDialTimeout,
+	})
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("%w (connect once with ssh to add the server to known hosts)", err)
+		}
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start sftp: %w", err)
+	}
+	return client, nil
+}
+
+// authMethods returns the configured key, or the SSH agent and the default keys
+func (s *SFTP) authMethods() ([]ssh.AuthMethod, error) {
+	if s.cfg.KeyFile != "" {
+		signer, err := loadSSHKey(expandHome(s.cfg.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var signers []ssh.Signer
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+	for _, name := range defaultSSHKeys {
+		// Keys protected by a passphrase are only usable through the agent
+		if signer, err := loadSSHKey(expandHome("~/.ssh/" + name)); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no ssh key found, set keyFile or start an ssh agent")
+	}
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
+}
+
+// loadSSHKey reads an unencrypted private key
+func loadSSHKey(name string) (ssh.Signer, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var passphraseErr *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseErr) {
+		return nil, fmt.Errorf("ssh key %s is protected by a passphrase, add it to the ssh agent instead", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh key %s: %w", name, err)
+	}
+	return signer, nil
+}
+
+// knownHostKeyAlgorithms returns the algorithms of the keys known for addr, so that the
+// server presents a key that can be verified. It is nil for unknown hosts.
+func knownHostKeyAlgorithms(callback ssh.HostKeyCallback, addr string) []string {
+	// Checking a key that is never known reports the known ones
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	placeholder, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if err := callback(addr, &net.TCPAddr{IP: net.IPv4zero}, placeholder); !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		if known.Key.Type() == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, known.Key.Type())
+	}
+	return algorithms
+}
+
+// remote returns the remote path of key
+func (s *SFTP) remote(key string) string {
+	return path.Join(s.root, key)
+}
+
+// fileInfo returns the storage information of a remote entry
+func (s *SFTP) fileInfo(client *sftp.Client, key string, stat os.FileInfo) (FileInfo, error) {
+	info := FileInfo{
+		Key:     path.Clean(key),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		Mode:    stat.Mode().Perm(),
+		IsDir:   stat.IsDir(),
+	}
+	if stat.Mode()&os.ModeSymlink != 0 {
+		target, err := client.ReadLink(s.remote(key))
+		if err != nil {
+			return FileInfo{}, err
+		}
+		info.Link = target
+	}
+	return info, nil
+}
+
+// wrapErr adds the location of key to SFTP errors
+func (s *SFTP) wrapErr(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", s.Location(key), err)
+}
+
+// mkdirAll creates the remote directory at name and its missing parents
+func (s *SFTP) mkdirAll(client *sftp.Client, name string, perm os.FileMode) error {
+	if stat, err := client.Lstat(name); err == nil {
+		if !stat.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", name)
+		}
+		return nil
+	}
+	if parent := path.Dir(name); parent != name {
+		if err := s.mkdirAll(client, parent, 0755); err != nil {
+			return err
+		}
+	}
+	if err := client.Mkdir(name); err != nil {
+		// Someone else may have created it in between
+		if stat, statErr := client.Lstat(name); statErr == nil && stat.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return client.Chmod(name, perm)
+}
+
+// removeAll removes the remote file or tree at name. Missing files are not an error.
+func (s *SFTP) removeAll(client *sftp.Client, name string) error {
+	stat, err := client.Lstat(name)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return client.Remove(name)
+	}
+
+	entries, err := client.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.removeAll(client, path.Join(name, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return client.RemoveDirectory(name)
+}
+
+// readFile returns the content of the remote file at name
+func (s *SFTP) readFile(client *sftp.Client, name string) ([]byte, error) {
+	file, err := client.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// createFile creates the remote file at name with data, failing if it exists. The mode is
+// set before writing, so that private files are never readable by others.
+func (s *SFTP) createFile(client *sftp.Client, name string, data []byte, perm os.FileMode) error {
+	file, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	err = file.Chmod(perm)
+	if err == nil {
+		_, err = file.Write(data)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// canReplace reports whether renames replace existing files
+func (s *SFTP) canReplace(client *sftp.Client) bool {
+	_, ok := client.HasExtension(sftpPosixRename)
+	return ok
+}
+
+// rename moves from to to, replacing to atomically when the server supports it
+func (s *SFTP) rename(client *sftp.Client, from, to string) error {
+	if s.canReplace(client) {
+		return client.PosixRename(from, to)
+	}
+	return client.Rename(from, to)
+}
+
+// Stat implements Storage
+func (s *SFTP) Stat(key string) (FileInfo, error) {
+	client, err := s.connect()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	stat, err := client.Lstat(s.remote(key))
+	if err != nil {
+		return FileInfo{}, s.wrapErr(key, err)
+	}
+	info, err := s.fileInfo(client, key, stat)
+	return info, s.wrapErr(key, err)
+}
+
+// Read implements Storage
+func (s *SFTP) Read(key string) ([]byte, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.readFile(client, s.remote(key))
+	return data, s.wrapErr(key, err)
+}
+
+// Write implements Storage by writing a temporary file next to key and renaming it
+func (s *SFTP) Write(key string, data []byte, opts WriteOptions) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	name := s.remote(key)
+	if err := s.mkdirAll(client, path.Dir(name), 0755); err != nil {
+		return s.wrapErr(key, err)
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".syncstation-"+hex.EncodeToString(suffix))
+
+	mode := opts.Mode.Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	err = s.createFile(client, tmp, data, mode)
+	if err == nil && !opts.ModTime.IsZero() {
+		err = client.Chtimes(tmp, opts.ModTime, opts.ModTime)
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return s.wrapErr(key, err)
+	}
+
+	// Without posix-rename, the standard rename refuses to replace files
+	if !s.canReplace(client) {
+		if existing, err := client.Lstat(name); err == nil && !existing.IsDir() {
+			client.Remove(name)
+		}
+	}
+	if err := s.rename(client, tmp, name); err != nil {
+		client.Remove(tmp)
+		return s.wrapErr(key, err)
+	}
+	return nil
+}
+
+// List implements Storage
+func (s *SFTP) List(key string) ([]FileInfo, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	stat, err := client.Lstat(s.remote(key))
+	if errors.Is(err, ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.wrapErr(key, err)
+	}
+	if !stat.IsDir() {
+		info, err := s.fileInfo(client, key, stat)
+		if err != nil {
+			return nil, s.wrapErr(key, err)
+		}
+		return []FileInfo{info}, nil
+	}
+
+	var entries []FileInfo
+	pending := []string{path.Clean(key)}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		children, err := client.ReadDir(s.remote(dir))
+		if err != nil {
+			return nil, s.wrapErr(dir, err)
+		}
+		for _, child := range children {
+			childKey := Join(dir, child.Name())
+			if childKey == sftpLockDir {
+				continue
+			}
+			// Directory entries aren't followed, so link loops can't recurse
+			mode := child.Mode()
+			if !mode.IsDir() && !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+				continue
+			}
+			info, err := s.fileInfo(client, childKey, child)
+			if err != nil {
+				return nil, s.wrapErr(childKey, err)
+			}
+			entries = append(entries, info)
+			if info.IsDir {
+				pending = append(pending, childKey)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Delete implements Storage
+func (s *SFTP) Delete(key string) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	return s.wrapErr(key, s.removeAll(client, s.remote(key)))
+}
+
+// Rename implements Storage. It is atomic for files when the server supports the
+// posix-rename extension, as OpenSSH does.
+func (s *SFTP) Rename(from, to string) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	src, dst := s.remote(from), s.remote(to)
+	if err := s.mkdirAll(client, path.Dir(dst), 0755); err != nil {
+		return s.wrapErr(to, err)
+	}
+	if existing, err := client.Lstat(dst); err == nil && (existing.IsDir() || !s.canReplace(client)) {
+		if err := s.removeAll(client, dst); err != nil {
+			return s.wrapErr(to, err)
+		}
+	}
+	return s.wrapErr(from, s.rename(client, src, dst))
+}
+
+// MakeDir implements DirMaker
+func (s *SFTP) MakeDir(key string, opts WriteOptions) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	name := s.remote(key)
+	if stat, err := client.Lstat(name); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+		if err := client.Remove(name); err != nil {
+			return s.wrapErr(key, err)
+		}
+	}
+
+	mode := opts.Mode.Perm()
+	if mode == 0 {
+		mode = 0755
+	}
+	if err := s.mkdirAll(client, name, mode); err != nil {
+		return s.wrapErr(key, err)
+	}
+	// Existing directories keep their mode otherwise
+	if err := client.Chmod(name, mode); err != nil {
+		return s.wrapErr(key, err)
+	}
+	if !opts.ModTime.IsZero() {
+		return s.wrapErr(key, client.Chtimes(name, opts.ModTime, opts.ModTime))
+	}
+	return nil
+}
+
+// Symlink implements Linker
+func (s *SFTP) Symlink(key, target string) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	name := s.remote(key)
+	if stat, err := client.Lstat(name); err == nil {
+		if stat.IsDir() {
+			return fmt.Errorf("refusing to replace directory %s with a symlink", s.Location(key))
+		}
+		if existing, err := client.ReadLink(name); err == nil && existing == target {
+			return nil
+		}
+		if err := client.Remove(name); err != nil {
+			return s.wrapErr(key, err)
+		}
+	}
+
+	if err := s.mkdirAll(client, path.Dir(name), 0755); err != nil {
+		return s.wrapErr(key, err)
+	}
+	return s.wrapErr(key, client.Symlink(target, name))
+}
+
+// Lock implements Storage with a lock file created exclusively on the server. The lock file
+// is touched while the lock is held, so that only locks of crashed processes become stale.
+func (s *SFTP) Lock(name string, timeout time.Duration) (func() error, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	lockDir := s.remote(sftpLockDir)
+	if err := s.mkdirAll(client, lockDir, 0755); err != nil {
+		return nil, s.wrapErr(sftpLockDir, err)
+	}
+	lock := path.Join(lockDir, name+".lock")
+
+	deadline := time.Now().Add(timeout)
+	for {
+		owner, err := s.lockOwner()
+		if err != nil {
+			return nil, err
+		}
+		createErr := s.createFile(client, lock, owner, 0600)
+		if createErr == nil {
+			return s.holdLock(client, lock, owner), nil
+		}
+
+		// Creating fails alike for existing files and other errors
+		if _, err := client.Lstat(lock); errors.Is(err, ErrNotExist) {
+			if time.Now().After(deadline) {
+				return nil, s.wrapErr(sftpLockDir, createErr)
+			}
+			// Released in between
+			continue
+		} else if err != nil {
+			return nil, s.wrapErr(sftpLockDir, err)
+		}
+
+		// Take over locks left behind by crashed processes
+		if removed, err := s.removeStale(client, lock); err != nil {
+			return nil, s.wrapErr(sftpLockDir, err)
+		} else if removed {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s is held by another computer (remove %s if it is stale)", ErrLocked, name, s.Location(path.Join(sftpLockDir, name+".lock")))
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// lockOwner returns the content of a new lock file, unique to each lock taken
+func (s *SFTP) lockOwner() ([]byte, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	return []byte(fmt.Sprintf("%s %d %s %s\n", hostname, os.Getpid(), time.Now().Format(time.RFC3339), hex.EncodeToString(nonce))), nil
+}
+
+// removeStale removes the file at name if it is older than staleLockAge, and reports
+// whether it did. SFTP has no conditional remove, so the file is only removed by the
+// computer exclusively creating the takeover file of its content: two computers finding the
+// same stale lock can't both remove it, and so can't remove the lock the other one took next.
+// Takeover files left by crashed computers become stale and are removed the same way.
+func (s *SFTP) removeStale(client *sftp.Client, name string) (bool, error) {
+	stale, data, err := s.staleContent(client, name)
+	if err != nil || stale == nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(data)
+	takeover := name + ".takeover-" + hex.EncodeToString(sum[:8])
+	owner, err := s.lockOwner()
+	if err != nil {
+		return false, err
+	}
+	if err := s.createFile(client, takeover, owner, 0600); err != nil {
+		// Another computer is taking the lock over, or crashed doing so
+		_, err := s.removeStale(client, takeover)
+		return false, err
+	}
+	defer client.Remove(takeover)
+
+	// The lock can't have been replaced unless it was removed in between
+	current, currentData, err := s.staleContent(client, name)
+	if err != nil || current == nil || !bytes.Equal(currentData, data) {
+		return false, err
+	}
+	if err := s.removeAll(client, name); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// staleContent returns the information and content of the file at name when it is older
+// than staleLockAge, and nil information otherwise. Lock directories of older versions have
+// no content.
+func (s *SFTP) staleContent(client *sftp.Client, name string) (os.FileInfo, []byte, error) {
+	stat, err := client.Lstat(name)
+	if errors.Is(err, ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil || time.Since(stat.ModTime()) <= staleLockAge {
+		return nil, nil, err
+	}
+	if stat.IsDir() {
+		return stat, nil, nil
+	}
+	data, err := s.readFile(client, name)
+	if errors.Is(err, ErrNotExist) {
+		return nil, nil, nil
+	}
+	return stat, data, err
+}
+
+// holdLock touches the lock file at name holding owner until the returned function removes
+// it. A lock taken over meanwhile, after the computer slept for instance, is left alone.
+func (s *SFTP) holdLock(client *sftp.Client, name string, owner []byte) func() error {
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(sftpLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				client.Chtimes(name, now, now)
+			}
+		}
+	}()
+
+	return func() error {
+		close(stop)
+		<-done
+		data, err := s.readFile(client, name)
+		if errors.Is(err, ErrNotExist) || (err == nil && !bytes.Equal(data, owner)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := client.Remove(name); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+}
+
+// Location implements Storage
+func (s *SFTP) Location(key string) string {
+	return fmt.Sprintf("sftp://%s@%s/%s", s.cfg.User, s.cfg.Host, strings.TrimPrefix(s.remote(key), "./"))
+}
@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// raceReader runs race, once, before passing on the first request containing trigger, as
+// if another computer had acted in between
+type raceReader struct {
+	io.Reader
+	trigger []byte
+	race    func()
+	once    sync.Once
+}
+
+func (r *raceReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if r.race != nil && bytes.Contains(p[:n], r.trigger) {
+		r.once.Do(r.race)
+	}
+	return n, err
+}
+
+// testSFTP serves a local directory with in-process SFTP servers
+type testSFTP struct {
+	t     *testing.T
+	dir   string
+	dials atomic.Int32
+}
+
+// newTestSFTP returns a server of a temporary directory, the cloud copy being kept in its
+// "cloud" subdirectory
+func newTestSFTP(t *testing.T) *testSFTP {
+	return &testSFTP{t: t, dir: t.TempDir()}
+}
+
+// pipe starts a server and returns a client talking to it. The server reads requests
+// through wrap, if not nil.
+func (ts *testSFTP) pipe(wrap func(io.Reader) io.Reader) (*sftp.Client, error) {
+	ts.dials.Add(1)
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	var requests io.Reader = serverIn
+	if wrap != nil {
+		requests = wrap(serverIn)
+	}
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{requests, serverOut}, sftp.WithServerWorkingDirectory(ts.dir))
+	if err != nil {
+		return nil, err
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientIn, clientOut)
+	if err != nil {
+		return nil, err
+	}
+	ts.t.Cleanup(func() {
+		clientOut.Close()
+		serverOut.Close()
+		client.Close()
+		server.Close()
+	})
+	return client, nil
+}
+
+// connect returns a storage connecting, as a separate computer would, on first use
+func (ts *testSFTP) connect(wrap func(io.Reader) io.Reader) *SFTP {
+	s, err := NewSFTP(SFTPConfig{Host: "cloud.example.com", User: "me", Path: "~/cloud"})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	s.dial = func() (*sftp.Client, error) { return ts.pipe(wrap) }
+	return s
+}
+
+// path returns the local path of key in the served directory
+func (ts *testSFTP) path(key string) string {
+	return filepath.Join(ts.dir, "cloud", filepath.FromSlash(key))
+}
+
+func TestNewSFTP(t *testing.T) {
+	tests := []struct {
+		cfg        SFTPConfig
+		addr, root string
+	}{
+		{SFTPConfig{Host: "nas", User: "me", Path: "~/cloud"}, "nas:22", "cloud"},
+		{SFTPConfig{Host: "nas:2222", User: "me", Path: "/srv/cloud/"}, "nas:2222", "/srv/cloud"},
+		{SFTPConfig{Host: "nas", User: "me"}, "nas:22", "."},
+		{SFTPConfig{Host: "nas", User: "me", Path: "~"}, "nas:22", "."},
+	}
+	for _, test := range tests {
+		s, err := NewSFTP(test.cfg)
+		if err != nil {
+			t.Errorf("NewSFTP(%+v) = %v", test.cfg, err)
+			continue
+		}
+		if s.addr != test.addr || s.root != test.root {
+			t.Errorf("NewSFTP(%+v) connects to %s in %s, want %s in %s", test.cfg, s.addr, s.root, test.addr, test.root)
+		}
+	}
+	if _, err := NewSFTP(SFTPConfig{Path: "~/cloud"}); err == nil {
+		t.Error("a storage without host was created")
+	}
+}
+
+func TestSFTPReadWrite(t *testing.T) {
+	server := newTestSFTP(t)
+	s := server.connect(nil)
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := s.Write("configs/Shell/.zshrc", []byte("export EDITOR=nvim\n"), WriteOptions{Mode: 0600, ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := s.Read("configs/Shell/.zshrc")
+	if err != nil || string(data) != "export EDITOR=nvim\n" {
+		t.Fatalf("Read = %q, %v", data, err)
+	}
+	info, err := s.Stat("configs/Shell/.zshrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "configs/Shell/.zshrc" || info.Mode != 0600 || !info.ModTime.Equal(modTime) || info.IsDir {
+		t.Errorf("Stat = %+v", info)
+	}
+	if stat, err := os.Stat(server.path("configs/Shell/.zshrc")); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("file on the server = %v, %v, want mode 0600", stat, err)
+	}
+
+	// Replacing keeps no temporary file behind
+	if err := s.Write("configs/Shell/.zshrc", []byte("export EDITOR=vim\n"), WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(server.path("configs/Shell")); err != nil || len(entries) != 1 {
+		t.Errorf("files on the server = %v, %v", entries, err)
+	}
+	if _, err := s.Read("configs/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Read of missing key = %v, want ErrNotExist", err)
+	}
+}
+
+func TestSFTPListRenameDelete(t *testing.T) {
+	s := newTestSFTP(t).connect(nil)
+	for _, key := range []string{"configs/Nvim/init.lua", "configs/Nvim/lua/plugins.lua", "configs/Shell/.zshrc"} {
+		if err := s.Write(key, []byte(key), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.MakeDir("configs/Nvim/after", WriteOptions{Mode: 0700}); err != nil {
+		t.Fatal(err)
+	}
+	// The test server resolves relative targets from its working directory, OpenSSH doesn't
+	if err := s.Symlink("configs/Nvim/current", "/home/me/.config/nvim/init.lua"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.List("configs/Nvim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+		switch entry.Key {
+		case "configs/Nvim/after":
+			if !entry.IsDir || entry.Mode != 0700 {
+				t.Errorf("directory = %+v", entry)
+			}
+		case "configs/Nvim/current":
+			if entry.Link != "/home/me/.config/nvim/init.lua" {
+				t.Errorf("symlink = %+v", entry)
+			}
+		}
+	}
+	want := "configs/Nvim/after configs/Nvim/current configs/Nvim/init.lua configs/Nvim/lua configs/Nvim/lua/plugins.lua"
+	if strings.Join(keys, " ") != want {
+		t.Errorf("List = %v, want %s", keys, want)
+	}
+
+	if err := s.Rename("configs/Nvim", "configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := s.Read("configs/Neovim/lua/plugins.lua"); err != nil || string(data) != "configs/Nvim/lua/plugins.lua" {
+		t.Errorf("renamed file = %q, %v", data, err)
+	}
+	if err := s.Delete("configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("configs/Neovim"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat after delete = %v, want ErrNotExist", err)
+	}
+}
+
+func TestSFTPConnectsOnce(t *testing.T) {
+	server := newTestSFTP(t)
+	s := server.connect(nil)
+
+	// The engine uses the storage from several goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.List("configs"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if dials := server.dials.Load(); dials != 1 {
+		t.Errorf("connected %d times, want 1", dials)
+	}
+}
+
+func TestSFTPLockExcludesOtherComputers(t *testing.T) {
+	server := newTestSFTP(t)
+	laptop, desktop := server.connect(nil), server.connect(nil)
+
+	unlock, err := laptop.Lock("sync", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := desktop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock = %v, want ErrLocked", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err = desktop.Lock("sync", 0)
+	if err != nil {
+		t.Fatalf("Lock after unlock = %v", err)
+	}
+	unlock()
+}
+
+// writeStaleLock leaves the lock file of a crashed computer at key
+func writeStaleLock(t *testing.T, server *testSFTP, key string) {
+	t.Helper()
+	name := server.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("crashed 1 "+key+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSFTPStaleLockIsTakenOverOnce(t *testing.T) {
+	server := newTestSFTP(t)
+	writeStaleLock(t, server, sftpLockDir+"/sync.lock")
+
+	// The laptop takes the stale lock over after the desktop found it stale
+	laptop := server.connect(nil)
+	var laptopUnlock func() error
+	desktop := server.connect(func(requests io.Reader) io.Reader {
+		return &raceReader{Reader: requests, trigger: []byte("sync.lock.takeover-"), race: func() {
+			var err error
+			if laptopUnlock, err = laptop.Lock("sync", 0); err != nil {
+				t.Errorf("laptop Lock = %v", err)
+			}
+		}}
+	})
+	if _, err := desktop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("desktop Lock = %v, want ErrLocked as the laptop took the lock over", err)
+	}
+	if laptopUnlock == nil {
+		t.Fatal("the laptop didn't take the stale lock over")
+	}
+
+	if err := laptopUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(server.path(sftpLockDir))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("lock files after unlock = %v, %v", entries, err)
+	}
+}
+
+func TestSFTPCrashedTakeoverIsTakenOver(t *testing.T) {
+	server := newTestSFTP(t)
+	writeStaleLock(t, server, sftpLockDir+"/sync.lock")
+	data, err := os.ReadFile(server.path(sftpLockDir + "/sync.lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another computer crashed while taking the stale lock over
+	sum := sha256.Sum256(data)
+	writeStaleLock(t, server, sftpLockDir+"/sync.lock.takeover-"+hex.EncodeToString(sum[:8]))
+
+	laptop := server.connect(nil)
+	unlock, err := laptop.Lock("sync", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Lock = %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(server.path(sftpLockDir))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("lock files after unlock = %v, %v", entries, err)
+	}
+}
+
+func TestSFTPUnlockKeepsLockTakenOverByOthers(t *testing.T) {
+	server := newTestSFTP(t)
+	laptop := server.connect(nil)
+	unlock, err := laptop.Lock("sync", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another computer took the lock over while this one was asleep
+	if err := os.WriteFile(server.path(sftpLockDir+"/sync.lock"), []byte("desktop 42\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(server.path(sftpLockDir + "/sync.lock")); err != nil || string(data) != "desktop 42\n" {
+		t.Errorf("lock after unlock = %q, %v, want the other computer's lock", data, err)
+	}
+}
+
+func TestSFTPHeldLockIsRefreshed(t *testing.T) {
+	refresh := sftpLockRefresh
+	sftpLockRefresh = 10 * time.Millisecond
+	t.Cleanup(func() { sftpLockRefresh = refresh })
+
+	server := newTestSFTP(t)
+	laptop, desktop := server.connect(nil), server.connect(nil)
+	unlock, err := laptop.Lock("sync", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	// A long sync keeps its lock from becoming stale
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(server.path(sftpLockDir+"/sync.lock"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := desktop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Lock of a held lock = %v, want ErrLocked", err)
+	}
+}
+
+func TestSFTPStaleLockDirectoryIsTakenOver(t *testing.T) {
+	server := newTestSFTP(t)
+
+	// Older versions locked with a directory
+	lock := server.path(sftpLockDir + "/sync.lock")
+	if err := os.MkdirAll(lock, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lock, "owner"), []byte("crashed 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := server.connect(nil).Lock("sync", 0)
+	if err != nil {
+		t.Fatalf("Lock = %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned, wrapped, when a key does not exist
+var ErrNotExist = fs.ErrNotExist
+
+// ErrLocked is returned when a lock is still held by someone else after the lock timeout
+var ErrLocked = errors.New("storage is locked")
+
+// ErrConflict is returned, wrapped, when a conditional write finds the file changed
+var ErrConflict = errors.New("file was changed by someone else")
+
+// Backend types
+const (
+	TypeLocal  = "local"  // the cloud sync directory on this computer
+	TypeS3     = "s3"     // an S3-compatible bucket, such as AWS S3 or MinIO
+	TypeWebDAV = "webdav" // a WebDAV collection, such as Nextcloud
+	TypeSFTP   = "sftp"   // a directory on an SSH server
+)
+
+// Config selects and configures the storage backend holding the cloud copy
+type Config struct {
+	Type   string       `json:"type"`   // "local" (default), "s3", "webdav" or "sftp"
+	S3     S3Config     `json:"s3"`     // settings of the "s3" backend
+	WebDAV WebDAVConfig `json:"webdav"` // settings of the "webdav" backend
+	SFTP   SFTPConfig   `json:"sftp"`   // settings of the "sftp" backend
+}
+
+// FileInfo describes a file, directory or symlink in a storage
+type FileInfo struct {
+	Key     string      // slash-separated path relative to the storage root
+	Size    int64       // size in bytes of files
+	ModTime time.Time   // modification time
+	Mode    os.FileMode // permission bits, where the backend keeps them
+	IsDir   bool        // true for directories
+	Link    string      // target of symlinks, empty for other entries
+	ETag    string      // version of the content, where the backend has one
+}
+
+// IsLink reports whether the entry is a symlink
+func (fi FileInfo) IsLink() bool {
+	return fi.Link != ""
+}
+
+// WriteOptions are the attributes given to a written file. Zero values use backend defaults.
+type WriteOptions struct {
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// Storage holds the cloud copy of the sync items. Keys are slash-separated paths relative to
+// the storage root, such as "configs/Neovim-Config/init.lua". Implementations must be safe
+// to use from one goroutine at a time.
+type Storage interface {
+	// Stat returns information about the entry at key, without following symlinks.
+	// Missing keys return an error wrapping ErrNotExist.
+	Stat(key string) (FileInfo, error)
+
+	// Read returns the content of the file at key
+	Read(key string) ([]byte, error)
+
+	// Write atomically replaces the file at key with data, creating parent directories.
+	// A symlink at key is replaced, never written through.
+	Write(key string, data []byte, opts WriteOptions) error
+
+	// List returns every file, directory and symlink below key, sorted by key, without
+	// following symlinks. A missing key lists nothing.
+	List(key string) ([]FileInfo, error)
+
+	// Delete removes the file or tree at key. Missing keys are not an error.
+	Delete(key string) error
+
+	// Rename atomically moves the file or tree at from to to, replacing to
+	Rename(from, to string) error
+
+	// Lock takes the exclusive lock called name, waiting up to timeout, and returns the
+	// function releasing it. It returns an error wrapping ErrLocked on timeout.
+	Lock(name string, timeout time.Duration) (func() error, error)
+
+	// Location describes key for messages, e.g. as a local path or URL
+	Location(key string) string
+}
+
+// Linker is implemented by storages that can store symlinks
+type Linker interface {
+	// Symlink creates a symlink to target at key, replacing any file at key
+	Symlink(key, target string) error
+}
+
+// DirMaker is implemented by storages that keep directories as entries of their own
+type DirMaker interface {
+	// MakeDir creates the directory at key, or updates its attributes, replacing any
+	// symlink at key
+	MakeDir(key string, opts WriteOptions) error
+}
+
+// Wrapper is implemented by storages layered over another one
+type Wrapper interface {
+	// Unwrap returns the storage underneath
+	Unwrap() Storage
+}
+
+// Versioned is implemented by storages supporting conditional writes, which let computers
+// update a shared file concurrently without a lock
+type Versioned interface {
+	// ReadVersion returns the content of the file at key and its ETag
+	ReadVersion(key string) ([]byte, string, error)
+
+	// WriteIfMatch replaces the file at key with data only if its ETag still is etag, or
+	// creates it only if it doesn't exist when etag is empty. It returns an error wrapping
+	// ErrConflict otherwise.
+	WriteIfMatch(key string, data []byte, etag string, opts WriteOptions) error
+}
+
+// Open returns the storage configured by cfg. root is the cloud sync directory.
+func Open(cfg Config, root string) (Storage, error) {
+	switch cfg.Type {
+	case "", TypeLocal:
+		return NewLocal(root), nil
+	case TypeS3:
+		return NewS3(cfg.S3)
+	case TypeWebDAV:
+		return NewWebDAV(cfg.WebDAV)
+	case TypeSFTP:
+		return NewSFTP(cfg.SFTP)
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", cfg.Type)
+	}
+}
+
+// Exists reports whether key exists in a storage
+func Exists(st Storage, key string) bool {
+	_, err := st.Stat(key)
+	return err == nil
+}
+
+// LocalPath returns the path of key on this computer, for storages keeping their files here
+func LocalPath(st Storage, key string) (string, bool) {
+	for {
+		wrapper, ok := st.(Wrapper)
+		if !ok {
+			break
+		}
+		st = wrapper.Unwrap()
+	}
+	local, ok := st.(*Local)
+	if !ok {
+		return "", false
+	}
+	return local.Path(key), true
+}
+
+// LinkTarget returns the target of the symlink entry below the tree at root, and whether
+// the target stays inside the tree. Absolute targets are never inside.
+func LinkTarget(root string, entry FileInfo) (string, bool) {
+	if path.IsAbs(entry.Link) {
+		return entry.Link, false
+	}
+	_, inside := Rel(root, path.Join(path.Dir(entry.Key), entry.Link))
+	return entry.Link, inside
+}
+
+// Join joins key elements with slashes
+func Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Rel returns key relative to base, or false if key is not below base
+func Rel(base, key string) (string, bool) {
+	base, key = path.Clean(base), path.Clean(key)
+	if key == base {
+		return ".", true
+	}
+	if base == "." {
+		return key, !strings.HasPrefix(key, "../")
+	}
+	if !strings.HasPrefix(key, base+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(key, base+"/"), true
+}
+
+// Unavailable is a storage whose operations all fail, used when the configured backend
+// can't be opened so that the error surfaces where the storage is used
+type Unavailable struct {
+	Err error
+}
+
+// Stat implements Storage
+func (u Unavailable) Stat(key string) (FileInfo, error) { return FileInfo{}, u.Err }
+
+// Read implements Storage
+func (u Unavailable) Read(key string) ([]byte, error) { return nil, u.Err }
+
+// Write implements Storage
+func (u Unavailable) Write(key string, data []byte, opts WriteOptions) error { return u.Err }
+
+// List implements Storage
+func (u Unavailable) List(key string) ([]FileInfo, error) { return nil, u.Err }
+
+// Delete implements Storage
+func (u Unavailable) Delete(key string) error { return u.Err }
+
+// Rename implements Storage
+func (u Unavailable) Rename(from, to string) error { return u.Err }
+
+// Lock implements Storage
+func (u Unavailable) Lock(name string, timeout time.Duration) (func() error, error) {
+	return nil, u.Err
+}
+
+// Location implements Storage
+func (u Unavailable) Location(key string) string { return key }
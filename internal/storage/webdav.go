@@ -0,0 +1,710 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWebDAVChunkSizeMB is the size of chunked upload parts when the configuration
+// doesn't set one
+const defaultWebDAVChunkSizeMB = 10
+
+// webDAVPasswordEnv is the environment variable holding the password when the
+// configuration doesn't
+const webDAVPasswordEnv = "SYNCSTATION_WEBDAV_PASSWORD"
+
+// webDAVLockDir is the collection below the root holding lock resources
+const webDAVLockDir = ".syncstation-locks"
+
+// webDAVRequestTimeout is how long a request may take, body included, so that a server that
+// stops answering fails the sync instead of hanging it
+var webDAVRequestTimeout = 5 * time.Minute
+
+// webDAVLockTimeout is how long the server keeps a lock that isn't refreshed, so that locks
+// of crashed processes expire. Held locks are refreshed three times per timeout.
+var webDAVLockTimeout = staleLockAge
+
+// errNoProperties is returned, wrapped, when the server refuses to store custom properties
+var errNoProperties = errors.New("server doesn't store custom properties")
+
+// webDAVNamespace is the XML namespace of the properties keeping file attributes
+const webDAVNamespace = "https://github.com/AntoineArt/syncstation"
+
+// WebDAVConfig configures a WebDAV storage such as Nextcloud or ownCloud
+type WebDAVConfig struct {
+	URL         string `json:"url"`         // collection holding the cloud copy
+	Username    string `json:"username"`    // user name for basic authentication
+	Password    string `json:"password"`    // password or app token, taken from SYNCSTATION_WEBDAV_PASSWORD when empty
+	UploadsURL  string `json:"uploadsURL"`  // Nextcloud chunked upload collection, large files use single PUTs when empty
+	ChunkSizeMB int    `json:"chunkSizeMB"` // chunked upload part size, 10 when 0
+}
+
+// WebDAV is a storage keeping the cloud copy on a WebDAV server. Permissions, modification
+// times and symlink targets are kept in custom properties, symlinks being empty files.
+type WebDAV struct {
+	client    *http.Client
+	base      *url.URL
+	username  string
+	password  string
+	uploads   string
+	chunkSize int
+}
+
+// NewWebDAV returns a storage for the WebDAV collection configured by cfg
+func NewWebDAV(cfg WebDAVConfig) (*WebDAV, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webdav storage needs a url")
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.URL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav url: %w", err)
+	}
+	password := cfg.Password
+	if password == "" {
+		password = os.Getenv(webDAVPasswordEnv)
+	}
+	chunkSizeMB := cfg.ChunkSizeMB
+	if chunkSizeMB == 0 {
+		chunkSizeMB = defaultWebDAVChunkSizeMB
+	}
+
+	return &WebDAV{
+		// Redirects are followed by do, since the client would turn them into GETs
+		client: &http.Client{
+			Timeout: webDAVRequestTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		base:      base,
+		username:  cfg.Username,
+		password:  password,
+		uploads:   strings.TrimSuffix(cfg.UploadsURL, "/"),
+		chunkSize: chunkSizeMB << 20,
+	}, nil
+}
+
+// davMultistatus is the body of PROPFIND and PROPPATCH responses
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+// davResponse describes one resource of a multistatus
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+// davPropstat holds the properties of a resource sharing a status
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+// davProp holds the properties requested by PROPFIND
+type davProp struct {
+	ContentLength string    `xml:"DAV: getcontentlength"`
+	LastModified  string    `xml:"DAV: getlastmodified"`
+	ETag          string    `xml:"DAV: getetag"`
+	Collection    *struct{} `xml:"DAV: resourcetype>collection"`
+	Mode          string    `xml:"https://github.com/AntoineArt/syncstation mode"`
+	ModTime       string    `xml:"https://github.com/AntoineArt/syncstation mtime"`
+	Link          string    `xml:"https://github.com/AntoineArt/syncstation link"`
+}
+
+// propfindBody requests the properties read into davProp
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:S="` + webDAVNamespace + `"><D:prop>
+<D:getcontentlength/><D:getlastmodified/><D:getetag/><D:resourcetype/><S:mode/><S:mtime/><S:link/>
+</D:prop></D:propfind>`
+
+// url returns the URL of key, with a trailing slash for collections
+func (w *WebDAV) url(key string, collection bool) string {
+	name := path.Clean("/" + key)
+	if collection && name != "/" {
+		name += "/"
+	}
+	ref := &url.URL{Path: strings.TrimPrefix(name, "/")}
+	return w.base.ResolveReference(ref).String()
+}
+
+// key returns the storage key of a href found in a response
+func (w *WebDAV) key(href string) (string, bool) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	base, name := path.Clean(w.base.Path), path.Clean("/"+ref.Path)
+	if base == "/" {
+		return Rel(".", strings.TrimPrefix(name, "/"))
+	}
+	return Rel(base, name)
+}
+
+// do sends a request for key and returns the response, whose body the caller closes.
+// Servers such as Apache and Nextcloud redirect requests for a collection without a
+// trailing slash, so the request is sent again to the collection.
+func (w *WebDAV) do(method, target string, body []byte, header http.Header) (*http.Response, error) {
+	resp, err := w.send(method, target, body, header)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		location, err := resp.Location()
+		if err != nil || location.Path != resp.Request.URL.Path+"/" {
+			return resp, nil
+		}
+		resp.Body.Close()
+		return w.send(method, location.String(), body, header)
+	}
+	return resp, nil
+}
+
+// send sends a single request and returns the response, whose body the caller closes
+func (w *WebDAV) send(method, target string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	return w.client.Do(req)
+}
+
+// statusErr returns the storage error for a failed response about key
+func (w *WebDAV) statusErr(key string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%s: %w", w.Location(key), ErrNotExist)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%s: %w", w.Location(key), ErrConflict)
+	case http.StatusLocked:
+		return fmt.Errorf("%s: %w", w.Location(key), ErrLocked)
+	}
+	return fmt.Errorf("%s: %s %s", w.Location(key), resp.Request.Method, resp.Status)
+}
+
+// propfind returns the resources at key, and its members when depth is "1"
+func (w *WebDAV) propfind(key string, collection bool, depth string) ([]FileInfo, error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := w.do("PROPFIND", w.url(key, collection), []byte(propfindBody), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, w.statusErr(key, resp)
+	}
+
+	var status davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("%s: invalid PROPFIND response: %w", w.Location(key), err)
+	}
+
+	infos := make([]FileInfo, 0, len(status.Responses))
+	for _, response := range status.Responses {
+		entryKey, ok := w.key(response.Href)
+		if !ok {
+			continue
+		}
+		info := FileInfo{Key: entryKey}
+		for _, propstat := range response.Propstats {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			prop := propstat.Prop
+			if prop.Collection != nil {
+				info.IsDir = true
+			}
+			if size, err := strconv.ParseInt(prop.ContentLength, 10, 64); err == nil {
+				info.Size = size
+			}
+			if modTime, err := http.ParseTime(prop.LastModified); err == nil && info.ModTime.IsZero() {
+				info.ModTime = modTime
+			}
+			if prop.ETag != "" {
+				info.ETag = prop.ETag
+			}
+			if mode, err := strconv.ParseUint(prop.Mode, 8, 32); err == nil {
+				info.Mode = os.FileMode(mode).Perm()
+			}
+			if modTime, err := time.Parse(time.RFC3339Nano, prop.ModTime); err == nil {
+				info.ModTime = modTime
+			}
+			if prop.Link != "" {
+				info.Link = prop.Link
+				info.Size = int64(len(prop.Link))
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// proppatch sets the attributes in opts and the link target on the resource at key, and
+// removes the link target when link is empty
+func (w *WebDAV) proppatch(key string, collection bool, opts WriteOptions, link string) error {
+	var set, remove bytes.Buffer
+	if opts.Mode != 0 {
+		fmt.Fprintf(&set, "<S:mode>%s</S:mode>", strconv.FormatUint(uint64(opts.Mode.Perm()), 8))
+	}
+	if !opts.ModTime.IsZero() {
+		fmt.Fprintf(&set, "<S:mtime>%s</S:mtime>", opts.ModTime.UTC().Format(time.RFC3339Nano))
+	}
+	if link != "" {
+		set.WriteString("<S:link>")
+		xml.EscapeText(&set, []byte(link))
+		set.WriteString("</S:link>")
+	} else {
+		remove.WriteString("<S:link/>")
+	}
+
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:propertyupdate xmlns:D="DAV:" xmlns:S="` + webDAVNamespace + `">`)
+	if set.Len() > 0 {
+		fmt.Fprintf(&body, "<D:set><D:prop>%s</D:prop></D:set>", set.String())
+	}
+	if remove.Len() > 0 {
+		fmt.Fprintf(&body, "<D:remove><D:prop>%s</D:prop></D:remove>", remove.String())
+	}
+	body.WriteString("</D:propertyupdate>")
+
+	header := http.Header{"Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := w.do("PROPPATCH", w.url(key, collection), body.Bytes(), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return w.statusErr(key, resp)
+	}
+
+	// Servers answer with the status of every property; removing a missing property is fine
+	var status davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&status); err == nil {
+		for _, response := range status.Responses {
+			for _, propstat := range response.Propstats {
+				failed := !strings.Contains(propstat.Status, " 200 ") && !strings.Contains(propstat.Status, " 404 ")
+				if failed {
+					return fmt.Errorf("%s: %w (%s)", w.Location(key), errNoProperties, propstat.Status)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mkcolAll creates the collection at key and its missing parents below the configured URL,
+// which is created too but whose own parent must exist
+func (w *WebDAV) mkcolAll(key string) error {
+	key = path.Clean(key)
+	root := key == "." || key == "/"
+
+	resp, err := w.do("MKCOL", w.url(key, true), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusMethodNotAllowed:
+		// 405 means the collection exists
+		return nil
+	case http.StatusConflict:
+		if root {
+			break
+		}
+		if err := w.mkcolAll(path.Dir(key)); err != nil {
+			return err
+		}
+		return w.mkcolAll(key)
+	}
+	return w.statusErr(key, resp)
+}
+
+// put uploads data to key, creating missing parent collections
+func (w *WebDAV) put(key string, data []byte, header http.Header) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := w.do(http.MethodPut, w.url(key, false), data, header)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusConflict && attempt == 0 {
+			if err := w.mkcolAll(path.Dir(key)); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			return w.statusErr(key, resp)
+		}
+		return nil
+	}
+}
+
+// putChunked uploads data to key in parts through the Nextcloud chunked upload collection
+func (w *WebDAV) putChunked(key string, data []byte, header http.Header) error {
+	if err := w.mkcolAll(path.Dir(key)); err != nil {
+		return err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	transfer := w.uploads + "/syncstation-" + hex.EncodeToString(id)
+	destination := w.url(key, false)
+	chunkHeader := http.Header{"Destination": {destination}}
+
+	cleanup := func() {
+		if resp, err := w.do(http.MethodDelete, transfer, nil, nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+	check := func(resp *http.Response, err error) error {
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			cleanup()
+			return fmt.Errorf("%s: chunked upload failed: %s %s", w.Location(key), resp.Request.Method, resp.Status)
+		}
+		return nil
+	}
+
+	if err := check(w.do("MKCOL", transfer, nil, chunkHeader)); err != nil {
+		return err
+	}
+	for i, offset := 1, 0; offset < len(data); i, offset = i+1, offset+w.chunkSize {
+		end := min(offset+w.chunkSize, len(data))
+		chunk := fmt.Sprintf("%s/%05d", transfer, i)
+		if err := check(w.do(http.MethodPut, chunk, data[offset:end], chunkHeader)); err != nil {
+			return err
+		}
+	}
+
+	moveHeader := header.Clone()
+	moveHeader.Set("Destination", destination)
+	moveHeader.Set("Overwrite", "T")
+	moveHeader.Set("OC-Total-Length", strconv.Itoa(len(data)))
+	return check(w.do("MOVE", transfer+"/.file", nil, moveHeader))
+}
+
+// write uploads data to key with the extra request headers and sets the attributes in opts
+func (w *WebDAV) write(key string, data []byte, opts WriteOptions, header http.Header) error {
+	if !opts.ModTime.IsZero() {
+		// Nextcloud sets the modification time of the file from this header
+		header.Set("X-OC-Mtime", strconv.FormatInt(opts.ModTime.Unix(), 10))
+	}
+
+	var err error
+	if w.uploads != "" && len(data) > w.chunkSize && header.Get("If-Match") == "" && header.Get("If-None-Match") == "" {
+		err = w.putChunked(key, data, header)
+	} else {
+		err = w.put(key, data, header)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Attributes are kept where the server allows it
+	if err := w.proppatch(key, false, opts, ""); err != nil && !errors.Is(err, errNoProperties) {
+		return err
+	}
+	return nil
+}
+
+// Stat implements Storage
+func (w *WebDAV) Stat(key string) (FileInfo, error) {
+	infos, err := w.propfind(key, false, "0")
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if len(infos) == 0 {
+		return FileInfo{}, fmt.Errorf("%s: %w", w.Location(key), ErrNotExist)
+	}
+	return infos[0], nil
+}
+
+// Read implements Storage
+func (w *WebDAV) Read(key string) ([]byte, error) {
+	data, _, err := w.ReadVersion(key)
+	return data, err
+}
+
+// ReadVersion implements Versioned
+func (w *WebDAV) ReadVersion(key string) ([]byte, string, error) {
+	resp, err := w.do(http.MethodGet, w.url(key, false), nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", w.statusErr(key, resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// Write implements Storage. Files larger than the chunk size are uploaded in parts when an
+// uploads collection is configured.
+func (w *WebDAV) Write(key string, data []byte, opts WriteOptions) error {
+	return w.write(key, data, opts, http.Header{})
+}
+
+// WriteIfMatch implements Versioned with If-Match and If-None-Match preconditions
+func (w *WebDAV) WriteIfMatch(key string, data []byte, etag string, opts WriteOptions) error {
+	header := http.Header{}
+	if etag == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", etag)
+	}
+	return w.write(key, data, opts, header)
+}
+
+// List implements Storage, walking collections one level at a time since servers such as
+// Nextcloud refuse infinite depth
+func (w *WebDAV) List(key string) ([]FileInfo, error) {
+	var entries []FileInfo
+	pending := []string{key}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		infos, err := w.propfind(dir, true, "1")
+		if errors.Is(err, ErrNotExist) && dir == key {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if rel, _ := Rel(dir, info.Key); rel == "." || info.Key == webDAVLockDir || strings.HasPrefix(info.Key, webDAVLockDir+"/") {
+				continue
+			}
+			entries = append(entries, info)
+			if info.IsDir {
+				pending = append(pending, info.Key)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Delete implements Storage
+func (w *WebDAV) Delete(key string) error {
+	resp, err := w.do(http.MethodDelete, w.url(key, false), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return w.statusErr(key, resp)
+	}
+	return nil
+}
+
+// Rename implements Storage with MOVE
+func (w *WebDAV) Rename(from, to string) error {
+	info, err := w.Stat(from)
+	if err != nil {
+		return err
+	}
+	// Servers answer a missing parent with 403 or 409, so it is created first
+	if err := w.mkcolAll(path.Dir(to)); err != nil {
+		return err
+	}
+
+	header := http.Header{"Destination": {w.url(to, info.IsDir)}, "Overwrite": {"T"}}
+	resp, err := w.do("MOVE", w.url(from, info.IsDir), nil, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return w.statusErr(from, resp)
+	}
+	return nil
+}
+
+// MakeDir implements DirMaker
+func (w *WebDAV) MakeDir(key string, opts WriteOptions) error {
+	// Replace a link or file left at key
+	if info, err := w.Stat(key); err == nil && !info.IsDir {
+		if err := w.Delete(key); err != nil {
+			return err
+		}
+	}
+	if err := w.mkcolAll(key); err != nil {
+		return err
+	}
+	if opts.Mode == 0 && opts.ModTime.IsZero() {
+		return nil
+	}
+	if err := w.proppatch(key, true, opts, ""); err != nil && !errors.Is(err, errNoProperties) {
+		return err
+	}
+	return nil
+}
+
+// Symlink implements Linker with an empty file whose properties hold the target
+func (w *WebDAV) Symlink(key, target string) error {
+	if info, err := w.Stat(key); err == nil && info.IsDir {
+		if err := w.Delete(key); err != nil {
+			return err
+		}
+	}
+	if err := w.put(key, nil, http.Header{}); err != nil {
+		return err
+	}
+	if err := w.proppatch(key, false, WriteOptions{Mode: 0777}, target); err != nil {
+		w.Delete(key)
+		return err
+	}
+	return nil
+}
+
+// Lock implements Storage with a WebDAV LOCK on a lock resource. The lock is refreshed until
+// it is released, and the server releases locks of crashed processes once their timeout
+// expires.
+func (w *WebDAV) Lock(name string, timeout time.Duration) (func() error, error) {
+	key := Join(webDAVLockDir, name+".lock")
+	hostname, _ := os.Hostname()
+
+	var owner bytes.Buffer
+	xml.EscapeText(&owner, []byte(fmt.Sprintf("%s %d %s", hostname, os.Getpid(), time.Now().Format(time.RFC3339))))
+	body := []byte(`<?xml version="1.0" encoding="utf-8"?><D:lockinfo xmlns:D="DAV:">` +
+		`<D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype>` +
+		`<D:owner>` + owner.String() + `</D:owner></D:lockinfo>`)
+	header := http.Header{
+		"Content-Type": {"application/xml; charset=utf-8"},
+		"Depth":        {"0"},
+		"Timeout":      {webDAVTimeout()},
+	}
+
+	// Servers don't agree on the error for a missing parent, so it is created first
+	if err := w.mkcolAll(webDAVLockDir); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := w.do("LOCK", w.url(key, false), body, header)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+			return w.refreshLock(key, resp.Header.Get("Lock-Token")), nil
+		case resp.StatusCode != http.StatusLocked:
+			return nil, w.statusErr(key, resp)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s is held by another computer (it expires after %s)", ErrLocked, name, webDAVLockTimeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// webDAVTimeout returns the Timeout header value of locks
+func webDAVTimeout() string {
+	return fmt.Sprintf("Second-%d", int(webDAVLockTimeout.Seconds()))
+}
+
+// refreshLock refreshes the lock on key with token until the returned function releases
+// it. The release fails when a refresh did, as the lock may have been lost meanwhile.
+func (w *WebDAV) refreshLock(key, token string) func() error {
+	stop, done := make(chan struct{}), make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(webDAVLockTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			case <-ticker.C:
+			}
+
+			header := http.Header{"If": {"(" + token + ")"}, "Timeout": {webDAVTimeout()}}
+			resp, err := w.do("LOCK", w.url(key, false), nil, header)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode >= 300 {
+					err = w.statusErr(key, resp)
+				}
+			}
+			if err != nil {
+				done <- fmt.Errorf("failed to refresh lock %s: %w", w.Location(key), err)
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		close(stop)
+		refreshErr := <-done
+		if err := w.unlock(key, token); err != nil {
+			return err
+		}
+		return refreshErr
+	}
+}
+
+// unlock deletes the lock resource at key while holding the lock, then releases the lock.
+// Servers dropping locks with their resource answer the UNLOCK with an error, which is fine.
+func (w *WebDAV) unlock(key, token string) error {
+	resp, err := w.do(http.MethodDelete, w.url(key, false), nil, http.Header{"If": {"(" + token + ")"}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = w.do("UNLOCK", w.url(key, false), nil, http.Header{"Lock-Token": {token}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed:
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		return w.statusErr(key, resp)
+	}
+	return nil
+}
+
+// Location implements Storage
+func (w *WebDAV) Location(key string) string {
+	return w.url(key, false)
+}
@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// preconditions makes a WebDAV handler enforce the If-Match and If-None-Match headers of
+// PUT requests, which the x/net/webdav handler ignores
+func preconditions(handler http.Handler) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if r.Method != http.MethodPut || (ifMatch == "" && ifNoneMatch == "") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		head := httptest.NewRecorder()
+		handler.ServeHTTP(head, httptest.NewRequest(http.MethodHead, r.URL.Path, nil))
+		exists := head.Code == http.StatusOK
+		if (ifNoneMatch == "*" && exists) || (ifMatch != "" && (!exists || ifMatch != head.Header().Get("ETag"))) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// testWebDAV is an in-process WebDAV server redirecting requests for collections without a
+// trailing slash, as Apache and Nextcloud do
+type testWebDAV struct {
+	mu        sync.Mutex
+	redirects []string // methods of the redirected requests
+	gets      []string // paths of the GET requests
+}
+
+// newTestWebDAV returns a function connecting new clients, as separate computers would, to
+// an in-process WebDAV server
+func newTestWebDAV(t *testing.T) (func() *WebDAV, *testWebDAV) {
+	t.Helper()
+	fs := webdav.NewMemFS()
+	handler := &webdav.Handler{Prefix: "/dav", FileSystem: fs, LockSystem: webdav.NewMemLS()}
+	dav := preconditions(handler)
+	server := &testWebDAV{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/dav")
+		info, err := fs.Stat(context.Background(), name)
+		server.mu.Lock()
+		if r.Method == http.MethodGet {
+			server.gets = append(server.gets, r.URL.Path)
+		}
+		redirect := err == nil && info.IsDir() && !strings.HasSuffix(r.URL.Path, "/")
+		if redirect {
+			server.redirects = append(server.redirects, r.Method)
+		}
+		server.mu.Unlock()
+		if redirect {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+
+	return func() *WebDAV {
+		w, err := NewWebDAV(WebDAVConfig{URL: httpServer.URL + "/dav"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}, server
+}
+
+func TestWebDAVReadWrite(t *testing.T) {
+	connect, _ := newTestWebDAV(t)
+	w := connect()
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := w.Write("configs/Shell/.zshrc", []byte("export EDITOR=nvim\n"), WriteOptions{Mode: 0600, ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := w.Read("configs/Shell/.zshrc")
+	if err != nil || string(data) != "export EDITOR=nvim\n" {
+		t.Fatalf("Read = %q, %v", data, err)
+	}
+	info, err := w.Stat("configs/Shell/.zshrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "configs/Shell/.zshrc" || info.Mode != 0600 || !info.ModTime.Equal(modTime) || info.IsDir {
+		t.Errorf("Stat = %+v", info)
+	}
+	if _, err := w.Read("configs/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Read of missing key = %v, want ErrNotExist", err)
+	}
+}
+
+func TestWebDAVListRenameDelete(t *testing.T) {
+	connect, _ := newTestWebDAV(t)
+	w := connect()
+	for _, key := range []string{"configs/Nvim/init.lua", "configs/Nvim/lua/plugins.lua", "configs/Shell/.zshrc"} {
+		if err := w.Write(key, []byte(key), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.MakeDir("configs/Nvim/after", WriteOptions{Mode: 0700}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Symlink("configs/Nvim/current", "init.lua"); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := w.Stat("configs/Nvim"); err != nil || !info.IsDir {
+		t.Errorf("Stat of collection = %+v, %v", info, err)
+	}
+	entries, err := w.List("configs/Nvim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+		switch entry.Key {
+		case "configs/Nvim/after":
+			if !entry.IsDir || entry.Mode != 0700 {
+				t.Errorf("directory = %+v", entry)
+			}
+		case "configs/Nvim/current":
+			if entry.Link != "init.lua" {
+				t.Errorf("symlink = %+v", entry)
+			}
+		}
+	}
+	want := "configs/Nvim/after configs/Nvim/current configs/Nvim/init.lua configs/Nvim/lua configs/Nvim/lua/plugins.lua"
+	if strings.Join(keys, " ") != want {
+		t.Errorf("List = %v, want %s", keys, want)
+	}
+
+	if err := w.Rename("configs/Nvim", "configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := w.Read("configs/Neovim/lua/plugins.lua"); err != nil || string(data) != "configs/Nvim/lua/plugins.lua" {
+		t.Errorf("renamed file = %q, %v", data, err)
+	}
+	if err := w.Delete("configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Stat("configs/Neovim"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat after delete = %v, want ErrNotExist", err)
+	}
+}
+
+func TestWebDAVCollectionsBehindRedirects(t *testing.T) {
+	connect, server := newTestWebDAV(t)
+	w := connect()
+	for _, key := range []string{"configs/Nvim/init.lua", "configs/Nvim/lua/plugins.lua", "configs/Shell/.zshrc"} {
+		if err := w.Write(key, []byte(key), WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.MakeDir("configs/Nvim/after", WriteOptions{Mode: 0700}); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := w.Stat("configs/Nvim"); err != nil || !info.IsDir {
+		t.Errorf("Stat of collection = %+v, %v", info, err)
+	}
+	entries, err := w.List("configs/Nvim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	want := "configs/Nvim/after configs/Nvim/init.lua configs/Nvim/lua configs/Nvim/lua/plugins.lua"
+	if strings.Join(keys, " ") != want {
+		t.Errorf("List = %v, want %s", keys, want)
+	}
+
+	if err := w.Rename("configs/Nvim", "configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := w.Read("configs/Neovim/lua/plugins.lua"); err != nil || string(data) != "configs/Nvim/lua/plugins.lua" {
+		t.Errorf("renamed file = %q, %v", data, err)
+	}
+	if err := w.Delete("configs/Neovim"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Stat("configs/Neovim"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat after delete = %v, want ErrNotExist", err)
+	}
+
+	// Redirected requests must be sent again with their method, not as GETs
+	if len(server.redirects) == 0 {
+		t.Error("no request was redirected, the test server doesn't redirect collections")
+	}
+	for _, get := range server.gets {
+		if !strings.HasSuffix(get, ".lua") {
+			t.Errorf("unexpected GET %s", get)
+		}
+	}
+}
+
+func TestWebDAVWriteIfMatch(t *testing.T) {
+	connect, _ := newTestWebDAV(t)
+	w := connect()
+	if err := w.WriteIfMatch("file-metadata.json", []byte("v1"), "", WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteIfMatch("file-metadata.json", []byte("v1 again"), "", WriteOptions{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("create-only write of existing key = %v, want ErrConflict", err)
+	}
+
+	_, etag, err := w.ReadVersion("file-metadata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("file-metadata.json", []byte("v2 from another computer"), WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteIfMatch("file-metadata.json", []byte("v2"), etag, WriteOptions{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("write with stale etag = %v, want ErrConflict", err)
+	}
+
+	_, etag, _ = w.ReadVersion("file-metadata.json")
+	if err := w.WriteIfMatch("file-metadata.json", []byte("v3"), etag, WriteOptions{}); err != nil {
+		t.Errorf("write with current etag = %v", err)
+	}
+}
+
+func TestWebDAVLockExcludesOtherComputers(t *testing.T) {
+	connect, _ := newTestWebDAV(t)
+	laptop, desktop := connect(), connect()
+
+	unlock, err := laptop.Lock("sync", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := desktop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock = %v, want ErrLocked", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err = desktop.Lock("sync", 0)
+	if err != nil {
+		t.Fatalf("Lock after unlock = %v", err)
+	}
+	unlock()
+}
+
+func TestWebDAVLockIsRefreshed(t *testing.T) {
+	timeout := webDAVLockTimeout
+	webDAVLockTimeout = time.Second
+	t.Cleanup(func() { webDAVLockTimeout = timeout })
+
+	connect, _ := newTestWebDAV(t)
+	laptop, desktop := connect(), connect()
+	unlock, err := laptop.Lock("sync", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A long sync keeps the lock past its timeout
+	time.Sleep(3 * webDAVLockTimeout)
+	if _, err := desktop.Lock("sync", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Lock after the timeout of a held lock = %v, want ErrLocked", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err = desktop.Lock("sync", 0)
+	if err != nil {
+		t.Fatalf("Lock after unlock = %v", err)
+	}
+	unlock()
+}
+
+func TestWebDAVRequestsTimeOut(t *testing.T) {
+	timeout := webDAVRequestTimeout
+	webDAVRequestTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { webDAVRequestTimeout = timeout })
+
+	// A server that accepts connections but never answers
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(httpServer.Close)
+	w, err := NewWebDAV(WebDAVConfig{URL: httpServer.URL + "/dav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Read("sync-items.json")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Read from a server that never answers succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read from a server that never answers didn't time out")
+	}
+}
+
+func TestWebDAVPasswordFromEnvironment(t *testing.T) {
+	t.Setenv(webDAVPasswordEnv, "app-token")
+	w, err := NewWebDAV(WebDAVConfig{URL: "https://cloud.example.com/remote.php/dav/files/me", Username: "me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.password != "app-token" {
+		t.Errorf("password = %q, want the one from %s", w.password, webDAVPasswordEnv)
+	}
+	w, err = NewWebDAV(WebDAVConfig{URL: "https://cloud.example.com/dav", Password: "configured"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.password != "configured" {
+		t.Errorf("password = %q, want the configured one", w.password)
+	}
+	if _, err := NewWebDAV(WebDAVConfig{}); err == nil {
+		t.Error("a storage without url was created")
+	}
+}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sensitivePatterns are file names holding keys or credentials that must only be readable by their owner
+var sensitivePatterns = []string{"id_*", "*.pem", "*.key", "*.p12", "*.pfx", ".netrc", ".pgpass", ".git-credentials", "credentials"}
+
+// sensitiveDirs are directories whose content must only be readable by their owner
+var sensitiveDirs = []string{".ssh", ".gnupg"}
+
+// isSensitivePath reports whether a file or directory holds keys or credentials
+func isSensitivePath(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasSuffix(name, ".pub") {
+		return false
+	}
+
+	for _, pattern := range sensitivePatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		for _, dir := range sensitiveDirs {
+			if part == dir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// privateMode returns mode without group and other permissions when path is sensitive,
+// since cloud providers often drop permission bits
+func privateMode(path string, mode os.FileMode) os.FileMode {
+	if isSensitivePath(path) {
+		return mode &^ 0077
+	}
+	return mode
+}
+
+// restoreAttributes applies the permission bits recorded when a file was pushed, and its
+// owner when this computer opted in: the metadata is shared, so any computer could name
+// the user a file is given to
+func (s *SyncEngine) restoreAttributes(path string, mode os.FileMode, owner string) error {
+	if err := os.Chmod(path, privateMode(path, mode)); err != nil {
+		return err
+	}
+	if owner == "" || !s.localConfig.RestoreOwners {
+		return nil
+	}
+	return restoreOwner(path, owner)
+}
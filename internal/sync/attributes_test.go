@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+func TestIsSensitivePath(t *testing.T) {
+	tests := map[string]bool{
+		"/home/me/.ssh/config":         true,
+		"/home/me/.ssh/id_ed25519":     true,
+		"/home/me/.ssh/id_ed25519.pub": false,
+		"/home/me/.gnupg/pubring.kbx":  true,
+		"/home/me/keys/server.pem":     true,
+		"/home/me/keys/server.key":     true,
+		"/home/me/.netrc":              true,
+		"/home/me/.aws/credentials":    true,
+		"/home/me/.git-credentials":    true,
+		"/home/me/.config/nvim/init":   false,
+		"/home/me/notes/ssh.md":        false,
+		"/home/me/keyboard.conf":       false,
+	}
+	for path, want := range tests {
+		if got := isSensitivePath(path); got != want {
+			t.Errorf("isSensitivePath(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	if got := privateMode("/home/me/.ssh/id_rsa", 0644); got != 0600 {
+		t.Errorf("private mode of a key = %o, want 600", got)
+	}
+	if got := privateMode("/home/me/.zshrc", 0755); got != 0755 {
+		t.Errorf("private mode of a script = %o, want it unchanged", got)
+	}
+}
+
+// fileMode returns the permission bits of path
+func fileMode(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestModesAndTimesAreKeptAcrossPushAndPull(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not kept on Windows")
+	}
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{
+		"bin/run.sh":       "#!/bin/sh",
+		"private/notes":    "private",
+		"config":           "set number",
+		".ssh/id_ed25519":  "key",
+		".ssh/known_hosts": "hosts",
+	})
+	modes := map[string]os.FileMode{"bin/run.sh": 0755, "private/notes": 0640, "config": 0644, ".ssh/id_ed25519": 0600, ".ssh/known_hosts": 0644}
+	for rel, mode := range modes {
+		if err := os.Chmod(filepath.Join(local, filepath.FromSlash(rel)), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(local, "private"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(local, "config"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Home", Type: "folder", Paths: map[string]string{testComputer: local}})
+	if _, err := engine.SyncItem(SyncPush, item); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cloud providers often drop permission bits, so pulls restore those recorded on push
+	cloud := item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+	for rel := range modes {
+		if err := os.Chmod(filepath.Join(cloud, filepath.FromSlash(rel)), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pulled := t.TempDir()
+	item.Paths[testComputer] = pulled
+	if _, err := engine.SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	modes[".ssh/known_hosts"] = 0600 // files below .ssh are kept private
+	for rel, want := range modes {
+		if got := fileMode(t, filepath.Join(pulled, filepath.FromSlash(rel))); got != want {
+			t.Errorf("pulled %s has mode %o, want %o", rel, got, want)
+		}
+	}
+	if got := fileMode(t, filepath.Join(pulled, "private")); got != 0700 {
+		t.Errorf("pulled directory has mode %o, want 700", got)
+	}
+	info, err := os.Stat(filepath.Join(pulled, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("pulled config was modified at %v, want %v", info.ModTime(), modTime)
+	}
+}
+
+func TestFileItemModesAreRestored(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not kept on Windows")
+	}
+	engine := newTestEngine(t, nil)
+	local := filepath.Join(t.TempDir(), "deploy.sh")
+	writeFiles(t, filepath.Dir(local), map[string]string{"deploy.sh": "#!/bin/sh"})
+	if err := os.Chmod(local, 0750); err != nil {
+		t.Fatal(err)
+	}
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Deploy", Type: "file", Paths: map[string]string{testComputer: local}})
+	if _, err := engine.SyncItem(SyncPush, item); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(item.GetCloudPath(engine.localConfig.GetCloudConfigsPath()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// File items are recorded by their path on each computer, so another path gets the latest mode
+	pulled := filepath.Join(t.TempDir(), "deploy.sh")
+	item.Paths[testComputer] = pulled
+	if _, err := engine.SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileMode(t, pulled); got != 0750 {
+		t.Errorf("pulled file has mode %o, want 750", got)
+	}
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// SetResolveConflictCopies sets whether pushes and pulls delete the provider conflict copies
+// of the items they sync, keeping the version they sync, instead of reporting them
+func (s *SyncEngine) SetResolveConflictCopies(resolve bool) {
+	s.resolveConflictCopies = resolve
+}
+
+// conflictCopies returns the provider conflict copies of the cloud files of an item. The
+// configs directory is listed once per engine, as an engine makes a single sync.
+func (s *SyncEngine) conflictCopies(item *config.SyncItem) ([]config.ConflictCopy, error) {
+	if s.conflictCopyFinder == nil {
+		syncItems, err := config.LoadSyncItemsData(s.localConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sync items: %w", err)
+		}
+		s.conflictCopyFinder = syncItems.NewConflictCopyFinder()
+	}
+	copies, err := s.conflictCopyFinder.Find(s.storage, item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for conflict copies: %w", err)
+	}
+	return copies, nil
+}
+
+// pullExclusions returns the function telling which slash-separated paths inside a folder
+// item a pull leaves out: those matching its exclude patterns, and its conflict copies
+func (s *SyncEngine) pullExclusions(item *config.SyncItem) (func(rel string, isDir bool) bool, error) {
+	if item.Type == "file" {
+		return nil, nil
+	}
+	copies, err := s.conflictCopies(item)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]bool, len(copies))
+	for _, conflict := range copies {
+		if rel, ok := storage.Rel(item.CloudKey(), conflict.Key); ok {
+			paths[rel] = true
+		}
+	}
+	return func(rel string, isDir bool) bool {
+		return paths[rel] || item.IsExcluded(rel, isDir)
+	}, nil
+}
+
+// conflictCopyOriginal returns the local path of the file a conflict copy of an item is a copy of
+func conflictCopyOriginal(item *config.SyncItem, localPath string, conflict config.ConflictCopy) string {
+	rel, ok := storage.Rel(item.CloudKey(), conflict.Original)
+	if !ok || rel == "." {
+		return localPath
+	}
+	return filepath.Join(localPath, filepath.FromSlash(rel))
+}
+
+// recordConflictCopies reports the conflict copies of an item as conflicts of their original
+func (s *SyncEngine) recordConflictCopies(result *SyncResult, item *config.SyncItem, localPath string, copies []config.ConflictCopy) {
+	for _, conflict := range copies {
+		original := conflictCopyOriginal(item, localPath, conflict)
+		location := s.storage.Location(conflict.Key)
+		result.Errors = append(result.Errors, fmt.Sprintf("%s conflict copy of %s: %s - merge the changes you want to keep, then delete it",
+			conflict.Provider, original, location))
+		s.recordOutcome(result, item.Name, original, "conflict", fmt.Sprintf("%s conflict copy %s", conflict.Provider, location))
+	}
+}
+
+// deleteConflictCopies resolves the conflicts of an item with its provider conflict copies
+// by deleting them, keeping the version that was just synced
+func (s *SyncEngine) deleteConflictCopies(result *SyncResult, item *config.SyncItem, localPath string, copies []config.ConflictCopy) {
+	for _, conflict := range copies {
+		original := conflictCopyOriginal(item, localPath, conflict)
+		location := s.storage.Location(conflict.Key)
+		if err := s.storage.Delete(conflict.Key); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to delete conflict copy %s: %v", location, err))
+			continue
+		}
+
+		// Coordinate git staging for the deleted copy
+		if s.gitCallback != nil {
+			if err := s.gitCallback(s.localConfig, location, "sync_add"); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("git staging warning: %v", err))
+			}
+		}
+		s.recordOutcome(result, item.Name, original, "resolved", fmt.Sprintf("deleted %s conflict copy %s", conflict.Provider, location))
+	}
+}
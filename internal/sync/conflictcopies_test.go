@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+func TestConflictCopiesAreReportedUnlessResolved(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	item := addTestItem(t, engine, &config.SyncItem{
+		Name:  "Shell",
+		Type:  "file",
+		Paths: map[string]string{testComputer: filepath.Join(local, ".zshrc")},
+	})
+	writeFiles(t, local, map[string]string{".zshrc": "export EDITOR=nvim\n"})
+	cloudStorage := engine.localConfig.CloudStorage()
+	copyKey := item.CloudKey() + " (Alice's conflicted copy 2026-01-02)"
+	if err := cloudStorage.Write(copyKey, []byte("export EDITOR=vim\n"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	original := []string{filepath.Join(local, ".zshrc")}
+
+	// Smart syncs can't pick a version and leave the item alone
+	result, err := engine.SyncItem(SyncSmart, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outcomeActions(result.Files)["conflict"]; !reflect.DeepEqual(got, original) {
+		t.Errorf("smart sync conflicts = %v, want %v", got, original)
+	}
+	if storage.Exists(cloudStorage, item.CloudKey()) {
+		t.Error("a smart sync with conflict copies pushed the item")
+	}
+
+	// Pushes report the copies and keep them
+	result, err = engine.SyncItem(SyncPush, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outcomeActions(result.Files)["conflict"]; !reflect.DeepEqual(got, original) {
+		t.Errorf("push conflicts = %v, want %v", got, original)
+	}
+	if !storage.Exists(cloudStorage, copyKey) {
+		t.Fatal("a push deleted the conflict copy without resolving")
+	}
+
+	// Resolving pushes delete them
+	engine = newTestEngine(t, engine.localConfig)
+	engine.SetResolveConflictCopies(true)
+	result, err = engine.SyncItem(SyncPush, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outcomeActions(result.Files)["resolved"]; !reflect.DeepEqual(got, original) {
+		t.Errorf("resolving push outcomes = %v, want %v", got, original)
+	}
+	if storage.Exists(cloudStorage, copyKey) {
+		t.Error("the conflict copy is left after resolving")
+	}
+}
+
+func TestConflictCopiesAndExcludedFilesInFoldersAreNotPulled(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	item := addTestItem(t, engine, &config.SyncItem{
+		Name:            "Nvim",
+		Type:            "folder",
+		Paths:           map[string]string{testComputer: local},
+		ExcludePatterns: []string{"*.log"},
+	})
+	cloudPath := item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+	writeFiles(t, cloudPath, map[string]string{
+		"init.lua": "vim.o.number = true",
+		"init.sync-conflict-20260102-101010-ABCDEFG.lua": "vim.o.number = false",
+		"debug.log": "noise",
+	})
+
+	engine.SetResolveConflictCopies(true)
+	if _, err := engine.SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	if !config.PathExists(filepath.Join(local, "init.lua")) {
+		t.Error("init.lua was not pulled")
+	}
+	if config.PathExists(filepath.Join(local, "init.sync-conflict-20260102-101010-ABCDEFG.lua")) {
+		t.Error("the conflict copy was pulled")
+	}
+	if config.PathExists(filepath.Join(local, "debug.log")) {
+		t.Error("excluded debug.log was pulled")
+	}
+}
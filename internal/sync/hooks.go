@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+// Hook names, matching the fields of config.Hooks
+const (
+	HookPrePush  = "prePush"
+	HookPostPush = "postPush"
+	HookPrePull  = "prePull"
+	HookPostPull = "postPull"
+)
+
+// DefaultHookTimeout is used when the local configuration sets no hook timeout
+const DefaultHookTimeout = 30 * time.Second
+
+// maxHookOutput caps the captured output of a hook
+const maxHookOutput = 64 * 1024
+
+// HookRun describes a hook command run during a sync
+type HookRun struct {
+	ItemName string
+	Hook     string // "prePush", "postPush", "prePull" or "postPull"
+	Command  string
+	Output   string // Combined stdout and stderr
+	Duration time.Duration
+	Err      error
+}
+
+// hookCommand is a command run for a hook
+type hookCommand struct {
+	command string
+	shared  bool // set in the shared sync items rather than on this computer
+}
+
+// runHooks runs the global and item commands of a hook for an item. Global pre-hooks run
+// before the item's and global post-hooks after it. Post-hooks only run when files changed.
+// Item hooks come from the shared sync items, so they are skipped with a warning until they
+// are approved on this computer. It stops at and returns the error of the first failing command.
+func (s *SyncEngine) runHooks(result *SyncResult, item *config.SyncItem, hook, localPath, cloudKey string) error {
+	cloudPath := s.storage.Location(cloudKey)
+	commands := []hookCommand{
+		{command: s.localConfig.Hooks.Command(hook)},
+		{command: item.Hooks.Command(hook), shared: true},
+	}
+	var changed []string
+	if strings.HasPrefix(hook, "post") {
+		commands[0], commands[1] = commands[1], commands[0]
+		changed = changedFiles(result, localPath, cloudPath)
+		if len(changed) == 0 {
+			return nil
+		}
+	}
+
+	for _, hookCommand := range commands {
+		command := hookCommand.command
+		if command == "" {
+			continue
+		}
+		if hookCommand.shared && !s.localConfig.IsTrusted(command) {
+			result.Errors = append(result.Errors, fmt.Sprintf("warning: skipped %s hook of %s, not approved on this computer: %s (run 'syncstation trust \"%s\"')",
+				hook, item.Name, command, item.Name))
+			s.recordOutcome(result, item.Name, command, "skipped", hook+" hook not approved on this computer")
+			continue
+		}
+
+		run := s.runHook(item, hook, command, localPath, cloudPath, changed)
+		result.Hooks = append(result.Hooks, run)
+		if run.Err != nil {
+			err := fmt.Errorf("%s hook failed: %v", hook, run.Err)
+			if output := lastLine(run.Output); output != "" {
+				err = fmt.Errorf("%w: %s", err, output)
+			}
+			s.recordOutcome(result, item.Name, command, "error", err.Error())
+			return err
+		}
+		s.recordOutcome(result, item.Name, command, "hook", hook)
+	}
+	return nil
+}
+
+// runHook runs a hook command through the shell with the sync details in its environment,
+// killing it when it exceeds the hook timeout
+func (s *SyncEngine) runHook(item *config.SyncItem, hook, command, localPath, cloudPath string, changed []string) HookRun {
+	run := HookRun{
+		ItemName: item.Name,
+		Hook:     hook,
+		Command:  command,
+	}
+
+	timeout := DefaultHookTimeout
+	if s.localConfig.HookTimeout > 0 {
+		timeout = time.Duration(s.localConfig.HookTimeout) * time.Second
+	}
+
+	// Output goes to a file rather than a pipe, so that background processes
+	// started by the hook can't keep the sync waiting
+	output, err := os.CreateTemp("", "syncstation-hook-*")
+	if err != nil {
+		run.Err = fmt.Errorf("failed to capture output: %w", err)
+		return run
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	cmd := shellCommand(command)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Dir = hookDir(item, localPath)
+	cmd.Env = append(os.Environ(),
+		"SYNCSTATION_ITEM="+item.Name,
+		"SYNCSTATION_HOOK="+hook,
+		"SYNCSTATION_COMPUTER="+s.localConfig.CurrentComputer,
+		"SYNCSTATION_LOCAL_PATH="+localPath,
+		"SYNCSTATION_CLOUD_PATH="+cloudPath,
+		"SYNCSTATION_CHANGED_FILES="+strings.Join(changed, "\n"),
+	)
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		run.Err = err
+		return run
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case run.Err = <-done:
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		<-done
+		run.Err = fmt.Errorf("timed out after %s", timeout)
+	}
+	run.Duration = time.Since(start)
+
+	if _, err := output.Seek(0, io.SeekStart); err == nil {
+		data, _ := io.ReadAll(io.LimitReader(output, maxHookOutput))
+		run.Output = strings.TrimSpace(string(data))
+	}
+	return run
+}
+
+// lastLine returns the last line of a hook's output, which usually explains a failure
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// shellCommand returns the command running a hook through the system shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// hookDir returns the directory hooks run in: the item's folder, or the directory of a file item
+func hookDir(item *config.SyncItem, localPath string) string {
+	dir := localPath
+	if item.Type == "file" {
+		dir = filepath.Dir(localPath)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return ""
+	}
+	return dir
+}
+
+// changedFiles returns the local paths of the files pushed, pulled or linked in a result.
+// Pulled files are recorded by their cloud location and are mapped to the local copy.
+func changedFiles(result *SyncResult, localPath, cloudPath string) []string {
+	var changed []string
+	for _, outcome := range result.Files {
+		if outcome.Action != "pushed" && outcome.Action != "pulled" && outcome.Action != "linked" {
+			continue
+		}
+
+		path := outcome.Path
+		if config.IsWithin(cloudPath, path) {
+			if rel, err := filepath.Rel(cloudPath, path); err == nil {
+				path = filepath.Join(localPath, rel)
+			}
+		}
+		changed = append(changed, path)
+	}
+	return changed
+}
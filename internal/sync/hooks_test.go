@@ -0,0 +1,262 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// hookTest sets up an engine and a folder item whose hooks append their name to a log
+type hookTest struct {
+	engine *SyncEngine
+	item   *config.SyncItem
+	local  string
+	log    string
+}
+
+func newHookTest(t *testing.T) *hookTest {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh")
+	}
+	h := &hookTest{log: filepath.Join(t.TempDir(), "hooks.log"), local: t.TempDir()}
+	h.engine = newTestEngine(t, nil)
+	writeFiles(t, h.local, map[string]string{"tmux.conf": "set -g mouse on"})
+	h.item = addTestItem(t, h.engine, &config.SyncItem{
+		Name:  "Tmux",
+		Type:  "folder",
+		Paths: map[string]string{testComputer: h.local},
+	})
+	return h
+}
+
+// command returns a hook command appending name to the log
+func (h *hookTest) command(name string) string {
+	return "echo " + name + " >> " + h.log
+}
+
+// trust approves the current item hooks on the test computer
+func (h *hookTest) trust() {
+	for _, command := range ItemCommands(h.item) {
+		h.engine.localConfig.TrustCommand(command)
+	}
+}
+
+// ran returns the names logged by the hooks, in order
+func (h *hookTest) ran(t *testing.T) []string {
+	t.Helper()
+	data, err := os.ReadFile(h.log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestHooksRunInOrder(t *testing.T) {
+	h := newHookTest(t)
+	h.engine.localConfig.Hooks = config.Hooks{PrePush: h.command("global-pre"), PostPush: h.command("global-post")}
+	h.item.Hooks = config.Hooks{PrePush: h.command("item-pre"), PostPush: h.command("item-post")}
+	h.trust()
+
+	result, err := h.engine.SyncItem(SyncPush, h.item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "global-pre item-pre item-post global-post"
+	if got := strings.Join(h.ran(t), " "); got != want {
+		t.Errorf("hooks ran as %q, want %q", got, want)
+	}
+	if len(result.Hooks) != 4 {
+		t.Errorf("%d hook runs recorded, want 4", len(result.Hooks))
+	}
+	if got := outcomeActions(result.Files)["hook"]; len(got) != 4 {
+		t.Errorf("hook outcomes = %v", got)
+	}
+}
+
+func TestPullHooks(t *testing.T) {
+	h := newHookTest(t)
+	if _, err := h.engine.SyncItem(SyncPush, h.item); err != nil {
+		t.Fatal(err)
+	}
+	h.item.Hooks = config.Hooks{PrePull: h.command("pre-pull"), PostPull: h.command("post-pull"), PrePush: h.command("pre-push")}
+	h.trust()
+	if err := os.Remove(filepath.Join(h.local, "tmux.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.engine.SyncItem(SyncPull, h.item); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(h.ran(t), " "); got != "pre-pull post-pull" {
+		t.Errorf("hooks ran as %q, want the pull hooks", got)
+	}
+}
+
+func TestPostHooksOnlyRunWhenFilesChanged(t *testing.T) {
+	h := newHookTest(t)
+	h.item.Hooks = config.Hooks{PrePull: h.command("pre-pull"), PostPull: h.command("post-pull")}
+	h.trust()
+
+	// An empty cloud copy pulls nothing
+	if err := os.MkdirAll(h.item.GetCloudPath(h.engine.localConfig.GetCloudConfigsPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.engine.SyncItem(SyncPull, h.item); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(h.ran(t), " "); got != "pre-pull" {
+		t.Errorf("hooks ran as %q, want only the pre-pull hook", got)
+	}
+}
+
+func TestFailingPreHookAbortsItem(t *testing.T) {
+	h := newHookTest(t)
+	h.item.Hooks = config.Hooks{PrePush: "echo starting; echo not ready >&2; exit 3", PostPush: h.command("item-post")}
+	h.trust()
+
+	_, err := h.engine.SyncItem(SyncPush, h.item)
+	if err == nil {
+		t.Fatal("push succeeded despite the failing pre-push hook")
+	}
+	if !strings.Contains(err.Error(), "prePush hook failed") || !strings.HasSuffix(err.Error(), ": not ready") {
+		t.Errorf("error %q doesn't report the last line of the hook output", err)
+	}
+	if config.PathExists(h.item.GetCloudPath(h.engine.localConfig.GetCloudConfigsPath())) {
+		t.Error("the item was pushed")
+	}
+	if ran := h.ran(t); len(ran) != 0 {
+		t.Errorf("hooks ran after the failing pre-hook: %v", ran)
+	}
+}
+
+func TestFailingPostHookIsAWarning(t *testing.T) {
+	h := newHookTest(t)
+	h.item.Hooks = config.Hooks{PostPush: "exit 1"}
+	h.trust()
+
+	result, err := h.engine.SyncItem(SyncPush, h.item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.PathExists(h.item.GetCloudPath(h.engine.localConfig.GetCloudConfigsPath())) {
+		t.Error("the item wasn't pushed")
+	}
+	warned := false
+	for _, message := range result.Errors {
+		warned = warned || strings.Contains(message, "postPush hook failed")
+	}
+	if !warned {
+		t.Errorf("no warning about the failing hook in %v", result.Errors)
+	}
+}
+
+func TestUnapprovedHooksAreSkipped(t *testing.T) {
+	h := newHookTest(t)
+	h.engine.localConfig.Hooks = config.Hooks{PrePush: h.command("global-pre")}
+	h.item.Hooks = config.Hooks{PrePush: h.command("item-pre"), PostPush: h.command("item-post")}
+	h.engine.localConfig.TrustCommand(h.item.Hooks.PostPush)
+
+	result, err := h.engine.SyncItem(SyncPush, h.item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(h.ran(t), " "); got != "global-pre item-post" {
+		t.Errorf("hooks ran as %q, want only the global and the approved hooks", got)
+	}
+	warned := false
+	for _, message := range result.Errors {
+		warned = warned || strings.Contains(message, "not approved") && strings.Contains(message, "item-pre")
+	}
+	if !warned {
+		t.Errorf("no warning about the skipped hook in %v", result.Errors)
+	}
+	if !storage.Exists(h.engine.localConfig.CloudStorage(), h.item.CloudKey()) {
+		t.Error("the item was not pushed")
+	}
+
+	// A changed command needs a new approval
+	h.item.Hooks.PostPush = h.command("changed-post")
+	if err := os.WriteFile(filepath.Join(h.local, "tmux.conf"), []byte("set -g mouse off"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.engine.SyncItem(SyncPush, h.item); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range h.ran(t) {
+		if name == "changed-post" {
+			t.Error("the changed hook ran without approval")
+		}
+	}
+}
+
+func TestHookEnvironment(t *testing.T) {
+	h := newHookTest(t)
+	env := filepath.Join(t.TempDir(), "env")
+	h.item.Hooks = config.Hooks{PostPush: `{ pwd; echo "$SYNCSTATION_ITEM $SYNCSTATION_HOOK $SYNCSTATION_COMPUTER"; echo "$SYNCSTATION_LOCAL_PATH"; echo "$SYNCSTATION_CLOUD_PATH"; echo "$SYNCSTATION_CHANGED_FILES"; } > ` + env}
+	h.trust()
+
+	if _, err := h.engine.SyncItem(SyncPush, h.item); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := filepath.EvalSymlinks(h.local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		local, // hooks run in the item's folder
+		"Tmux postPush laptop",
+		h.local,
+		h.item.GetCloudPath(h.engine.localConfig.GetCloudConfigsPath()),
+		filepath.Join(h.local, "tmux.conf"),
+	}, "\n") + "\n"
+	if string(data) != want {
+		t.Errorf("hook environment =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestHooksTimeOut(t *testing.T) {
+	h := newHookTest(t)
+	h.engine.localConfig.HookTimeout = 1
+	h.item.Hooks = config.Hooks{PrePush: "sleep 10"}
+	h.trust()
+
+	start := time.Now()
+	_, err := h.engine.SyncItem(SyncPush, h.item)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the hook was killed after %s", elapsed)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	result := &SyncResult{Files: []FileOutcome{
+		{Path: "/home/me/nvim/init.lua", Action: "pushed"},
+		{Path: "/cloud/Nvim/lua/plugins.lua", Action: "pulled"},
+		{Path: "/home/me/nvim", Action: "linked"},
+		{Path: "/home/me/nvim/same.lua", Action: "skipped"},
+		{Path: "/home/me/nvim/conflict.lua", Action: "conflict"},
+	}}
+	got := changedFiles(result, "/home/me/nvim", "/cloud/Nvim")
+	want := []string{"/home/me/nvim/init.lua", filepath.Join("/home/me/nvim", "lua", "plugins.lua"), "/home/me/nvim"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("changed files = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,248 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// writeSymlink creates a symlink to the slash-separated target at path, replacing any file at path
+func writeSymlink(path, target string) error {
+	target = filepath.FromSlash(target)
+	if info, err := os.Lstat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("refusing to replace directory %s with a symlink", path)
+		}
+		if existing, err := os.Readlink(path); err == nil && existing == target {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(target, path)
+}
+
+// removeSymlink removes path if it is a symlink, so that it can be written without following it
+func removeSymlink(path string) error {
+	if !config.IsSymlink(path) {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// isLinkedTo reports whether path is a symlink to target
+func isLinkedTo(path, target string) bool {
+	if !config.IsSymlink(path) {
+		return false
+	}
+
+	dest, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(filepath.Dir(path), dest)
+	}
+
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return false
+	}
+	return filepath.Clean(dest) == absTarget
+}
+
+// IsLinked reports whether the local path of an item on this computer is a symlink to its cloud copy
+func IsLinked(localConfig *config.LocalConfig, item *config.SyncItem) bool {
+	localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
+	cloudPath, ok := storage.LocalPath(localConfig.CloudStorage(), item.CloudKey())
+	return localPath != "" && ok && isLinkedTo(localPath, cloudPath)
+}
+
+// checkLinkDeploy returns an error if an item can't be deployed as a symlink to its cloud copy
+func (s *SyncEngine) checkLinkDeploy(item *config.SyncItem, localPath, cloudPath string) error {
+	switch {
+	case item.Template:
+		return fmt.Errorf("link deploy is not supported for templates")
+	case s.codec.ShouldEncrypt(item):
+		return fmt.Errorf("link deploy is not supported for encrypted items")
+	case config.IsWithin(localPath, cloudPath) || config.IsWithin(cloudPath, localPath):
+		return fmt.Errorf("local path %s and cloud copy %s must not contain each other", localPath, cloudPath)
+	}
+	return nil
+}
+
+// syncLinkedItem syncs an item deployed as a symlink: the cloud copy is brought up to date
+// with the local files, then the local path is replaced by a link to it. Only storages
+// keeping the cloud copy on this computer can be linked to.
+func (s *SyncEngine) syncLinkedItem(operation SyncOperation, item *config.SyncItem, localPath, cloudKey string) (*SyncResult, error) {
+	cloudPath, ok := storage.LocalPath(s.storage, cloudKey)
+	if !ok {
+		return nil, fmt.Errorf("link deploy needs the cloud copy on this computer, use copy deploy with this storage")
+	}
+
+	if isLinkedTo(localPath, cloudPath) {
+		result := &SyncResult{
+			Operation:    operation,
+			Success:      true,
+			Errors:       make([]string, 0),
+			FilesSkipped: 1,
+			Message:      fmt.Sprintf("%s is linked to the cloud copy", item.Name),
+		}
+		s.recordOutcome(result, item.Name, localPath, "skipped", "linked to cloud copy")
+		return result, nil
+	}
+
+	if err := s.checkLinkDeploy(item, localPath, cloudPath); err != nil {
+		return nil, err
+	}
+
+	_, statErr := os.Lstat(localPath)
+	localExists := statErr == nil
+
+	var result *SyncResult
+	var err error
+	pulling := false
+	switch {
+	case localExists && operation == SyncPush:
+		result, err = s.pushItem(item, localPath, cloudKey)
+	case localExists && operation == SyncSmart:
+		result, err = s.smartSyncItem(item, localPath, cloudKey)
+	case !config.PathExists(cloudPath):
+		return nil, fmt.Errorf("cloud path does not exist: %s", cloudPath)
+	default:
+		// Pulling links the cloud copy as is
+		result = &SyncResult{
+			Operation: operation,
+			Success:   true,
+			Errors:    make([]string, 0),
+		}
+		pulling = true
+
+		// The link exposes the cloud copy as is, so invalid files can only be refused
+		staged, failures, stageErr := s.stageIncoming(result, item, localPath, cloudKey)
+		if staged != "" {
+			os.RemoveAll(filepath.Dir(staged))
+		}
+		switch {
+		case stageErr != nil:
+			err = stageErr
+		case len(failures) > 0:
+			err = refuseInvalid(failures)
+		default:
+			err = s.runHooks(result, item, HookPrePull, localPath, cloudKey)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Conflicts must be resolved before the local files are replaced
+	for _, outcome := range result.Files {
+		if outcome.Action == "conflict" {
+			return result, nil
+		}
+	}
+
+	backup, err := replaceWithLink(localPath, cloudPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link %s: %w", localPath, err)
+	}
+
+	message := "linked to cloud copy"
+	if backup != "" {
+		message += ", previous files moved to " + backup
+	}
+	result.FilesChanged++
+	result.Message = fmt.Sprintf("Linked %s to the cloud copy", item.Name)
+	s.recordOutcome(result, item.Name, localPath, "linked", message)
+
+	if pulling {
+		if err := s.runHooks(result, item, HookPostPull, localPath, cloudKey); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("warning: %v", err))
+		}
+	}
+	return result, nil
+}
+
+// replaceWithLink replaces localPath with a symlink to cloudPath. Existing local files are
+// moved aside unless they are a file identical to the cloud copy. It returns the backup path.
+func replaceWithLink(localPath, cloudPath string) (string, error) {
+	absCloudPath, err := filepath.Abs(cloudPath)
+	if err != nil {
+		return "", err
+	}
+
+	backup := ""
+	if info, err := os.Lstat(localPath); err == nil {
+		if info.Mode().IsRegular() && sameFileContent(localPath, cloudPath) {
+			if err := os.Remove(localPath); err != nil {
+				return "", err
+			}
+		} else {
+			backup = fmt.Sprintf("%s.syncstation-backup-%s", localPath, time.Now().Format("20060102-150405"))
+			if err := os.Rename(localPath, backup); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Symlink(absCloudPath, localPath); err != nil {
+		// Put the previous files back
+		if backup != "" {
+			_ = os.Rename(backup, localPath)
+		}
+		return "", err
+	}
+
+	return backup, nil
+}
+
+// sameFileContent reports whether two files have the same content
+func sameFileContent(path1, path2 string) bool {
+	hash1, err := config.CalculateFileHash(path1)
+	if err != nil {
+		return false
+	}
+	hash2, err := config.CalculateFileHash(path2)
+	return err == nil && hash1 == hash2
+}
+
+// unlinkItem replaces the symlink of an item to its cloud copy with a copy of the cloud files
+func (s *SyncEngine) unlinkItem(item *config.SyncItem, localPath, cloudKey string) error {
+	target, err := os.Readlink(localPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(localPath); err != nil {
+		return err
+	}
+
+	if item.Type == "file" {
+		err = download(s.storage, cloudKey, localPath, itemDecoder(s.codec, s.localConfig, item))
+	} else {
+		var exclude func(rel string, isDir bool) bool
+		if exclude, err = s.pullExclusions(item); err == nil {
+			err = downloadDir(s.storage, cloudKey, localPath, s.codec.Decode, exclude, nil)
+		}
+	}
+	if err != nil {
+		// Restore the link so the local files stay reachable
+		_ = os.RemoveAll(localPath)
+		_ = os.Symlink(target, localPath)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,332 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+// symlink creates a symlink at path pointing to target
+func symlink(t *testing.T, target, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLink returns the target of the symlink at path, failing if it isn't a symlink
+func readLink(t *testing.T, path string) string {
+	t.Helper()
+	target, err := os.Readlink(path)
+	if err != nil {
+		t.Fatalf("%s is not a symlink: %v", path, err)
+	}
+	return target
+}
+
+// skippedPaths returns the paths of skipped outcomes with the reason they were skipped
+func skippedPaths(outcomes []FileOutcome) map[string]string {
+	skipped := make(map[string]string)
+	for _, outcome := range outcomes {
+		if outcome.Action == "skipped" {
+			skipped[outcome.Path] = outcome.Message
+		}
+	}
+	return skipped
+}
+
+func TestSymlinksAreStoredAsLinks(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret")
+	writeFiles(t, local, map[string]string{"init.lua": "require('plugins')", "lua/plugins.lua": "return {}"})
+	writeFiles(t, filepath.Dir(outside), map[string]string{"secret": "token"})
+	symlink(t, "init.lua", filepath.Join(local, "relative.lua"))
+	symlink(t, filepath.Join(local, "lua", "plugins.lua"), filepath.Join(local, "absolute.lua"))
+	symlink(t, "lua", filepath.Join(local, "lua-dir"))
+	symlink(t, outside, filepath.Join(local, "escaping-absolute"))
+	symlink(t, "../"+filepath.Base(filepath.Dir(outside))+"/secret", filepath.Join(local, "escaping-relative"))
+	symlink(t, "../init.lua", filepath.Join(local, "lua", "up.lua"))
+
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Nvim", Type: "folder", Paths: map[string]string{testComputer: local}})
+	result, err := engine.SyncItem(SyncPush, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloud := item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+	links := map[string]string{
+		"relative.lua": "init.lua",
+		"absolute.lua": filepath.Join("lua", "plugins.lua"), // made relative to stay valid in the cloud copy
+		"lua-dir":      "lua",
+		"lua/up.lua":   "../init.lua",
+	}
+	for rel, want := range links {
+		if got := readLink(t, filepath.Join(cloud, filepath.FromSlash(rel))); got != want {
+			t.Errorf("cloud link %s -> %s, want %s", rel, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cloud, "lua-dir", "plugins.lua")); err != nil {
+		t.Errorf("the directory link doesn't resolve inside the cloud copy: %v", err)
+	}
+
+	// Links escaping the item are reported as skipped and never stored
+	want := map[string]string{
+		filepath.Join(local, "escaping-absolute"): "symlink points outside the item",
+		filepath.Join(local, "escaping-relative"): "symlink points outside the item",
+	}
+	if got := skippedPaths(result.Files); !reflect.DeepEqual(got, want) {
+		t.Errorf("skipped = %v, want %v", got, want)
+	}
+	for _, name := range []string{"escaping-absolute", "escaping-relative"} {
+		if _, err := os.Lstat(filepath.Join(cloud, name)); !os.IsNotExist(err) {
+			t.Errorf("escaping link %s was stored: %v", name, err)
+		}
+	}
+
+	// Pulling recreates the links
+	pulled := t.TempDir()
+	item.Paths[testComputer] = pulled
+	if _, err := engine.SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	for rel, want := range links {
+		if got := readLink(t, filepath.Join(pulled, filepath.FromSlash(rel))); got != want {
+			t.Errorf("pulled link %s -> %s, want %s", rel, got, want)
+		}
+	}
+}
+
+func TestEscapingLinksInTheCloudAreNotPulled(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Nvim", Type: "folder", Paths: map[string]string{testComputer: local}})
+	cloud := item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+	writeFiles(t, cloud, map[string]string{"init.lua": "require('plugins')"})
+	symlink(t, "/etc/passwd", filepath.Join(cloud, "passwd"))
+
+	result, err := engine.SyncItem(SyncPull, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(local, "passwd")); !os.IsNotExist(err) {
+		t.Errorf("an escaping cloud link was pulled: %v", err)
+	}
+	if got := skippedPaths(result.Files); len(got) != 1 {
+		t.Errorf("skipped = %v, want the escaping link", got)
+	}
+}
+
+func TestLinkLoopsAreNotFollowed(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{"init.lua": "require('plugins')"})
+	symlink(t, ".", filepath.Join(local, "self"))
+	symlink(t, "..", filepath.Join(local, "sub", "parent"))
+	symlink(t, "b", filepath.Join(local, "a"))
+	symlink(t, "a", filepath.Join(local, "b"))
+
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Nvim", Type: "folder", Paths: map[string]string{testComputer: local}})
+	result, err := engine.SyncItem(SyncPush, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := skippedPaths(result.Files); len(got) != 0 {
+		t.Errorf("links inside the item were skipped: %v", got)
+	}
+
+	cloud := item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+	var stored []string
+	err = filepath.Walk(cloud, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(cloud, path)
+			stored = append(stored, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(stored)
+	if want := []string{"a", "b", "init.lua", "self", "sub/parent"}; !reflect.DeepEqual(stored, want) {
+		t.Errorf("cloud copy = %v, want %v", stored, want)
+	}
+	if got := readLink(t, filepath.Join(cloud, "self")); got != "." {
+		t.Errorf("cloud link self -> %s", got)
+	}
+}
+
+func TestReplaceWithLink(t *testing.T) {
+	cloudDir := t.TempDir()
+	writeFiles(t, cloudDir, map[string]string{"zshrc": "setopt autocd", "nvim/init.lua": "set number"})
+
+	tests := []struct {
+		name       string
+		cloud      string
+		setup      func(localPath string)
+		wantBackup bool
+	}{
+		{name: "missing local path", cloud: "zshrc", setup: func(string) {}},
+		{
+			name:  "identical file",
+			cloud: "zshrc",
+			setup: func(localPath string) {
+				writeFiles(t, filepath.Dir(localPath), map[string]string{filepath.Base(localPath): "setopt autocd"})
+			},
+		},
+		{
+			name:  "different file",
+			cloud: "zshrc",
+			setup: func(localPath string) {
+				writeFiles(t, filepath.Dir(localPath), map[string]string{filepath.Base(localPath): "setopt nocd"})
+			},
+			wantBackup: true,
+		},
+		{
+			name:       "folder",
+			cloud:      "nvim",
+			setup:      func(localPath string) { writeFiles(t, localPath, map[string]string{"init.lua": "set number"}) },
+			wantBackup: true,
+		},
+		{
+			name:       "link elsewhere",
+			cloud:      "zshrc",
+			setup:      func(localPath string) { symlink(t, "/etc/zshrc", localPath) },
+			wantBackup: true,
+		},
+	}
+	for _, test := range tests {
+		localPath := filepath.Join(t.TempDir(), "config", "local")
+		cloudPath := filepath.Join(cloudDir, test.cloud)
+		test.setup(localPath)
+
+		backup, err := replaceWithLink(localPath, cloudPath)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := readLink(t, localPath); got != cloudPath {
+			t.Errorf("%s: link -> %s, want %s", test.name, got, cloudPath)
+		}
+		if (backup != "") != test.wantBackup {
+			t.Errorf("%s: backup = %q, want one: %v", test.name, backup, test.wantBackup)
+		}
+		if backup != "" && !strings.HasPrefix(backup, localPath+".syncstation-backup-") {
+			t.Errorf("%s: backup %s isn't next to the local path", test.name, backup)
+		}
+		if _, err := os.Lstat(backup); backup != "" && err != nil {
+			t.Errorf("%s: the previous files weren't kept: %v", test.name, err)
+		}
+	}
+}
+
+func TestLinkDeployMode(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := filepath.Join(t.TempDir(), "nvim")
+	writeFiles(t, local, map[string]string{"init.lua": "set number"})
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Nvim", Type: "folder", Deploy: config.DeployLink, Paths: map[string]string{testComputer: local}})
+	cloud := item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+
+	// The first sync pushes the local files, then links them
+	result, err := engine.SyncItem(SyncSmart, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isLinkedTo(local, cloud) || !IsLinked(engine.localConfig, item) {
+		t.Fatal("the local path wasn't replaced by a link to the cloud copy")
+	}
+	if actions := outcomeActions(result.Files); len(actions["linked"]) != 1 || !strings.Contains(result.Files[len(result.Files)-1].Message, "previous files moved to") {
+		t.Errorf("outcomes = %+v", result.Files)
+	}
+	data, err := os.ReadFile(filepath.Join(local, "init.lua"))
+	if err != nil || string(data) != "set number" {
+		t.Errorf("init.lua through the link = %q, %v", data, err)
+	}
+
+	// Linked items have nothing left to sync
+	result, err = engine.SyncItem(SyncPush, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FilesSkipped != 1 || result.FilesChanged != 0 {
+		t.Errorf("syncing a linked item skipped %d and changed %d files", result.FilesSkipped, result.FilesChanged)
+	}
+
+	// Pulling on another computer links the cloud copy as is
+	other := filepath.Join(t.TempDir(), "nvim")
+	item.Paths[testComputer] = other
+	if _, err := engine.SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	if !isLinkedTo(other, cloud) {
+		t.Error("pulling didn't link the cloud copy")
+	}
+
+	// Switching back to copies replaces the link with a copy of the cloud files
+	item.Deploy = config.DeployCopy
+	if _, err := engine.SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	if config.IsSymlink(other) {
+		t.Error("the link wasn't replaced by a copy")
+	}
+	if data, err := os.ReadFile(filepath.Join(other, "init.lua")); err != nil || string(data) != "set number" {
+		t.Errorf("copied init.lua = %q, %v", data, err)
+	}
+}
+
+func TestLinkDeployIsRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    *config.SyncItem
+		local   func(cloud string) string
+		wantErr string
+	}{
+		{
+			name:    "template",
+			item:    &config.SyncItem{Name: "Git", Type: "file", Template: true},
+			wantErr: "not supported for templates",
+		},
+		{
+			name:    "local path inside the cloud copy",
+			item:    &config.SyncItem{Name: "Nvim", Type: "folder"},
+			local:   func(cloud string) string { return filepath.Join(cloud, "nested") },
+			wantErr: "must not contain each other",
+		},
+		{
+			name:    "cloud copy inside the local path",
+			item:    &config.SyncItem{Name: "Nvim", Type: "folder"},
+			local:   func(cloud string) string { return filepath.Dir(filepath.Dir(cloud)) },
+			wantErr: "must not contain each other",
+		},
+	}
+	for _, test := range tests {
+		engine := newTestEngine(t, nil)
+		cloud := test.item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+		local := filepath.Join(t.TempDir(), "local")
+		if test.local != nil {
+			local = test.local(cloud)
+		}
+		writeFiles(t, local, map[string]string{"init.lua": "set number"})
+		test.item.Deploy = config.DeployLink
+		test.item.Paths = map[string]string{testComputer: local}
+
+		if _, err := engine.SyncItem(SyncPush, test.item); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+		}
+		if config.IsSymlink(local) {
+			t.Errorf("%s: the local path was linked", test.name)
+		}
+	}
+}
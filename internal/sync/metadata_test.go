@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+func TestPushWritesMetadataOncePerItem(t *testing.T) {
+	var writes atomic.Int32
+	localConfig := newWebDAVConfig(t, func(r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/"+config.FileMetadataKey) {
+			writes.Add(1)
+		}
+	})
+	engine := newTestEngine(t, localConfig)
+
+	folder := t.TempDir()
+	writeFiles(t, folder, map[string]string{"a.conf": "a", "b.conf": "b", "sub/c.conf": "c", "sub/d.conf": "d"})
+	folderItem := addTestItem(t, engine, &config.SyncItem{Name: "Folder", Type: "folder", Paths: map[string]string{testComputer: folder}})
+
+	file := t.TempDir()
+	writeFiles(t, file, map[string]string{".zshrc": "export EDITOR=vim"})
+	fileItem := addTestItem(t, engine, &config.SyncItem{Name: "Zsh", Type: "file", Paths: map[string]string{testComputer: file + "/.zshrc"}})
+
+	for _, item := range []*config.SyncItem{folderItem, fileItem} {
+		writes.Store(0)
+		result, err := engine.SyncItem(SyncPush, item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Errors) > 0 {
+			t.Errorf("%s: %v", item.Name, result.Errors)
+		}
+		if got := writes.Load(); got != 1 {
+			t.Errorf("pushing %s wrote the metadata %d times, want 1", item.Name, got)
+		}
+	}
+
+	metadata, err := config.LoadCloudFileMetadata(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"a.conf", "b.conf", "sub/c.conf", "sub/d.conf"} {
+		if _, _, ok := metadata.GetFileMode(folderItem.Name, rel); !ok {
+			t.Errorf("no mode recorded for %s", rel)
+		}
+	}
+	zshrc := metadata.Metadata[fileItem.Name][file+"/.zshrc"]
+	if zshrc == nil || zshrc.CloudHash == "" || zshrc.Mode == "" || zshrc.Computers[testComputer] == nil {
+		t.Errorf("incomplete metadata for the file item: %+v", zshrc)
+	}
+}
+
+func TestFailedSyncDropsMetadata(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	engine.updateCloudHash("Zsh", "/home/me/.zshrc", "sha256:00", storage.FileInfo{})
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Missing", Type: "file", Paths: map[string]string{testComputer: t.TempDir() + "/missing"}})
+
+	if _, err := engine.SyncItem(SyncPush, item); err == nil {
+		t.Fatal("push of a missing file succeeded")
+	}
+	if len(engine.metadataUpdates) != 0 {
+		t.Error("metadata changes of the failed sync are still queued")
+	}
+	metadata, err := config.LoadCloudFileMetadata(engine.localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata.Metadata) != 0 {
+		t.Errorf("metadata of the failed sync was saved: %v", metadata.Metadata)
+	}
+}
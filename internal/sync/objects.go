@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/encryption"
+	"github.com/AntoineArt/syncstation/internal/objects"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// ItemStorage returns the storage holding the cloud copy of an item: the cloud storage, seen
+// through the object store for items kept there. item may be nil.
+func ItemStorage(localConfig *config.LocalConfig, item *config.SyncItem) storage.Storage {
+	cloudStorage := localConfig.CloudStorage()
+	if item == nil || !item.UsesObjectStore() {
+		return cloudStorage
+	}
+	overlay := objects.NewOverlay(cloudStorage)
+	overlay.Track(item.CloudKey())
+	return overlay
+}
+
+// CheckObjectStore returns an error if an item can't be kept in the object store. Only plain
+// folder items can: encrypted copies differ on every push, templates are rendered from a
+// single file and links need the files in the cloud directory.
+func CheckObjectStore(localConfig *config.LocalConfig, item *config.SyncItem) error {
+	return checkObjectStore(encryption.NewCodec(localConfig), item)
+}
+
+// checkObjectStore implements CheckObjectStore with the codec of an engine
+func checkObjectStore(codec *encryption.Codec, item *config.SyncItem) error {
+	switch {
+	case item.Type == "file":
+		return fmt.Errorf("%s can't use the object store: only folder items can", item.Name)
+	case item.Template:
+		return fmt.Errorf("%s can't use the object store: templates need a file of their own", item.Name)
+	case item.Deploy == config.DeployLink:
+		return fmt.Errorf("%s can't use the object store: linked items need a copy in the cloud directory", item.Name)
+	case codec.ShouldEncrypt(item):
+		return fmt.Errorf("%s can't use the object store: encrypted items can't be deduplicated", item.Name)
+	}
+	return nil
+}
+
+// trackObjects serves an item kept in the object store from its manifest
+func (s *SyncEngine) trackObjects(item *config.SyncItem) error {
+	if !item.UsesObjectStore() {
+		return nil
+	}
+	if err := checkObjectStore(s.codec, item); err != nil {
+		return err
+	}
+	s.objects.Track(item.CloudKey())
+	return nil
+}
+
+// commitObjects writes the manifests of the items kept in the object store that an operation
+// changed, or drops their changes when it failed
+func (s *SyncEngine) commitObjects(err error) error {
+	if err != nil {
+		s.objects.Discard()
+		return err
+	}
+	if err := s.objects.Commit(); err != nil {
+		return fmt.Errorf("failed to update the object store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+func TestObjectStoreItemsRoundTrip(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	item := addTestItem(t, engine, &config.SyncItem{
+		Name:  "Nvim",
+		Type:  "folder",
+		Paths: map[string]string{testComputer: local},
+		Store: config.StoreObjects,
+	})
+	writeFiles(t, local, map[string]string{"init.lua": "vim.o.number = true", "lua/plugins.lua": "return {}"})
+
+	result, err := engine.SyncItem(SyncPush, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success {
+		t.Fatalf("push failed: %v", result.Errors)
+	}
+	// The cloud configs only hold the manifest, the files are objects
+	if storage.Exists(engine.localConfig.CloudStorage(), storage.Join(item.CloudKey(), "init.lua")) {
+		t.Error("the files of an object store item were pushed as files")
+	}
+	if data, err := ItemStorage(engine.localConfig, item).Read(storage.Join(item.CloudKey(), "init.lua")); err != nil || string(data) != "vim.o.number = true" {
+		t.Errorf("init.lua in the object store = %q, %v", data, err)
+	}
+
+	if err := os.RemoveAll(local); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestEngine(t, engine.localConfig).SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(local, "lua", "plugins.lua")); got != "return {}" {
+		t.Errorf("pulled plugins.lua = %q", got)
+	}
+}
+
+func TestCheckObjectStore(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	localConfig := &config.LocalConfig{CloudSyncDir: t.TempDir()}
+	setUpEncryption(t, localConfig)
+	tests := []struct {
+		item *config.SyncItem
+		ok   bool
+	}{
+		{&config.SyncItem{Name: "Nvim", Type: "folder"}, true},
+		{&config.SyncItem{Name: "Shell", Type: "file"}, false},
+		{&config.SyncItem{Name: "Nvim", Type: "folder", Template: true}, false},
+		{&config.SyncItem{Name: "Nvim", Type: "folder", Deploy: config.DeployLink}, false},
+		{&config.SyncItem{Name: "Nvim", Type: "folder", Encrypt: true}, false},
+	}
+	for _, test := range tests {
+		if err := CheckObjectStore(localConfig, test.item); (err == nil) != test.ok {
+			t.Errorf("CheckObjectStore(%+v) = %v, want ok %v", test.item, err, test.ok)
+		}
+	}
+}
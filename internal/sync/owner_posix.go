@@ -0,0 +1,57 @@
+//go:build !windows
+
+package sync
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// fileOwner returns the name of the user owning a file, or "" if unknown
+func fileOwner(info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	owner, err := user.LookupId(strconv.FormatUint(uint64(stat.Uid), 10))
+	if err != nil {
+		return ""
+	}
+	return owner.Username
+}
+
+// restoreOwner gives a file to the named user when running as root. Other users can't
+// change ownership, and users that don't exist on this computer are ignored. Owners are
+// only matched by user name, never by numeric ID, since IDs differ between computers.
+func restoreOwner(path, owner string) error {
+	if os.Geteuid() != 0 || !validOwnerName(owner) {
+		return nil
+	}
+
+	account, err := user.Lookup(owner)
+	if err != nil {
+		return nil
+	}
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		return nil
+	}
+	gid, err := strconv.Atoi(account.Gid)
+	if err != nil {
+		return nil
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+// validOwnerName reports whether owner is a user name that can't be read as a numeric ID,
+// which some systems accept in place of a name
+func validOwnerName(owner string) bool {
+	if owner == "" || owner == "." || owner == ".." || strings.ContainsAny(owner, "/: \t\n") {
+		return false
+	}
+	_, err := strconv.ParseUint(owner, 10, 32)
+	return err != nil
+}
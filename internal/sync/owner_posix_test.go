@@ -0,0 +1,82 @@
+//go:build !windows
+
+package sync
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+func TestValidOwnerName(t *testing.T) {
+	tests := map[string]bool{
+		"jane":     true,
+		"www-data": true,
+		"_apt":     true,
+		"":         false,
+		"0":        false,
+		"1000":     false,
+		"../root":  false,
+		"a b":      false,
+	}
+	for owner, want := range tests {
+		if got := validOwnerName(owner); got != want {
+			t.Errorf("validOwnerName(%q) = %v, want %v", owner, got, want)
+		}
+	}
+}
+
+// fileUID returns the user ID owning path
+func fileUID(t *testing.T, path string) uint32 {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Sys().(*syscall.Stat_t).Uid
+}
+
+func TestRestoreOwnerIsOptIn(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root restores owners")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user on this computer")
+	}
+	nobodyUID, _ := strconv.Atoi(nobody.Uid)
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := newTestEngine(t, nil)
+	if err := engine.restoreAttributes(path, 0600, "nobody"); err != nil {
+		t.Fatal(err)
+	}
+	if fileUID(t, path) != 0 {
+		t.Error("owner was restored without restoreOwners")
+	}
+
+	engine = newTestEngine(t, &config.LocalConfig{CloudSyncDir: t.TempDir(), RestoreOwners: true})
+	for _, owner := range []string{nobody.Uid, "no-such-user-here"} {
+		if err := engine.restoreAttributes(path, 0600, owner); err != nil {
+			t.Fatal(err)
+		}
+		if fileUID(t, path) != 0 {
+			t.Errorf("owner %q was restored", owner)
+		}
+	}
+	if err := engine.restoreAttributes(path, 0600, "nobody"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileUID(t, path); got != uint32(nobodyUID) {
+		t.Errorf("file is owned by %d, want nobody (%d)", got, nobodyUID)
+	}
+}
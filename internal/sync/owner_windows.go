@@ -0,0 +1,13 @@
+package sync
+
+import "os"
+
+// fileOwner returns "": file ownership isn't recorded on Windows
+func fileOwner(info os.FileInfo) string {
+	return ""
+}
+
+// restoreOwner does nothing: file ownership isn't restored on Windows
+func restoreOwner(path, owner string) error {
+	return nil
+}
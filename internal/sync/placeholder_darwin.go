@@ -0,0 +1,15 @@
+package sync
+
+import (
+	"os"
+	"syscall"
+)
+
+// sfDataless is the file flag of the File Provider placeholders of online-only files
+const sfDataless = 0x40000000
+
+// isOnlineOnly reports whether a file is a placeholder whose content isn't downloaded
+func isOnlineOnly(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Flags&sfDataless != 0
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !windows
+
+package sync
+
+import "os"
+
+// isOnlineOnly reports false: placeholders can't be told apart from other files here
+func isOnlineOnly(info os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,19 @@
+package sync
+
+import (
+	"os"
+	"syscall"
+)
+
+// Attributes of the cloud files placeholders whose content isn't downloaded
+const (
+	fileAttributeOffline            = 0x1000
+	fileAttributeRecallOnOpen       = 0x40000
+	fileAttributeRecallOnDataAccess = 0x400000
+)
+
+// isOnlineOnly reports whether a file is a placeholder whose content isn't downloaded
+func isOnlineOnly(info os.FileInfo) bool {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&(fileAttributeOffline|fileAttributeRecallOnOpen|fileAttributeRecallOnDataAccess) != 0
+}
@@ -0,0 +1,206 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// Settle check defaults, used when the local configuration sets none
+const (
+	DefaultSettleWindow  = 5 * time.Second
+	DefaultSettleTimeout = 2 * time.Minute
+)
+
+// settlePollInterval is how often the cloud directory is scanned while waiting for it to settle
+const settlePollInterval = time.Second
+
+// ErrNotSettled is returned, wrapped, when the cloud drive client is still syncing the cloud
+// directory after the settle timeout
+var ErrNotSettled = errors.New("cloud drive client is still syncing")
+
+// CloudActivity describes the traces the cloud drive client leaves in the cloud directory
+// while it syncs
+type CloudActivity struct {
+	Pending      []string  // Temporary and placeholder files, relative to the cloud directory
+	LastModified time.Time // Latest modification time of the files and directories
+	Fingerprint  string    // Summary of the directory, which changes whenever a file changes
+}
+
+// Busy reports whether the cloud drive client is downloading files, or changed the cloud
+// directory less than window ago
+func (a CloudActivity) Busy(window time.Duration) bool {
+	return len(a.Pending) > 0 || (!a.LastModified.IsZero() && time.Since(a.LastModified) < window)
+}
+
+// pendingFilePatterns match the names cloud drive clients give to the files they are still
+// downloading, or whose content isn't on this computer yet
+var pendingFilePatterns = []*regexp.Regexp{
+	// Nextcloud and ownCloud download to ".<name>.~<hex id>"
+	regexp.MustCompile(`^\..+\.~[0-9a-f]+$`),
+	// Syncthing downloads to ".syncthing.<name>.tmp", or "~syncthing~<name>.tmp" on Windows
+	regexp.MustCompile(`^\.syncthing\..+\.tmp$`),
+	regexp.MustCompile(`^~syncthing~.+\.tmp$`),
+	// Resilio Sync downloads to "<name>.!sync"
+	regexp.MustCompile(`.\.!sync$`),
+	// iCloud Drive replaces files it evicted with ".<name>.icloud" placeholders
+	regexp.MustCompile(`^\..+\.icloud$`),
+}
+
+// isPendingFile reports whether a file of the cloud directory is a partial download or an
+// online-only placeholder whose content isn't on this computer yet
+func isPendingFile(name string, info fs.FileInfo) bool {
+	for _, pattern := range pendingFilePatterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	// odrive leaves zero-size stubs next to the files it hasn't downloaded
+	if info.Size() == 0 && (strings.HasSuffix(name, ".cloud") || strings.HasSuffix(name, ".cloudf")) {
+		return true
+	}
+	return info.Mode().IsRegular() && isOnlineOnly(info)
+}
+
+// ScanCloudActivity scans a cloud directory for the traces of its cloud drive client
+func ScanCloudActivity(dir string) (CloudActivity, error) {
+	var activity CloudActivity
+	var count int
+	var size int64
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // Skip entries removed or renamed while scanning
+		}
+		if entry.IsDir() && (entry.Name() == ".git" || entry.Name() == ".dropbox.cache") {
+			return filepath.SkipDir
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		count++
+		size += info.Size()
+		if info.ModTime().After(activity.LastModified) {
+			activity.LastModified = info.ModTime()
+		}
+		if !entry.IsDir() && isPendingFile(entry.Name(), info) {
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				activity.Pending = append(activity.Pending, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return CloudActivity{}, fmt.Errorf("failed to scan cloud directory: %w", err)
+	}
+
+	activity.Fingerprint = fmt.Sprintf("%d:%d:%d", count, size, activity.LastModified.UnixNano())
+	return activity, nil
+}
+
+// CheckCloudActivity returns the activity of the cloud copy. Cloud directories are scanned
+// for the traces of their cloud drive client, while other storages are fingerprinted from
+// the listing of the cloud copies and the stats of the shared files, without ever being busy.
+func CheckCloudActivity(localConfig *config.LocalConfig) (CloudActivity, error) {
+	cloudStorage := localConfig.CloudStorage()
+	if dir, ok := storage.LocalPath(cloudStorage, ""); ok {
+		return ScanCloudActivity(dir)
+	}
+
+	entries, err := cloudStorage.List(config.CloudConfigsKey)
+	if err != nil {
+		return CloudActivity{}, fmt.Errorf("failed to list cloud copies: %w", err)
+	}
+	for _, key := range []string{config.SyncItemsKey, config.FileMetadataKey, config.EncryptionKey} {
+		info, err := cloudStorage.Stat(key)
+		if errors.Is(err, storage.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return CloudActivity{}, fmt.Errorf("failed to stat %s: %w", cloudStorage.Location(key), err)
+		}
+		entries = append(entries, info)
+	}
+
+	hash := sha256.New()
+	for _, entry := range entries {
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\x00%s\x00%s\n", entry.Key, entry.Size, entry.ModTime.UnixNano(), entry.ETag, entry.Link)
+	}
+	return CloudActivity{Fingerprint: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// SettleDurations returns the settle window and timeout of a local configuration
+func SettleDurations(localConfig *config.LocalConfig) (window, timeout time.Duration) {
+	window, timeout = DefaultSettleWindow, DefaultSettleTimeout
+	if localConfig.Settle.Window > 0 {
+		window = time.Duration(localConfig.Settle.Window) * time.Second
+	}
+	if localConfig.Settle.Timeout > 0 {
+		timeout = time.Duration(localConfig.Settle.Timeout) * time.Second
+	}
+	return window, timeout
+}
+
+// WaitForSettle waits until the cloud drive client has finished syncing the cloud directory:
+// no partial downloads or placeholders are left, and nothing changed for the settle window.
+// It returns at once for a directory that settled long ago, when the check is disabled, in
+// git mode and with storages that don't keep the cloud copy on this computer. onWait, if not
+// nil, is called with what is still going on before every wait.
+func WaitForSettle(localConfig *config.LocalConfig, onWait func(activity CloudActivity)) error {
+	if localConfig.Settle.Disabled || localConfig.GitMode {
+		return nil
+	}
+	dir, ok := storage.LocalPath(localConfig.CloudStorage(), "")
+	if !ok {
+		return nil
+	}
+	window, timeout := SettleDurations(localConfig)
+
+	deadline := time.Now().Add(timeout)
+	activity, err := ScanCloudActivity(dir)
+	if err != nil {
+		return err
+	}
+	stableSince := time.Now()
+	for {
+		// Files written by the client keep the modification time of their source, so the
+		// directory must also stay the same for a whole window
+		if len(activity.Pending) == 0 && (!activity.Busy(window) || time.Since(stableSince) >= window) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if len(activity.Pending) > 0 {
+				return fmt.Errorf("%w after %s: %s", ErrNotSettled, timeout, strings.Join(activity.Pending, ", "))
+			}
+			return fmt.Errorf("%w after %s: files are still changing", ErrNotSettled, timeout)
+		}
+
+		if onWait != nil {
+			onWait(activity)
+		}
+		time.Sleep(settlePollInterval)
+
+		next, err := ScanCloudActivity(dir)
+		if err != nil {
+			return err
+		}
+		if next.Fingerprint != activity.Fingerprint || len(next.Pending) > 0 {
+			stableSince = time.Now()
+		}
+		activity = next
+	}
+}
@@ -0,0 +1,270 @@
+package sync
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// newWebDAVConfig returns a local configuration whose cloud copy is kept on an in-process
+// WebDAV server. Requests go through observe first, if not nil.
+func newWebDAVConfig(t *testing.T, observe func(r *http.Request)) *config.LocalConfig {
+	t.Helper()
+	handler := &webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if observe != nil {
+			observe(r)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return &config.LocalConfig{
+		CloudSyncDir: t.TempDir(),
+		Storage:      storage.Config{Type: storage.TypeWebDAV, WebDAV: storage.WebDAVConfig{URL: server.URL + "/"}},
+	}
+}
+
+func TestCheckCloudActivityLocal(t *testing.T) {
+	localConfig := &config.LocalConfig{CloudSyncDir: t.TempDir()}
+	file := filepath.Join(localConfig.CloudSyncDir, "configs", "Shell", ".zshrc")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := CheckCloudActivity(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !before.Busy(time.Minute) {
+		t.Error("a cloud directory changed just now should be busy")
+	}
+
+	if err := os.WriteFile(file, []byte("two, longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after, err := CheckCloudActivity(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Fingerprint == before.Fingerprint {
+		t.Error("fingerprint didn't change with the cloud directory")
+	}
+}
+
+func TestCheckCloudActivityRemote(t *testing.T) {
+	localConfig := newWebDAVConfig(t, nil)
+	cloudStorage := localConfig.CloudStorage()
+	if _, ok := storage.LocalPath(cloudStorage, ""); ok {
+		t.Fatal("WebDAV storage should not have a local path")
+	}
+	if err := cloudStorage.Write("configs/Shell/.zshrc", []byte("one"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := CheckCloudActivity(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Fingerprint == "" {
+		t.Fatal("remote storage has no fingerprint")
+	}
+	if first.Busy(time.Hour) {
+		t.Error("remote storages should never be busy")
+	}
+
+	again, err := CheckCloudActivity(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Fingerprint != first.Fingerprint {
+		t.Error("fingerprint changed without any change")
+	}
+
+	// The local folder of remote storages is ignored
+	if err := os.WriteFile(filepath.Join(localConfig.CloudSyncDir, "noise"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudStorage.Write("configs/Shell/.zshrc", []byte("two, longer"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := CheckCloudActivity(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Fingerprint == first.Fingerprint {
+		t.Error("fingerprint didn't change with the remote cloud copy")
+	}
+
+	if err := cloudStorage.Write(config.SyncItemsKey, []byte("{}"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	items, err := CheckCloudActivity(localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items.Fingerprint == changed.Fingerprint {
+		t.Error("fingerprint didn't change with the sync items")
+	}
+}
+
+// testFileInfo is the information of a regular file of the given name and size
+type testFileInfo struct {
+	name string
+	size int64
+}
+
+func (i testFileInfo) Name() string       { return i.name }
+func (i testFileInfo) Size() int64        { return i.size }
+func (i testFileInfo) Mode() fs.FileMode  { return 0644 }
+func (i testFileInfo) ModTime() time.Time { return time.Time{} }
+func (i testFileInfo) IsDir() bool        { return false }
+func (i testFileInfo) Sys() any           { return nil }
+
+func TestIsPendingFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int64
+		pending bool
+	}{
+		{".init.lua.~1a2b3c4d", 10, true},              // Nextcloud
+		{".syncthing.init.lua.tmp", 10, true},          // Syncthing
+		{"~syncthing~init.lua.tmp", 10, true},          // Syncthing on Windows
+		{"init.lua.!sync", 10, true},                   // Resilio Sync
+		{".init.lua.icloud", 10, true},                 // iCloud Drive
+		{"init.lua.cloud", 0, true},                    // odrive
+		{"Nvim.cloudf", 0, true},                       // odrive folder
+		{"init.lua", 10, false},                        // ordinary files
+		{".zshrc", 10, false},                          // dotfiles
+		{".vim.~backup", 10, false},                    // backups that only look like Nextcloud downloads
+		{".~lock.notes.odt#", 10, false},               // LibreOffice lock files
+		{"notes.md.~tmp", 10, false},                   // unknown temporary files
+		{"download.partial", 10, false},                // browser downloads
+		{".syncthing.init.lua", 10, false},             // not a Syncthing download
+		{"settings.cloud", 10, false},                  // files that aren't odrive stubs
+		{"backup.icloud", 10, false},                   // files that aren't iCloud placeholders
+		{".stfolder", 0, false},                        // Syncthing folder marker
+		{"init.sync-conflict-20260102.lua", 10, false}, // conflict copies are complete files
+	}
+	for _, test := range tests {
+		if got := isPendingFile(test.name, testFileInfo{name: test.name, size: test.size}); got != test.pending {
+			t.Errorf("isPendingFile(%q) = %v, want %v", test.name, got, test.pending)
+		}
+	}
+}
+
+func TestScanCloudActivity(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"configs/Shell/.zshrc":                        "export EDITOR=nvim",
+		"configs/Nvim/.init.lua.~1a2b3c4d":            "vim.o",
+		".git/objects/.syncthing.pack.tmp":            "ignored",
+		".dropbox.cache/.syncthing.init.lua.tmp":      "ignored",
+		"configs/Nvim/lua/.syncthing.plugins.lua.tmp": "ret",
+	})
+	old := time.Now().Add(-time.Hour)
+	if err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	activity, err := ScanCloudActivity(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"configs/Nvim/.init.lua.~1a2b3c4d", "configs/Nvim/lua/.syncthing.plugins.lua.tmp"}
+	if !reflect.DeepEqual(activity.Pending, want) {
+		t.Errorf("pending files = %v, want %v", activity.Pending, want)
+	}
+	if !activity.LastModified.Equal(old) {
+		t.Errorf("last modified = %v, want %v", activity.LastModified, old)
+	}
+	if !activity.Busy(time.Minute) {
+		t.Error("a directory with pending files should be busy")
+	}
+	if (CloudActivity{LastModified: old}).Busy(time.Minute) {
+		t.Error("a directory unchanged for an hour should not be busy")
+	}
+
+	// Any change of the files changes the fingerprint
+	writeFiles(t, dir, map[string]string{"configs/Shell/.zshrc": "export EDITOR=vim"})
+	changed, err := ScanCloudActivity(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Fingerprint == activity.Fingerprint {
+		t.Error("fingerprint didn't change with the cloud directory")
+	}
+	if _, err := ScanCloudActivity(filepath.Join(dir, "missing")); err == nil {
+		t.Error("a missing cloud directory was scanned")
+	}
+}
+
+func TestSettleDurations(t *testing.T) {
+	window, timeout := SettleDurations(&config.LocalConfig{})
+	if window != DefaultSettleWindow || timeout != DefaultSettleTimeout {
+		t.Errorf("default durations = %s, %s", window, timeout)
+	}
+	localConfig := &config.LocalConfig{Settle: config.SettleConfig{Window: 10, Timeout: 60}}
+	if window, timeout := SettleDurations(localConfig); window != 10*time.Second || timeout != time.Minute {
+		t.Errorf("configured durations = %s, %s", window, timeout)
+	}
+}
+
+func TestWaitForSettle(t *testing.T) {
+	localConfig := &config.LocalConfig{CloudSyncDir: t.TempDir(), Settle: config.SettleConfig{Timeout: 1}}
+	writeFiles(t, localConfig.CloudSyncDir, map[string]string{"configs/Nvim/.syncthing.init.lua.tmp": "vim.o"})
+
+	var waits int
+	err := WaitForSettle(localConfig, func(activity CloudActivity) { waits++ })
+	if !errors.Is(err, ErrNotSettled) {
+		t.Fatalf("WaitForSettle with a partial download = %v, want ErrNotSettled", err)
+	}
+	if waits == 0 {
+		t.Error("onWait wasn't called while waiting")
+	}
+
+	// Disabled checks and git mode don't wait
+	for _, skipped := range []*config.LocalConfig{
+		{CloudSyncDir: localConfig.CloudSyncDir, Settle: config.SettleConfig{Disabled: true}},
+		{CloudSyncDir: localConfig.CloudSyncDir, GitMode: true},
+	} {
+		if err := WaitForSettle(skipped, nil); err != nil {
+			t.Errorf("WaitForSettle(%+v) = %v", skipped, err)
+		}
+	}
+
+	// A directory that settled long ago doesn't wait either
+	if err := os.Remove(filepath.Join(localConfig.CloudSyncDir, "configs", "Nvim", ".syncthing.init.lua.tmp")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, path := range []string{localConfig.CloudSyncDir, filepath.Join(localConfig.CloudSyncDir, "configs"), filepath.Join(localConfig.CloudSyncDir, "configs", "Nvim")} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WaitForSettle(localConfig, func(CloudActivity) { t.Error("a settled directory was waited for") }); err != nil {
+		t.Error(err)
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/AntoineArt/syncstation/internal/config"
 	"github.com/AntoineArt/syncstation/internal/diff"
+	"github.com/AntoineArt/syncstation/internal/encryption"
+	"github.com/AntoineArt/syncstation/internal/objects"
+	"github.com/AntoineArt/syncstation/internal/secrets"
+	"github.com/AntoineArt/syncstation/internal/storage"
+	"github.com/AntoineArt/syncstation/internal/templating"
+	"github.com/AntoineArt/syncstation/internal/validation"
 )
 
 // SyncOperation represents a sync operation type
@@ -29,30 +36,55 @@ type SyncResult struct {
 	FilesErrored int
 	Errors       []string
 	Message      string
+	Files        []FileOutcome // Per-file outcomes in the order they happened
+	Hooks        []HookRun     // Hook commands run, with their output
 }
 
+// FileOutcome describes what happened to a single file during a sync
+type FileOutcome struct {
+	ItemName string
+	Path     string
+	Action   string // "pushed", "pulled", "linked", "hook", "skipped", "quarantined", "conflict", "resolved", "error"
+	Message  string
+}
+
+// FileOutcomeCallback is called every time a file outcome is recorded
+type FileOutcomeCallback func(outcome FileOutcome)
+
 // GitSafeOperationCallback represents a callback for git-safe operations
 type GitSafeOperationCallback func(localConfig *config.LocalConfig, filePath string, operation func() error) error
 
 // SyncEngine handles file synchronization operations
 type SyncEngine struct {
-	localConfig       *config.LocalConfig
-	diffEngine        *diff.DiffEngine
-	fileStatesPath    string
-	cloudMetadataPath string
-	gitCallback       config.GitOperationCallback // Callback for git operations
-	gitSafeCallback   GitSafeOperationCallback    // Callback for git-safe operations
+	localConfig     *config.LocalConfig
+	diffEngine      *diff.DiffEngine
+	fileStatesPath  string
+	storage         storage.Storage             // Storage holding the cloud copies
+	objects         *objects.Overlay            // Object store view of the storage
+	gitCallback     config.GitOperationCallback // Callback for git operations
+	gitSafeCallback GitSafeOperationCallback    // Callback for git-safe operations
+	outcomeCallback FileOutcomeCallback         // Callback for per-file progress
+	codec           *encryption.Codec           // Encrypts and decrypts cloud copies
+
+	resolveConflictCopies bool                       // Pushes and pulls delete provider conflict copies
+	conflictCopyFinder    *config.ConflictCopyFinder // Finds conflict copies, listing the configs directory once
+
+	metadataUpdates []func(metadata *config.FileMetadataData) // Cloud metadata changes of the item being synced
 }
 
 // NewSyncEngine creates a new sync engine
 func NewSyncEngine(localConfig *config.LocalConfig, diffEngine *diff.DiffEngine) *SyncEngine {
+	// Items kept in the object store are served from their manifest
+	overlay := objects.NewOverlay(localConfig.CloudStorage())
 	return &SyncEngine{
-		localConfig:       localConfig,
-		diffEngine:        diffEngine,
-		fileStatesPath:    filepath.Join(getConfigDir(localConfig), "file-states.json"),
-		cloudMetadataPath: localConfig.GetFileMetadataPath(),
-		gitCallback:       nil, // Will be set by caller if needed
-		gitSafeCallback:   nil, // Will be set by caller if needed
+		localConfig:     localConfig,
+		diffEngine:      diffEngine,
+		fileStatesPath:  filepath.Join(getConfigDir(localConfig), "file-states.json"),
+		storage:         overlay,
+		objects:         overlay,
+		gitCallback:     nil, // Will be set by caller if needed
+		gitSafeCallback: nil, // Will be set by caller if needed
+		codec:           encryption.NewCodec(localConfig),
 	}
 }
 
@@ -66,6 +98,217 @@ func (s *SyncEngine) SetGitSafeCallback(callback GitSafeOperationCallback) {
 	s.gitSafeCallback = callback
 }
 
+// SetFileOutcomeCallback sets the callback used to stream per-file outcomes
+func (s *SyncEngine) SetFileOutcomeCallback(callback FileOutcomeCallback) {
+	s.outcomeCallback = callback
+}
+
+// recordOutcome appends a file outcome to the result and notifies the callback
+func (s *SyncEngine) recordOutcome(result *SyncResult, itemName, path, action, message string) {
+	outcome := FileOutcome{
+		ItemName: itemName,
+		Path:     path,
+		Action:   action,
+		Message:  message,
+	}
+	result.Files = append(result.Files, outcome)
+	if s.outcomeCallback != nil {
+		s.outcomeCallback(outcome)
+	}
+}
+
+// copyOutcome returns the uploadDir callback recording each file of an item with action, or as skipped
+func (s *SyncEngine) copyOutcome(result *SyncResult, item *config.SyncItem, action string) func(path, skipped string) {
+	return func(path, skipped string) {
+		if skipped != "" {
+			result.Errors = append(result.Errors, fmt.Sprintf("warning: skipped %s: %s", path, skipped))
+			s.recordOutcome(result, item.Name, path, "skipped", skipped)
+			return
+		}
+		s.recordOutcome(result, item.Name, path, action, "")
+	}
+}
+
+// cloudEncoder returns the transform applied to an item's files when pushing, or nil if stored as is.
+// force encrypts the files even if the item isn't marked as encrypted.
+func (s *SyncEngine) cloudEncoder(item *config.SyncItem, force bool) func(data []byte) ([]byte, error) {
+	if force {
+		return s.codec.Encrypt
+	}
+	if !s.codec.ShouldEncrypt(item) {
+		return nil
+	}
+	return func(data []byte) ([]byte, error) {
+		return s.codec.Encode(item, data)
+	}
+}
+
+// CloudDecoder returns the decoder that turns the cloud copy of an item into the content
+// this computer should have: encrypted copies are decrypted and templates are rendered.
+// item may be nil when only decryption is needed.
+func CloudDecoder(localConfig *config.LocalConfig, item *config.SyncItem) diff.ContentDecoder {
+	return itemDecoder(encryption.NewCodec(localConfig), localConfig, item)
+}
+
+// TemplateData returns the template data of the current computer for an item, with the
+// computer's own variables overridden by the item's variables
+func TemplateData(localConfig *config.LocalConfig, item *config.SyncItem) templating.Data {
+	vars := item.GetComputerVars(localConfig.CurrentComputer)
+	if syncItems, err := config.LoadSyncItemsData(localConfig); err == nil {
+		vars = syncItems.TemplateVars(item, localConfig.CurrentComputer)
+	}
+	return templating.NewData(localConfig.CurrentComputer, vars)
+}
+
+// itemDecoder decrypts cloud content with codec and renders templates for the current computer
+func itemDecoder(codec *encryption.Codec, localConfig *config.LocalConfig, item *config.SyncItem) diff.ContentDecoder {
+	if item == nil || !item.Template {
+		return codec.Decode
+	}
+
+	return func(data []byte) ([]byte, error) {
+		content, err := codec.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		return templating.Render(item.Name, content, TemplateData(localConfig, item))
+	}
+}
+
+// pushTemplate updates the cloud template of an item with the local edits of its rendered file.
+// It returns the hash of the new template.
+func (s *SyncEngine) pushTemplate(item *config.SyncItem, localPath, cloudKey string, forceEncrypt bool) (string, error) {
+	local, err := os.ReadFile(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	// The first push stores the file as is
+	content := local
+	if storage.Exists(s.storage, cloudKey) {
+		stored, err := s.storage.Read(cloudKey)
+		if err != nil {
+			return "", err
+		}
+		current, err := s.codec.Decode(stored)
+		if err != nil {
+			return "", err
+		}
+		rendered, err := itemDecoder(s.codec, s.localConfig, item)(stored)
+		if err != nil {
+			return "", err
+		}
+
+		content, err = templating.Apply(current, rendered, local)
+		if err != nil {
+			return "", fmt.Errorf("%w: edit the template with 'syncstation template edit %s'", err, item.Name)
+		}
+	}
+
+	// Never store a template that no longer renders on this computer
+	if _, err := templating.Render(item.Name, content, TemplateData(s.localConfig, item)); err != nil {
+		return "", err
+	}
+
+	data := content
+	if encode := s.cloudEncoder(item, forceEncrypt); encode != nil {
+		if data, err = encode(content); err != nil {
+			return "", err
+		}
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	err = s.storage.Write(cloudKey, data, storage.WriteOptions{
+		Mode:    privateMode(cloudKey, info.Mode().Perm()),
+		ModTime: info.ModTime(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return config.CalculateHash(content), nil
+}
+
+// secretPolicy returns the secret policy of an item, falling back to the local default
+func (s *SyncEngine) secretPolicy(item *config.SyncItem) string {
+	if item.SecretPolicy != "" {
+		return item.SecretPolicy
+	}
+	if s.localConfig.SecretPolicy != "" {
+		return s.localConfig.SecretPolicy
+	}
+	return secrets.DefaultPolicy
+}
+
+// checkSecrets scans an item before it is pushed and applies its secret policy.
+// It returns true when the item must be pushed encrypted.
+func (s *SyncEngine) checkSecrets(item *config.SyncItem, localPath string, result *SyncResult) (bool, error) {
+	policy := s.secretPolicy(item)
+	if !secrets.ValidPolicy(policy) {
+		return false, fmt.Errorf("unknown secret policy: %s", policy)
+	}
+
+	// Encrypted content never leaves the machine in plaintext
+	if policy == secrets.PolicyOff || s.codec.ShouldEncrypt(item) {
+		return false, nil
+	}
+
+	scanner, err := secrets.NewDefaultScanner(item.SecretPatterns)
+	if err != nil {
+		return false, err
+	}
+	scanner.SetExclude(item.IsExcluded)
+
+	findings, err := scanner.ScanPath(localPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to scan for secrets: %w", err)
+	}
+	if len(findings) == 0 {
+		return false, nil
+	}
+
+	summary := summarizeFindings(findings)
+	switch policy {
+	case secrets.PolicyBlock:
+		return false, fmt.Errorf("push blocked, %s (run 'syncstation scan %s' for details)", summary, item.Name)
+	case secrets.PolicyEncrypt:
+		if err := s.codec.CanEncrypt(); err != nil {
+			return false, fmt.Errorf("push blocked, %s and the item can't be encrypted: %w", summary, err)
+		}
+		if item.UsesObjectStore() {
+			return false, fmt.Errorf("push blocked, %s and items in the object store can't be encrypted", summary)
+		}
+		result.Errors = append(result.Errors, fmt.Sprintf("warning: %s - pushed encrypted", summary))
+		return true, nil
+	default:
+		result.Errors = append(result.Errors, fmt.Sprintf("warning: %s (run 'syncstation scan %s' for details)", summary, item.Name))
+		return false, nil
+	}
+}
+
+// summarizeFindings describes the first few findings of a scan in one line
+func summarizeFindings(findings []secrets.Finding) string {
+	const maxListed = 3
+
+	var listed []string
+	for i, finding := range findings {
+		if i == maxListed {
+			listed = append(listed, fmt.Sprintf("and %d more", len(findings)-maxListed))
+			break
+		}
+		listed = append(listed, fmt.Sprintf("%s in %s:%d", finding.Reason, filepath.Base(finding.Path), finding.Line))
+	}
+
+	noun := "secrets"
+	if len(findings) == 1 {
+		noun = "secret"
+	}
+	return fmt.Sprintf("%d possible %s found (%s)", len(findings), noun, strings.Join(listed, ", "))
+}
+
 // getConfigDir returns the appropriate config directory for the platform
 func getConfigDir(localConfig *config.LocalConfig) string {
 	// This should match the logic in main.go getConfigDir()
@@ -86,11 +329,11 @@ func (s *SyncEngine) loadFileStates() (*config.FileStatesData, error) {
 
 // loadCloudMetadata loads the cloud metadata, creating empty data if file doesn't exist
 func (s *SyncEngine) loadCloudMetadata() (*config.FileMetadataData, error) {
-	// Use git-aware loading when in git mode
-	return config.LoadFileMetadataDataGitAware(s.localConfig, s.cloudMetadataPath)
+	return config.LoadCloudFileMetadata(s.localConfig)
 }
 
-// updateFileMetadata updates both local and cloud metadata after a successful file operation
+// updateFileMetadata updates the local file state after a successful file operation, and
+// queues the matching cloud metadata update
 func (s *SyncEngine) updateFileMetadata(itemName, filePath string, fileInfo os.FileInfo, fileHash string) error {
 	// Load current metadata
 	fileStates, err := s.loadFileStates()
@@ -98,36 +341,66 @@ func (s *SyncEngine) updateFileMetadata(itemName, filePath string, fileInfo os.F
 		return fmt.Errorf("failed to load file states: %w", err)
 	}
 
-	cloudMetadata, err := s.loadCloudMetadata()
-	if err != nil {
-		return fmt.Errorf("failed to load cloud metadata: %w", err)
-	}
-
 	// Update local file state
 	fileStates.UpdateFileState(itemName, filePath, fileHash, fileInfo.ModTime(), fileInfo.Size())
-
-	// Update cloud metadata
-	cloudMetadata.UpdateFileMetadata(itemName, filePath, s.localConfig.CurrentComputer, fileHash, fileInfo.ModTime())
-
-	// Save both files
 	if err := fileStates.SaveFileStatesData(s.fileStatesPath); err != nil {
 		return fmt.Errorf("failed to save file states: %w", err)
 	}
 
-	if err := cloudMetadata.SaveFileMetadataDataGitAware(s.localConfig, s.cloudMetadataPath); err != nil {
-		return fmt.Errorf("failed to save cloud metadata: %w", err)
+	s.queueMetadata(func(cloudMetadata *config.FileMetadataData) {
+		cloudMetadata.UpdateFileMetadata(itemName, filePath, s.localConfig.CurrentComputer, fileHash, fileInfo.ModTime())
+	})
+	return nil
+}
+
+// updateFileAttributes queues recording the permission bits and owner of pushed files in
+// the cloud metadata
+func (s *SyncEngine) updateFileAttributes(itemName string, files map[string]os.FileInfo) {
+	if len(files) == 0 {
+		return
 	}
 
-	return nil
+	s.queueMetadata(func(cloudMetadata *config.FileMetadataData) {
+		for filePath, info := range files {
+			cloudMetadata.SetFileAttributes(itemName, filePath, info.Mode(), fileOwner(info))
+		}
+	})
 }
 
-// updateCloudHash updates the cloud hash in metadata after a push operation
-func (s *SyncEngine) updateCloudHash(itemName, filePath, cloudHash string, cloudModTime time.Time) error {
-	cloudMetadata, err := s.loadCloudMetadata()
-	if err != nil {
-		return fmt.Errorf("failed to load cloud metadata: %w", err)
+// updateCloudHash queues recording the cloud hash in metadata after a push operation
+func (s *SyncEngine) updateCloudHash(itemName, filePath, cloudHash string, cloudInfo storage.FileInfo) {
+	s.queueMetadata(func(cloudMetadata *config.FileMetadataData) {
+		setCloudHash(cloudMetadata, itemName, filePath, cloudHash, cloudInfo, s.localConfig.CurrentComputer)
+	})
+}
+
+// queueMetadata adds a change to the cloud metadata of the item being synced. Changes are
+// saved together once the item is synced, so that each item costs a single metadata write.
+func (s *SyncEngine) queueMetadata(update func(metadata *config.FileMetadataData)) {
+	s.metadataUpdates = append(s.metadataUpdates, update)
+}
+
+// saveMetadata saves the queued cloud metadata changes in a single update, or drops them
+// when the sync failed
+func (s *SyncEngine) saveMetadata(result *SyncResult, err error) {
+	updates := s.metadataUpdates
+	s.metadataUpdates = nil
+	if err != nil || len(updates) == 0 {
+		return
 	}
 
+	err = config.UpdateCloudFileMetadata(s.localConfig, func(cloudMetadata *config.FileMetadataData) {
+		for _, update := range updates {
+			update(cloudMetadata)
+		}
+	})
+	if err != nil && result != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to save cloud metadata: %v", err))
+	}
+}
+
+// setCloudHash records the hash, modification time and ETag of the cloud copy of a file
+func setCloudHash(cloudMetadata *config.FileMetadataData, itemName, filePath, cloudHash string, cloudInfo storage.FileInfo, computer string) {
 	// Initialize maps if needed
 	if cloudMetadata.Metadata == nil {
 		cloudMetadata.Metadata = make(map[string]map[string]*config.FileMetadata)
@@ -143,11 +416,10 @@ func (s *SyncEngine) updateCloudHash(itemName, filePath, cloudHash string, cloud
 
 	// Update cloud-specific metadata
 	cloudMetadata.Metadata[itemName][filePath].CloudHash = cloudHash
-	cloudMetadata.Metadata[itemName][filePath].CloudModTime = cloudModTime.Format(time.RFC3339)
-	cloudMetadata.Metadata[itemName][filePath].UpdatedBy = s.localConfig.CurrentComputer
+	cloudMetadata.Metadata[itemName][filePath].CloudModTime = cloudInfo.ModTime.Format(time.RFC3339)
+	cloudMetadata.Metadata[itemName][filePath].CloudETag = cloudInfo.ETag
+	cloudMetadata.Metadata[itemName][filePath].UpdatedBy = computer
 	cloudMetadata.Metadata[itemName][filePath].LastUpdated = time.Now().Format(time.RFC3339)
-
-	return cloudMetadata.SaveFileMetadataDataGitAware(s.localConfig, s.cloudMetadataPath)
 }
 
 // isFileChanged checks if a file has changed since last sync by comparing hashes
@@ -190,6 +462,8 @@ func (s *SyncEngine) SyncAll(operation SyncOperation, syncItems []*config.SyncIt
 		result.FilesSkipped += itemResult.FilesSkipped
 		result.FilesErrored += itemResult.FilesErrored
 		result.Errors = append(result.Errors, itemResult.Errors...)
+		result.Files = append(result.Files, itemResult.Files...)
+		result.Hooks = append(result.Hooks, itemResult.Hooks...)
 	}
 
 	if result.FilesErrored > 0 {
@@ -210,29 +484,87 @@ func (s *SyncEngine) SyncItem(operation SyncOperation, item *config.SyncItem) (*
 		return nil, fmt.Errorf("no path configured for computer '%s'", s.localConfig.CurrentComputer)
 	}
 
-	cloudPath := item.GetCloudPath(s.localConfig.GetCloudConfigsPath())
+	cloudKey := item.CloudKey()
+
+	if item.Template && item.Type != "file" {
+		return nil, fmt.Errorf("templates are only supported for file items")
+	}
+	if err := s.trackObjects(item); err != nil {
+		return nil, err
+	}
+
+	// Conflict copies made by the cloud provider hold changes that one of the versions lacks.
+	// Smart syncs can't pick a version for the user, so they leave the item alone until the
+	// copies are gone, while pushes and pulls report them, or delete them when resolving.
+	copies, err := s.conflictCopies(item)
+	if err != nil {
+		return nil, err
+	}
+	if len(copies) > 0 && operation == SyncSmart {
+		result := &SyncResult{
+			Operation: operation,
+			Success:   true,
+			Errors:    make([]string, 0),
+			Message:   fmt.Sprintf("Conflict detected for %s - the cloud provider made conflict copies", item.Name),
+		}
+		s.recordConflictCopies(result, item, localPath, copies)
+		return result, nil
+	}
+
+	result, err := s.syncItem(operation, item, localPath, cloudKey)
+	err = s.commitObjects(err)
+	s.saveMetadata(result, err)
+	if err != nil || len(copies) == 0 {
+		return result, err
+	}
+	if s.resolveConflictCopies {
+		s.deleteConflictCopies(result, item, localPath, copies)
+	} else {
+		s.recordConflictCopies(result, item, localPath, copies)
+	}
+	return result, nil
+}
+
+// syncItem performs sync operation on a single sync item at localPath and cloudKey
+func (s *SyncEngine) syncItem(operation SyncOperation, item *config.SyncItem, localPath, cloudKey string) (*SyncResult, error) {
+
+	if item.Deploy == config.DeployLink {
+		return s.syncLinkedItem(operation, item, localPath, cloudKey)
+	}
+
+	// Items switched back to copies replace their link with a copy first
+	if cloudPath, ok := storage.LocalPath(s.storage, cloudKey); ok && isLinkedTo(localPath, cloudPath) {
+		if err := s.unlinkItem(item, localPath, cloudKey); err != nil {
+			return nil, fmt.Errorf("failed to replace link with a copy: %w", err)
+		}
+	}
 
 	// Perform sync based on operation type
 	switch operation {
 	case SyncPush:
-		return s.pushItem(item, localPath, cloudPath)
+		return s.pushItem(item, localPath, cloudKey)
 	case SyncPull:
-		return s.pullItem(item, localPath, cloudPath)
+		return s.pullItem(item, localPath, cloudKey)
 	case SyncSmart:
-		return s.smartSyncItem(item, localPath, cloudPath)
+		return s.smartSyncItem(item, localPath, cloudKey)
 	default:
 		return nil, fmt.Errorf("unknown sync operation: %d", operation)
 	}
 }
 
 // pushItem pushes a single item from local to cloud
-func (s *SyncEngine) pushItem(item *config.SyncItem, localPath, cloudPath string) (*SyncResult, error) {
+func (s *SyncEngine) pushItem(item *config.SyncItem, localPath, cloudKey string) (*SyncResult, error) {
 	result := &SyncResult{
 		Operation: SyncPush,
 		Success:   true,
 		Errors:    make([]string, 0),
 	}
 
+	// Pre-push hooks run first so that they can prepare the local files
+	if err := s.runHooks(result, item, HookPrePush, localPath, cloudKey); err != nil {
+		return nil, err
+	}
+
 	if !config.PathExists(localPath) {
 		return nil, fmt.Errorf("local path does not exist: %s", localPath)
 	}
@@ -245,13 +577,20 @@ func (s *SyncEngine) pushItem(item *config.SyncItem, localPath, cloudPath string
 		} else if !changed {
 			result.Message = fmt.Sprintf("%s unchanged - skipped", item.Name)
 			result.FilesSkipped = 1
+			s.recordOutcome(result, item.Name, localPath, "skipped", "unchanged")
 			return result, nil
 		}
 	}
 
-	// Check git staging before operation
+	// Scan for secrets before any content leaves the machine
+	forceEncrypt, err := s.checkSecrets(item, localPath, result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check git staging of the cloud copy before overwriting it
 	if s.gitCallback != nil {
-		if err := s.gitCallback(s.localConfig, localPath, "pre_sync_backup"); err != nil {
+		if err := s.gitCallback(s.localConfig, s.storage.Location(cloudKey), "pre_sync_backup"); err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("git warning: %v", err))
 		}
 	}
@@ -259,12 +598,18 @@ func (s *SyncEngine) pushItem(item *config.SyncItem, localPath, cloudPath string
 	// Copy based on item type
 	if item.Type == "file" {
 		// Perform git-safe file operation
+		var templateHash string
 		copyOperation := func() error {
-			return copyFile(localPath, cloudPath)
+			if item.Template {
+				var err error
+				templateHash, err = s.pushTemplate(item, localPath, cloudKey, forceEncrypt)
+				return err
+			}
+			return s.upload(localPath, cloudKey, s.cloudEncoder(item, forceEncrypt))
 		}
 
 		if s.gitSafeCallback != nil {
-			if err := s.gitSafeCallback(s.localConfig, localPath, copyOperation); err != nil {
+			if err := s.gitSafeCallback(s.localConfig, s.storage.Location(cloudKey), copyOperation); err != nil {
 				return nil, fmt.Errorf("failed to copy file: %w", err)
 			}
 		} else {
@@ -275,7 +620,7 @@ func (s *SyncEngine) pushItem(item *config.SyncItem, localPath, cloudPath string
 
 		// Coordinate git staging for the synced file
 		if s.gitCallback != nil {
-			if err := s.gitCallback(s.localConfig, cloudPath, "sync_add"); err != nil {
+			if err := s.gitCallback(s.localConfig, s.storage.Location(cloudKey), "sync_add"); err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("git staging warning: %v", err))
 			}
 		}
@@ -295,40 +640,89 @@ func (s *SyncEngine) pushItem(item *config.SyncItem, localPath, cloudPath string
 				}
 
 				// Update cloud metadata with cloud file hash
-				cloudInfo, err := os.Stat(cloudPath)
-				if err == nil {
-					if err := s.updateCloudHash(item.Name, localPath, localHash, cloudInfo.ModTime()); err != nil {
-						result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to update cloud hash: %v", err))
-					}
+				cloudHash := localHash
+				if item.Template {
+					cloudHash = templateHash
+				}
+				if cloudInfo, err := s.storage.Stat(cloudKey); err == nil {
+					s.updateCloudHash(item.Name, localPath, cloudHash, cloudInfo)
 				}
 			}
+
+			// Cloud providers drop permission bits, so keep them in the metadata
+			s.updateFileAttributes(item.Name, map[string]os.FileInfo{localPath: localInfo})
 		}
 
 		result.FilesChanged = 1
+		s.recordOutcome(result, item.Name, localPath, "pushed", "")
 	} else {
-		if err := copyDir(localPath, cloudPath); err != nil {
+		// Files of folder items are recorded by their path inside the item
+		attributes := make(map[string]os.FileInfo)
+		recordOutcome := s.copyOutcome(result, item, "pushed")
+		err := s.uploadDir(localPath, cloudKey, s.cloudEncoder(item, forceEncrypt), item.IsExcluded, func(path, skipped string) {
+			recordOutcome(path, skipped)
+			info, err := os.Lstat(path)
+			if skipped != "" || err != nil || !info.Mode().IsRegular() {
+				return
+			}
+			if rel, err := filepath.Rel(localPath, path); err == nil {
+				attributes[filepath.ToSlash(rel)] = info
+			}
+		})
+		if err != nil {
 			return nil, fmt.Errorf("failed to copy directory: %w", err)
 		}
 
+		s.updateFileAttributes(item.Name, attributes)
+
 		// For directories, we'd need to recursively update metadata for all files
 		// For now, just mark the directory operation as successful
 		result.FilesChanged = 1
 	}
 
+	if err := s.runHooks(result, item, HookPostPush, localPath, cloudKey); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("warning: %v", err))
+	}
+
 	result.Message = fmt.Sprintf("Pushed %s to cloud", item.Name)
 	return result, nil
 }
 
 // pullItem pulls a single item from cloud to local
-func (s *SyncEngine) pullItem(item *config.SyncItem, localPath, cloudPath string) (*SyncResult, error) {
+func (s *SyncEngine) pullItem(item *config.SyncItem, localPath, cloudKey string) (*SyncResult, error) {
 	result := &SyncResult{
 		Operation: SyncPull,
 		Success:   true,
 		Errors:    make([]string, 0),
 	}
 
-	if !config.PathExists(cloudPath) {
-		return nil, fmt.Errorf("cloud path does not exist: %s", cloudPath)
+	if !storage.Exists(s.storage, cloudKey) {
+		return nil, fmt.Errorf("cloud path does not exist: %s", s.storage.Location(cloudKey))
+	}
+
+	// Validate the incoming version before anything on this computer is touched
+	staged, failures, err := s.stageIncoming(result, item, localPath, cloudKey)
+	if err != nil {
+		return nil, err
+	}
+	if staged != "" {
+		defer os.RemoveAll(filepath.Dir(staged))
+	}
+	if len(failures) > 0 {
+		if item.OnInvalid != validation.PolicyQuarantine {
+			return nil, refuseInvalid(failures)
+		}
+		if err := s.quarantineInvalid(result, item, staged, localPath, failures); err != nil {
+			return nil, err
+		}
+		if item.Type == "file" {
+			result.Message = fmt.Sprintf("Kept %s, the incoming version is invalid", item.Name)
+			return result, nil
+		}
+	}
+
+	if err := s.runHooks(result, item, HookPrePull, localPath, cloudKey); err != nil {
+		return nil, err
 	}
 
 	// Check git staging before operation
@@ -342,7 +736,10 @@ func (s *SyncEngine) pullItem(item *config.SyncItem, localPath, cloudPath string
 	if item.Type == "file" {
 		// Perform git-safe file operation
 		copyOperation := func() error {
-			return copyFile(cloudPath, localPath)
+			if staged != "" {
+				return download(stagedStorage(staged), filepath.Base(staged), localPath, nil)
+			}
+			return download(s.storage, cloudKey, localPath, itemDecoder(s.codec, s.localConfig, item))
 		}
 
 		if s.gitSafeCallback != nil {
@@ -362,6 +759,15 @@ func (s *SyncEngine) pullItem(item *config.SyncItem, localPath, cloudPath string
 			}
 		}
 
+		// Restore the permission bits recorded on push
+		if cloudMetadata, err := s.loadCloudMetadata(); err == nil {
+			if mode, owner, ok := cloudMetadata.LatestFileMode(item.Name); ok {
+				if err := s.restoreAttributes(localPath, mode, owner); err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to restore file mode: %v", err))
+				}
+			}
+		}
+
 		// Update metadata for the pulled file
 		localInfo, err := os.Stat(localPath)
 		if err != nil {
@@ -378,8 +784,43 @@ func (s *SyncEngine) pullItem(item *config.SyncItem, localPath, cloudPath string
 		}
 
 		result.FilesChanged = 1
+		s.recordOutcome(result, item.Name, localPath, "pulled", "")
 	} else {
-		if err := copyDir(cloudPath, localPath); err != nil {
+		cloudMetadata, err := s.loadCloudMetadata()
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to load cloud metadata: %v", err))
+			cloudMetadata = config.NewFileMetadataData()
+		}
+
+		// Validated items are pulled from their checked, already decoded copy
+		source, sourceKey, decode := s.storage, cloudKey, s.codec.Decode
+		if staged != "" {
+			source, sourceKey, decode = stagedStorage(staged), filepath.Base(staged), nil
+		}
+
+		// Excluded files and conflict copies, which stay in the cloud until they are
+		// resolved, are left out
+		exclude, err := s.pullExclusions(item)
+		if err != nil {
+			return nil, err
+		}
+
+		// Files are recorded by their cloud location, and get the permission bits
+		// recorded on push restored
+		recordOutcome := s.copyOutcome(result, item, "pulled")
+		err = downloadDir(source, sourceKey, localPath, decode, exclude, func(rel, skipped string) {
+			recordOutcome(s.storage.Location(storage.Join(cloudKey, rel)), skipped)
+			path := filepath.Join(localPath, filepath.FromSlash(rel))
+			if skipped != "" || config.IsSymlink(path) {
+				return
+			}
+			if mode, owner, ok := cloudMetadata.GetFileMode(item.Name, rel); ok {
+				if err := s.restoreAttributes(path, mode, owner); err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to restore mode of %s: %v", rel, err))
+				}
+			}
+		})
+		if err != nil {
 			return nil, fmt.Errorf("failed to copy directory: %w", err)
 		}
 
@@ -387,12 +828,16 @@ func (s *SyncEngine) pullItem(item *config.SyncItem, localPath, cloudPath string
 		result.FilesChanged = 1
 	}
 
+	if err := s.runHooks(result, item, HookPostPull, localPath, cloudKey); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("warning: %v", err))
+	}
+
 	result.Message = fmt.Sprintf("Pulled %s from cloud", item.Name)
 	return result, nil
 }
 
 // smartSyncItem performs intelligent bidirectional sync
-func (s *SyncEngine) smartSyncItem(item *config.SyncItem, localPath, cloudPath string) (*SyncResult, error) {
+func (s *SyncEngine) smartSyncItem(item *config.SyncItem, localPath, cloudKey string) (*SyncResult, error) {
 	result := &SyncResult{
 		Operation: SyncSmart,
 		Success:   true,
@@ -400,7 +845,7 @@ func (s *SyncEngine) smartSyncItem(item *config.SyncItem, localPath, cloudPath s
 	}
 
 	localExists := config.PathExists(localPath)
-	cloudExists := config.PathExists(cloudPath)
+	cloudExists := storage.Exists(s.storage, cloudKey)
 
 	// Handle different scenarios
 	if !localExists && !cloudExists {
@@ -410,24 +855,24 @@ func (s *SyncEngine) smartSyncItem(item *config.SyncItem, localPath, cloudPath s
 
 	if localExists && !cloudExists {
 		// Local only - push to cloud
-		return s.pushItem(item, localPath, cloudPath)
+		return s.pushItem(item, localPath, cloudKey)
 	}
 
 	if !localExists && cloudExists {
 		// Cloud only - pull to local
-		return s.pullItem(item, localPath, cloudPath)
+		return s.pullItem(item, localPath, cloudKey)
 	}
 
 	// Both exist - use intelligent hash-based comparison
 	if item.Type == "file" {
-		return s.smartSyncFile(item, localPath, cloudPath)
+		return s.smartSyncFile(item, localPath, cloudKey)
 	} else {
-		return s.smartSyncDirectory(item, localPath, cloudPath)
+		return s.smartSyncDirectory(item, localPath, cloudKey)
 	}
 }
 
 // smartSyncFile performs intelligent sync for a single file using hash comparison
-func (s *SyncEngine) smartSyncFile(item *config.SyncItem, localPath, cloudPath string) (*SyncResult, error) {
+func (s *SyncEngine) smartSyncFile(item *config.SyncItem, localPath, cloudKey string) (*SyncResult, error) {
 	result := &SyncResult{
 		Operation: SyncSmart,
 		Success:   true,
@@ -440,13 +885,55 @@ func (s *SyncEngine) smartSyncFile(item *config.SyncItem, localPath, cloudPath s
 		return nil, fmt.Errorf("failed to calculate local file hash: %w", err)
 	}
 
-	cloudHash, err := config.CalculateFileHash(cloudPath)
+	cloudInfo, err := s.storage.Stat(cloudKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat cloud file: %w", err)
+	}
+
+	// Load cloud metadata to check sync history
+	cloudMetadata, err := s.loadCloudMetadata()
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate cloud file hash: %w", err)
+		result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to load cloud metadata: %v", err))
+	}
+
+	// Check if we have metadata for this file
+	var lastKnownCloudHash, lastKnownCloudETag string
+	if cloudMetadata != nil {
+		if itemMetadata, exists := cloudMetadata.Metadata[item.Name]; exists {
+			if fileMetadata, exists := itemMetadata[localPath]; exists {
+				lastKnownCloudHash = fileMetadata.CloudHash
+				lastKnownCloudETag = fileMetadata.CloudETag
+			}
+		}
+	}
+
+	// An unchanged ETag means the cloud copy is the one last synced, so storages with
+	// ETags don't need to download it to hash it
+	cloudHash := lastKnownCloudHash
+	if item.Template || cloudInfo.ETag == "" || cloudInfo.ETag != lastKnownCloudETag || cloudHash == "" {
+		// Hash the plaintext so encrypted cloud copies compare equal to local files
+		cloudHash, err = s.codec.HashFile(s.storage, cloudKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate cloud file hash: %w", err)
+		}
+	}
+
+	// Templates are compared with their rendering for this computer
+	renderedHash := cloudHash
+	if item.Template {
+		stored, err := s.storage.Read(cloudKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cloud file: %w", err)
+		}
+		rendered, err := itemDecoder(s.codec, s.localConfig, item)(stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render template: %w", err)
+		}
+		renderedHash = config.CalculateHash(rendered)
 	}
 
 	// If hashes are the same, files are identical
-	if localHash == cloudHash {
+	if localHash == renderedHash {
 		// Update metadata if needed (in case we missed previous sync)
 		localInfo, err := os.Stat(localPath)
 		if err == nil {
@@ -457,6 +944,7 @@ func (s *SyncEngine) smartSyncFile(item *config.SyncItem, localPath, cloudPath s
 
 		result.Message = fmt.Sprintf("%s is already in sync (hash match)", item.Name)
 		result.FilesSkipped = 1
+		s.recordOutcome(result, item.Name, localPath, "skipped", "already in sync")
 		return result, nil
 	}
 
@@ -466,63 +954,44 @@ func (s *SyncEngine) smartSyncFile(item *config.SyncItem, localPath, cloudPath s
 		return nil, fmt.Errorf("failed to stat local file: %w", err)
 	}
 
-	cloudInfo, err := os.Stat(cloudPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to stat cloud file: %w", err)
-	}
-
-	// Load cloud metadata to check sync history
-	cloudMetadata, err := s.loadCloudMetadata()
-	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("warning: failed to load cloud metadata: %v", err))
-	}
-
-	// Check if we have metadata for this file
-	var lastKnownCloudHash string
-	if cloudMetadata != nil {
-		if itemMetadata, exists := cloudMetadata.Metadata[item.Name]; exists {
-			if fileMetadata, exists := itemMetadata[localPath]; exists {
-				lastKnownCloudHash = fileMetadata.CloudHash
-			}
-		}
-	}
-
 	// Decision logic based on timestamps and metadata
 	if lastKnownCloudHash != "" && lastKnownCloudHash == cloudHash {
 		// Cloud hasn't changed since last sync, local must be newer
 		result.Message = fmt.Sprintf("Local modified for %s - pushing to cloud", item.Name)
-		return s.pushItem(item, localPath, cloudPath)
+		return s.pushItem(item, localPath, cloudKey)
 	} else if lastKnownCloudHash != "" && lastKnownCloudHash != cloudHash {
 		// Cloud has changed since last sync
-		if localInfo.ModTime().After(cloudInfo.ModTime()) {
+		if localInfo.ModTime().After(cloudInfo.ModTime) {
 			// Local is newer by timestamp - potential conflict
 			result.Message = fmt.Sprintf("Conflict detected for %s - both files modified", item.Name)
 			result.Errors = append(result.Errors, "Both local and cloud files have been modified since last sync")
+			s.recordOutcome(result, item.Name, localPath, "conflict", "both local and cloud modified since last sync")
 			return result, nil
 		} else {
 			// Cloud is newer - pull from cloud
 			result.Message = fmt.Sprintf("Cloud modified for %s - pulling to local", item.Name)
-			return s.pullItem(item, localPath, cloudPath)
+			return s.pullItem(item, localPath, cloudKey)
 		}
 	} else {
 		// No previous metadata - fall back to timestamp comparison
-		if localInfo.ModTime().After(cloudInfo.ModTime()) {
+		if localInfo.ModTime().After(cloudInfo.ModTime) {
 			result.Message = fmt.Sprintf("Local newer for %s - pushing to cloud", item.Name)
-			return s.pushItem(item, localPath, cloudPath)
-		} else if cloudInfo.ModTime().After(localInfo.ModTime()) {
+			return s.pushItem(item, localPath, cloudKey)
+		} else if cloudInfo.ModTime.After(localInfo.ModTime()) {
 			result.Message = fmt.Sprintf("Cloud newer for %s - pulling to local", item.Name)
-			return s.pullItem(item, localPath, cloudPath)
+			return s.pullItem(item, localPath, cloudKey)
 		} else {
 			// Same timestamp but different hashes - conflict
 			result.Message = fmt.Sprintf("Conflict detected for %s - same timestamp, different content", item.Name)
 			result.Errors = append(result.Errors, "Files have same timestamp but different content - manual resolution needed")
+			s.recordOutcome(result, item.Name, localPath, "conflict", "same timestamp, different content")
 			return result, nil
 		}
 	}
 }
 
 // smartSyncDirectory performs intelligent sync for directories (simplified for now)
-func (s *SyncEngine) smartSyncDirectory(item *config.SyncItem, localPath, cloudPath string) (*SyncResult, error) {
+func (s *SyncEngine) smartSyncDirectory(item *config.SyncItem, localPath, cloudKey string) (*SyncResult, error) {
 	result := &SyncResult{
 		Operation: SyncSmart,
 		Success:   true,
@@ -536,26 +1005,27 @@ func (s *SyncEngine) smartSyncDirectory(item *config.SyncItem, localPath, cloudP
 		return nil, fmt.Errorf("failed to stat local directory: %w", err)
 	}
 
-	cloudInfo, err := os.Stat(cloudPath)
+	cloudInfo, err := s.storage.Stat(cloudKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat cloud directory: %w", err)
 	}
 
-	if localInfo.ModTime().After(cloudInfo.ModTime()) {
+	if localInfo.ModTime().After(cloudInfo.ModTime) {
 		result.Message = fmt.Sprintf("Local directory newer for %s - pushing to cloud", item.Name)
-		return s.pushItem(item, localPath, cloudPath)
-	} else if cloudInfo.ModTime().After(localInfo.ModTime()) {
+		return s.pushItem(item, localPath, cloudKey)
+	} else if cloudInfo.ModTime.After(localInfo.ModTime()) {
 		result.Message = fmt.Sprintf("Cloud directory newer for %s - pulling to local", item.Name)
-		return s.pullItem(item, localPath, cloudPath)
+		return s.pullItem(item, localPath, cloudKey)
 	} else {
 		result.Message = fmt.Sprintf("Directory %s appears in sync", item.Name)
 		result.FilesSkipped = 1
+		s.recordOutcome(result, item.Name, localPath, "skipped", "appears in sync")
 	}
 
 	return result, nil
 }
 
-// copyFile copies a single file from src to dst
+// copyFile copies a single file from src to dst, keeping its permissions and modification time
 func copyFile(src, dst string) error {
 	// Ensure destination directory exists
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
@@ -579,49 +1049,25 @@ func copyFile(src, dst string) error {
 		return err
 	}
 
-	// Copy file permissions
+	// Copy file permissions and modification time
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
 
-	return os.Chmod(dst, srcInfo.Mode())
+	return copyAttributes(dst, srcInfo)
 }
 
-// copyDir recursively copies a directory from src to dst
-func copyDir(src, dst string) error {
-	// Get source directory info
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-
-	// Create destination directory
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
+// copyAttributes applies the permissions and modification time of a source file to dst.
+// Sensitive files lose group and other permissions.
+func copyAttributes(dst string, srcInfo os.FileInfo) error {
+	if err := os.Chmod(dst, privateMode(dst, srcInfo.Mode())); err != nil {
 		return err
 	}
+	return os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+}
 
-	// Read source directory
-	entries, err := os.ReadDir(src)
-	if err != nil {
-		return err
-	}
-
-	// Copy each entry
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
-
-		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			if err := copyFile(srcPath, dstPath); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
+// stagedStorage returns a storage reading the staged copy of an item by its base name
+func stagedStorage(staged string) storage.Storage {
+	return storage.NewLocal(filepath.Dir(staged))
 }
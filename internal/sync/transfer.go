@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+)
+
+// upload writes the local file src to key in the cloud storage, passing its content through
+// transform, and keeps its permissions and modification time. A nil transform stores it as is.
+func (s *SyncEngine) upload(src, key string, transform func(data []byte) ([]byte, error)) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if transform != nil {
+		if data, err = transform(data); err != nil {
+			return err
+		}
+	}
+
+	return s.storage.Write(key, data, storage.WriteOptions{
+		Mode:    privateMode(key, info.Mode().Perm()),
+		ModTime: info.ModTime(),
+	})
+}
+
+// uploadDir recursively writes the local directory src to key in the cloud storage, passing
+// file contents through transform and keeping permissions and modification times. Symlinks
+// below src are stored as links and never followed, so link loops can't recurse; links
+// pointing outside src or that the storage can't hold and special files are skipped.
+// onFile, if not nil, is called with the local path of every file or link, and the reason
+// it was skipped, if any. Entries whose slash-separated path inside src is in exclude, if
+// not nil, are left out.
+func (s *SyncEngine) uploadDir(src, key string, transform func(data []byte) ([]byte, error), exclude func(rel string, isDir bool) bool, onFile func(path, skipped string)) error {
+	return s.uploadTree(src, src, key, transform, exclude, onFile)
+}
+
+// uploadTree writes the directory src of the item rooted at root to key
+func (s *SyncEngine) uploadTree(root, src, key string, transform func(data []byte) ([]byte, error), exclude func(rel string, isDir bool) bool, onFile func(path, skipped string)) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	// Storages keeping directories create them first, replacing any link left at key
+	dirs, keepsDirs := s.storage.(storage.DirMaker)
+	mode := privateMode(key, srcInfo.Mode().Perm())
+	if keepsDirs {
+		if err := dirs.MakeDir(key, storage.WriteOptions{Mode: mode}); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		srcPath := filepath.Join(src, entry.Name())
+		entryKey := storage.Join(key, entry.Name())
+		if exclude != nil {
+			if rel, err := filepath.Rel(root, srcPath); err == nil && exclude(filepath.ToSlash(rel), entry.IsDir()) {
+				continue
+			}
+		}
+
+		skipped := ""
+		switch {
+		case entry.Type()&os.ModeSymlink != 0:
+			if skipped, err = s.uploadLink(root, srcPath, entryKey); err != nil {
+				return err
+			}
+		case entry.IsDir():
+			if err := s.uploadTree(root, srcPath, entryKey, transform, exclude, onFile); err != nil {
+				return err
+			}
+			continue
+		case !entry.Type().IsRegular():
+			skipped = "not a regular file"
+		default:
+			if err := s.upload(srcPath, entryKey, transform); err != nil {
+				return err
+			}
+		}
+
+		if onFile != nil {
+			onFile(srcPath, skipped)
+		}
+	}
+
+	// The modification time is set once the directory content no longer changes
+	if keepsDirs {
+		return dirs.MakeDir(key, storage.WriteOptions{Mode: mode, ModTime: srcInfo.ModTime()})
+	}
+	return nil
+}
+
+// uploadLink stores the symlink src of the item rooted at root at key. It returns the reason
+// the link was skipped, if it was.
+func (s *SyncEngine) uploadLink(root, src, key string) (string, error) {
+	target, inside, err := config.ReadItemLink(root, src)
+	if err != nil {
+		return "", err
+	}
+	if !inside {
+		return "symlink points outside the item", nil
+	}
+
+	linker, ok := s.storage.(storage.Linker)
+	if !ok {
+		return "symlinks are not supported by this storage", nil
+	}
+	err = linker.Symlink(key, filepath.ToSlash(target))
+	if errors.Is(err, errors.ErrUnsupported) {
+		return "symlinks are not supported by this storage", nil
+	}
+	return "", err
+}
+
+// download writes the file at key in src to the local path dst, passing its content through
+// transform, and keeps its permissions and modification time. A nil transform copies it as is.
+func download(src storage.Storage, key, dst string, transform func(data []byte) ([]byte, error)) error {
+	info, err := src.Stat(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := src.Read(key)
+	if err != nil {
+		return err
+	}
+	if transform != nil {
+		if data, err = transform(data); err != nil {
+			return err
+		}
+	}
+
+	return writeLocalFile(dst, data, info)
+}
+
+// downloadDir recursively writes the tree at key in src to the local directory dst, passing
+// file contents through transform and keeping permissions and modification times. Symlinks
+// are recreated as links; links pointing outside the tree are skipped. Entries whose
+// slash-separated path inside the tree is in exclude, if not nil, are left out. onFile, if
+// not nil, is called with the path inside the tree of every file or link, and the reason it
+// was skipped, if any.
+func downloadDir(src storage.Storage, key, dst string, transform func(data []byte) ([]byte, error), exclude func(rel string, isDir bool) bool, onFile func(rel, skipped string)) error {
+	rootInfo, err := src.Stat(key)
+	if err != nil {
+		return err
+	}
+	entries, err := src.List(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, dirMode(rootInfo)); err != nil {
+		return err
+	}
+	dirs := []storage.FileInfo{rootInfo}
+	dirPaths := []string{dst}
+
+	for _, entry := range entries {
+		rel, ok := storage.Rel(key, entry.Key)
+		if !ok || rel == "." || (exclude != nil && exclude(rel, entry.IsDir)) {
+			continue
+		}
+		path := filepath.Join(dst, filepath.FromSlash(rel))
+
+		skipped := ""
+		switch {
+		case entry.IsDir:
+			// Never write through a link left below the destination root
+			if err := removeSymlink(path); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(path, dirMode(entry)); err != nil {
+				return err
+			}
+			dirs = append(dirs, entry)
+			dirPaths = append(dirPaths, path)
+			continue
+		case entry.IsLink():
+			target, inside := storage.LinkTarget(key, entry)
+			if !inside {
+				skipped = "symlink points outside the item"
+			} else if err := writeSymlink(path, target); err != nil {
+				return err
+			}
+		default:
+			if err := removeSymlink(path); err != nil {
+				return err
+			}
+			if err := download(src, entry.Key, path, transform); err != nil {
+				return err
+			}
+		}
+
+		if onFile != nil {
+			onFile(rel, skipped)
+		}
+	}
+
+	// Fix the directory modes, which MkdirAll leaves alone for existing directories, and
+	// their modification times once their content no longer changes, deepest first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirPaths[i], privateMode(dirPaths[i], dirMode(dirs[i]))); err != nil {
+			return err
+		}
+		if !dirs[i].ModTime.IsZero() {
+			if err := os.Chtimes(dirPaths[i], dirs[i].ModTime, dirs[i].ModTime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dirMode returns the permission bits of a stored directory, or 0755 for storages without modes
+func dirMode(info storage.FileInfo) os.FileMode {
+	if info.Mode == 0 {
+		return 0755
+	}
+	return info.Mode
+}
+
+// writeLocalFile writes data to path with the permissions and modification time of the
+// stored file it comes from. Sensitive files lose group and other permissions.
+func writeLocalFile(path string, data []byte, info storage.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	mode := info.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, privateMode(path, mode)); err != nil {
+		return err
+	}
+	if info.ModTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(path, info.ModTime, info.ModTime)
+}
@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/validation"
+)
+
+// ItemCommands returns the commands of an item that only run on a computer once approved
+// there: its hooks, in the order they run, and its validator commands
+func ItemCommands(item *config.SyncItem) []string {
+	var commands []string
+	for _, command := range []string{item.Hooks.PrePush, item.Hooks.PostPush, item.Hooks.PrePull, item.Hooks.PostPull} {
+		if command != "" {
+			commands = append(commands, command)
+		}
+	}
+	for _, spec := range item.Validators {
+		if validation.IsCommand(spec) {
+			commands = append(commands, spec)
+		}
+	}
+	return commands
+}
+
+// approvedValidators returns the validators of an item that may run on this computer. Validator
+// commands that weren't approved are left out with a warning, like item hooks.
+func (s *SyncEngine) approvedValidators(result *SyncResult, item *config.SyncItem) []string {
+	var specs []string
+	for _, spec := range item.Validators {
+		if validation.IsCommand(spec) && !s.localConfig.IsTrusted(spec) {
+			result.Errors = append(result.Errors, fmt.Sprintf("warning: skipped validator of %s, not approved on this computer: %s (run 'syncstation trust \"%s\"')",
+				item.Name, spec, item.Name))
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+	"github.com/AntoineArt/syncstation/internal/validation"
+)
+
+// stageIncoming decodes the cloud copy of an item into a temporary directory under its local
+// name and runs the item's validators on it. It returns the staged copy and the failures
+// keyed by path inside the item, "." for a file item or a folder-wide check. The staged copy
+// is empty when the item has no validators; otherwise the caller removes its parent directory.
+func (s *SyncEngine) stageIncoming(result *SyncResult, item *config.SyncItem, localPath, cloudKey string) (string, map[string]error, error) {
+	checker, err := validation.NewChecker(s.approvedValidators(result, item))
+	if err != nil {
+		return "", nil, err
+	}
+	if checker.IsEmpty() {
+		return "", nil, nil
+	}
+
+	staging, err := os.MkdirTemp("", "syncstation-incoming-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	staged := filepath.Join(staging, filepath.Base(localPath))
+
+	failures := make(map[string]error)
+	if item.Type == "file" {
+		err = download(s.storage, cloudKey, staged, itemDecoder(s.codec, s.localConfig, item))
+		if err == nil {
+			if invalid := checker.CheckFile(staged); invalid != nil {
+				failures["."] = invalid
+			}
+		}
+	} else {
+		// Skipped files are reported here since the pull copies from the staged copy
+		recordSkipped := s.copyOutcome(result, item, "pulled")
+		var exclude func(rel string, isDir bool) bool
+		exclude, err = s.pullExclusions(item)
+		if err == nil {
+			err = downloadDir(s.storage, cloudKey, staged, s.codec.Decode, exclude, func(rel, skipped string) {
+				if skipped != "" {
+					recordSkipped(s.storage.Location(storage.Join(cloudKey, rel)), skipped)
+				}
+			})
+		}
+		if err == nil {
+			failures, err = checker.CheckDir(staged)
+		}
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+		return "", nil, fmt.Errorf("failed to validate incoming files: %w", err)
+	}
+
+	return staged, failures, nil
+}
+
+// refuseInvalid returns the error refusing an incoming version that failed validation
+func refuseInvalid(failures map[string]error) error {
+	var problems []string
+	for _, path := range validation.SortedPaths(failures) {
+		if path == "." {
+			problems = append(problems, failures[path].Error())
+		} else {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, failures[path]))
+		}
+	}
+	return fmt.Errorf("refusing to pull invalid files: %s", strings.Join(problems, "; "))
+}
+
+// quarantineInvalid moves the invalid files out of the staged copy of an item into the
+// quarantine directory, so that only the valid files are pulled. Folder-wide failures
+// can't be narrowed down to files and refuse the pull.
+func (s *SyncEngine) quarantineInvalid(result *SyncResult, item *config.SyncItem, staged, localPath string, failures map[string]error) error {
+	if _, ok := failures["."]; ok && item.Type != "file" {
+		return refuseInvalid(failures)
+	}
+
+	quarantine := filepath.Join(item.GetCloudPath(filepath.Join(getConfigDir(s.localConfig), "quarantine")),
+		time.Now().Format("20060102-150405"))
+
+	for _, rel := range validation.SortedPaths(failures) {
+		src, dst, local := staged, filepath.Join(quarantine, filepath.Base(localPath)), localPath
+		if rel != "." {
+			src = filepath.Join(staged, filepath.FromSlash(rel))
+			dst = filepath.Join(quarantine, filepath.FromSlash(rel))
+			local = filepath.Join(localPath, filepath.FromSlash(rel))
+		}
+
+		if err := copyFile(src, dst); err != nil {
+			return fmt.Errorf("failed to quarantine %s: %w", rel, err)
+		}
+		if err := os.Remove(src); err != nil {
+			return fmt.Errorf("failed to quarantine %s: %w", rel, err)
+		}
+
+		result.Errors = append(result.Errors, fmt.Sprintf("warning: kept %s unchanged, incoming version is invalid (%v) and was moved to %s", local, failures[rel], dst))
+		result.FilesSkipped++
+		s.recordOutcome(result, item.Name, local, "quarantined", fmt.Sprintf("%v, incoming version moved to %s", failures[rel], dst))
+	}
+	return nil
+}
+
+// ValidateIncoming runs the validators of an item on its cloud copy without pulling it,
+// and returns the failures keyed by path inside the item ("." for a file item) and the
+// warnings, such as validators skipped because they aren't approved on this computer
+func (s *SyncEngine) ValidateIncoming(item *config.SyncItem) (map[string]error, []string, error) {
+	localPath := item.GetCurrentComputerPath(s.localConfig.CurrentComputer)
+	if localPath == "" {
+		return nil, nil, fmt.Errorf("no path configured for computer '%s'", s.localConfig.CurrentComputer)
+	}
+
+	cloudKey := item.CloudKey()
+	if err := s.trackObjects(item); err != nil {
+		return nil, nil, err
+	}
+	if !storage.Exists(s.storage, cloudKey) {
+		return nil, nil, fmt.Errorf("cloud path does not exist: %s", s.storage.Location(cloudKey))
+	}
+
+	result := &SyncResult{Operation: SyncPull, Errors: make([]string, 0)}
+	staged, failures, err := s.stageIncoming(result, item, localPath, cloudKey)
+	if staged != "" {
+		os.RemoveAll(filepath.Dir(staged))
+	}
+	return failures, result.Errors, err
+}
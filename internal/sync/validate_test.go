@@ -0,0 +1,210 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/storage"
+	"github.com/AntoineArt/syncstation/internal/validation"
+)
+
+// readFile returns the content of a file, or "" if it doesn't exist
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestInvalidIncomingFilesAreRefused(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{"settings.json": `{"theme": "light"}`})
+	item := addTestItem(t, engine, &config.SyncItem{Name: "Code", Type: "folder", Paths: map[string]string{testComputer: local}, Validators: []string{"auto"}})
+	writeFiles(t, item.GetCloudPath(engine.localConfig.GetCloudConfigsPath()), map[string]string{
+		"settings.json":    `{"theme": "dark"`,
+		"keybindings.json": `[]`,
+	})
+
+	_, err := engine.SyncItem(SyncPull, item)
+	if err == nil || !strings.Contains(err.Error(), "refusing to pull invalid files: settings.json: invalid JSON") {
+		t.Fatalf("pull error = %v, want a refusal", err)
+	}
+	if got := readFile(t, filepath.Join(local, "settings.json")); got != `{"theme": "light"}` {
+		t.Errorf("local settings.json = %s, want it unchanged", got)
+	}
+	if config.PathExists(filepath.Join(local, "keybindings.json")) {
+		t.Error("valid files were pulled although the pull was refused")
+	}
+
+	failures, warnings, err := engine.ValidateIncoming(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(validation.SortedPaths(failures), ","); got != "settings.json" || len(warnings) != 0 {
+		t.Errorf("ValidateIncoming failures = %s, warnings %v", got, warnings)
+	}
+}
+
+func TestInvalidIncomingFilesAreQuarantined(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{"settings.json": `{"theme": "light"}`})
+	item := addTestItem(t, engine, &config.SyncItem{
+		Name:       "Code",
+		Type:       "folder",
+		Paths:      map[string]string{testComputer: local},
+		Validators: []string{"auto"},
+		OnInvalid:  validation.PolicyQuarantine,
+	})
+	writeFiles(t, item.GetCloudPath(engine.localConfig.GetCloudConfigsPath()), map[string]string{
+		"settings.json":    `{"theme": "dark"`,
+		"keybindings.json": `[]`,
+	})
+
+	result, err := engine.SyncItem(SyncPull, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(local, "settings.json")); got != `{"theme": "light"}` {
+		t.Errorf("local settings.json = %s, want it unchanged", got)
+	}
+	if got := readFile(t, filepath.Join(local, "keybindings.json")); got != "[]" {
+		t.Errorf("valid keybindings.json wasn't pulled: %q", got)
+	}
+
+	quarantined := outcomeActions(result.Files)["quarantined"]
+	if len(quarantined) != 1 || quarantined[0] != filepath.Join(local, "settings.json") {
+		t.Fatalf("quarantined = %v", quarantined)
+	}
+	matches, err := filepath.Glob(filepath.Join(getConfigDir(engine.localConfig), "quarantine", "Code", "*", "settings.json"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("quarantined copies = %v, %v", matches, err)
+	}
+	if got := readFile(t, matches[0]); got != `{"theme": "dark"` {
+		t.Errorf("quarantined copy = %s", got)
+	}
+}
+
+func TestInvalidFileItemsAreKept(t *testing.T) {
+	engine := newTestEngine(t, nil)
+	local := filepath.Join(t.TempDir(), "config.toml")
+	writeFiles(t, filepath.Dir(local), map[string]string{"config.toml": "a = 1"})
+	item := addTestItem(t, engine, &config.SyncItem{Name: "App", Type: "file", Paths: map[string]string{testComputer: local}, Validators: []string{"toml"}, OnInvalid: validation.PolicyQuarantine})
+	cloud := item.GetCloudPath(engine.localConfig.GetCloudConfigsPath())
+	writeFiles(t, filepath.Dir(cloud), map[string]string{filepath.Base(cloud): "a = "})
+
+	result, err := engine.SyncItem(SyncPull, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, local); got != "a = 1" {
+		t.Errorf("local file = %q, want it unchanged", got)
+	}
+	if !strings.Contains(result.Message, "the incoming version is invalid") {
+		t.Errorf("message = %q", result.Message)
+	}
+
+	// A valid version is pulled
+	writeFiles(t, filepath.Dir(cloud), map[string]string{filepath.Base(cloud): "a = 2"})
+	if _, err := engine.SyncItem(SyncPull, item); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, local); got != "a = 2" {
+		t.Errorf("local file = %q, want the valid version", got)
+	}
+}
+
+func TestFolderWideFailuresAreRefused(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("validator commands use sh")
+	}
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	item := addTestItem(t, engine, &config.SyncItem{
+		Name:       "Nginx",
+		Type:       "folder",
+		Paths:      map[string]string{testComputer: local},
+		Validators: []string{"test -f {dir}/nginx.conf"},
+		OnInvalid:  validation.PolicyQuarantine,
+	})
+	engine.localConfig.TrustCommand(item.Validators[0])
+	writeFiles(t, item.GetCloudPath(engine.localConfig.GetCloudConfigsPath()), map[string]string{"mime.types": "types {}"})
+
+	// Folder-wide checks can't be narrowed down to files to quarantine
+	if _, err := engine.SyncItem(SyncPull, item); err == nil || !strings.Contains(err.Error(), "refusing to pull invalid files") {
+		t.Errorf("pull error = %v, want a refusal", err)
+	}
+	if config.PathExists(filepath.Join(local, "mime.types")) {
+		t.Error("files were pulled")
+	}
+}
+
+func TestValidatorCommandsNeedApproval(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("validator commands use sh")
+	}
+	engine := newTestEngine(t, nil)
+	local := t.TempDir()
+	log := filepath.Join(t.TempDir(), "validator.log")
+	validator := "echo ran >> " + log + " && test -s {file} && false"
+	item := addTestItem(t, engine, &config.SyncItem{
+		Name:       "Nginx",
+		Type:       "folder",
+		Paths:      map[string]string{testComputer: local},
+		Validators: []string{validator},
+	})
+	cloudStorage := engine.localConfig.CloudStorage()
+	if err := cloudStorage.Write(storage.Join(item.CloudKey(), "nginx.conf"), []byte("events {}"), storage.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unapproved commands are skipped with a warning, and the pull goes on
+	result, err := engine.SyncItem(SyncPull, item)
+	if err != nil {
+		t.Fatalf("pull failed: %v", err)
+	}
+	if config.PathExists(log) {
+		t.Error("the unapproved validator ran")
+	}
+	if !strings.Contains(strings.Join(result.Errors, "\n"), "not approved") {
+		t.Errorf("no warning about the skipped validator in %v", result.Errors)
+	}
+	if !config.PathExists(filepath.Join(local, "nginx.conf")) {
+		t.Error("nginx.conf was not pulled")
+	}
+
+	// Approved, the failing command refuses the pull
+	if err := os.Remove(filepath.Join(local, "nginx.conf")); err != nil {
+		t.Fatal(err)
+	}
+	engine.localConfig.TrustCommand(validator)
+	if _, err := engine.SyncItem(SyncPull, item); err == nil {
+		t.Error("pull succeeded despite the failing validator")
+	}
+	if !config.PathExists(log) {
+		t.Error("the approved validator didn't run")
+	}
+	if config.PathExists(filepath.Join(local, "nginx.conf")) {
+		t.Error("the invalid version was pulled")
+	}
+}
+
+func TestItemCommands(t *testing.T) {
+	item := &config.SyncItem{
+		Hooks:      config.Hooks{PrePull: "backup", PostPull: "reload"},
+		Validators: []string{"json", "nginx -t -c {file}"},
+	}
+	if got := strings.Join(ItemCommands(item), "|"); got != "backup|reload|nginx -t -c {file}" {
+		t.Errorf("ItemCommands = %q", got)
+	}
+}
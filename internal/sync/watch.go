@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+// Watcher tells a watching sync when to sync again: when other computers changed the cloud
+// copy, or the local files of the items changed. Both are compared with their state after
+// the last sync, and cloud changes are only reported once the cloud drive client settled.
+type Watcher struct {
+	localConfig *config.LocalConfig
+	cloud       string // fingerprint of the cloud copy after the last sync
+	local       string // fingerprint of the local files after the last sync
+}
+
+// NewWatcher returns a watcher of the cloud copy of localConfig
+func NewWatcher(localConfig *config.LocalConfig) *Watcher {
+	return &Watcher{localConfig: localConfig}
+}
+
+// Synced records the state of the cloud copy and of the local files of items after a sync,
+// so that the changes made by the sync itself aren't taken for new changes
+func (w *Watcher) Synced(items []*config.SyncItem) error {
+	w.local = localFingerprint(w.localConfig, items)
+	if w.localConfig.GitMode {
+		return nil
+	}
+	activity, err := CheckCloudActivity(w.localConfig)
+	if err != nil {
+		return err
+	}
+	w.cloud = activity.Fingerprint
+	return nil
+}
+
+// Changed reports whether the local files of items changed since the last sync, or the
+// cloud copy changed and the cloud drive client has finished syncing it. In git mode,
+// changes of other computers are only seen by fetching, so every check reports a change.
+func (w *Watcher) Changed(items []*config.SyncItem) (bool, error) {
+	if w.localConfig.GitMode || localFingerprint(w.localConfig, items) != w.local {
+		return true, nil
+	}
+	activity, err := CheckCloudActivity(w.localConfig)
+	if err != nil {
+		return false, err
+	}
+	window, _ := SettleDurations(w.localConfig)
+	if !w.localConfig.Settle.Disabled && activity.Busy(window) {
+		return false, nil
+	}
+	return activity.Fingerprint != w.cloud, nil
+}
+
+// localFingerprint summarises the names, sizes, modes and modification times of the local
+// files of items on this computer
+func localFingerprint(localConfig *config.LocalConfig, items []*config.SyncItem) string {
+	hash := sha256.New()
+	for _, item := range items {
+		localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
+		if localPath == "" {
+			continue
+		}
+		fmt.Fprintf(hash, "%s\x00", item.Name)
+		filepath.WalkDir(localPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				fmt.Fprintf(hash, "%s\x00missing\n", path)
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(hash, "%s\x00%d\x00%v\x00%d\n", path, info.Size(), info.Mode(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+func TestWatcherReportsSettledCloudChanges(t *testing.T) {
+	localConfig := &config.LocalConfig{CloudSyncDir: t.TempDir()}
+	file := filepath.Join(localConfig.CloudSyncDir, "configs", "Shell", ".zshrc")
+	writeFiles(t, localConfig.CloudSyncDir, map[string]string{"configs/Shell/.zshrc": "one"})
+	past := time.Now().Add(-time.Hour)
+	for _, path := range []string{file, filepath.Dir(file), filepath.Dir(filepath.Dir(file)), localConfig.CloudSyncDir} {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	watcher := NewWatcher(localConfig)
+	if err := watcher.Synced(nil); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := watcher.Changed(nil); err != nil || changed {
+		t.Fatalf("Changed without changes = %v, %v", changed, err)
+	}
+
+	// A file the client is still writing isn't a change yet
+	if err := os.WriteFile(file, []byte("two, longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := watcher.Changed(nil); err != nil || changed {
+		t.Errorf("Changed while the client syncs = %v, %v, want false", changed, err)
+	}
+
+	// Nor is a settled directory with a partial download
+	if err := os.Chtimes(file, past.Add(time.Minute), past.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(filepath.Dir(file), ".zprofile.~5e1f0a")
+	if err := os.WriteFile(partial, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{partial, filepath.Dir(file)} {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if changed, err := watcher.Changed(nil); err != nil || changed {
+		t.Errorf("Changed with a partial download = %v, %v, want false", changed, err)
+	}
+
+	if err := os.Remove(partial); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Dir(file), past, past); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := watcher.Changed(nil); err != nil || !changed {
+		t.Errorf("Changed once settled = %v, %v, want true", changed, err)
+	}
+
+	if err := watcher.Synced(nil); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := watcher.Changed(nil); err != nil || changed {
+		t.Errorf("Changed after syncing = %v, %v, want false", changed, err)
+	}
+}
+
+func TestWatcherAlwaysSyncsInGitMode(t *testing.T) {
+	watcher := NewWatcher(&config.LocalConfig{CloudSyncDir: t.TempDir(), GitMode: true})
+	if changed, err := watcher.Changed(nil); err != nil || !changed {
+		t.Errorf("Changed in git mode = %v, %v, want true", changed, err)
+	}
+}
+
+func TestWatcherReportsLocalChanges(t *testing.T) {
+	localConfig := &config.LocalConfig{CloudSyncDir: t.TempDir(), CurrentComputer: testComputer, Settle: config.SettleConfig{Disabled: true}}
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{"init.lua": "one", "lua/plugins.lua": "{}"})
+	items := []*config.SyncItem{
+		{Name: "Nvim", Type: "folder", Paths: map[string]string{testComputer: local}},
+		{Name: "Elsewhere", Type: "file", Paths: map[string]string{"desktop": "/nowhere"}},
+	}
+
+	watcher := NewWatcher(localConfig)
+	if err := watcher.Synced(items); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := watcher.Changed(items); err != nil || changed {
+		t.Fatalf("Changed without changes = %v, %v", changed, err)
+	}
+
+	writeFiles(t, local, map[string]string{"lua/plugins.lua": "{ 'telescope' }"})
+	if changed, err := watcher.Changed(items); err != nil || !changed {
+		t.Errorf("Changed after a local edit = %v, %v, want true", changed, err)
+	}
+	if err := watcher.Synced(items); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := watcher.Changed(items); err != nil || changed {
+		t.Errorf("Changed after syncing = %v, %v, want false", changed, err)
+	}
+
+	if err := os.Remove(filepath.Join(local, "init.lua")); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := watcher.Changed(items); err != nil || !changed {
+		t.Errorf("Changed after a local deletion = %v, %v, want true", changed, err)
+	}
+}
@@ -0,0 +1,191 @@
+package templating
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/AntoineArt/syncstation/internal/diff"
+)
+
+// ErrTemplatedLine is returned when a local edit changes the output of a template action
+var ErrTemplatedLine = errors.New("local edit changes templated lines")
+
+// Data holds the per-computer variables available to templates
+type Data struct {
+	Computer string            // computer ID
+	Hostname string            // hostname of this computer
+	OS       string            // "linux", "darwin", "windows", ...
+	Arch     string            // "amd64", "arm64", ...
+	User     string            // current user name
+	Home     string            // home directory
+	Vars     map[string]string // user-defined variables of this computer
+}
+
+// NewData collects the template variables of the current computer
+func NewData(computerID string, vars map[string]string) Data {
+	data := Data{
+		Computer: computerID,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Home:     os.Getenv("HOME"),
+		Vars:     vars,
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		data.Hostname = hostname
+	}
+	if current, err := user.Current(); err == nil {
+		data.User = current.Username
+		if data.Home == "" {
+			data.Home = current.HomeDir
+		}
+	}
+	if data.Vars == nil {
+		data.Vars = make(map[string]string)
+	}
+
+	return data
+}
+
+// funcs are the functions available to templates in addition to the text/template builtins
+var funcs = template.FuncMap{
+	"env": os.Getenv,
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// Render executes a template with the given data. Missing variables are errors
+// so that a computer without a value never gets a file with "<no value>" in it.
+// Binary content is returned unchanged.
+func Render(name string, content []byte, data Data) ([]byte, error) {
+	if bytes.IndexByte(content, 0) != -1 {
+		return content, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// Apply carries local edits of a rendered file back into its template.
+// rendered is the template rendered for this computer and local is the edited file.
+// Lines that are literal in the template are updated in place; edits to lines produced
+// by template actions can't be mapped back and return ErrTemplatedLine.
+func Apply(content, rendered, local []byte) ([]byte, error) {
+	diffEngine := diff.NewDiffEngine()
+	templateLines := strings.Split(string(content), "\n")
+	renderedLines := strings.Split(string(rendered), "\n")
+	localLines := strings.Split(string(local), "\n")
+
+	// Map rendered lines to the literal template lines they came from
+	source := make(map[int]int) // rendered index -> template index
+	t, r := 0, 0
+	for _, line := range diffEngine.DiffLines(templateLines, renderedLines) {
+		switch line.Type {
+		case "same":
+			if !strings.Contains(templateLines[t], "{{") {
+				source[r] = t
+			}
+			t++
+			r++
+		case "removed":
+			t++
+		case "added":
+			r++
+		}
+	}
+
+	// Translate the local edits into template edits
+	deleted := make(map[int]bool)          // template index -> deleted
+	insertBefore := make(map[int][]string) // template index -> lines inserted before it
+	badLines := make(map[int]bool)         // local line numbers that can't be mapped
+	r, l := 0, 0
+	for _, line := range diffEngine.DiffLines(renderedLines, localLines) {
+		switch line.Type {
+		case "same":
+			r++
+			l++
+		case "removed":
+			if index, ok := source[r]; ok {
+				deleted[index] = true
+			} else {
+				badLines[l+1] = true
+			}
+			r++
+		case "added":
+			if index, ok := insertionPoint(source, r, len(renderedLines), len(templateLines)); ok {
+				insertBefore[index] = append(insertBefore[index], line.Content)
+			} else {
+				badLines[l+1] = true
+			}
+			l++
+		}
+	}
+
+	if len(badLines) > 0 {
+		return nil, fmt.Errorf("%w (line %s)", ErrTemplatedLine, joinLineNumbers(badLines))
+	}
+
+	var out []string
+	for i, line := range templateLines {
+		out = append(out, insertBefore[i]...)
+		if !deleted[i] {
+			out = append(out, line)
+		}
+	}
+	out = append(out, insertBefore[len(templateLines)]...)
+
+	return []byte(strings.Join(out, "\n")), nil
+}
+
+// insertionPoint returns the template index before which lines inserted before
+// rendered line r belong. Insertions must be next to a literal line to be placed.
+func insertionPoint(source map[int]int, r, renderedCount, templateCount int) (int, bool) {
+	if r == 0 {
+		return 0, true
+	}
+	if t, ok := source[r-1]; ok {
+		return t + 1, true
+	}
+	if t, ok := source[r]; ok {
+		return t, true
+	}
+	if r == renderedCount {
+		return templateCount, true
+	}
+	return 0, false
+}
+
+// joinLineNumbers formats a set of line numbers as "1, 4, 7"
+func joinLineNumbers(lines map[int]bool) string {
+	numbers := make([]int, 0, len(lines))
+	for line := range lines {
+		numbers = append(numbers, line)
+	}
+	sort.Ints(numbers)
+
+	parts := make([]string, len(numbers))
+	for i, number := range numbers {
+		parts[i] = fmt.Sprint(number)
+	}
+	return strings.Join(parts, ", ")
+}
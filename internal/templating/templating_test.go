@@ -0,0 +1,177 @@
+package templating
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testData are the variables of the computer templates are rendered for in tests
+var testData = Data{
+	Computer: "laptop",
+	Hostname: "laptop.local",
+	OS:       "linux",
+	Home:     "/home/me",
+	Vars:     map[string]string{"email": "me@example.com"},
+}
+
+func TestRender(t *testing.T) {
+	t.Setenv("SYNCSTATION_TEST_SHELL", "zsh")
+	t.Setenv("SYNCSTATION_TEST_EDITOR", "")
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"literal", "set -o vi\n", "set -o vi\n"},
+		{"variables", "host={{ .Hostname }} os={{ .OS }} home={{ .Home }}", "host=laptop.local os=linux home=/home/me"},
+		{"user variables", "email = {{ .Vars.email }}", "email = me@example.com"},
+		{"conditions", "{{ if eq .OS \"darwin\" }}brew{{ else }}apt{{ end }}", "apt"},
+		{"environment", "{{ env \"SYNCSTATION_TEST_SHELL\" }}", "zsh"},
+		{"default", "{{ env \"SYNCSTATION_TEST_EDITOR\" | default \"nvim\" }}", "nvim"},
+	}
+	for _, test := range tests {
+		got, err := Render(test.name, []byte(test.template), testData)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: Render = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	for name, template := range map[string]string{
+		"missing variable": "{{ .Missing }}",
+		"invalid template": "{{ if }}",
+	} {
+		if got, err := Render(name, []byte(template), testData); err == nil {
+			t.Errorf("%s: Render = %q, want an error", name, got)
+		}
+	}
+
+	binary := []byte("\x00{{ .Missing }}")
+	if got, err := Render("binary", binary, testData); err != nil || string(got) != string(binary) {
+		t.Errorf("Render of binary content = %q, %v", got, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	template := strings.Join([]string{
+		"# shell",
+		"export EDITOR=nvim",
+		"export HOST={{ .Hostname }}",
+		"{{ if eq .OS \"linux\" }}",
+		"alias open=xdg-open",
+		"{{ end }}",
+		"alias ll='ls -l'",
+	}, "\n")
+	tests := []struct {
+		name  string
+		edit  func(lines []string) []string
+		want  []string // lines of the template after the edit
+		lines string   // lines that can't be carried back, if any
+	}{
+		{
+			name: "no edit",
+			edit: func(lines []string) []string { return lines },
+		},
+		{
+			name: "literal line changed",
+			edit: func(lines []string) []string { lines[1] = "export EDITOR=vim"; return lines },
+			want: []string{"# shell", "export EDITOR=vim", "export HOST={{ .Hostname }}", "{{ if eq .OS \"linux\" }}", "alias open=xdg-open", "{{ end }}", "alias ll='ls -l'"},
+		},
+		{
+			name: "line inside a condition changed",
+			edit: func(lines []string) []string { lines[4] = "alias open=gio open"; return lines },
+			want: []string{"# shell", "export EDITOR=nvim", "export HOST={{ .Hostname }}", "{{ if eq .OS \"linux\" }}", "alias open=gio open", "{{ end }}", "alias ll='ls -l'"},
+		},
+		{
+			name: "literal line deleted",
+			edit: func(lines []string) []string { return append(lines[:1], lines[2:]...) },
+			want: []string{"# shell", "export HOST={{ .Hostname }}", "{{ if eq .OS \"linux\" }}", "alias open=xdg-open", "{{ end }}", "alias ll='ls -l'"},
+		},
+		{
+			name: "lines added at both ends",
+			edit: func(lines []string) []string {
+				return append(append([]string{"#!/bin/sh"}, lines...), "alias la='ls -a'")
+			},
+			want: []string{"#!/bin/sh", "# shell", "export EDITOR=nvim", "export HOST={{ .Hostname }}", "{{ if eq .OS \"linux\" }}", "alias open=xdg-open", "{{ end }}", "alias ll='ls -l'", "alias la='ls -a'"},
+		},
+		{
+			name: "line added after a literal line",
+			edit: func(lines []string) []string {
+				return append(lines[:2], append([]string{"export PAGER=less"}, lines[2:]...)...)
+			},
+			want: []string{"# shell", "export EDITOR=nvim", "export PAGER=less", "export HOST={{ .Hostname }}", "{{ if eq .OS \"linux\" }}", "alias open=xdg-open", "{{ end }}", "alias ll='ls -l'"},
+		},
+		{
+			name:  "templated line changed",
+			edit:  func(lines []string) []string { lines[2] = "export HOST=desktop"; return lines },
+			lines: "3",
+		},
+		{
+			name:  "templated line deleted",
+			edit:  func(lines []string) []string { return append(lines[:2], lines[3:]...) },
+			lines: "3",
+		},
+	}
+
+	for _, test := range tests {
+		rendered, err := Render(test.name, []byte(template), testData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		local := strings.Join(test.edit(strings.Split(string(rendered), "\n")), "\n")
+
+		got, err := Apply([]byte(template), rendered, []byte(local))
+		if test.lines != "" {
+			if !errors.Is(err, ErrTemplatedLine) || !strings.Contains(err.Error(), "(line "+test.lines+")") {
+				t.Errorf("%s: Apply returned %v, want ErrTemplatedLine for line %s", test.name, err, test.lines)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		want := template
+		if test.want != nil {
+			want = strings.Join(test.want, "\n")
+		}
+		if string(got) != want {
+			t.Errorf("%s: Apply = %q, want %q", test.name, got, want)
+			continue
+		}
+
+		// The updated template renders the local file
+		if again, err := Render(test.name, got, testData); err != nil || string(again) != local {
+			t.Errorf("%s: the updated template renders %q, %v, want %q", test.name, again, err, local)
+		}
+	}
+}
+
+func TestApplyRefusesLinesBetweenTemplatedLines(t *testing.T) {
+	template := "{{ .Computer }}\n{{ .Hostname }}"
+	rendered, err := Render("hosts", []byte(template), testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := "laptop\nadded\nlaptop.local"
+	if _, err := Apply([]byte(template), rendered, []byte(local)); !errors.Is(err, ErrTemplatedLine) {
+		t.Errorf("Apply returned %v, want ErrTemplatedLine", err)
+	}
+}
+
+func TestNewData(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+	data := NewData("laptop", nil)
+	if data.Computer != "laptop" || data.Home != "/home/tester" || data.OS == "" || data.Arch == "" {
+		t.Errorf("NewData = %+v", data)
+	}
+	if data.Vars == nil {
+		t.Error("NewData left Vars nil, so templates reading variables would fail")
+	}
+}
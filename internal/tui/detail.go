@@ -0,0 +1,380 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/diff"
+	"github.com/AntoineArt/syncstation/internal/sync"
+	"github.com/AntoineArt/syncstation/internal/validation"
+)
+
+// Diff viewer styles
+var (
+	diffAddedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#50FA7B"))
+
+	diffRemovedStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#FF5555"))
+
+	diffGutterStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#6272A4"))
+
+	detailLabelStyle = lipgloss.NewStyle().
+				Bold(true).
+				Foreground(lipgloss.Color("#8BE9FD"))
+)
+
+// maxDetailFileLines is the number of files shown at once in the detail file list
+const maxDetailFileLines = 12
+
+// detailFile is a single file of a sync item shown in the detail view
+type detailFile struct {
+	name string // path relative to the item root ("." for file items)
+	diff *diff.FileDiff
+}
+
+// itemDiffMsg carries the file list of an item computed in the background
+type itemDiffMsg struct {
+	name  string
+	files []detailFile
+	err   error
+}
+
+// fileDiffMsg carries a rendered file diff computed in the background
+type fileDiffMsg struct {
+	name    string
+	file    string
+	content string
+	err     error
+}
+
+// openDetail switches to the detail view of the item under the cursor
+func (m tuiModel) openDetail() (tuiModel, tea.Cmd) {
+	item := m.currentItem()
+	if item == nil {
+		return m, nil
+	}
+
+	m.view = "detail"
+	m.detailName = item.Name
+	m.detailFiles = nil
+	m.detailErr = nil
+	m.detailLoading = true
+	m.fileCursor = 0
+
+	return m, loadItemDiff(m.localConfig, item)
+}
+
+// loadItemDiff returns a command computing the per-file status of an item
+func loadItemDiff(localConfig *config.LocalConfig, item *config.SyncItem) tea.Cmd {
+	localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
+	cloudKey := item.CloudKey()
+
+	return func() tea.Msg {
+		diffs, err := newDiffEngine(localConfig, item).GetSyncItemDiff(localPath, cloudKey)
+		if err != nil {
+			return itemDiffMsg{name: item.Name, err: err}
+		}
+
+		files := make([]detailFile, 0, len(diffs))
+		for name, fileDiff := range diffs {
+			files = append(files, detailFile{name: name, diff: fileDiff})
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].name < files[j].name
+		})
+
+		return itemDiffMsg{name: item.Name, files: files}
+	}
+}
+
+// loadFileDiff returns a command computing and colourising the diff of a single file
+func loadFileDiff(localConfig *config.LocalConfig, item *config.SyncItem, file detailFile, width int) tea.Cmd {
+	return func() tea.Msg {
+		lines, err := newDiffEngine(localConfig, item).GenerateFileDiff(file.diff.LocalPath, file.diff.CloudPath)
+		if err != nil {
+			return fileDiffMsg{name: item.Name, file: file.name, err: err}
+		}
+		return fileDiffMsg{name: item.Name, file: file.name, content: renderDiffLines(lines, width)}
+	}
+}
+
+// renderDiffLines colourises diff lines for the diff viewport
+func renderDiffLines(lines []diff.DiffLine, width int) string {
+	if len(lines) == 0 {
+		return dimmedStyle.Render("(both sides are empty)")
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		content := strings.ReplaceAll(line.Content, "\t", "    ")
+		if runes := []rune(content); width > 10 && len(runes) > width-10 {
+			content = string(runes[:width-10]) + "…"
+		}
+
+		gutter := diffGutterStyle.Render(fmt.Sprintf("%5d ", line.LineNumber))
+		switch line.Type {
+		case "added":
+			b.WriteString(gutter + diffAddedStyle.Render("+ "+content))
+		case "removed":
+			b.WriteString(gutter + diffRemovedStyle.Render("- "+content))
+		default:
+			b.WriteString(gutter + "  " + content)
+		}
+		b.WriteString("\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// updateDetail handles key presses in the detail view
+func (m tuiModel) updateDetail(msg tea.KeyMsg) (tuiModel, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+
+	case "esc", "backspace":
+		m.view = "list"
+
+	case "up", "k":
+		if m.fileCursor > 0 {
+			m.fileCursor--
+		}
+
+	case "down", "j":
+		if m.fileCursor < len(m.detailFiles)-1 {
+			m.fileCursor++
+		}
+
+	case "enter":
+		item := m.syncItems.FindSyncItem(m.detailName)
+		if item == nil || m.detailLoading || m.fileCursor >= len(m.detailFiles) {
+			return m, nil
+		}
+		file := m.detailFiles[m.fileCursor]
+		m.view = "diff"
+		m.diffTitle = file.name
+		m.diffViewport = viewport.New(m.diffViewportSize())
+		m.diffViewport.SetContent(dimmedStyle.Render("Computing diff..."))
+		return m, loadFileDiff(m.localConfig, item, file, m.diffViewport.Width)
+	}
+
+	return m, nil
+}
+
+// updateDiff handles messages in the diff view
+func (m tuiModel) updateDiff(msg tea.KeyMsg) (tuiModel, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+
+	case "esc", "backspace":
+		m.view = "detail"
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.diffViewport, cmd = m.diffViewport.Update(msg)
+	return m, cmd
+}
+
+// diffViewportSize returns the viewport size for the current window
+func (m tuiModel) diffViewportSize() (int, int) {
+	width, height := 80, 24
+	if m.width > 0 {
+		width = m.width
+	}
+	if m.height > 0 {
+		height = m.height
+	}
+
+	// Leave room for the borders, title, header and help bar around the viewport
+	width -= 12
+	height -= 22
+	if width < 40 {
+		width = 40
+	}
+	if height < 5 {
+		height = 5
+	}
+	return width, height
+}
+
+// detailView renders the item detail screen
+func (m tuiModel) detailView() string {
+	item := m.syncItems.FindSyncItem(m.detailName)
+
+	var b strings.Builder
+	b.WriteString(itemsHeaderStyle.Render(fmt.Sprintf("%s %s (%s)", m.getTypeIcon(item.Type), item.Name, item.Type)) + "\n")
+
+	// Paths per computer
+	b.WriteString(detailLabelStyle.Render("Paths") + "\n")
+	computers := getSortedComputers(item.Paths)
+	if len(computers) == 0 && len(item.PathRules) == 0 {
+		b.WriteString(dimmedStyle.Render("  (none configured)") + "\n")
+	}
+	for _, computerID := range computers {
+		marker := "  "
+		if computerID == m.localConfig.CurrentComputer {
+			marker = "▶ "
+		}
+		b.WriteString(fmt.Sprintf("%s%s: %s\n", marker, computerID, pathStyle.Render(item.Paths[computerID])))
+	}
+	if _, explicit := item.Paths[m.localConfig.CurrentComputer]; !explicit {
+		if rule := item.MatchPathRule(m.localConfig.CurrentComputer); rule != nil {
+			b.WriteString(fmt.Sprintf("▶ %s: %s %s\n", m.localConfig.CurrentComputer,
+				pathStyle.Render(item.GetCurrentComputerPath(m.localConfig.CurrentComputer)), dimmedStyle.Render("(rule "+rule.String()+")")))
+		}
+	}
+	for _, rule := range item.PathRules {
+		b.WriteString(fmt.Sprintf("  🧭 %s: %s\n", rule, pathStyle.Render(rule.Path)))
+	}
+	b.WriteString(fmt.Sprintf("  ☁️  cloud: %s\n", pathStyle.Render(sync.ItemStorage(m.localConfig, item).Location(item.CloudKey()))))
+	if m.encryption.IsItemEncrypted(item) {
+		b.WriteString(fmt.Sprintf("  🔒 encrypted (key %s)\n", m.encryption.KeyID))
+	}
+	if item.Template {
+		b.WriteString("  🧩 template rendered for each computer\n")
+	}
+	if item.UsesObjectStore() {
+		b.WriteString("  🧱 kept in the object store\n")
+	}
+	if len(item.Tags) > 0 {
+		b.WriteString(fmt.Sprintf("  🏷️  tags: %s\n", strings.Join(item.Tags, ", ")))
+	}
+	if item.Deploy == config.DeployLink {
+		if sync.IsLinked(m.localConfig, item) {
+			b.WriteString("  🔗 linked to the cloud copy\n")
+		} else {
+			b.WriteString("  🔗 deployed as a symlink on the next sync\n")
+		}
+	}
+	for _, hook := range []string{sync.HookPrePush, sync.HookPostPush, sync.HookPrePull, sync.HookPostPull} {
+		if command := item.Hooks.Command(hook); command != "" {
+			approval := ""
+			if !m.localConfig.IsTrusted(command) {
+				approval = " (not approved on this computer)"
+			}
+			b.WriteString(fmt.Sprintf("  🪝 %s: %s%s\n", hook, command, approval))
+		}
+	}
+	if len(item.Validators) > 0 {
+		b.WriteString(fmt.Sprintf("  🧪 validated with %s before pull\n", strings.Join(item.Validators, ", ")))
+		for _, spec := range item.Validators {
+			if validation.IsCommand(spec) && !m.localConfig.IsTrusted(spec) {
+				b.WriteString(fmt.Sprintf("  🧪 %s (not approved on this computer)\n", spec))
+			}
+		}
+	}
+
+	// Exclude patterns
+	b.WriteString("\n" + detailLabelStyle.Render("Exclude patterns") + "\n")
+	if len(item.ExcludePatterns) == 0 {
+		b.WriteString(dimmedStyle.Render("  (none)") + "\n")
+	} else {
+		b.WriteString("  " + strings.Join(item.ExcludePatterns, ", ") + "\n")
+	}
+
+	// Files with their status
+	b.WriteString("\n" + detailLabelStyle.Render("Files") + "\n")
+	switch {
+	case m.detailLoading:
+		b.WriteString(dimmedStyle.Render("  Comparing files...") + "\n")
+	case m.detailErr != nil:
+		b.WriteString(conflictStyle.Render(fmt.Sprintf("  ❌ %v", m.detailErr)) + "\n")
+	case len(m.detailFiles) == 0:
+		b.WriteString(dimmedStyle.Render("  (no files)") + "\n")
+	default:
+		start := 0
+		if m.fileCursor >= maxDetailFileLines {
+			start = m.fileCursor - maxDetailFileLines + 1
+		}
+		end := start + maxDetailFileLines
+		if end > len(m.detailFiles) {
+			end = len(m.detailFiles)
+		}
+
+		for i := start; i < end; i++ {
+			file := m.detailFiles[i]
+			name := file.name
+			if name == "." {
+				name = filepath.Base(file.diff.LocalPath)
+			}
+
+			line := fmt.Sprintf("%s %s", name, m.getStyledStatus(fileDiffStatus(file.diff.Status)))
+			if i == m.fileCursor {
+				b.WriteString(selectedItemStyle.Render("▶ "+line) + "\n")
+			} else {
+				b.WriteString(itemStyle.Render("  "+line) + "\n")
+			}
+		}
+
+		if len(m.detailFiles) > maxDetailFileLines {
+			b.WriteString(dimmedStyle.Render(fmt.Sprintf("  %d/%d files", m.fileCursor+1, len(m.detailFiles))) + "\n")
+		}
+	}
+
+	return contentBoxStyle.Render(strings.TrimRight(b.String(), "\n"))
+}
+
+// diffView renders the scrollable diff of the selected file
+func (m tuiModel) diffView() string {
+	header := itemsHeaderStyle.Render(fmt.Sprintf("🔍 %s  %s  %s",
+		m.diffTitle,
+		diffRemovedStyle.Render("- local"),
+		diffAddedStyle.Render("+ cloud")))
+
+	footer := dimmedStyle.Render(fmt.Sprintf("%3.f%%", m.diffViewport.ScrollPercent()*100))
+	return contentBoxStyle.Render(header + "\n" + m.diffViewport.View() + "\n" + footer)
+}
+
+// fileDiffStatus maps a diff engine status to the TUI status names
+func fileDiffStatus(status string) string {
+	switch status {
+	case "same":
+		return "Ready"
+	case "local_newer":
+		return "Local newer"
+	case "cloud_newer":
+		return "Cloud newer"
+	case "conflict":
+		return "Conflict"
+	case "local_only":
+		return "Cloud missing"
+	case "cloud_only":
+		return "Local missing"
+	default:
+		return "Unknown"
+	}
+}
+
+// diffErrorMessage returns a friendly explanation for a failed file diff
+func diffErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, diff.ErrBinaryFile):
+		return "Binary file - no text diff available"
+	case errors.Is(err, diff.ErrFileTooLarge):
+		return "File is too large to diff"
+	default:
+		return fmt.Sprintf("Failed to compute diff: %v", err)
+	}
+}
+
+// getSortedComputers returns the computer IDs of a paths map in a stable order
+func getSortedComputers(paths map[string]string) []string {
+	computers := make([]string, 0, len(paths))
+	for computerID := range paths {
+		computers = append(computers, computerID)
+	}
+	sort.Strings(computers)
+	return computers
+}
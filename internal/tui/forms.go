@@ -0,0 +1,565 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+// maxPathSuggestions limits the number of completions offered for a path
+const maxPathSuggestions = 50
+
+// removeChoices are the removal modes offered by the remove form, matching the remove command
+var removeChoices = []struct {
+	mode  string
+	label string
+}{
+	{"local", "Disable on this computer only"},
+	{"global", "Remove from all computers (keep cloud files)"},
+	{"delete-cloud", "Remove everywhere and delete cloud files"},
+}
+
+// itemForm is an interactive form for adding, editing or removing a sync item
+type itemForm struct {
+	kind       string // "add", "excludes", "path" or "remove"
+	itemName   string // target item, empty when adding
+	labels     []string
+	inputs     []textinput.Model
+	pathInput  int // index of the input with path completion, -1 if none
+	focus      int
+	choice     int // index into removeChoices for "remove" forms
+	confirming bool
+	summary    []string // lines shown when asking for confirmation
+	err        string
+}
+
+// formAppliedMsg reports the outcome of a confirmed form
+type formAppliedMsg struct {
+	message string
+	err     error
+}
+
+// newTextInput creates a text input with the form styling
+func newTextInput(placeholder, value string) textinput.Model {
+	input := textinput.New()
+	input.Placeholder = placeholder
+	input.Prompt = "› "
+	input.Width = 50
+	input.SetValue(value)
+	return input
+}
+
+// newAddForm creates the form for adding a sync item
+func newAddForm() *itemForm {
+	form := &itemForm{
+		kind:      "add",
+		labels:    []string{"Name", "Path", "Exclude patterns"},
+		pathInput: 1,
+		inputs: []textinput.Model{
+			newTextInput("Neovim Config", ""),
+			newTextInput("~/.config/nvim", ""),
+			newTextInput("*.log, .cache/ (optional)", ""),
+		},
+	}
+	form.inputs[1].ShowSuggestions = true
+	form.inputs[0].Focus()
+	return form
+}
+
+// newExcludesForm creates the form for editing the exclude patterns of an item
+func newExcludesForm(item *config.SyncItem) *itemForm {
+	form := &itemForm{
+		kind:      "excludes",
+		itemName:  item.Name,
+		labels:    []string{"Exclude patterns (comma separated)"},
+		pathInput: -1,
+		inputs: []textinput.Model{
+			newTextInput("*.log, .cache/", strings.Join(item.ExcludePatterns, ", ")),
+		},
+	}
+	form.inputs[0].Focus()
+	return form
+}
+
+// newPathForm creates the form for setting the path of an item on this computer
+func newPathForm(item *config.SyncItem, computerID string) *itemForm {
+	form := &itemForm{
+		kind:      "path",
+		itemName:  item.Name,
+		labels:    []string{fmt.Sprintf("Path on %s", computerID)},
+		pathInput: 0,
+		inputs: []textinput.Model{
+			newTextInput("~/.config/app", item.Paths[computerID]),
+		},
+	}
+	form.inputs[0].ShowSuggestions = true
+	form.inputs[0].Focus()
+	form.updateSuggestions(item)
+	return form
+}
+
+// newRemoveForm creates the form for removing an item
+func newRemoveForm(item *config.SyncItem) *itemForm {
+	return &itemForm{
+		kind:      "remove",
+		itemName:  item.Name,
+		pathInput: -1,
+	}
+}
+
+// title returns the heading of the form
+func (f *itemForm) title() string {
+	switch f.kind {
+	case "add":
+		return "➕ Add sync item"
+	case "excludes":
+		return fmt.Sprintf("🚫 Exclude patterns for %s", f.itemName)
+	case "path":
+		return fmt.Sprintf("📂 Local path for %s", f.itemName)
+	default:
+		return fmt.Sprintf("🗑️  Remove %s", f.itemName)
+	}
+}
+
+// value returns the trimmed value of an input
+func (f *itemForm) value(index int) string {
+	return strings.TrimSpace(f.inputs[index].Value())
+}
+
+// setFocus moves the focus to the given input
+func (f *itemForm) setFocus(index int) {
+	if index < 0 || index >= len(f.inputs) {
+		return
+	}
+	f.inputs[f.focus].Blur()
+	f.focus = index
+	f.inputs[f.focus].Focus()
+}
+
+// updateSuggestions refreshes the path completions of the path input.
+// For path forms, paths used on other computers are offered as well.
+func (f *itemForm) updateSuggestions(item *config.SyncItem) {
+	if f.pathInput < 0 {
+		return
+	}
+
+	suggestions := pathSuggestions(f.inputs[f.pathInput].Value())
+	if item != nil {
+		for _, computerID := range getSortedComputers(item.Paths) {
+			suggestions = append(suggestions, item.Paths[computerID])
+		}
+	}
+	f.inputs[f.pathInput].SetSuggestions(suggestions)
+}
+
+// pathSuggestions lists filesystem entries that complete a partially typed path
+func pathSuggestions(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	dirPart, prefix := "", value
+	if index := strings.LastIndex(value, "/"); index >= 0 {
+		dirPart, prefix = value[:index+1], value[index+1:]
+	}
+
+	entries, err := os.ReadDir(config.ExpandPath(dirPart + "."))
+	if err != nil {
+		return nil
+	}
+
+	var suggestions []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+
+		suggestion := dirPart + name
+		if entry.IsDir() {
+			suggestion += "/"
+		}
+		suggestions = append(suggestions, suggestion)
+		if len(suggestions) >= maxPathSuggestions {
+			break
+		}
+	}
+	return suggestions
+}
+
+// parsePatterns splits a comma separated list of exclude patterns
+func parsePatterns(value string) []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// resolveInputPath expands and absolutises a path typed into a form
+func resolveInputPath(value string) (string, error) {
+	return filepath.Abs(config.ExpandPath(value))
+}
+
+// openForm switches to a form acting on the item under the cursor (or a new item)
+func (m tuiModel) openForm(kind string) (tuiModel, tea.Cmd) {
+	if m.syncing {
+		return m, nil
+	}
+
+	if kind == "add" {
+		m.form = newAddForm()
+	} else {
+		item := m.currentItem()
+		if item == nil {
+			return m, nil
+		}
+		switch kind {
+		case "excludes":
+			m.form = newExcludesForm(item)
+		case "path":
+			m.form = newPathForm(item, m.localConfig.CurrentComputer)
+		case "remove":
+			m.form = newRemoveForm(item)
+		}
+	}
+
+	m.view = "form"
+	return m, textinput.Blink
+}
+
+// updateForm handles key presses while a form is open
+func (m tuiModel) updateForm(msg tea.KeyMsg) (tuiModel, tea.Cmd) {
+	form := m.form
+
+	if form.confirming {
+		switch msg.String() {
+		case "y", "Y":
+			form.confirming = false
+			return m, m.applyForm()
+		case "n", "N", "esc":
+			form.confirming = false
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "esc":
+		m.form = nil
+		m.view = "list"
+		return m, nil
+
+	case "enter":
+		if form.focus < len(form.inputs)-1 {
+			form.setFocus(form.focus + 1)
+			return m, nil
+		}
+		m.validateForm()
+		return m, nil
+
+	case "up", "shift+tab":
+		if form.kind == "remove" {
+			if form.choice > 0 {
+				form.choice--
+			}
+		} else {
+			form.setFocus(form.focus - 1)
+		}
+		return m, nil
+
+	case "down":
+		if form.kind == "remove" {
+			if form.choice < len(removeChoices)-1 {
+				form.choice++
+			}
+		} else {
+			form.setFocus(form.focus + 1)
+		}
+		return m, nil
+	}
+
+	if len(form.inputs) == 0 {
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	form.inputs[form.focus], cmd = form.inputs[form.focus].Update(msg)
+	form.err = ""
+	if form.focus == form.pathInput {
+		form.updateSuggestions(m.syncItems.FindSyncItem(form.itemName))
+	}
+	return m, cmd
+}
+
+// validateForm checks the form input and, if valid, asks for confirmation
+func (m tuiModel) validateForm() {
+	form := m.form
+	form.err = ""
+	form.summary = nil
+
+	switch form.kind {
+	case "add":
+		name := form.value(0)
+		if name == "" {
+			form.err = "Name is required"
+			return
+		}
+		if m.syncItems.FindSyncItem(name) != nil {
+			form.err = fmt.Sprintf("Sync item with name '%s' already exists", name)
+			return
+		}
+		if form.value(1) == "" {
+			form.err = "Path is required"
+			return
+		}
+		absolutePath, err := resolveInputPath(form.value(1))
+		if err != nil {
+			form.err = fmt.Sprintf("Invalid path: %v", err)
+			return
+		}
+		itemType, err := config.DetectItemType(absolutePath)
+		if err != nil {
+			form.err = fmt.Sprintf("Path does not exist: %s", absolutePath)
+			return
+		}
+		form.summary = []string{
+			fmt.Sprintf("Add %s %s (%s)", m.getTypeIcon(itemType), name, itemType),
+			fmt.Sprintf("Path: %s", absolutePath),
+		}
+		if patterns := parsePatterns(form.value(2)); len(patterns) > 0 {
+			form.summary = append(form.summary, fmt.Sprintf("Excludes: %s", strings.Join(patterns, ", ")))
+		}
+
+	case "excludes":
+		patterns := parsePatterns(form.value(0))
+		if len(patterns) == 0 {
+			form.summary = []string{fmt.Sprintf("Remove all exclude patterns from %s", form.itemName)}
+		} else {
+			form.summary = []string{fmt.Sprintf("Set exclude patterns of %s to: %s", form.itemName, strings.Join(patterns, ", "))}
+		}
+
+	case "path":
+		if form.value(0) == "" {
+			form.err = "Path is required"
+			return
+		}
+		absolutePath, err := resolveInputPath(form.value(0))
+		if err != nil {
+			form.err = fmt.Sprintf("Invalid path: %v", err)
+			return
+		}
+		form.summary = []string{fmt.Sprintf("Use %s for %s on %s", absolutePath, form.itemName, m.localConfig.CurrentComputer)}
+		if !config.PathExists(absolutePath) {
+			form.summary = append(form.summary, fmt.Sprintf("⚠️  Path does not exist: %s", absolutePath))
+		}
+
+	case "remove":
+		item := m.syncItems.FindSyncItem(form.itemName)
+		if item == nil {
+			form.err = fmt.Sprintf("Sync item not found: %s", form.itemName)
+			return
+		}
+		switch removeChoices[form.choice].mode {
+		case "local":
+			if item.GetCurrentComputerPath(m.localConfig.CurrentComputer) == "" {
+				form.err = fmt.Sprintf("'%s' is not configured for this computer (%s)", item.Name, m.localConfig.CurrentComputer)
+				return
+			}
+			if len(item.Paths) <= 1 && len(item.PathRules) == 0 {
+				form.err = fmt.Sprintf("'%s' only has one computer configured - remove it from all computers instead", item.Name)
+				return
+			}
+			form.summary = []string{fmt.Sprintf("Disable sync for %s on this computer (%s)", item.Name, m.localConfig.CurrentComputer)}
+		case "global":
+			form.summary = []string{fmt.Sprintf("Remove %s from all computers (cloud backup files preserved)", item.Name)}
+		case "delete-cloud":
+			form.summary = []string{
+				fmt.Sprintf("Remove %s from all computers", item.Name),
+				fmt.Sprintf("⚠️  Permanently delete %s", sync.ItemStorage(m.localConfig, item).Location(item.CloudKey())),
+			}
+		}
+	}
+
+	form.confirming = true
+}
+
+// applyForm returns a command that applies a confirmed form to the cloud sync items
+func (m tuiModel) applyForm() tea.Cmd {
+	form := m.form
+	localConfig := m.localConfig
+	kind, itemName, choice := form.kind, form.itemName, form.choice
+
+	values := make([]string, len(form.inputs))
+	for i := range form.inputs {
+		values[i] = form.value(i)
+	}
+
+	return func() tea.Msg {
+		// Update under the sync items lock so changes made elsewhere since the last refresh are kept
+		var message string
+		err := config.UpdateSyncItemsData(localConfig, func(syncItems *config.SyncItemsData) error {
+			if kind == "add" {
+				absolutePath, err := resolveInputPath(values[1])
+				if err != nil {
+					return fmt.Errorf("invalid path: %w", err)
+				}
+				itemType, err := config.DetectItemType(absolutePath)
+				if err != nil {
+					return fmt.Errorf("failed to stat path: %w", err)
+				}
+				paths := map[string]string{localConfig.CurrentComputer: absolutePath}
+				if err := syncItems.AddSyncItem(values[0], itemType, paths, parsePatterns(values[2])); err != nil {
+					return fmt.Errorf("failed to add sync item: %w", err)
+				}
+				message = fmt.Sprintf("Added sync item: %s", values[0])
+				return nil
+			}
+
+			item := syncItems.FindSyncItem(itemName)
+			if item == nil {
+				return fmt.Errorf("sync item not found: %s", itemName)
+			}
+
+			switch kind {
+			case "excludes":
+				item.ExcludePatterns = parsePatterns(values[0])
+				message = fmt.Sprintf("Updated exclude patterns for %s", itemName)
+
+			case "path":
+				absolutePath, err := resolveInputPath(values[0])
+				if err != nil {
+					return fmt.Errorf("invalid path: %w", err)
+				}
+				if item.Paths == nil {
+					item.Paths = make(map[string]string)
+				}
+				item.Paths[localConfig.CurrentComputer] = absolutePath
+				message = fmt.Sprintf("Configured %s -> %s", itemName, absolutePath)
+
+			case "remove":
+				var err error
+				message, err = removeItem(localConfig, syncItems, item, removeChoices[choice].mode)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return formAppliedMsg{err: err}
+		}
+		return formAppliedMsg{message: message}
+	}
+}
+
+// removeItem removes an item the same way the remove command does for the given mode
+func removeItem(localConfig *config.LocalConfig, syncItems *config.SyncItemsData, item *config.SyncItem, mode string) (string, error) {
+	fileStatesPath := filepath.Join(getConfigDir(), "file-states.json")
+
+	switch mode {
+	case "delete-cloud":
+		if err := item.DeleteCloudFiles(sync.ItemStorage(localConfig, item)); err != nil {
+			return "", fmt.Errorf("failed to delete cloud files: %w", err)
+		}
+		if err := config.CleanupItemMetadata(localConfig, fileStatesPath, item.Name); err != nil {
+			return "", err
+		}
+		syncItems.RemoveSyncItem(item.Name)
+		return fmt.Sprintf("Completely removed '%s' and deleted cloud backup files", item.Name), nil
+
+	case "global":
+		if err := config.CleanupItemMetadata(localConfig, fileStatesPath, item.Name); err != nil {
+			return "", err
+		}
+		syncItems.RemoveSyncItem(item.Name)
+		return fmt.Sprintf("Removed sync item '%s' from all computers (cloud backup files preserved)", item.Name), nil
+
+	default:
+		if len(item.Paths) <= 1 && len(item.PathRules) == 0 {
+			return "", fmt.Errorf("'%s' only has one computer configured", item.Name)
+		}
+		item.DisableOnComputer(localConfig.CurrentComputer)
+		return fmt.Sprintf("Disabled sync for '%s' on this computer (%s)", item.Name, localConfig.CurrentComputer), nil
+	}
+}
+
+// formView renders the open form
+func (m tuiModel) formView() string {
+	form := m.form
+
+	var b strings.Builder
+	b.WriteString(itemsHeaderStyle.Render(form.title()) + "\n")
+
+	if form.kind == "remove" {
+		for i, choice := range removeChoices {
+			if i == form.choice {
+				b.WriteString(selectedItemStyle.Render("▶ "+choice.label) + "\n")
+			} else {
+				b.WriteString(itemStyle.Render("  "+choice.label) + "\n")
+			}
+		}
+	}
+
+	for i, input := range form.inputs {
+		b.WriteString(detailLabelStyle.Render(form.labels[i]) + "\n")
+		b.WriteString(input.View() + "\n")
+
+		// Live file/folder detection while typing a new item's path
+		if form.kind == "add" && i == form.pathInput && form.value(i) != "" {
+			if absolutePath, err := resolveInputPath(form.value(i)); err == nil {
+				if itemType, err := config.DetectItemType(absolutePath); err == nil {
+					b.WriteString(fileCountStyle.Render(fmt.Sprintf("  Detected: %s %s", m.getTypeIcon(itemType), itemType)) + "\n")
+				} else {
+					b.WriteString(dimmedStyle.Render("  Path does not exist yet") + "\n")
+				}
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	// Paths used on other computers, like the setup command shows
+	if form.kind == "path" {
+		if item := m.syncItems.FindSyncItem(form.itemName); item != nil {
+			for _, computerID := range getSortedComputers(item.Paths) {
+				if computerID != m.localConfig.CurrentComputer {
+					b.WriteString(dimmedStyle.Render(fmt.Sprintf("  %s: %s", computerID, item.Paths[computerID])) + "\n")
+				}
+			}
+		}
+	}
+
+	if form.err != "" {
+		b.WriteString("\n" + conflictStyle.Render("❌ "+form.err) + "\n")
+	}
+
+	if form.confirming {
+		b.WriteString("\n")
+		for _, line := range form.summary {
+			b.WriteString(warningStyle.Render(line) + "\n")
+		}
+		b.WriteString(warningStyle.Render("Confirm? [Y/N]") + "\n")
+	}
+
+	return contentBoxStyle.Render(strings.TrimRight(b.String(), "\n"))
+}
+
+// formHelp returns the help bar text for the open form
+func (m tuiModel) formHelp() string {
+	switch {
+	case m.form.confirming:
+		return "💡 [Y] confirm  [N] back  [Esc] back"
+	case m.form.kind == "remove":
+		return "💡 [↑/↓] choose  [Enter] continue  [Esc] cancel"
+	case m.form.pathInput >= 0:
+		return "💡 [Tab] complete path  [Enter] next/continue  [↑/↓] field  [Esc] cancel"
+	default:
+		return "💡 [Enter] next/continue  [↑/↓] field  [Esc] cancel"
+	}
+}
@@ -0,0 +1,293 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+// saveItems saves the sync items of a model to its cloud directory
+func saveItems(t *testing.T, m tuiModel) {
+	t.Helper()
+	if err := m.syncItems.SaveSyncItemsData(m.localConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// savedItems loads the sync items saved in the cloud directory of a model
+func savedItems(t *testing.T, m tuiModel) *config.SyncItemsData {
+	t.Helper()
+	syncItems, err := config.LoadSyncItemsData(m.localConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return syncItems
+}
+
+// typeText types text into the focused input of the open form
+func typeText(t *testing.T, m tuiModel, text string) tuiModel {
+	t.Helper()
+	m, _ = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)})
+	return m
+}
+
+// confirmForm confirms the open form and applies it, returning the updated model
+func confirmForm(t *testing.T, m tuiModel) tuiModel {
+	t.Helper()
+	if !m.form.confirming {
+		t.Fatalf("the form doesn't ask for confirmation: %q", m.form.err)
+	}
+	m, cmd := update(t, m, keyMsg("y"))
+	if cmd == nil {
+		t.Fatal("confirming didn't apply the form")
+	}
+	m, _ = update(t, m, cmd())
+	return m
+}
+
+func TestAddForm(t *testing.T) {
+	m := newTestModel(t)
+	saveItems(t, m)
+	folder := t.TempDir()
+
+	m, _ = update(t, m, keyMsg("+"))
+	if m.view != "form" || m.form.kind != "add" {
+		t.Fatalf("+ opened %q, want the add form", m.view)
+	}
+	m = typeText(t, m, "Nvim")
+	m, _ = update(t, m, keyMsg("enter"))
+	m = typeText(t, m, folder)
+	if !strings.Contains(m.View(), "Detected: 📁 folder") {
+		t.Error("the form doesn't detect that the path is a folder")
+	}
+	m, _ = update(t, m, keyMsg("enter"))
+	m = typeText(t, m, "*.log, .cache/")
+	m, _ = update(t, m, keyMsg("enter"))
+
+	view := m.View()
+	for _, want := range []string{"Add 📁 Nvim (folder)", "Excludes: *.log, .cache/", "Confirm? [Y/N]"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("the confirmation doesn't show %q", want)
+		}
+	}
+
+	m = confirmForm(t, m)
+	if m.view != "list" || m.form != nil || m.lastStatus != "Added sync item: Nvim" {
+		t.Errorf("after adding, view %q and status %q", m.view, m.lastStatus)
+	}
+	item := savedItems(t, m).FindSyncItem("Nvim")
+	if item == nil {
+		t.Fatal("the item wasn't saved")
+	}
+	if item.Type != "folder" || item.Paths["laptop"] != folder || !reflect.DeepEqual(item.ExcludePatterns, []string{"*.log", ".cache/"}) {
+		t.Errorf("saved item = %+v", item)
+	}
+}
+
+func TestAddFormValidation(t *testing.T) {
+	existing := t.TempDir()
+	tests := []struct {
+		name, path string
+		wantErr    string
+	}{
+		{"", existing, "Name is required"},
+		{"Shell", existing, "Sync item with name 'Shell' already exists"},
+		{"New", "", "Path is required"},
+		{"New", filepath.Join(existing, "missing"), "Path does not exist"},
+	}
+	for _, test := range tests {
+		m := newTestModel(t, &config.SyncItem{Name: "Shell", Type: "file"})
+		m, _ = update(t, m, keyMsg("+"))
+		m = typeText(t, m, test.name)
+		m, _ = update(t, m, keyMsg("enter"))
+		m = typeText(t, m, test.path)
+		m, _ = update(t, m, keyMsg("enter"))
+		m, _ = update(t, m, keyMsg("enter"))
+		if m.form.confirming || !strings.Contains(m.form.err, test.wantErr) {
+			t.Errorf("name %q, path %q: error %q, want %q", test.name, test.path, m.form.err, test.wantErr)
+		}
+	}
+}
+
+func TestExcludesForm(t *testing.T) {
+	m := newTestModel(t, &config.SyncItem{Name: "Nvim", Type: "folder", ExcludePatterns: []string{"*.log"}})
+	saveItems(t, m)
+
+	m, _ = update(t, m, keyMsg("e"))
+	if m.form.value(0) != "*.log" {
+		t.Errorf("the form starts with %q, want the current patterns", m.form.value(0))
+	}
+	m = typeText(t, m, ", .cache/")
+	m, _ = update(t, m, keyMsg("enter"))
+
+	// Declining goes back to editing without saving
+	m, _ = update(t, m, keyMsg("n"))
+	if m.form.confirming || m.view != "form" {
+		t.Error("declining didn't go back to the form")
+	}
+	if patterns := savedItems(t, m).FindSyncItem("Nvim").ExcludePatterns; len(patterns) != 1 {
+		t.Errorf("declined patterns were saved: %v", patterns)
+	}
+
+	m, _ = update(t, m, keyMsg("enter"))
+	m = confirmForm(t, m)
+	if patterns := savedItems(t, m).FindSyncItem("Nvim").ExcludePatterns; !reflect.DeepEqual(patterns, []string{"*.log", ".cache/"}) {
+		t.Errorf("saved patterns = %v", patterns)
+	}
+}
+
+func TestPathForm(t *testing.T) {
+	m := newTestModel(t, &config.SyncItem{Name: "Nvim", Type: "folder", Paths: map[string]string{"desktop": "/home/me/.config/nvim"}})
+	saveItems(t, m)
+	local := filepath.Join(t.TempDir(), "nvim")
+
+	m, _ = update(t, m, keyMsg("c"))
+	if !strings.Contains(m.View(), "desktop: /home/me/.config/nvim") {
+		t.Error("the form doesn't show the paths of other computers")
+	}
+	m = typeText(t, m, local)
+	m, _ = update(t, m, keyMsg("enter"))
+	if !strings.Contains(m.View(), "Path does not exist") {
+		t.Error("the form doesn't warn about a missing path")
+	}
+
+	m = confirmForm(t, m)
+	paths := savedItems(t, m).FindSyncItem("Nvim").Paths
+	if paths["laptop"] != local || paths["desktop"] != "/home/me/.config/nvim" {
+		t.Errorf("saved paths = %v", paths)
+	}
+}
+
+func TestFormsApplyToTheLatestSyncItems(t *testing.T) {
+	m := newTestModel(t, &config.SyncItem{Name: "Nvim", Type: "folder"})
+	saveItems(t, m)
+
+	// Another computer adds an item while the form is open
+	m, _ = update(t, m, keyMsg("e"))
+	m = typeText(t, m, "*.log")
+	m, _ = update(t, m, keyMsg("enter"))
+	other := savedItems(t, m)
+	if err := other.AddSyncItem("Git", "file", map[string]string{"desktop": "~/.gitconfig"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SaveSyncItemsData(m.localConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	m = confirmForm(t, m)
+	saved := savedItems(t, m)
+	if saved.FindSyncItem("Git") == nil {
+		t.Error("the item added by the other computer was lost")
+	}
+	if patterns := saved.FindSyncItem("Nvim").ExcludePatterns; !reflect.DeepEqual(patterns, []string{"*.log"}) {
+		t.Errorf("saved patterns = %v", patterns)
+	}
+
+	// Another computer removes the item while the form is open
+	m, _ = update(t, m, keyMsg("e"))
+	m, _ = update(t, m, keyMsg("enter"))
+	saved.RemoveSyncItem("Nvim")
+	if err := saved.SaveSyncItemsData(m.localConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	m, cmd := update(t, m, keyMsg("y"))
+	m, _ = update(t, m, cmd())
+	if m.view != "form" || !strings.Contains(m.form.err, "sync item not found: Nvim") {
+		t.Errorf("after the item was removed, view %q and error %q", m.view, m.form.err)
+	}
+	if savedItems(t, m).FindSyncItem("Nvim") != nil {
+		t.Error("the form saved the removed item again")
+	}
+}
+
+func TestRemoveForm(t *testing.T) {
+	tests := []struct {
+		choice      int // number of down presses
+		paths       map[string]string
+		wantErr     string
+		wantRemoved bool
+		wantPaths   int
+		wantCloud   bool
+	}{
+		{choice: 0, paths: map[string]string{"laptop": "/a", "desktop": "/b"}, wantPaths: 1, wantCloud: true},
+		{choice: 0, paths: map[string]string{"laptop": "/a"}, wantErr: "only has one computer configured"},
+		{choice: 0, paths: map[string]string{"desktop": "/b"}, wantErr: "is not configured for this computer"},
+		{choice: 1, paths: map[string]string{"laptop": "/a"}, wantRemoved: true, wantCloud: true},
+		{choice: 2, paths: map[string]string{"laptop": "/a"}, wantRemoved: true},
+	}
+	for _, test := range tests {
+		m := newTestModel(t, &config.SyncItem{Name: "Nvim", Type: "folder", Paths: test.paths})
+		saveItems(t, m)
+		cloudFolder(t, m, "Nvim", map[string]string{"init.lua": "set number"})
+
+		m, _ = update(t, m, keyMsg("x"))
+		for i := 0; i < test.choice; i++ {
+			m, _ = update(t, m, keyMsg("down"))
+		}
+		m, _ = update(t, m, keyMsg("enter"))
+		if test.wantErr != "" {
+			if m.form.confirming || !strings.Contains(m.form.err, test.wantErr) {
+				t.Errorf("choice %d: error %q, want %q", test.choice, m.form.err, test.wantErr)
+			}
+			continue
+		}
+
+		m = confirmForm(t, m)
+		item := savedItems(t, m).FindSyncItem("Nvim")
+		if removed := item == nil; removed != test.wantRemoved {
+			t.Errorf("choice %d: removed = %v, want %v", test.choice, removed, test.wantRemoved)
+		}
+		if item != nil && len(item.Paths) != test.wantPaths {
+			t.Errorf("choice %d: paths = %v", test.choice, item.Paths)
+		}
+		_, err := os.Stat(filepath.Join(m.localConfig.GetCloudConfigsPath(), "Nvim"))
+		if cloud := err == nil; cloud != test.wantCloud {
+			t.Errorf("choice %d: cloud files kept = %v, want %v", test.choice, cloud, test.wantCloud)
+		}
+	}
+}
+
+func TestFormsCanBeCancelled(t *testing.T) {
+	m := newTestModel(t, &config.SyncItem{Name: "Nvim", Type: "folder"})
+	for _, key := range []string{"+", "e", "c", "x"} {
+		m, _ = update(t, m, keyMsg(key))
+		if m.view != "form" {
+			t.Fatalf("%s didn't open a form", key)
+		}
+		m, _ = update(t, m, keyMsg("esc"))
+		if m.view != "list" || m.form != nil {
+			t.Errorf("esc didn't close the form opened by %s", key)
+		}
+	}
+}
+
+func TestPathSuggestions(t *testing.T) {
+	dir := t.TempDir()
+	writeWithTime(t, filepath.Join(dir, "nvim", "init.lua"), time.Now())
+	writeWithTime(t, filepath.Join(dir, "notes.txt"), time.Now())
+	writeWithTime(t, filepath.Join(dir, ".hidden"), time.Now())
+
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{dir + "/n", []string{dir + "/notes.txt", dir + "/nvim/"}},
+		{dir + "/nv", []string{dir + "/nvim/"}},
+		{dir + "/.h", []string{dir + "/.hidden"}},
+		{dir + "/missing/", nil},
+	}
+	for _, test := range tests {
+		if got := pathSuggestions(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pathSuggestions(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
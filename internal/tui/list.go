@@ -0,0 +1,488 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+// listChrome is the number of lines used around the item list (title, header, borders, help bar)
+const listChrome = 26
+
+// statusFilters are the status filters cycled with the filter key
+var statusFilters = []struct {
+	name  string
+	label string
+}{
+	{"all", "All items"},
+	{"conflicts", "Only conflicts"},
+	{"pending", "Only pending"},
+	{"unconfigured", "Not configured here"},
+}
+
+// groupModes are the grouping modes cycled with the group key
+var groupModes = []string{"none", "type", "tag"}
+
+// untaggedGroup is the group key of items without tags; it sorts after every tag
+const untaggedGroup = "~"
+
+// listRow is a line of the item list: either a group header or an item
+type listRow struct {
+	header string
+	item   *config.SyncItem
+	index  int // index of the item among the visible items, -1 for headers
+}
+
+// newSearchInput creates the search input of the item list
+func newSearchInput() textinput.Model {
+	input := textinput.New()
+	input.Prompt = "🔍 "
+	input.Placeholder = "search name or path"
+	input.Width = 40
+	return input
+}
+
+// visibleItems returns the items matching the search query and status filter,
+// ordered by group and search relevance
+func (m tuiModel) visibleItems() []*config.SyncItem {
+	query := strings.TrimSpace(m.searchInput.Value())
+
+	type scoredItem struct {
+		item  *config.SyncItem
+		score int
+	}
+
+	var matches []scoredItem
+	for _, item := range m.syncItems.SyncItems {
+		if !m.matchesStatusFilter(item) {
+			continue
+		}
+
+		score := 0
+		if query != "" {
+			nameScore, nameMatch := fuzzyScore(query, item.Name)
+			pathScore, pathMatch := fuzzyScore(query, item.GetCurrentComputerPath(m.localConfig.CurrentComputer))
+			if !nameMatch && !pathMatch {
+				continue
+			}
+			// Name matches rank above path matches
+			if nameMatch {
+				score = nameScore * 2
+			}
+			if pathMatch && pathScore > score {
+				score = pathScore
+			}
+		}
+		matches = append(matches, scoredItem{item: item, score: score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		groupI, groupJ := m.groupKey(matches[i].item), m.groupKey(matches[j].item)
+		if groupI != groupJ {
+			return groupI < groupJ
+		}
+		return matches[i].score > matches[j].score
+	})
+
+	items := make([]*config.SyncItem, len(matches))
+	for i, match := range matches {
+		items[i] = match.item
+	}
+	return items
+}
+
+// currentItem returns the item under the cursor, or nil if no item is visible
+func (m tuiModel) currentItem() *config.SyncItem {
+	items := m.visibleItems()
+	if m.cursor < 0 || m.cursor >= len(items) {
+		return nil
+	}
+	return items[m.cursor]
+}
+
+// matchesStatusFilter reports whether an item passes the active status filter
+func (m tuiModel) matchesStatusFilter(item *config.SyncItem) bool {
+	status := m.getItemStatus(item)
+
+	switch statusFilters[m.statusFilter].name {
+	case "conflicts":
+		return status == "Conflict" || m.itemStates[item.Name] == "conflict"
+	case "pending":
+		switch status {
+		case "Local newer", "Cloud newer", "Local missing", "Cloud missing":
+			return true
+		}
+		return false
+	case "unconfigured":
+		return status == "No path"
+	default:
+		return true
+	}
+}
+
+// groupKey returns the group an item belongs to, or "" when grouping is off
+func (m tuiModel) groupKey(item *config.SyncItem) string {
+	switch groupModes[m.groupMode] {
+	case "type":
+		return item.Type
+	case "tag":
+		// Items are listed once, under their first tag
+		if len(item.Tags) == 0 {
+			return untaggedGroup
+		}
+		return item.Tags[0]
+	default:
+		return ""
+	}
+}
+
+// groupTitle returns the header shown above a group
+func (m tuiModel) groupTitle(key string, count int) string {
+	switch groupModes[m.groupMode] {
+	case "type":
+		return fmt.Sprintf("%s %ss (%d)", m.getTypeIcon(key), key, count)
+	case "tag":
+		if key == untaggedGroup {
+			return fmt.Sprintf("🏷️  untagged (%d)", count)
+		}
+		return fmt.Sprintf("🏷️  %s (%d)", key, count)
+	default:
+		return key
+	}
+}
+
+// fuzzyScore reports whether all characters of query appear in text in order,
+// scoring consecutive matches and matches at word boundaries higher
+func fuzzyScore(query, text string) (int, bool) {
+	queryRunes := []rune(strings.ToLower(query))
+	textRunes := []rune(strings.ToLower(text))
+	if len(queryRunes) == 0 {
+		return 0, true
+	}
+
+	score, queryIndex, lastMatch := 0, 0, -2
+	for i, r := range textRunes {
+		if queryIndex >= len(queryRunes) {
+			break
+		}
+		if r != queryRunes[queryIndex] {
+			continue
+		}
+
+		score++
+		if lastMatch == i-1 {
+			score += 3 // consecutive characters
+		}
+		if i == 0 || !unicode.IsLetter(textRunes[i-1]) && !unicode.IsDigit(textRunes[i-1]) {
+			score += 2 // start of a word
+		}
+		lastMatch = i
+		queryIndex++
+	}
+
+	return score, queryIndex == len(queryRunes)
+}
+
+// listRows builds the rows of the item list, inserting group headers when grouping
+func (m tuiModel) listRows(items []*config.SyncItem) []listRow {
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[m.groupKey(item)]++
+	}
+
+	var rows []listRow
+	currentGroup := ""
+	for i, item := range items {
+		if key := m.groupKey(item); key != "" && (i == 0 || key != currentGroup) {
+			rows = append(rows, listRow{header: m.groupTitle(key, counts[key]), index: -1})
+			currentGroup = key
+		}
+		rows = append(rows, listRow{item: item, index: i})
+	}
+	return rows
+}
+
+// rowHeight returns the number of lines a row takes when rendered
+func (m tuiModel) rowHeight(row listRow) int {
+	if row.item == nil {
+		return 1
+	}
+	if m.itemNotes[row.item.Name] != "" {
+		return 4
+	}
+	return 3
+}
+
+// listHeight returns the number of lines available to the item list, or 0 when unlimited
+func (m tuiModel) listHeight() int {
+	if m.height == 0 {
+		return 0
+	}
+
+	height := m.height - listChrome
+	if len(m.results) > 0 {
+		shown := len(m.results)
+		if shown > maxResultLines {
+			shown = maxResultLines
+		}
+		height -= shown + 7
+	}
+	if m.searching || m.searchInput.Value() != "" {
+		height -= 2
+	}
+	if height < 3 {
+		height = 3
+	}
+	return height
+}
+
+// listWindow returns the first row to render so that the cursor stays visible,
+// starting from the stored scroll offset
+func (m tuiModel) listWindow(rows []listRow) int {
+	height := m.listHeight()
+	if height == 0 {
+		return 0
+	}
+
+	cursorRow := 0
+	for i, row := range rows {
+		if row.index == m.cursor {
+			cursorRow = i
+			break
+		}
+	}
+
+	start := m.listOffset
+	if start > cursorRow {
+		start = cursorRow
+	}
+	// Keep the group header of the cursor visible when scrolling up to it
+	if start == cursorRow && start > 0 && rows[start-1].item == nil {
+		start--
+	}
+
+	for start < cursorRow {
+		used := 0
+		for i := start; i <= cursorRow; i++ {
+			used += m.rowHeight(rows[i])
+		}
+		if used <= height {
+			break
+		}
+		start++
+	}
+	return start
+}
+
+// scrollToCursor stores the scroll offset that keeps the cursor visible
+func (m *tuiModel) scrollToCursor() {
+	m.listOffset = m.listWindow(m.listRows(m.visibleItems()))
+}
+
+// moveCursor moves the cursor by delta visible items, clamped to the list
+func (m *tuiModel) moveCursor(delta int) {
+	count := len(m.visibleItems())
+	m.cursor += delta
+	if m.cursor >= count {
+		m.cursor = count - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	m.scrollToCursor()
+}
+
+// pageSize returns the approximate number of items that fit on screen
+func (m tuiModel) pageSize() int {
+	if height := m.listHeight(); height > 0 {
+		if size := height / 3; size > 1 {
+			return size
+		}
+	}
+	return 1
+}
+
+// keepCursorOn moves the cursor to the named item if it is visible, otherwise clamps it
+func (m *tuiModel) keepCursorOn(name string) {
+	for i, item := range m.visibleItems() {
+		if item.Name == name {
+			m.cursor = i
+			m.scrollToCursor()
+			return
+		}
+	}
+	m.moveCursor(0)
+}
+
+// updateSearch handles key presses while typing a search query
+func (m tuiModel) updateSearch(msg tea.KeyMsg) (tuiModel, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.searching = false
+		m.searchInput.SetValue("")
+		m.searchInput.Blur()
+		m.moveCursor(0)
+		return m, nil
+
+	case "enter":
+		m.searching = false
+		m.searchInput.Blur()
+		return m, nil
+
+	case "up":
+		m.moveCursor(-1)
+		return m, nil
+
+	case "down":
+		m.moveCursor(1)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.searchInput, cmd = m.searchInput.Update(msg)
+	m.cursor = 0
+	m.listOffset = 0
+	return m, cmd
+}
+
+// renderItemList renders the visible rows of the item list
+func (m tuiModel) renderItemList() string {
+	var b strings.Builder
+
+	if m.searching || m.searchInput.Value() != "" {
+		b.WriteString(m.searchInput.View() + "\n\n")
+	}
+
+	if len(m.syncItems.SyncItems) == 0 {
+		b.WriteString(dimmedStyle.Render("📭 No sync items configured yet") + "\n")
+		b.WriteString(dimmedStyle.Render("💡 Add items with: syncstation add") + "\n")
+		return b.String()
+	}
+
+	items := m.visibleItems()
+	if len(items) == 0 {
+		b.WriteString(dimmedStyle.Render("🔎 No items match the current search and filter") + "\n")
+		return b.String()
+	}
+
+	rows := m.listRows(items)
+	start := m.listWindow(rows)
+	height := m.listHeight()
+
+	if start > 0 {
+		b.WriteString(dimmedStyle.Render(fmt.Sprintf("  ↑ %d more", start)) + "\n")
+	}
+
+	used, end := 0, start
+	for end < len(rows) {
+		rowHeight := m.rowHeight(rows[end])
+		if height > 0 && used+rowHeight > height && end > start {
+			break
+		}
+		used += rowHeight
+
+		row := rows[end]
+		if row.item == nil {
+			b.WriteString(detailLabelStyle.Render(row.header) + "\n")
+		} else {
+			b.WriteString(m.renderItem(row.item, row.index == m.cursor))
+		}
+		end++
+	}
+
+	if end < len(rows) {
+		b.WriteString(dimmedStyle.Render(fmt.Sprintf("  ↓ %d more", len(rows)-end)) + "\n")
+	}
+
+	return b.String()
+}
+
+// renderItem renders a single item with its status, path and sync notes
+func (m tuiModel) renderItem(item *config.SyncItem, isCursor bool) string {
+	var b strings.Builder
+
+	// Fancy cursor indicator
+	cursor := "  "
+	if isCursor {
+		cursor = "▶ "
+	}
+
+	// Enhanced checkbox with fancy symbols
+	checkbox := "☐"
+	if m.selected[item.Name] {
+		checkbox = "☑"
+	}
+
+	// Get status and apply fancy styling
+	styledStatus := m.getSyncStateStatus(item.Name)
+	if styledStatus == "" {
+		styledStatus = m.getStyledStatus(m.getItemStatus(item))
+	}
+
+	// Get item type icon
+	typeIcon := m.getTypeIcon(item.Type)
+
+	// Get local path with fancy formatting
+	localPath := item.GetCurrentComputerPath(m.localConfig.CurrentComputer)
+	pathInfo := "⚠️  No path configured"
+	if localPath != "" {
+		pathInfo = pathStyle.Render(localPath)
+	}
+
+	// File count if available
+	fileCount := m.getFileCount(item)
+
+	// Main item line with fancy formatting
+	itemLine := fmt.Sprintf("%s%s %s %s %s",
+		cursor, checkbox, typeIcon, item.Name, styledStatus)
+
+	// Sub-line with path and details
+	subLine := fmt.Sprintf("    %s %s", pathInfo, fileCount)
+
+	if isCursor {
+		b.WriteString(selectedItemStyle.Render(itemLine) + "\n")
+		b.WriteString(selectedItemStyle.Render(subLine) + "\n")
+	} else {
+		b.WriteString(itemStyle.Render(itemLine) + "\n")
+		b.WriteString(dimmedStyle.Render(subLine) + "\n")
+	}
+
+	// Inline conflict or error details from the last sync
+	if note := m.itemNotes[item.Name]; note != "" {
+		noteStyle := warningStyle
+		if m.itemStates[item.Name] == "conflict" || m.itemStates[item.Name] == "error" {
+			noteStyle = conflictStyle
+		}
+		b.WriteString(noteStyle.Render("    ↳ "+note) + "\n")
+	}
+
+	// Add spacing between items
+	b.WriteString("\n")
+	return b.String()
+}
+
+// listTitle returns the item list header, including active filter and grouping
+func (m tuiModel) listTitle() string {
+	title := "📦 Sync Items"
+	if m.statusFilter != 0 {
+		title += " · " + statusFilters[m.statusFilter].label
+	}
+	if groupModes[m.groupMode] != "none" {
+		title += " · by " + groupModes[m.groupMode]
+	}
+	return title
+}
+
+// currentItemName returns the name of the item under the cursor, or "" if none
+func (m tuiModel) currentItemName() string {
+	if item := m.currentItem(); item != nil {
+		return item.Name
+	}
+	return ""
+}
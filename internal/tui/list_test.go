@@ -0,0 +1,188 @@
+package tui
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+)
+
+// visibleNames returns the names of the visible items of a model
+func visibleNames(m tuiModel) []string {
+	var names []string
+	for _, item := range m.visibleItems() {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, text string
+		match       bool
+	}{
+		{"", "anything", true},
+		{"nvim", "Nvim", true},
+		{"nvm", "Nvim", true},
+		{"cfg", "~/.config/git", true},
+		{"vn", "Nvim", false},
+		{"zsh", "bash", false},
+	}
+	for _, test := range tests {
+		if _, match := fuzzyScore(test.query, test.text); match != test.match {
+			t.Errorf("fuzzyScore(%q, %q) matches = %v, want %v", test.query, test.text, match, test.match)
+		}
+	}
+
+	// Consecutive characters and word starts score higher
+	consecutive, _ := fuzzyScore("git", "git config")
+	scattered, _ := fuzzyScore("git", "great interest")
+	if consecutive <= scattered {
+		t.Errorf("consecutive match scores %d, not above scattered match %d", consecutive, scattered)
+	}
+}
+
+func TestSearchMatchesNameAndPath(t *testing.T) {
+	m := newTestModel(t,
+		&config.SyncItem{Name: "Shell", Type: "file", Paths: map[string]string{"laptop": "/home/me/.zshrc"}},
+		&config.SyncItem{Name: "Nvim", Type: "folder", Paths: map[string]string{"laptop": "/home/me/.config/nvim"}},
+		&config.SyncItem{Name: "Git", Type: "file", Paths: map[string]string{"laptop": "/home/me/.gitconfig"}},
+	)
+
+	m, _ = update(t, m, keyMsg("/"))
+	if !m.searching {
+		t.Fatal("/ didn't start a search")
+	}
+	m = typeText(t, m, "zsh")
+	if got := visibleNames(m); !reflect.DeepEqual(got, []string{"Shell"}) {
+		t.Errorf("search by path shows %v, want Shell", got)
+	}
+	m = typeText(t, m, "x")
+	if !strings.Contains(m.View(), "No items match") {
+		t.Error("the list doesn't explain that no item matches")
+	}
+
+	// Enter keeps the query, esc in the list clears it
+	m, _ = update(t, m, tea.KeyMsg{Type: tea.KeyBackspace})
+	m, _ = update(t, m, keyMsg("enter"))
+	if m.searching || len(visibleNames(m)) != 1 {
+		t.Errorf("enter ended the search with %v visible", visibleNames(m))
+	}
+	if !strings.Contains(m.View(), "1/3 items") {
+		t.Error("the header doesn't show how many items are visible")
+	}
+	m, _ = update(t, m, keyMsg("esc"))
+	if len(visibleNames(m)) != 3 {
+		t.Errorf("esc left %v visible", visibleNames(m))
+	}
+
+	// Name matches rank above path matches
+	m, _ = update(t, m, keyMsg("/"))
+	m = typeText(t, m, "git")
+	if got := visibleNames(m); len(got) == 0 || got[0] != "Git" {
+		t.Errorf("search for git shows %v, want Git first", got)
+	}
+}
+
+func TestStatusFilters(t *testing.T) {
+	m := newTestModel(t,
+		&config.SyncItem{Name: "Ready", Type: "file"},
+		&config.SyncItem{Name: "Conflict", Type: "file"},
+		&config.SyncItem{Name: "Pending", Type: "file"},
+		&config.SyncItem{Name: "Unconfigured", Type: "file"},
+	)
+	m.statuses = map[string]string{"Ready": "Ready", "Conflict": "Conflict", "Pending": "Cloud newer", "Unconfigured": "No path"}
+
+	want := []struct {
+		title string
+		names []string
+	}{
+		{"Only conflicts", []string{"Conflict"}},
+		{"Only pending", []string{"Pending"}},
+		{"Not configured here", []string{"Unconfigured"}},
+		{"Sync Items", []string{"Ready", "Conflict", "Pending", "Unconfigured"}},
+	}
+	for _, filter := range want {
+		m, _ = update(t, m, keyMsg("f"))
+		if got := visibleNames(m); !reflect.DeepEqual(got, filter.names) {
+			t.Errorf("filter %q shows %v, want %v", filter.title, got, filter.names)
+		}
+		if !strings.Contains(m.View(), filter.title) {
+			t.Errorf("the list title doesn't show the filter %q", filter.title)
+		}
+	}
+
+	// Items conflicting in the last sync count as conflicts
+	m.itemStates["Ready"] = "conflict"
+	m, _ = update(t, m, keyMsg("f"))
+	if got := visibleNames(m); !reflect.DeepEqual(got, []string{"Ready", "Conflict"}) {
+		t.Errorf("conflict filter shows %v, want the item that conflicted in the last sync too", got)
+	}
+}
+
+func TestGroupingByType(t *testing.T) {
+	m := newTestModel(t,
+		&config.SyncItem{Name: "Shell", Type: "file"},
+		&config.SyncItem{Name: "Nvim", Type: "folder"},
+		&config.SyncItem{Name: "Git", Type: "file"},
+	)
+	m.cursor = 1 // Nvim
+
+	m, _ = update(t, m, keyMsg("g"))
+	if got := visibleNames(m); !reflect.DeepEqual(got, []string{"Shell", "Git", "Nvim"}) {
+		t.Errorf("grouped items = %v", got)
+	}
+	if m.currentItemName() != "Nvim" {
+		t.Errorf("grouping moved the cursor to %q", m.currentItemName())
+	}
+
+	var headers []string
+	for _, row := range m.listRows(m.visibleItems()) {
+		if row.item == nil {
+			headers = append(headers, row.header)
+		}
+	}
+	if !reflect.DeepEqual(headers, []string{"📄 files (2)", "📁 folders (1)"}) {
+		t.Errorf("group headers = %v", headers)
+	}
+}
+
+func TestListScrollsToKeepTheCursorVisible(t *testing.T) {
+	var items []*config.SyncItem
+	for i := 0; i < 60; i++ {
+		items = append(items, &config.SyncItem{Name: fmt.Sprintf("item-%02d", i), Type: "file"})
+	}
+	m := newTestModel(t, items...)
+	m, _ = update(t, m, tea.WindowSizeMsg{Width: 120, Height: 40})
+
+	view := m.View()
+	if !strings.Contains(view, "item-00") || strings.Contains(view, "item-59") || !strings.Contains(view, "more") {
+		t.Error("a long list isn't cut to the window height")
+	}
+
+	m, _ = update(t, m, keyMsg("end"))
+	view = m.View()
+	if m.cursor != 59 || !strings.Contains(view, "item-59") || strings.Contains(view, "item-00") {
+		t.Errorf("end moved the cursor to %d without scrolling to it", m.cursor)
+	}
+	if !strings.Contains(view, "↑") {
+		t.Error("the list doesn't show that items are hidden above")
+	}
+
+	m, _ = update(t, m, keyMsg("pgup"))
+	if m.cursor != 59-m.pageSize() {
+		t.Errorf("pgup moved the cursor to %d, want %d", m.cursor, 59-m.pageSize())
+	}
+	if !strings.Contains(m.View(), items[m.cursor].Name) {
+		t.Error("the cursor isn't visible after pgup")
+	}
+
+	m, _ = update(t, m, keyMsg("home"))
+	if m.cursor != 0 || m.listOffset != 0 {
+		t.Errorf("home left the cursor at %d and offset %d", m.cursor, m.listOffset)
+	}
+}
@@ -1,16 +1,25 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/diff"
+	"github.com/AntoineArt/syncstation/internal/gitrepo"
+	"github.com/AntoineArt/syncstation/internal/storage"
+	"github.com/AntoineArt/syncstation/internal/sync"
 )
 
 // TUI styles - Enhanced with fancy visual elements
@@ -114,19 +123,73 @@ var (
 
 	fileCountStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#8BE9FD"))
+
+	// Results pane shown below the item list
+	resultsBoxStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#44475A")).
+			Padding(0, 2).
+			MarginBottom(1)
+
+	spinnerStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF79C6"))
 )
 
+// maxResultLines is the number of most recent file outcomes shown in the results pane
+const maxResultLines = 8
+
+// autoRefreshInterval is how often the cloud directory is checked for changes
+const autoRefreshInterval = 3 * time.Second
+
+// remoteRefreshInterval is how often remote storages are checked for changes, since every
+// check lists the cloud copies over the network
+const remoteRefreshInterval = 30 * time.Second
+
 // TUI model
 type tuiModel struct {
 	localConfig *config.LocalConfig
 	syncItems   *config.SyncItemsData
+	encryption  *config.EncryptionData
 	cursor      int
-	selected    map[int]bool
+	selected    map[string]bool // item name -> selected
 	showStatus  bool
 	lastStatus  string
 	width       int
 	height      int
 	err         error
+
+	// Search, filtering, grouping and scrolling of the item list
+	searchInput  textinput.Model
+	searching    bool // typing a search query
+	statusFilter int  // index into statusFilters
+	groupMode    int  // index into groupModes
+	listOffset   int  // first rendered row of the item list
+
+	// Sync progress
+	spinner    spinner.Model
+	syncing    bool
+	syncOp     sync.SyncOperation
+	syncEvents chan tea.Msg
+	itemStates map[string]string // item name -> "queued", "syncing", "done", "conflict", "error"
+	itemNotes  map[string]string // item name -> inline conflict or error message
+	results    []sync.FileOutcome
+
+	// Live item statuses, computed in the background
+	statuses         map[string]string // item name -> status
+	fileCounts       map[string]int    // item name -> number of local files
+	statusGeneration int               // incremented on every refresh to drop stale results
+	cloudFingerprint string            // last seen state of the cloud directory
+
+	// Detail, diff and form views
+	view          string // "list", "detail", "diff" or "form"
+	detailName    string
+	detailFiles   []detailFile
+	detailLoading bool
+	detailErr     error
+	fileCursor    int
+	diffViewport  viewport.Model
+	diffTitle     string
+	form          *itemForm
 }
 
 type statusMsg struct {
@@ -134,6 +197,57 @@ type statusMsg struct {
 	isError bool
 }
 
+// itemSyncStartedMsg is sent when the sync of an item begins
+type itemSyncStartedMsg struct {
+	name string
+}
+
+// fileOutcomeMsg streams a single file outcome from the sync engine
+type fileOutcomeMsg struct {
+	outcome sync.FileOutcome
+}
+
+// itemSyncedMsg is sent when the sync of an item completes
+type itemSyncedMsg struct {
+	name   string
+	result *sync.SyncResult
+	err    error
+}
+
+// dataRefreshedMsg carries sync items reloaded from cloud storage
+type dataRefreshedMsg struct {
+	syncItems  *config.SyncItemsData
+	encryption *config.EncryptionData
+	auto       bool // triggered by a cloud directory change rather than a key press
+}
+
+// itemStatusesMsg carries the statuses and file counts of the items computed in the background
+type itemStatusesMsg struct {
+	generation int
+	statuses   map[string]string
+	fileCounts map[string]int
+}
+
+// cloudCheckMsg carries the current fingerprint of the cloud directory
+type cloudCheckMsg struct {
+	fingerprint string
+	busy        bool // the cloud drive client is still syncing the directory
+}
+
+// syncWaitingMsg is sent while a sync waits for the cloud drive client to settle
+type syncWaitingMsg struct {
+	pending int // files still downloading
+}
+
+// syncFinishedMsg is sent once every queued item has been processed
+type syncFinishedMsg struct {
+	changed   int
+	skipped   int
+	errored   int
+	conflicts int
+	git       string // What git mode committed and pushed, or why it failed
+}
+
 // InitialTUIModel initializes the TUI model
 func InitialTUIModel() (tuiModel, error) {
 	// Load local config
@@ -147,71 +261,203 @@ func InitialTUIModel() (tuiModel, error) {
 	}
 
 	// Load sync items
-	syncItems, err := config.LoadSyncItemsData(localConfig.GetSyncItemsPath())
+	syncItems, err := config.LoadSyncItemsData(localConfig)
 	if err != nil {
 		return tuiModel{}, fmt.Errorf("failed to load sync items: %w", err)
 	}
 
+	// Load encryption settings
+	encryptionData, err := config.LoadEncryptionData(localConfig)
+	if err != nil {
+		return tuiModel{}, fmt.Errorf("failed to load encryption settings: %w", err)
+	}
+
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = spinnerStyle
+
 	return tuiModel{
 		localConfig: localConfig,
 		syncItems:   syncItems,
-		selected:    make(map[int]bool),
+		encryption:  encryptionData,
+		selected:    make(map[string]bool),
+		spinner:     s,
+		searchInput: newSearchInput(),
+		view:        "list",
+		itemStates:  make(map[string]string),
+		itemNotes:   make(map[string]string),
+		statuses:    make(map[string]string),
+		fileCounts:  make(map[string]int),
 	}, nil
 }
 
 func (m tuiModel) Init() tea.Cmd {
-	return nil
+	return tea.Batch(
+		computeStatuses(m.localConfig, m.syncItems.SyncItems, m.statusGeneration),
+		checkCloudDir(m.localConfig, 0),
+	)
 }
 
 func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+
+		switch m.view {
+		case "detail":
+			return m.updateDetail(msg)
+		case "diff":
+			return m.updateDiff(msg)
+		case "form":
+			return m.updateForm(msg)
+		}
+
+		if m.searching {
+			return m.updateSearch(msg)
+		}
+
 		switch msg.String() {
-		case "ctrl+c", "q":
+		case "q":
 			return m, tea.Quit
 
 		case "up", "k":
-			if m.cursor > 0 {
-				m.cursor--
-			}
+			m.moveCursor(-1)
 
 		case "down", "j":
-			if m.cursor < len(m.syncItems.SyncItems)-1 {
-				m.cursor++
-			}
+			m.moveCursor(1)
+
+		case "pgup":
+			m.moveCursor(-m.pageSize())
+
+		case "pgdown":
+			m.moveCursor(m.pageSize())
+
+		case "home":
+			m.moveCursor(-len(m.syncItems.SyncItems))
+
+		case "end":
+			m.moveCursor(len(m.syncItems.SyncItems))
 
 		case " ":
 			// Toggle selection
-			if len(m.syncItems.SyncItems) > 0 {
-				m.selected[m.cursor] = !m.selected[m.cursor]
+			if item := m.currentItem(); item != nil {
+				m.selected[item.Name] = !m.selected[item.Name]
 			}
 
 		case "a":
-			// Select all
-			for i := range m.syncItems.SyncItems {
-				m.selected[i] = true
+			// Select all visible items
+			for _, item := range m.visibleItems() {
+				m.selected[item.Name] = true
 			}
 
+		case "/":
+			// Search by name or path
+			m.searching = true
+			return m, m.searchInput.Focus()
+
+		case "f":
+			// Cycle status filters, keeping the cursor on the same item if possible
+			name := m.currentItemName()
+			m.statusFilter = (m.statusFilter + 1) % len(statusFilters)
+			m.keepCursorOn(name)
+
+		case "g":
+			// Cycle grouping modes
+			name := m.currentItemName()
+			m.groupMode = (m.groupMode + 1) % len(groupModes)
+			m.keepCursorOn(name)
+
+		case "esc":
+			// Clear search and filter
+			name := m.currentItemName()
+			m.searchInput.SetValue("")
+			m.statusFilter = 0
+			m.keepCursorOn(name)
+
 		case "n":
 			// Select none
-			m.selected = make(map[int]bool)
+			m.selected = make(map[string]bool)
 
 		case "s":
-			// Sync selected items
-			return m, m.syncSelected()
+			// Smart sync selected items
+			return m.syncSelected(sync.SyncSmart)
+
+		case "p":
+			// Push selected items
+			return m.syncSelected(sync.SyncPush)
+
+		case "l":
+			// Pull selected items
+			return m.syncSelected(sync.SyncPull)
 
 		case "enter":
-			// Show item details (placeholder)
-			if len(m.syncItems.SyncItems) > 0 && m.cursor < len(m.syncItems.SyncItems) {
-				item := m.syncItems.SyncItems[m.cursor]
-				m.lastStatus = fmt.Sprintf("Details for: %s", item.Name)
-				m.showStatus = true
-			}
+			// Show item details
+			return m.openDetail()
 
 		case "r":
 			// Refresh data
-			return m, m.refreshData()
+			return m, m.refreshData(false)
+
+		case "+":
+			// Add a new sync item
+			return m.openForm("add")
+
+		case "e":
+			// Edit exclude patterns
+			return m.openForm("excludes")
+
+		case "c":
+			// Configure the path on this computer
+			return m.openForm("path")
+
+		case "x", "delete":
+			// Remove the item
+			return m.openForm("remove")
+		}
+
+	case formAppliedMsg:
+		if m.form == nil {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.form.err = msg.err.Error()
+			return m, nil
+		}
+		m.form = nil
+		m.view = "list"
+		m.lastStatus = msg.message
+		m.showStatus = true
+		return m, m.refreshData(true)
+
+	case dataRefreshedMsg:
+		return m.applyRefresh(msg)
+
+	case itemStatusesMsg:
+		if msg.generation == m.statusGeneration {
+			// Statuses drive the status filter, so keep the cursor on the same item
+			name := m.currentItemName()
+			for itemName, status := range msg.statuses {
+				m.statuses[itemName] = status
+				m.fileCounts[itemName] = msg.fileCounts[itemName]
+			}
+			m.keepCursorOn(name)
+		}
+
+	case cloudCheckMsg:
+		// Changes are looked at once the cloud drive client has finished downloading them
+		next := checkCloudDir(m.localConfig, autoRefreshInterval)
+		if msg.busy {
+			return m, next
+		}
+		changed := m.cloudFingerprint != "" && msg.fingerprint != m.cloudFingerprint
+		m.cloudFingerprint = msg.fingerprint
+
+		if changed && !m.syncing {
+			return m, tea.Batch(next, m.refreshData(true))
 		}
+		return m, next
 
 	case statusMsg:
 		m.lastStatus = msg.message
@@ -225,11 +471,137 @@ func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.diffViewport.Width, m.diffViewport.Height = m.diffViewportSize()
+		m.scrollToCursor()
+
+	case itemDiffMsg:
+		if m.view == "list" || msg.name != m.detailName {
+			return m, nil // Stale result for a view that was closed
+		}
+		m.detailLoading = false
+		m.detailFiles = msg.files
+		m.detailErr = msg.err
+
+	case fileDiffMsg:
+		if m.view != "diff" || msg.name != m.detailName || msg.file != m.diffTitle {
+			return m, nil // Stale result for a view that was closed
+		}
+		if msg.err != nil {
+			m.diffViewport.SetContent(warningStyle.Render(diffErrorMessage(msg.err)))
+		} else {
+			m.diffViewport.SetContent(msg.content)
+		}
+
+	case spinner.TickMsg:
+		if !m.syncing {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case syncWaitingMsg:
+		m.lastStatus = "Waiting for the cloud drive client to finish syncing"
+		if msg.pending > 0 {
+			m.lastStatus = fmt.Sprintf("Waiting for the cloud drive client to download %d files", msg.pending)
+		}
+		m.showStatus = true
+		return m, waitForSyncEvent(m.syncEvents)
+
+	case itemSyncStartedMsg:
+		m.itemStates[msg.name] = "syncing"
+		return m, waitForSyncEvent(m.syncEvents)
+
+	case fileOutcomeMsg:
+		m.results = append(m.results, msg.outcome)
+		return m, waitForSyncEvent(m.syncEvents)
+
+	case itemSyncedMsg:
+		m.applyItemResult(msg)
+		return m, waitForSyncEvent(m.syncEvents)
+
+	case syncFinishedMsg:
+		m.syncing = false
+		m.syncEvents = nil
+		m.lastStatus = fmt.Sprintf("%s complete: %d changed, %d skipped, %d conflicts, %d errors",
+			operationName(m.syncOp), msg.changed, msg.skipped, msg.conflicts, msg.errored)
+		if msg.git != "" {
+			m.lastStatus += " - " + msg.git
+		}
+		m.showStatus = true
+
+		// Finished items fall back to their live status
+		for name, state := range m.itemStates {
+			if state == "done" {
+				delete(m.itemStates, name)
+			}
+		}
+		return m, m.refreshData(true)
+
+	default:
+		// Cursor blinking and other input messages for an open form
+		if m.view == "form" && m.form != nil && len(m.form.inputs) > 0 {
+			var cmd tea.Cmd
+			m.form.inputs[m.form.focus], cmd = m.form.inputs[m.form.focus].Update(msg)
+			return m, cmd
+		}
 	}
 
 	return m, nil
 }
 
+// applyRefresh replaces the sync items with freshly loaded data and recomputes statuses
+func (m tuiModel) applyRefresh(msg dataRefreshedMsg) (tuiModel, tea.Cmd) {
+	name := m.currentItemName()
+	m.syncItems = msg.syncItems
+	m.encryption = msg.encryption
+	m.statusGeneration++
+	m.statuses = make(map[string]string)
+	m.fileCounts = make(map[string]int)
+
+	// Drop state for items that no longer exist
+	for name := range m.selected {
+		if m.syncItems.FindSyncItem(name) == nil {
+			delete(m.selected, name)
+		}
+	}
+	m.keepCursorOn(name)
+	if m.view != "list" && m.syncItems.FindSyncItem(m.detailName) == nil {
+		m.view = "list"
+	}
+
+	if !msg.auto {
+		m.lastStatus = "Data refreshed"
+		m.showStatus = true
+	}
+
+	return m, computeStatuses(m.localConfig, m.syncItems.SyncItems, m.statusGeneration)
+}
+
+// applyItemResult records the outcome of a finished item on the model
+func (m *tuiModel) applyItemResult(msg itemSyncedMsg) {
+	delete(m.itemNotes, msg.name)
+
+	if msg.err != nil {
+		m.itemStates[msg.name] = "error"
+		m.itemNotes[msg.name] = msg.err.Error()
+		return
+	}
+
+	for _, outcome := range msg.result.Files {
+		if outcome.Action == "conflict" {
+			m.itemStates[msg.name] = "conflict"
+			m.itemNotes[msg.name] = outcome.Message
+			return
+		}
+	}
+
+	m.itemStates[msg.name] = "done"
+	if len(msg.result.Errors) > 0 {
+		m.itemNotes[msg.name] = strings.Join(msg.result.Errors, "; ")
+	}
+}
+
 func (m tuiModel) View() string {
 	if m.err != nil {
 		return mainBorderStyle.Render(errorStyle.Render(fmt.Sprintf("❌ Error: %v\n\nPress 'q' to quit.", m.err)))
@@ -241,82 +613,51 @@ func (m tuiModel) View() string {
 	title := titleStyle.Render("🚀 Sync Station v1.0.0")
 
 	// Header info bar with icons and formatting
-	computerInfo := fmt.Sprintf("💻 %s     ☁️  %s     🔄 %d items",
+	itemCount := fmt.Sprintf("%d items", len(m.syncItems.SyncItems))
+	if visible := len(m.visibleItems()); visible != len(m.syncItems.SyncItems) {
+		itemCount = fmt.Sprintf("%d/%d items", visible, len(m.syncItems.SyncItems))
+	}
+	computerInfo := fmt.Sprintf("💻 %s     ☁️  %s     🔄 %s",
 		m.localConfig.CurrentComputer,
 		m.localConfig.CloudSyncDir,
-		len(m.syncItems.SyncItems))
+		itemCount)
 	headerInfo := headerInfoStyle.Render(computerInfo)
 
 	b.WriteString(title + "\n")
 	b.WriteString(headerInfo + "\n\n")
 
+	switch m.view {
+	case "detail":
+		b.WriteString(m.detailView())
+		b.WriteString("\n" + helpBarStyle.Render("💡 [↑/↓] select file  [Enter] view diff  [Esc] back  [Q] quit"))
+		return mainBorderStyle.Render(b.String())
+	case "diff":
+		b.WriteString(m.diffView())
+		b.WriteString("\n" + helpBarStyle.Render("💡 [↑/↓/PgUp/PgDn] scroll  [Esc] back  [Q] quit"))
+		return mainBorderStyle.Render(b.String())
+	case "form":
+		b.WriteString(m.formView())
+		b.WriteString("\n" + helpBarStyle.Render(m.formHelp()))
+		return mainBorderStyle.Render(b.String())
+	}
+
 	// Content box with fancy border
 	var contentBuilder strings.Builder
 
 	// Items header with fancy styling
-	itemsHeader := itemsHeaderStyle.Render("📦 Sync Items")
+	itemsHeader := itemsHeaderStyle.Render(m.listTitle())
 	contentBuilder.WriteString(itemsHeader + "\n")
-
-	if len(m.syncItems.SyncItems) == 0 {
-		emptyMsg := dimmedStyle.Render("📭 No sync items configured yet")
-		helpMsg := dimmedStyle.Render("💡 Add items with: syncstation add")
-		contentBuilder.WriteString(emptyMsg + "\n")
-		contentBuilder.WriteString(helpMsg + "\n")
-	} else {
-		for i, item := range m.syncItems.SyncItems {
-			// Fancy cursor indicator
-			cursor := "  "
-			if m.cursor == i {
-				cursor = "▶ "
-			}
-
-			// Enhanced checkbox with fancy symbols
-			checkbox := "☐"
-			if m.selected[i] {
-				checkbox = "☑"
-			}
-
-			// Get status and apply fancy styling
-			status := m.getItemStatus(item)
-			styledStatus := m.getStyledStatus(status)
-
-			// Get item type icon
-			typeIcon := m.getTypeIcon(item.Type)
-
-			// Get local path with fancy formatting
-			localPath := item.GetCurrentComputerPath(m.localConfig.CurrentComputer)
-			pathInfo := "⚠️  No path configured"
-			if localPath != "" {
-				pathInfo = pathStyle.Render(localPath)
-			}
-
-			// File count if available
-			fileCount := m.getFileCount(item)
-
-			// Main item line with fancy formatting
-			itemLine := fmt.Sprintf("%s%s %s %s %s",
-				cursor, checkbox, typeIcon, item.Name, styledStatus)
-
-			// Sub-line with path and details
-			subLine := fmt.Sprintf("    %s %s", pathInfo, fileCount)
-
-			if m.cursor == i {
-				contentBuilder.WriteString(selectedItemStyle.Render(itemLine) + "\n")
-				contentBuilder.WriteString(selectedItemStyle.Render(subLine) + "\n")
-			} else {
-				contentBuilder.WriteString(itemStyle.Render(itemLine) + "\n")
-				contentBuilder.WriteString(dimmedStyle.Render(subLine) + "\n")
-			}
-
-			// Add spacing between items
-			contentBuilder.WriteString("\n")
-		}
-	}
+	contentBuilder.WriteString(m.renderItemList())
 
 	// Wrap content in fancy box
 	content := contentBoxStyle.Render(contentBuilder.String())
 	b.WriteString(content)
 
+	// Results pane with the most recent file outcomes
+	if len(m.results) > 0 {
+		b.WriteString("\n" + resultsBoxStyle.Render(m.renderResults()))
+	}
+
 	// Status message with fancy styling
 	if m.showStatus && m.lastStatus != "" {
 		statusMsg := fmt.Sprintf("ℹ️  %s", m.lastStatus)
@@ -324,7 +665,10 @@ func (m tuiModel) View() string {
 	}
 
 	// Fancy help bar
-	helpText := "💡 [Space] select  [S] sync  [P] push  [L] pull  [A] all  [N] none  [R] refresh  [Q] quit"
+	helpText := "💡 [Space] select  [Enter] details  [/] search  [F] filter  [G] group  [S] sync  [P] push  [L] pull  [A] all  [N] none  [+] add  [E] excludes  [C] path  [X] remove  [R] refresh  [Q] quit"
+	if m.syncing {
+		helpText = fmt.Sprintf("%s %s in progress...  [Q] quit", m.spinner.View(), operationName(m.syncOp))
+	}
 	helpBar := helpBarStyle.Render(helpText)
 	b.WriteString("\n" + helpBar)
 
@@ -332,6 +676,95 @@ func (m tuiModel) View() string {
 	return mainBorderStyle.Render(b.String())
 }
 
+// renderResults renders the most recent file outcomes of the current sync
+func (m tuiModel) renderResults() string {
+	var b strings.Builder
+	b.WriteString(itemsHeaderStyle.Render(fmt.Sprintf("📋 Results (%d files)", len(m.results))) + "\n")
+
+	start := 0
+	if len(m.results) > maxResultLines {
+		start = len(m.results) - maxResultLines
+	}
+
+	for _, outcome := range m.results[start:] {
+		line := fmt.Sprintf("%s %s: %s", outcomeIcon(outcome.Action), outcome.ItemName, outcome.Path)
+		if outcome.Message != "" {
+			line += " - " + outcome.Message
+		}
+
+		switch outcome.Action {
+		case "pushed":
+			b.WriteString(localNewerStyle.Render(line))
+		case "pulled":
+			b.WriteString(cloudNewerStyle.Render(line))
+		case "conflict", "error", "quarantined":
+			b.WriteString(conflictStyle.Render(line))
+		default:
+			b.WriteString(dimmedStyle.Render(line))
+		}
+		b.WriteString("\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// getSyncStateStatus returns the styled progress of an item during or after a TUI sync,
+// or an empty string if the item has not been part of one
+func (m tuiModel) getSyncStateStatus(name string) string {
+	switch m.itemStates[name] {
+	case "queued":
+		return dimmedStyle.Render("⏳ Queued")
+	case "syncing":
+		return spinnerStyle.Render(m.spinner.View() + " Syncing")
+	case "done":
+		return syncedStyle.Render("✅ Done")
+	case "conflict":
+		return conflictStyle.Render("🔥 Conflict")
+	case "error":
+		return conflictStyle.Render("❌ Error")
+	default:
+		return ""
+	}
+}
+
+// outcomeIcon returns an emoji icon for a file outcome action
+func outcomeIcon(action string) string {
+	switch action {
+	case "pushed":
+		return "⬆️ "
+	case "pulled":
+		return "⬇️ "
+	case "linked":
+		return "🔗"
+	case "hook":
+		return "🪝"
+	case "quarantined":
+		return "🚫"
+	case "skipped":
+		return "⏭️ "
+	case "conflict":
+		return "🔥"
+	case "resolved":
+		return "🧹"
+	case "error":
+		return "❌"
+	default:
+		return "•"
+	}
+}
+
+// operationName returns a human readable name for a sync operation
+func operationName(operation sync.SyncOperation) string {
+	switch operation {
+	case sync.SyncPush:
+		return "Push"
+	case sync.SyncPull:
+		return "Pull"
+	default:
+		return "Smart sync"
+	}
+}
+
 // getStyledStatus returns a styled status with fancy colors and icons
 func (m tuiModel) getStyledStatus(status string) string {
 	switch status {
@@ -349,6 +782,8 @@ func (m tuiModel) getStyledStatus(status string) string {
 		return warningStyle.Render("🟡 Cloud missing")
 	case "No path":
 		return dimmedStyle.Render("⚪ No path")
+	case "Checking":
+		return dimmedStyle.Render("⏳ Checking")
 	default:
 		return dimmedStyle.Render("⚪ Unknown")
 	}
@@ -368,42 +803,126 @@ func (m tuiModel) getTypeIcon(itemType string) string {
 
 // getFileCount returns a styled file count for display
 func (m tuiModel) getFileCount(item *config.SyncItem) string {
-	// For now, show placeholder - would be enhanced with actual file counting
-	localPath := item.GetCurrentComputerPath(m.localConfig.CurrentComputer)
-	if localPath == "" {
+	switch m.getItemStatus(item) {
+	case "No path":
 		return dimmedStyle.Render("(not configured)")
-	}
-
-	if !config.PathExists(config.ExpandPath(localPath)) {
+	case "Local missing":
 		return dimmedStyle.Render("(missing)")
+	case "Checking":
+		return ""
 	}
 
-	// TODO: Implement actual file counting
 	if item.Type == "folder" {
-		return fileCountStyle.Render("(folder)")
-	} else {
-		return fileCountStyle.Render("(file)")
+		count := m.fileCounts[item.Name]
+		if count == 1 {
+			return fileCountStyle.Render("(1 file)")
+		}
+		return fileCountStyle.Render(fmt.Sprintf("(%d files)", count))
 	}
+	return fileCountStyle.Render("(file)")
 }
 
-// getItemStatus determines the sync status of an item
+// getItemStatus returns the last computed sync status of an item
 func (m tuiModel) getItemStatus(item *config.SyncItem) string {
-	localPath := item.GetCurrentComputerPath(m.localConfig.CurrentComputer)
+	if status, exists := m.statuses[item.Name]; exists {
+		return status
+	}
+	return "Checking"
+}
+
+// computeStatuses returns a command computing the status of every item in the background.
+// Items are checked one after the other, so the cloud storage is never read concurrently.
+func computeStatuses(localConfig *config.LocalConfig, items []*config.SyncItem, generation int) tea.Cmd {
+	return func() tea.Msg {
+		msg := itemStatusesMsg{
+			generation: generation,
+			statuses:   make(map[string]string, len(items)),
+			fileCounts: make(map[string]int, len(items)),
+		}
+		for _, item := range items {
+			msg.statuses[item.Name], msg.fileCounts[item.Name] = computeItemStatus(localConfig, item)
+		}
+		return msg
+	}
+}
+
+// computeItemStatus determines the sync status of an item by comparing local and cloud
+// files, and counts the local files of the item
+func computeItemStatus(localConfig *config.LocalConfig, item *config.SyncItem) (string, int) {
+	localPath := item.GetCurrentComputerPath(localConfig.CurrentComputer)
 	if localPath == "" {
-		return "No path"
+		return "No path", 0
 	}
 
 	if !config.PathExists(localPath) {
-		return "Local missing"
+		return "Local missing", 0
+	}
+
+	cloudKey := item.CloudKey()
+	diffs, err := newDiffEngine(localConfig, item).GetSyncItemDiff(localPath, cloudKey)
+	if err != nil {
+		return "Unknown", 0
+	}
+
+	fileCount := 0
+	for _, fileDiff := range diffs {
+		if fileDiff.LocalExists {
+			fileCount++
+		}
+	}
+
+	if !storage.Exists(sync.ItemStorage(localConfig, item), cloudKey) {
+		return "Cloud missing", fileCount
 	}
 
-	cloudPath := item.GetCloudPath(m.localConfig.GetCloudConfigsPath())
-	if !config.PathExists(cloudPath) {
-		return "Cloud missing"
+	localChanged, cloudChanged, conflict := false, false, false
+	for _, fileDiff := range diffs {
+		switch fileDiff.Status {
+		case "conflict":
+			conflict = true
+		case "local_newer", "local_only":
+			localChanged = true
+		case "cloud_newer", "cloud_only":
+			cloudChanged = true
+		}
 	}
 
-	// TODO: Implement proper status checking in Phase 6
-	return "Ready"
+	switch {
+	case conflict || (localChanged && cloudChanged):
+		return "Conflict", fileCount
+	case localChanged:
+		return "Local newer", fileCount
+	case cloudChanged:
+		return "Cloud newer", fileCount
+	default:
+		return "Ready", fileCount
+	}
+}
+
+// checkCloudDir returns a command that fingerprints the cloud copy after a delay, so changes
+// made by other computers can be detected without watching every file. Remote storages are
+// listed through the storage, at most every remoteRefreshInterval.
+func checkCloudDir(localConfig *config.LocalConfig, delay time.Duration) tea.Cmd {
+	check := func() tea.Msg {
+		activity, err := sync.CheckCloudActivity(localConfig)
+		if err != nil {
+			return cloudCheckMsg{}
+		}
+		window, _ := sync.SettleDurations(localConfig)
+		return cloudCheckMsg{
+			fingerprint: activity.Fingerprint,
+			busy:        !localConfig.Settle.Disabled && activity.Busy(window),
+		}
+	}
+	if delay == 0 {
+		return check
+	}
+	if _, local := storage.LocalPath(localConfig.CloudStorage(), ""); !local && delay < remoteRefreshInterval {
+		delay = remoteRefreshInterval
+	}
+	return tea.Tick(delay, func(time.Time) tea.Msg {
+		return check()
+	})
 }
 
 // getStatusIcon returns a colored icon for the status
@@ -420,34 +939,197 @@ func (m tuiModel) getStatusIcon(status string) string {
 	}
 }
 
-// syncSelected creates a command to sync selected items
-func (m tuiModel) syncSelected() tea.Cmd {
-	return func() tea.Msg {
-		selectedCount := 0
-		for range m.selected {
-			selectedCount++
+// syncSelected starts an asynchronous sync of the selected items, or of the
+// item under the cursor when nothing is selected
+func (m tuiModel) syncSelected(operation sync.SyncOperation) (tea.Model, tea.Cmd) {
+	if m.syncing {
+		return m, nil
+	}
+
+	var items []*config.SyncItem
+	for _, item := range m.syncItems.SyncItems {
+		if m.selected[item.Name] {
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		item := m.currentItem()
+		if item == nil {
+			return m, func() tea.Msg {
+				return statusMsg{
+					message: "No items selected for sync",
+					isError: true,
+				}
+			}
 		}
+		items = []*config.SyncItem{item}
+	}
 
-		if selectedCount == 0 {
-			return statusMsg{
-				message: "No items selected for sync",
-				isError: true,
+	m.syncing = true
+	m.syncOp = operation
+	m.syncEvents = make(chan tea.Msg)
+	m.results = nil
+	m.itemStates = make(map[string]string)
+	m.itemNotes = make(map[string]string)
+	for _, item := range items {
+		m.itemStates[item.Name] = "queued"
+	}
+	m.lastStatus = fmt.Sprintf("%s of %d items started", operationName(operation), len(items))
+	m.showStatus = true
+
+	go runSync(m.syncEvents, m.localConfig, operation, items)
+
+	return m, tea.Batch(m.spinner.Tick, waitForSyncEvent(m.syncEvents))
+}
+
+// runSync syncs items one by one through the sync engine and reports progress on events.
+// The channel is closed once every item has been processed.
+func runSync(events chan<- tea.Msg, localConfig *config.LocalConfig, operation sync.SyncOperation, items []*config.SyncItem) {
+	defer close(events)
+
+	var finished syncFinishedMsg
+
+	// The cloud drive client may still be downloading what other computers changed
+	err := sync.WaitForSettle(localConfig, func(activity sync.CloudActivity) {
+		events <- syncWaitingMsg{pending: len(activity.Pending)}
+	})
+	if err != nil {
+		for _, item := range items {
+			finished.errored++
+			events <- itemSyncedMsg{name: item.Name, err: err}
+		}
+		events <- finished
+		return
+	}
+
+	// Git mode starts from what other computers pushed
+	repo, err := pullGitRepo(localConfig)
+	if err != nil {
+		for _, item := range items {
+			finished.errored++
+			events <- itemSyncedMsg{name: item.Name, err: err}
+		}
+		finished.git = err.Error()
+		events <- finished
+		return
+	}
+
+	syncEngine := sync.NewSyncEngine(localConfig, newDiffEngine(localConfig, nil))
+	syncEngine.SetFileOutcomeCallback(func(outcome sync.FileOutcome) {
+		events <- fileOutcomeMsg{outcome: outcome}
+	})
+	if repo != nil {
+		syncEngine.SetGitCallback(repo.OperationCallback)
+		syncEngine.SetGitSafeCallback(repo.SafeOperationCallback)
+	}
+
+	var pushedItems []string
+	for _, item := range items {
+		events <- itemSyncStartedMsg{name: item.Name}
+
+		result, err := syncEngine.SyncItem(operation, item)
+		if err != nil {
+			finished.errored++
+			events <- fileOutcomeMsg{outcome: sync.FileOutcome{
+				ItemName: item.Name,
+				Action:   "error",
+				Message:  err.Error(),
+			}}
+		} else {
+			finished.changed += result.FilesChanged
+			finished.skipped += result.FilesSkipped
+			finished.errored += result.FilesErrored
+			pushed := false
+			for _, outcome := range result.Files {
+				switch outcome.Action {
+				case "conflict":
+					finished.conflicts++
+				case "pushed":
+					pushed = true
+				}
+			}
+			if pushed {
+				pushedItems = append(pushedItems, item.Name)
 			}
 		}
 
-		// TODO: Implement actual sync in Phase 6
-		return statusMsg{
-			message: fmt.Sprintf("Sync for %d items will be implemented in Phase 6", selectedCount),
-			isError: false,
+		events <- itemSyncedMsg{name: item.Name, result: result, err: err}
+	}
+
+	// Last seen is informational, so a failure to record it isn't reported
+	_ = config.RecordComputerSeen(localConfig)
+
+	if repo != nil {
+		finished.git = commitAndPush(repo, pushedItems)
+	}
+	events <- finished
+}
+
+// pullGitRepo brings the git repository of git mode up to date before a sync. The
+// repository is nil outside git mode. An unreachable remote or a detached HEAD isn't an
+// error, commitAndPush reports them.
+func pullGitRepo(localConfig *config.LocalConfig) (*gitrepo.Repo, error) {
+	if !localConfig.GitMode {
+		return nil, nil
+	}
+	repo, err := gitrepo.Open(localConfig)
+	if err != nil {
+		return nil, err
+	}
+	err = repo.Pull()
+	if err != nil && !errors.Is(err, gitrepo.ErrUnreachable) && !errors.Is(err, gitrepo.ErrDetachedHead) {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// commitAndPush commits the changes of a sync and pushes them, and describes the outcome
+func commitAndPush(repo *gitrepo.Repo, items []string) string {
+	commit, err := repo.Commit(items)
+	if errors.Is(err, gitrepo.ErrDetachedHead) {
+		if _, pushErr := repo.Push(); pushErr != nil {
+			return fmt.Sprintf("git push failed: %v", pushErr)
+		}
+		return "not committed: " + err.Error()
+	}
+	if err != nil {
+		return fmt.Sprintf("git commit failed: %v", err)
+	}
+	pushed, err := repo.Push()
+	if err != nil {
+		return fmt.Sprintf("git push failed: %v", err)
+	}
+
+	switch {
+	case commit != "" && pushed != "":
+		return fmt.Sprintf("committed %s and pushed to %s", commit, pushed)
+	case commit != "":
+		return fmt.Sprintf("committed %s", commit)
+	case pushed != "":
+		return fmt.Sprintf("pushed to %s", pushed)
+	}
+	return ""
+}
+
+// waitForSyncEvent returns a command that waits for the next sync progress message
+func waitForSyncEvent(events <-chan tea.Msg) tea.Cmd {
+	if events == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
 		}
+		return msg
 	}
 }
 
-// refreshData creates a command to refresh sync items data
-func (m tuiModel) refreshData() tea.Cmd {
+// refreshData creates a command to reload sync items data from cloud storage
+func (m tuiModel) refreshData(auto bool) tea.Cmd {
 	return func() tea.Msg {
-		// Reload sync items
-		_, err := config.LoadSyncItemsData(m.localConfig.GetSyncItemsPath())
+		syncItems, err := config.LoadSyncItemsData(m.localConfig)
 		if err != nil {
 			return statusMsg{
 				message: fmt.Sprintf("Failed to refresh: %v", err),
@@ -455,13 +1137,28 @@ func (m tuiModel) refreshData() tea.Cmd {
 			}
 		}
 
-		// TODO: In a proper implementation, we'd send the new data back
-		// For now, just confirm the refresh worked
-		return statusMsg{
-			message: "Data refreshed",
-			isError: false,
+		encryptionData, err := config.LoadEncryptionData(m.localConfig)
+		if err != nil {
+			return statusMsg{
+				message: fmt.Sprintf("Failed to refresh: %v", err),
+				isError: true,
+			}
 		}
+
+		return dataRefreshedMsg{syncItems: syncItems, encryption: encryptionData, auto: auto}
+	}
+}
+
+// newDiffEngine creates a diff engine that compares the plaintext of encrypted cloud copies
+// and, for templates, their rendering for this computer. item may be nil.
+func newDiffEngine(localConfig *config.LocalConfig, item *config.SyncItem) *diff.DiffEngine {
+	diffEngine := diff.NewDiffEngine()
+	diffEngine.SetCloudDecoder(sync.CloudDecoder(localConfig, item))
+	diffEngine.SetStorage(sync.ItemStorage(localConfig, item))
+	if item != nil {
+		diffEngine.SetExclude(item.IsExcluded)
 	}
+	return diffEngine
 }
 
 // LaunchTUI launches the interactive terminal user interface
@@ -0,0 +1,445 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/AntoineArt/syncstation/internal/config"
+	"github.com/AntoineArt/syncstation/internal/diff"
+	"github.com/AntoineArt/syncstation/internal/sync"
+)
+
+// newTestModel returns a model for the computer "laptop" with an empty cloud directory and
+// the given items, keeping the local state of the sync engine in a temporary directory
+func newTestModel(t *testing.T, items ...*config.SyncItem) tuiModel {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	return tuiModel{
+		localConfig: &config.LocalConfig{CloudSyncDir: t.TempDir(), CurrentComputer: "laptop"},
+		syncItems:   &config.SyncItemsData{SyncItems: items},
+		encryption:  &config.EncryptionData{},
+		selected:    make(map[string]bool),
+		searchInput: newSearchInput(),
+		view:        "list",
+		itemStates:  make(map[string]string),
+		itemNotes:   make(map[string]string),
+		statuses:    make(map[string]string),
+		fileCounts:  make(map[string]int),
+	}
+}
+
+// keyMsg returns the message of a key press
+func keyMsg(key string) tea.KeyMsg {
+	switch key {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case " ":
+		return tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+}
+
+// update passes a message to a model and returns the updated model
+func update(t *testing.T, m tuiModel, msg tea.Msg) (tuiModel, tea.Cmd) {
+	t.Helper()
+	updated, cmd := m.Update(msg)
+	return updated.(tuiModel), cmd
+}
+
+// finishSync feeds the progress messages of the running sync to the model until it ends
+func finishSync(t *testing.T, m tuiModel) tuiModel {
+	t.Helper()
+	for m.syncing {
+		msg, ok := <-m.syncEvents
+		if !ok {
+			t.Fatal("the sync events ended before the sync finished")
+		}
+		m, _ = update(t, m, msg)
+	}
+	return m
+}
+
+func TestSyncRunsSelectedItemsThroughTheSyncEngine(t *testing.T) {
+	local := t.TempDir()
+	if err := os.WriteFile(filepath.Join(local, "init.lua"), []byte("vim.o.number = true"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newTestModel(t,
+		&config.SyncItem{Name: "Nvim", Type: "folder", Paths: map[string]string{"laptop": local}},
+		&config.SyncItem{Name: "Missing", Type: "folder", Paths: map[string]string{"laptop": filepath.Join(local, "missing")}},
+		&config.SyncItem{Name: "Unselected", Type: "folder", Paths: map[string]string{"laptop": local}},
+	)
+	m.selected["Nvim"], m.selected["Missing"] = true, true
+
+	m, cmd := update(t, m, keyMsg("p"))
+	if !m.syncing || cmd == nil {
+		t.Fatal("pressing p didn't start a push")
+	}
+	if m.itemStates["Nvim"] != "queued" || m.itemStates["Missing"] != "queued" || m.itemStates["Unselected"] != "" {
+		t.Errorf("item states after starting = %v", m.itemStates)
+	}
+	if !strings.Contains(m.View(), "Push in progress") {
+		t.Error("the help bar doesn't show the push in progress")
+	}
+
+	// Keys don't start another sync while one runs
+	m, _ = update(t, m, keyMsg("l"))
+	if m.syncOp != sync.SyncPush {
+		t.Error("a pull started during the push")
+	}
+
+	// Finished items fall back to their live status, failed ones keep showing the error
+	m = finishSync(t, m)
+	if m.itemStates["Nvim"] != "" || m.itemStates["Missing"] != "error" {
+		t.Errorf("item states after the push = %v", m.itemStates)
+	}
+	if !strings.Contains(m.itemNotes["Missing"], "does not exist") {
+		t.Errorf("the error of the missing item isn't shown inline: %q", m.itemNotes["Missing"])
+	}
+	if len(m.results) != 2 || m.results[0].Action != "pushed" || m.results[1].Action != "error" {
+		t.Errorf("results = %v, want the pushed file and the error", m.results)
+	}
+	if !strings.HasPrefix(m.lastStatus, "Push complete") || !strings.Contains(m.lastStatus, "1 errors") {
+		t.Errorf("status after the push = %q", m.lastStatus)
+	}
+	if _, err := os.Stat(filepath.Join(m.localConfig.GetCloudConfigsPath(), "Nvim", "init.lua")); err != nil {
+		t.Errorf("the selected item wasn't pushed: %v", err)
+	}
+	if view := m.View(); !strings.Contains(view, "Results (2 files)") || !strings.Contains(view, "init.lua") {
+		t.Error("the results pane doesn't list the outcomes")
+	}
+}
+
+func TestSyncWithoutSelectionSyncsItemUnderCursor(t *testing.T) {
+	local := t.TempDir()
+	m := newTestModel(t,
+		&config.SyncItem{Name: "First", Type: "folder", Paths: map[string]string{"laptop": local}},
+		&config.SyncItem{Name: "Second", Type: "folder", Paths: map[string]string{"laptop": local}},
+	)
+	m.cursor = 1
+
+	m, _ = update(t, m, keyMsg("p"))
+	if len(m.itemStates) != 1 || m.itemStates["Second"] != "queued" {
+		t.Errorf("item states = %v, want only the item under the cursor", m.itemStates)
+	}
+	finishSync(t, m)
+}
+
+func TestSyncWithoutItems(t *testing.T) {
+	m := newTestModel(t)
+	m, cmd := update(t, m, keyMsg("s"))
+	if m.syncing || cmd == nil {
+		t.Fatal("a sync started without items")
+	}
+	if msg, ok := cmd().(statusMsg); !ok || !msg.isError {
+		t.Errorf("syncing without items returned %v, want an error status", msg)
+	}
+}
+
+func TestConflictsAreShownInline(t *testing.T) {
+	m := newTestModel(t, &config.SyncItem{Name: "Shell", Type: "file"})
+	m.applyItemResult(itemSyncedMsg{name: "Shell", result: &sync.SyncResult{Files: []sync.FileOutcome{
+		{ItemName: "Shell", Action: "conflict", Message: "both local and cloud modified since last sync"},
+	}}})
+	if m.itemStates["Shell"] != "conflict" || m.itemNotes["Shell"] != "both local and cloud modified since last sync" {
+		t.Errorf("state %q, note %q", m.itemStates["Shell"], m.itemNotes["Shell"])
+	}
+	if !strings.Contains(m.View(), "both local and cloud modified") {
+		t.Error("the conflict isn't shown below the item")
+	}
+}
+
+// cloudFolder writes files to the cloud copy of a folder item
+func cloudFolder(t *testing.T, m tuiModel, item string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(m.localConfig.GetCloudConfigsPath(), item, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetailViewShowsFilesAndTheirDiffs(t *testing.T) {
+	local := t.TempDir()
+	for name, content := range map[string]string{"init.lua": "set number\nset nowrap\n", "local.lua": "local"} {
+		if err := os.WriteFile(filepath.Join(local, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := newTestModel(t, &config.SyncItem{
+		Name:            "Nvim",
+		Type:            "folder",
+		Paths:           map[string]string{"laptop": local, "desktop": "/home/me/.config/nvim"},
+		ExcludePatterns: []string{"*.log"},
+	})
+	cloudFolder(t, m, "Nvim", map[string]string{"init.lua": "set number\nset wrap\n", "cloud.lua": "cloud"})
+
+	m, cmd := update(t, m, keyMsg("enter"))
+	if m.view != "detail" || cmd == nil {
+		t.Fatal("enter didn't open the detail view")
+	}
+	if !strings.Contains(m.View(), "Comparing files") {
+		t.Error("the detail view doesn't show that files are being compared")
+	}
+	m, _ = update(t, m, cmd())
+	view := m.View()
+	for _, want := range []string{"laptop: " + local, "desktop: /home/me/.config/nvim", "*.log", "cloud.lua", "init.lua", "local.lua"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("the detail view doesn't show %q", want)
+		}
+	}
+
+	// Files are sorted by name: cloud.lua, init.lua, local.lua
+	m, _ = update(t, m, keyMsg("down"))
+	m, cmd = update(t, m, keyMsg("enter"))
+	if m.view != "diff" || m.diffTitle != "init.lua" || cmd == nil {
+		t.Fatalf("enter opened %q for %q, want the diff of init.lua", m.view, m.diffTitle)
+	}
+	m, _ = update(t, m, cmd())
+	view = m.View()
+	if !strings.Contains(view, "- set nowrap") || !strings.Contains(view, "+ set wrap") {
+		t.Errorf("the diff view doesn't show the changed lines:\n%s", view)
+	}
+
+	// A diff computed for a file that is no longer shown is dropped
+	m, _ = update(t, m, fileDiffMsg{name: "Nvim", file: "local.lua", content: "stale"})
+	if strings.Contains(m.View(), "stale") {
+		t.Error("a stale diff replaced the shown one")
+	}
+
+	m, _ = update(t, m, keyMsg("esc"))
+	if m.view != "detail" {
+		t.Errorf("esc in the diff view went to %q", m.view)
+	}
+	m, _ = update(t, m, keyMsg("esc"))
+	if m.view != "list" {
+		t.Errorf("esc in the detail view went to %q", m.view)
+	}
+}
+
+func TestDiffViewExplainsBinaryFiles(t *testing.T) {
+	local := t.TempDir()
+	if err := os.WriteFile(filepath.Join(local, "image.png"), []byte{0x89, 'P', 'N', 'G', 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newTestModel(t, &config.SyncItem{Name: "Images", Type: "folder", Paths: map[string]string{"laptop": local}})
+
+	m, cmd := update(t, m, keyMsg("enter"))
+	m, _ = update(t, m, cmd())
+	m, cmd = update(t, m, keyMsg("enter"))
+	m, _ = update(t, m, cmd())
+	if !strings.Contains(m.View(), diffErrorMessage(diff.ErrBinaryFile)) {
+		t.Errorf("the diff view of a binary file doesn't explain why there is no diff:\n%s", m.View())
+	}
+}
+
+// runStatuses runs a status command, which computes every status at once, and feeds the
+// statuses to the model
+func runStatuses(t *testing.T, m tuiModel, cmd tea.Cmd) tuiModel {
+	t.Helper()
+	if cmd == nil {
+		return m
+	}
+	msg := cmd()
+	if _, ok := msg.(itemStatusesMsg); !ok {
+		t.Fatalf("status command returned %T, want itemStatusesMsg", msg)
+	}
+	m, _ = update(t, m, msg)
+	return m
+}
+
+func TestItemStatusesAreComputedInTheBackground(t *testing.T) {
+	older, newer := time.Now().Add(-time.Hour), time.Now()
+	folder := func(t *testing.T, m tuiModel, name string, local, cloud map[string]time.Time) *config.SyncItem {
+		t.Helper()
+		localDir := t.TempDir()
+		for file, modTime := range local {
+			writeWithTime(t, filepath.Join(localDir, file), modTime)
+		}
+		for file, modTime := range cloud {
+			writeWithTime(t, filepath.Join(m.localConfig.GetCloudConfigsPath(), name, file), modTime)
+		}
+		return &config.SyncItem{Name: name, Type: "folder", Paths: map[string]string{"laptop": localDir}}
+	}
+
+	m := newTestModel(t)
+	m.syncItems.SyncItems = []*config.SyncItem{
+		folder(t, m, "Ready", map[string]time.Time{"a": older}, map[string]time.Time{"a": older}),
+		folder(t, m, "LocalNewer", map[string]time.Time{"a": newer, "b": older}, map[string]time.Time{"a": older, "b": older}),
+		folder(t, m, "CloudNewer", map[string]time.Time{"a": older}, map[string]time.Time{"a": newer}),
+		folder(t, m, "Conflict", map[string]time.Time{"a": older}, map[string]time.Time{"b": older}),
+		folder(t, m, "CloudMissing", map[string]time.Time{"a": older, "b": older, "c": older}, nil),
+		{Name: "LocalMissing", Type: "folder", Paths: map[string]string{"laptop": filepath.Join(t.TempDir(), "missing")}},
+		{Name: "NoPath", Type: "folder", Paths: map[string]string{"desktop": "/home/me"}},
+	}
+
+	if status := m.getItemStatus(m.syncItems.SyncItems[0]); status != "Checking" {
+		t.Errorf("status before computing = %q, want Checking", status)
+	}
+	m = runStatuses(t, m, computeStatuses(m.localConfig, m.syncItems.SyncItems, m.statusGeneration))
+
+	want := map[string]string{
+		"Ready":        "Ready",
+		"LocalNewer":   "Local newer",
+		"CloudNewer":   "Cloud newer",
+		"Conflict":     "Conflict",
+		"CloudMissing": "Cloud missing",
+		"LocalMissing": "Local missing",
+		"NoPath":       "No path",
+	}
+	for _, item := range m.syncItems.SyncItems {
+		if got := m.getItemStatus(item); got != want[item.Name] {
+			t.Errorf("status of %s = %q, want %q", item.Name, got, want[item.Name])
+		}
+	}
+	if count := m.fileCounts["CloudMissing"]; count != 3 {
+		t.Errorf("file count of CloudMissing = %d, want 3", count)
+	}
+	if !strings.Contains(m.View(), "(3 files)") {
+		t.Error("the list doesn't show the file count of folders")
+	}
+
+	// Statuses computed before a refresh are dropped
+	m.statusGeneration++
+	m, _ = update(t, m, itemStatusesMsg{generation: m.statusGeneration - 1, statuses: map[string]string{"Ready": "Conflict"}})
+	if m.statuses["Ready"] != "Ready" {
+		t.Errorf("a stale status replaced the current one: %q", m.statuses["Ready"])
+	}
+}
+
+// writeWithTime writes a file and sets its modification time
+func writeWithTime(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(modTime.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshReloadsSyncItems(t *testing.T) {
+	m := newTestModel(t,
+		&config.SyncItem{Name: "Kept", Type: "file"},
+		&config.SyncItem{Name: "Removed", Type: "file"},
+	)
+	m.cursor = 1
+	m.selected["Kept"], m.selected["Removed"] = true, true
+	m.statuses["Kept"] = "Ready"
+
+	saved := config.NewSyncItemsData()
+	saved.SyncItems = []*config.SyncItem{{Name: "Kept", Type: "file"}}
+	if err := saved.SaveSyncItemsData(m.localConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	m, cmd := update(t, m, keyMsg("r"))
+	msg, ok := cmd().(dataRefreshedMsg)
+	if !ok || msg.auto {
+		t.Fatalf("refreshing returned %+v, want data refreshed by a key press", msg)
+	}
+	m, cmd = update(t, m, msg)
+	if len(m.syncItems.SyncItems) != 1 || m.syncItems.SyncItems[0].Name != "Kept" {
+		t.Errorf("items after refresh = %v", m.syncItems.SyncItems)
+	}
+	if m.cursor != 0 || !m.selected["Kept"] || m.selected["Removed"] {
+		t.Errorf("cursor %d and selection %v aren't adjusted to the reloaded items", m.cursor, m.selected)
+	}
+	if m.lastStatus != "Data refreshed" {
+		t.Errorf("status after refresh = %q", m.lastStatus)
+	}
+	if len(m.statuses) != 0 {
+		t.Errorf("statuses %v survived the refresh", m.statuses)
+	}
+	if m = runStatuses(t, m, cmd); m.statuses["Kept"] != "No path" {
+		t.Errorf("status of Kept after refresh = %q, want it recomputed", m.statuses["Kept"])
+	}
+}
+
+// refreshes reports whether a command returned for a cloud check refreshes data besides
+// scheduling the next check, which only returns once the refresh interval has elapsed
+func refreshes(cmd tea.Cmd) bool {
+	msgs := make(chan tea.Msg, 1)
+	go func() { msgs <- cmd() }()
+	select {
+	case msg := <-msgs:
+		_, ok := msg.(tea.BatchMsg)
+		return ok
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+func TestCloudChangesTriggerAnAutomaticRefresh(t *testing.T) {
+	m := newTestModel(t, &config.SyncItem{Name: "Shell", Type: "file"})
+	// Files written by the test are changed just now, which the settle window would wait for
+	m.localConfig.Settle.Disabled = true
+
+	// The first check only records the state of the cloud directory
+	m, _ = update(t, m, checkCloudDir(m.localConfig, 0)())
+	m, cmd := update(t, m, cloudCheckMsg{fingerprint: m.cloudFingerprint})
+	if refreshes(cmd) {
+		t.Fatal("an unchanged cloud directory triggered a refresh")
+	}
+
+	cloudFolder(t, m, "Shell", map[string]string{".zshrc": "setopt autocd"})
+	m, cmd = update(t, m, checkCloudDir(m.localConfig, 0)())
+	batch, ok := cmd().(tea.BatchMsg)
+	if !ok || len(batch) != 2 {
+		t.Fatal("a change of the cloud directory didn't trigger a refresh")
+	}
+	if msg, ok := batch[1]().(dataRefreshedMsg); !ok || !msg.auto {
+		t.Errorf("the refresh returned %+v, want an automatic refresh", msg)
+	}
+
+	// No refresh happens while a sync runs
+	m.syncing = true
+	writeWithTime(t, filepath.Join(m.localConfig.GetCloudConfigsPath(), "Shell", ".bashrc"), time.Now())
+	m, cmd = update(t, m, checkCloudDir(m.localConfig, 0)())
+	if refreshes(cmd) {
+		t.Error("a change of the cloud directory triggered a refresh during a sync")
+	}
+
+	// Changes are only looked at once the cloud drive client has settled
+	m.syncing, m.localConfig.Settle.Disabled = false, false
+	fingerprint := m.cloudFingerprint
+	writeWithTime(t, filepath.Join(m.localConfig.GetCloudConfigsPath(), "Shell", ".zprofile"), time.Now())
+	m, cmd = update(t, m, checkCloudDir(m.localConfig, 0)())
+	if refreshes(cmd) || m.cloudFingerprint != fingerprint {
+		t.Error("a change of a busy cloud directory was looked at")
+	}
+}
+
+func TestDetailViewShowsEncryption(t *testing.T) {
+	m := newTestModel(t,
+		&config.SyncItem{Name: "SSH", Type: "folder", Encrypt: true},
+		&config.SyncItem{Name: "Shell", Type: "folder"},
+	)
+	m.encryption = &config.EncryptionData{KeyID: "0123456789abcdef"}
+
+	m, _ = update(t, m, keyMsg("enter"))
+	if !strings.Contains(m.View(), "encrypted (key 0123456789abcdef)") {
+		t.Error("the detail view doesn't show that the item is encrypted")
+	}
+	m, _ = update(t, m, keyMsg("esc"))
+	m, _ = update(t, m, keyMsg("down"))
+	m, _ = update(t, m, keyMsg("enter"))
+	if strings.Contains(m.View(), "encrypted (key") {
+		t.Error("the detail view shows an unencrypted item as encrypted")
+	}
+}
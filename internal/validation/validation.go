@@ -0,0 +1,423 @@
+package validation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Policies applied when an incoming version fails validation
+const (
+	PolicyRefuse     = "refuse"     // fail the pull and keep the local files
+	PolicyQuarantine = "quarantine" // keep invalid files aside and pull the valid ones
+)
+
+// DefaultPolicy is used when an item sets no policy
+const DefaultPolicy = PolicyRefuse
+
+// Built-in validator names
+const (
+	KindAuto = "auto" // pick a parser from the file extension
+	KindJSON = "json"
+	KindYAML = "yaml"
+	KindTOML = "toml"
+	KindINI  = "ini"
+)
+
+// CommandTimeout is how long an external validator may run
+const CommandTimeout = 30 * time.Second
+
+// ValidPolicy reports whether policy is a known invalid-version policy
+func ValidPolicy(policy string) bool {
+	return policy == PolicyRefuse || policy == PolicyQuarantine
+}
+
+// Validator checks incoming files before they replace the local copy
+type Validator interface {
+	// Validate returns why the file at path is invalid, or nil
+	Validate(path string) error
+	// Matches reports whether the validator applies to a file named name inside a folder item
+	Matches(name string) bool
+}
+
+// Parser validates files by parsing them in a configuration format
+type Parser struct {
+	Kind       string
+	Extensions []string
+	Parse      func(data []byte) error
+}
+
+// Validate implements Validator
+func (p *Parser) Validate(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(data); err != nil {
+		return fmt.Errorf("invalid %s: %w", strings.ToUpper(p.Kind), err)
+	}
+	return nil
+}
+
+// Matches implements Validator
+func (p *Parser) Matches(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, candidate := range p.Extensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// parsers are the built-in format validators
+var parsers = []*Parser{
+	{Kind: KindJSON, Extensions: []string{".json", ".jsonc"}, Parse: parseJSON},
+	{Kind: KindYAML, Extensions: []string{".yaml", ".yml"}, Parse: parseYAML},
+	{Kind: KindTOML, Extensions: []string{".toml"}, Parse: parseTOML},
+	{Kind: KindINI, Extensions: []string{".ini", ".cfg"}, Parse: parseINI},
+}
+
+// AutoValidator validates files with the parser matching their extension
+type AutoValidator struct{}
+
+// Validate implements Validator. Files without a known extension are accepted.
+func (AutoValidator) Validate(path string) error {
+	if parser := parserFor(path); parser != nil {
+		return parser.Validate(path)
+	}
+	return nil
+}
+
+// Matches implements Validator
+func (AutoValidator) Matches(name string) bool {
+	return parserFor(name) != nil
+}
+
+// parserFor returns the built-in parser for a file name, or nil
+func parserFor(name string) *Parser {
+	for _, parser := range parsers {
+		if parser.Matches(name) {
+			return parser
+		}
+	}
+	return nil
+}
+
+// CommandValidator runs an external command such as "nginx -t -c {file}". {file} is replaced
+// by the incoming file and {dir} by the incoming copy of the item's folder. The file is
+// invalid when the command exits with an error.
+type CommandValidator struct {
+	Command string
+}
+
+// Validate implements Validator
+func (c *CommandValidator) Validate(path string) error {
+	return c.run(path, filepath.Dir(path))
+}
+
+// ValidateDir runs a command without {file} once for the incoming copy of a folder item
+func (c *CommandValidator) ValidateDir(dir string) error {
+	return c.run("", dir)
+}
+
+// Matches implements Validator: commands using {file} check every file of a folder item
+func (c *CommandValidator) Matches(name string) bool {
+	return c.PerFile()
+}
+
+// PerFile reports whether the command checks single files
+func (c *CommandValidator) PerFile() bool {
+	return strings.Contains(c.Command, "{file}")
+}
+
+// run runs the command with the placeholders replaced
+func (c *CommandValidator) run(path, dir string) error {
+	command := strings.ReplaceAll(c.Command, "{file}", shellQuote(path))
+	command = strings.ReplaceAll(command, "{dir}", shellQuote(dir))
+
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", c.Command, CommandTimeout)
+	}
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			return fmt.Errorf("%s failed: %s", c.Command, last)
+		}
+		return fmt.Errorf("%s failed: %w", c.Command, err)
+	}
+	return nil
+}
+
+// shellQuote quotes a path for the system shell
+func shellQuote(path string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + path + `"`
+	}
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+// IsCommand reports whether a validator spec is an external command rather than a parser
+func IsCommand(spec string) bool {
+	return strings.Contains(spec, "{file}") || strings.Contains(spec, "{dir}")
+}
+
+// Parse returns the validator for a spec: a built-in name (auto, json, yaml, toml, ini)
+// or an external command using {file} or {dir}
+func Parse(spec string) (Validator, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == KindAuto {
+		return AutoValidator{}, nil
+	}
+	for _, parser := range parsers {
+		if strings.EqualFold(spec, parser.Kind) {
+			return parser, nil
+		}
+	}
+	if IsCommand(spec) {
+		return &CommandValidator{Command: spec}, nil
+	}
+	return nil, fmt.Errorf("unknown validator %q: use auto, json, yaml, toml, ini or a command with {file} or {dir}", spec)
+}
+
+// Checker runs the validators of an item
+type Checker struct {
+	validators []Validator
+}
+
+// NewChecker creates a checker for the validator specs of an item
+func NewChecker(specs []string) (*Checker, error) {
+	checker := &Checker{}
+	for _, spec := range specs {
+		validator, err := Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		checker.validators = append(checker.validators, validator)
+	}
+	return checker, nil
+}
+
+// IsEmpty reports whether the checker has no validators
+func (c *Checker) IsEmpty() bool {
+	return len(c.validators) == 0
+}
+
+// CheckFile validates the incoming copy at path of a file item. Every validator applies,
+// except that auto only checks known extensions.
+func (c *Checker) CheckFile(path string) error {
+	for _, validator := range c.validators {
+		if err := validator.Validate(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckDir validates the incoming copy of a folder item at root. Format validators check the
+// files with their extensions, commands using {file} check every file and other commands run
+// once for the folder. It returns the failures keyed by slash-separated path inside the item,
+// "." for folder-wide commands.
+func (c *Checker) CheckDir(root string) (map[string]error, error) {
+	failures := make(map[string]error)
+
+	for _, validator := range c.validators {
+		if command, ok := validator.(*CommandValidator); ok && !command.PerFile() {
+			if err := command.ValidateDir(root); err != nil {
+				failures["."] = err
+			}
+		}
+	}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		for _, validator := range c.validators {
+			if !validator.Matches(entry.Name()) {
+				continue
+			}
+			if err := validator.Validate(path); err != nil {
+				failures[filepath.ToSlash(rel)] = err
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// SortedPaths returns the paths of failures in order
+func SortedPaths(failures map[string]error) []string {
+	paths := make([]string, 0, len(failures))
+	for path := range failures {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// parseJSON checks JSON syntax, reporting the line of a syntax error. Comments and trailing
+// commas are accepted, since editors such as VS Code allow them in their settings files.
+func parseJSON(data []byte) error {
+	data = stripJSONC(data)
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+		return fmt.Errorf("line %d: %v", line, syntaxErr)
+	}
+	return err
+}
+
+// stripJSONC blanks out the comments and trailing commas of JSON with comments, leaving
+// strings alone. Offsets and line numbers are kept so that syntax errors point at the source.
+func stripJSONC(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	lastComma := -1   // offset of a comma after a value, only followed by blanks and comments so far
+	var previous byte // last character outside blanks and comments
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case c == '"':
+			lastComma = -1
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+			continue
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				return out // unterminated comment, left for the parser to report
+			}
+			for j := i; j < i+2+end+2; j++ {
+				if out[j] != '\n' {
+					out[j] = ' '
+				}
+			}
+			i += end + 3
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == ',':
+			lastComma = -1
+			if previous != 0 && previous != ',' && previous != '[' && previous != '{' {
+				lastComma = i
+			}
+		case c == '}' || c == ']':
+			if lastComma >= 0 {
+				out[lastComma] = ' '
+			}
+			lastComma = -1
+		default:
+			lastComma = -1
+		}
+		previous = c
+	}
+	return out
+}
+
+// parseYAML checks the syntax of every document of a YAML stream
+func parseYAML(data []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseTOML checks TOML syntax
+func parseTOML(data []byte) error {
+	var value map[string]interface{}
+	err := toml.Unmarshal(data, &value)
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		line, _ := decodeErr.Position()
+		return fmt.Errorf("line %d: %v", line, decodeErr)
+	}
+	return err
+}
+
+// parseINI checks INI syntax: section headers, key = value or key: value pairs,
+// comments starting with ; or # and indented continuation lines
+func parseINI(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+
+		switch {
+		case line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") || len(line) < 3 {
+				return fmt.Errorf("line %d: malformed section header %q", lineNumber, line)
+			}
+		case raw[0] == ' ' || raw[0] == '\t':
+			// Continuation of the previous value
+		default:
+			separator := strings.IndexAny(line, "=:")
+			if separator < 0 {
+				return fmt.Errorf("line %d: expected key = value, got %q", lineNumber, line)
+			}
+			if strings.TrimSpace(line[:separator]) == "" {
+				return fmt.Errorf("line %d: missing key", lineNumber)
+			}
+		}
+	}
+	return scanner.Err()
+}
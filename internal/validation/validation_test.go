@@ -0,0 +1,293 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a file in dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string // type and kind of the validator
+		wantErr bool
+	}{
+		{spec: "auto", want: "auto"},
+		{spec: "json", want: "json"},
+		{spec: " YAML ", want: "yaml"},
+		{spec: "toml", want: "toml"},
+		{spec: "ini", want: "ini"},
+		{spec: "nginx -t -c {file}", want: "command"},
+		{spec: "make -C {dir} check", want: "command"},
+		{spec: "xml", wantErr: true},
+		{spec: "nginx -t", wantErr: true},
+	}
+	for _, test := range tests {
+		validator, err := Parse(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Parse(%q) error = %v", test.spec, err)
+			continue
+		}
+		var got string
+		switch v := validator.(type) {
+		case AutoValidator:
+			got = "auto"
+		case *Parser:
+			got = v.Kind
+		case *CommandValidator:
+			got = "command"
+		}
+		if got != test.want {
+			t.Errorf("Parse(%q) = %s, want %s", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		kind    string
+		input   string
+		wantErr string // empty for valid input
+	}{
+		{kind: KindJSON, input: `{"a": [1, 2], "b": null}`},
+		{kind: KindJSON, input: "{\n  \"a\": 1,\n  \"b\": 2\n  \"c\": 3\n}", wantErr: "line 4"},
+		{kind: KindJSON, input: `{"a": 1`, wantErr: "unexpected end"},
+		{kind: KindYAML, input: "a: 1\nb:\n  - x\n  - y\n"},
+		{kind: KindYAML, input: "a: 1\n---\nb: 2\n"},
+		{kind: KindYAML, input: "a: 1\n---\nb: [1, 2\n", wantErr: "yaml"},
+		{kind: KindYAML, input: "a:\n\tb: 1\n", wantErr: "yaml"},
+		{kind: KindTOML, input: "[server]\nport = 8080\n"},
+		{kind: KindTOML, input: "[server]\nport = 8080\nname = \n", wantErr: "line 3"},
+		{kind: KindTOML, input: "[server]\nport = 8080\nport = 8081\n", wantErr: "already defined"},
+		{kind: KindINI, input: "; comment\n# comment\n[core]\neditor = vim\npager: less\n  continued\n"},
+		{kind: KindINI, input: "[core\neditor = vim\n", wantErr: "line 1: malformed section header"},
+		{kind: KindINI, input: "[core]\neditor\n", wantErr: "line 2: expected key = value"},
+		{kind: KindINI, input: "[core]\n= vim\n", wantErr: "line 2: missing key"},
+	}
+	dir := t.TempDir()
+	for i, test := range tests {
+		validator, err := Parse(test.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := writeFile(t, dir, test.kind+string(rune('a'+i)), test.input)
+		err = validator.Validate(path)
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s %q: %v", test.kind, test.input, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s %q: error %v, want %q", test.kind, test.input, err, test.wantErr)
+		case err != nil && !strings.HasPrefix(err.Error(), "invalid "+strings.ToUpper(test.kind)+": "):
+			t.Errorf("%s error %q doesn't name the format", test.kind, err)
+		}
+	}
+}
+
+func TestJSONValidatorAcceptsComments(t *testing.T) {
+	for _, spec := range []string{KindJSON, KindAuto} {
+		validator, err := Parse(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validator.Validate(filepath.Join("testdata", "vscode-settings.json")); err != nil {
+			t.Errorf("%s rejected VS Code settings with comments and trailing commas: %v", spec, err)
+		}
+
+		err = validator.Validate(filepath.Join("testdata", "broken-settings.json"))
+		if err == nil {
+			t.Errorf("%s accepted settings with a missing comma", spec)
+		} else if !strings.Contains(err.Error(), "line 5") {
+			t.Errorf("%s error %q doesn't point at line 5", spec, err)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"plain", `{"a": [1, 2]}`, true},
+		{"line comment", "{\n// comment\n\"a\": 1}", true},
+		{"block comment", `{/* a, } */ "a": 1}`, true},
+		{"trailing commas", `{"a": [1, 2,], "b": {"c": 1,},}`, true},
+		{"comment after trailing comma", "[1, // last\n]", true},
+		{"comment markers in strings", `{"a": "// x", "b": "/* y */"}`, true},
+		{"escaped quote", `{"a": "say \"hi\" // x",}`, true},
+		{"leading comma", `[,1]`, false},
+		{"lone comma", `[,]`, false},
+		{"double comma", `[1,,]`, false},
+		{"missing comma", `{"a": 1 "b": 2}`, false},
+		{"unterminated comment", `{"a": 1} /* x`, false},
+		{"comma in empty object", `{,}`, false},
+	}
+	for _, tt := range tests {
+		err := parseJSON([]byte(tt.input))
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: parseJSON(%q) = %v, want valid %v", tt.name, tt.input, err, tt.valid)
+		}
+	}
+}
+
+func TestAutoValidator(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content string
+		valid         bool
+	}{
+		{"settings.json", `{"a": 1}`, true},
+		{"settings.JSON", `{"a": `, false},
+		{"compose.yml", "a: [", false},
+		{"Cargo.toml", "a = ", false},
+		{"php.ini", "[PHP\n", false},
+		{"setup.cfg", "[metadata]\nname = x\n", true},
+		{"notes.txt", "{ not json", true}, // unknown extensions are accepted
+	}
+	for _, test := range tests {
+		err := AutoValidator{}.Validate(writeFile(t, dir, test.name, test.content))
+		if (err == nil) != test.valid {
+			t.Errorf("auto validation of %s = %v, want valid %v", test.name, err, test.valid)
+		}
+		if matches := (AutoValidator{}).Matches(test.name); matches != (test.name != "notes.txt") {
+			t.Errorf("auto matches %s = %v", test.name, matches)
+		}
+	}
+}
+
+func TestCommandValidator(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("validator commands use sh")
+	}
+	dir := t.TempDir()
+	path := writeFile(t, dir, "it's a file.conf", "listen 80;")
+
+	tests := []struct {
+		command string
+		wantErr string
+	}{
+		{command: "grep -q listen {file}"},
+		{command: "test -d {dir}"},
+		{command: "test -f {dir}/\"it's a file.conf\""},
+		{command: "grep -q server {file}", wantErr: "grep -q server {file} failed: exit status 1"},
+		{command: "echo first; echo 'line 1: unknown directive' >&2; exit 1 # {file}", wantErr: "failed: line 1: unknown directive"},
+	}
+	for _, test := range tests {
+		validator := &CommandValidator{Command: test.command}
+		err := validator.Validate(path)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: %v", test.command, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: error %v, want %q", test.command, err, test.wantErr)
+		}
+	}
+
+	if !(&CommandValidator{Command: "lint {file}"}).Matches("any.conf") || (&CommandValidator{Command: "make -C {dir}"}).Matches("any.conf") {
+		t.Error("only commands using {file} should check single files")
+	}
+}
+
+func TestCheckFile(t *testing.T) {
+	dir := t.TempDir()
+	checker, err := NewChecker([]string{"auto", "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckFile(writeFile(t, dir, "settings.json", `{"a": 1}`)); err != nil {
+		t.Errorf("valid file: %v", err)
+	}
+	// Every validator applies to file items, whatever the name of the file
+	if err := checker.CheckFile(writeFile(t, dir, "settings", `{"a": `)); err == nil {
+		t.Error("the json validator didn't check a file without extension")
+	}
+
+	if _, err := NewChecker([]string{"json", "xml"}); err == nil {
+		t.Error("NewChecker accepted an unknown validator")
+	}
+	if empty, _ := NewChecker(nil); !empty.IsEmpty() {
+		t.Error("a checker without validators isn't empty")
+	}
+}
+
+func TestCheckDir(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"settings.json":         `{"a": 1, /* ok */}`,
+		"keybindings.json":      `[{"key": "ctrl+k"`,
+		"config.yaml":           "a: [1, 2",
+		"app.toml":              "a = 1",
+		"notes.txt":             "{ not json",
+		"nested/broken.ini":     "[section",
+		"nested/valid.yml":      "a: 1",
+		"nested/deep/data.json": "{}",
+	}
+	for name, content := range files {
+		writeFile(t, root, name, content)
+	}
+
+	checker, err := NewChecker([]string{KindAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures, err := checker.CheckDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(SortedPaths(failures), ","); got != "config.yaml,keybindings.json,nested/broken.ini" {
+		t.Errorf("failures = %s, want config.yaml,keybindings.json,nested/broken.ini", got)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// Commands with {file} check every file, others run once for the folder
+	checker, err = NewChecker([]string{"grep -qv json {file}", "test -f {dir}/missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures, err = checker.CheckDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(SortedPaths(failures), ","); got != ".,notes.txt" {
+		t.Errorf("failures = %s, want .,notes.txt", got)
+	}
+}
+
+func TestValidPolicy(t *testing.T) {
+	for policy, want := range map[string]bool{"refuse": true, "quarantine": true, "": false, "ignore": false} {
+		if got := ValidPolicy(policy); got != want {
+			t.Errorf("ValidPolicy(%q) = %v, want %v", policy, got, want)
+		}
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	for spec, want := range map[string]bool{
+		"json":               false,
+		"auto":               false,
+		"nginx -t -c {file}": true,
+		"make -C {dir} test": true,
+	} {
+		if got := IsCommand(spec); got != want {
+			t.Errorf("IsCommand(%q) = %v, want %v", spec, got, want)
+		}
+	}
+}